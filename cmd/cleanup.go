@@ -0,0 +1,71 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/facebookincubator/ttpforge/pkg/blocks"
+	"github.com/spf13/cobra"
+)
+
+func buildCleanupCommand(cfg *Config) *cobra.Command {
+	var ttpCfg blocks.TTPExecutionConfig
+	cleanupCmd := &cobra.Command{
+		Use:   "cleanup [run_id]",
+		Short: "Clean up an earlier run of a TTP that was not (fully) cleaned up.",
+		Long: `
+Runs the cleanup actions of all steps of an earlier TTP run that have
+not been cleaned up yet - for example, because the run used --no-cleanup
+or because TTPForge was killed. The run ID is logged by 'ttpforge run'.
+    `,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// don't want confusing usage display for errors past this point
+			cmd.SilenceUsage = true
+
+			// capture output for tests if needed
+			if cfg.testCfg != nil {
+				ttpCfg.Stdout, ttpCfg.Stderr = cfg.testCfg.Stdout, cfg.testCfg.Stderr
+			}
+
+			stateDir, err := cfg.stateDir()
+			if err != nil {
+				return fmt.Errorf("could not lookup state directory: %v", err)
+			}
+			if stateDir == "" {
+				return fmt.Errorf("no state directory is configured")
+			}
+
+			// named targets are needed to clean up
+			// steps that ran on remote hosts
+			if ttpCfg.Targets, err = cfg.targetsByName(); err != nil {
+				return err
+			}
+
+			runID := args[0]
+			if err := blocks.RunDeferredCleanup(stateDir, runID, ttpCfg); err != nil {
+				return fmt.Errorf("failed to clean up run %v: %v", runID, err)
+			}
+			return nil
+		},
+	}
+	return cleanupCmd
+}
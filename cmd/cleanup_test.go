@@ -0,0 +1,117 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func runWithStateDir(t *testing.T, stateDir string, args ...string) (string, error) {
+	var stdoutBuf, stderrBuf bytes.Buffer
+	rc := BuildRootCommand(&TestConfig{
+		Stdout:   &stdoutBuf,
+		Stderr:   &stderrBuf,
+		StateDir: stateDir,
+	})
+	rc.SetArgs(args)
+	logMutex.Lock()
+	err := rc.Execute()
+	logMutex.Unlock()
+	return stdoutBuf.String(), err
+}
+
+func TestCleanupCommand(t *testing.T) {
+	testConfigFilePath := filepath.Join(testResourcesDir, "test-config.yaml")
+
+	testCases := []struct {
+		name                  string
+		ttpRef                string
+		expectedRunStdout     string
+		wantRunError          bool
+		expectedCleanupStdout string
+	}{
+		{
+			name:                  "Simple TTP",
+			ttpRef:                "another-repo//simple-inline.yaml",
+			expectedRunStdout:     "simple inline was executed\n",
+			expectedCleanupStdout: "cleaning up simple inline\n",
+		},
+		{
+			name:                  "Nested Sub TTPs",
+			ttpRef:                "another-repo//sub-ttp-example/ttp.yaml",
+			expectedRunStdout:     "subttp1_step_1\nsubttp1_step_2\nsubttp2_step_1\n",
+			wantRunError:          true,
+			expectedCleanupStdout: "subttp2_step_1_cleanup\nsubttp1_step_2_cleanup\nsubttp1_step_1_cleanup\n",
+		},
+		{
+			name:                  "Stress Test",
+			ttpRef:                "another-repo//cleanup-tests/stress-tests.yaml",
+			expectedRunStdout:     "execute_step_1\nexecute_step_2\nexecute_step_3\nexecute_step_4\n",
+			expectedCleanupStdout: "cleanup_step_4\ncleanup_step_3\ncleanup_step_2\ncleanup_step_1\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			stateDir := t.TempDir()
+			stdout, err := runWithStateDir(t, stateDir, "run", "-c", testConfigFilePath, "--no-cleanup", tc.ttpRef)
+			if tc.wantRunError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tc.expectedRunStdout, stdout)
+
+			// the journal of the run is named after its run ID
+			entries, err := os.ReadDir(stateDir)
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			runID := entries[0].Name()
+
+			stdout, err = runWithStateDir(t, stateDir, "cleanup", "-c", testConfigFilePath, runID)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedCleanupStdout, stdout)
+
+			// once cleaned up, a run cannot be cleaned up again
+			_, err = os.Stat(filepath.Join(stateDir, runID))
+			assert.True(t, os.IsNotExist(err), "state directory should be removed after cleanup")
+			_, err = runWithStateDir(t, stateDir, "cleanup", "-c", testConfigFilePath, runID)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestRunRemovesJournalAfterCleanup(t *testing.T) {
+	testConfigFilePath := filepath.Join(testResourcesDir, "test-config.yaml")
+	stateDir := t.TempDir()
+	stdout, err := runWithStateDir(t, stateDir, "run", "-c", testConfigFilePath, "another-repo//simple-inline.yaml")
+	require.NoError(t, err)
+	assert.Equal(t, "simple inline was executed\ncleaning up simple inline\n", stdout)
+
+	entries, err := os.ReadDir(stateDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries, "nothing should be left to clean up")
+}
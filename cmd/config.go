@@ -30,8 +30,10 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/facebookincubator/ttpforge/pkg/executors"
 	"github.com/facebookincubator/ttpforge/pkg/logging"
 	"github.com/facebookincubator/ttpforge/pkg/repos"
+	"github.com/facebookincubator/ttpforge/pkg/targets"
 	"github.com/spf13/afero"
 	"gopkg.in/yaml.v3"
 )
@@ -45,6 +47,11 @@ type TestConfig struct {
 	// TTPExecutionContext
 	Stdout io.Writer
 	Stderr io.Writer
+	// StateDir replaces the default state directory
+	// in which cleanup journals are recorded.
+	// Cleanup journals are not recorded in tests
+	// unless this is set.
+	StateDir string
 }
 
 // Config stores the variables from the TTPForge global config file
@@ -52,6 +59,10 @@ type TestConfig struct {
 // should not touch it
 type Config struct {
 	RepoSpecs []repos.Spec `yaml:"repos"`
+	// Executors are custom executors available to all TTPs
+	Executors []executors.Definition `yaml:"executors,omitempty"`
+	// Targets are remote hosts on which TTPs can run
+	Targets []targets.Target `yaml:"targets,omitempty"`
 
 	repoCollection repos.RepoCollection
 	cfgFile        string
@@ -63,6 +74,7 @@ var (
 	defaultConfigContents string
 	defaultConfigFileName = "config.yaml"
 	defaultResourceDir    = ".ttpforge"
+	defaultStateDirName   = "runs"
 
 	logConfig logging.Config
 )
@@ -76,6 +88,19 @@ func getDefaultConfigFilePath() (string, error) {
 	return defaultConfigPath, nil
 }
 
+// stateDir returns the directory in which the state of each
+// TTP run (such as its cleanup journal) is recorded
+func (cfg *Config) stateDir() (string, error) {
+	if cfg.testCfg != nil {
+		return cfg.testCfg.StateDir, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, defaultResourceDir, defaultStateDirName), nil
+}
+
 // loadRepoCollection verifies that all repositories specified
 // in the configuration file are present on the filesystem
 // and clones missing ones if needed
@@ -93,6 +118,39 @@ func (cfg *Config) loadRepoCollection() (repos.RepoCollection, error) {
 	return repos.NewRepoCollection(fsys, cfg.RepoSpecs, basePath)
 }
 
+// executorRegistry assembles the custom executors available to the
+// TTPs of the specified repo: those of the global configuration file,
+// overridden by those of the repo configuration file
+func (cfg *Config) executorRegistry(repo repos.Repo) (*executors.Registry, error) {
+	registry := executors.NewRegistry()
+	if err := registry.Register(cfg.Executors...); err != nil {
+		return nil, fmt.Errorf("invalid executors in config file: %w", err)
+	}
+	if err := registry.Register(repo.GetExecutors()...); err != nil {
+		return nil, fmt.Errorf("invalid executors in repo %v: %w", repo.GetName(), err)
+	}
+	return registry, nil
+}
+
+// targetsByName validates the targets of the config file
+// and indexes them by name
+func (cfg *Config) targetsByName() (map[string]targets.Target, error) {
+	byName := make(map[string]targets.Target)
+	for _, target := range cfg.Targets {
+		if target.Name == "" {
+			return nil, fmt.Errorf("target %v in config file has no name", target)
+		}
+		if _, ok := byName[target.Name]; ok {
+			return nil, fmt.Errorf("duplicate target name in config file: %v", target.Name)
+		}
+		if err := target.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid target %q in config file: %w", target.Name, err)
+		}
+		byName[target.Name] = target
+	}
+	return byName, nil
+}
+
 // save() writes the current config back to its file - used by `install“ command
 func (cfg *Config) save() error {
 	var b bytes.Buffer
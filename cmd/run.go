@@ -20,15 +20,25 @@ THE SOFTWARE.
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/facebookincubator/ttpforge/pkg/blocks"
 	"github.com/facebookincubator/ttpforge/pkg/logging"
+	"github.com/facebookincubator/ttpforge/pkg/targets"
+	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
 )
 
 func buildRunCommand(cfg *Config) *cobra.Command {
 	var argsList []string
+	var reportPath string
+	var targetName string
+	var inventoryPath string
+	var hostPatterns []string
+	var concurrency int
 	var ttpCfg blocks.TTPExecutionConfig
 	runCmd := &cobra.Command{
 		Use:   "run [repo_name//path/to/ttp]",
@@ -53,6 +63,32 @@ func buildRunCommand(cfg *Config) *cobra.Command {
 			// load TTP and process argument values
 			// based on the TTPs argument value specifications
 			ttpCfg.Repo = foundRepo
+			if ttpCfg.Executors, err = cfg.executorRegistry(foundRepo); err != nil {
+				return err
+			}
+			if ttpCfg.Targets, err = cfg.targetsByName(); err != nil {
+				return err
+			}
+			if inventoryPath != "" {
+				fleet := blocks.FleetRun{
+					TTPPath:     ttpAbsPath,
+					Fs:          foundRepo.GetFs(),
+					Cfg:         ttpCfg,
+					Args:        argsList,
+					Concurrency: concurrency,
+				}
+				return runOnInventory(cmd.Context(), cfg, fleet, inventoryPath, hostPatterns, reportPath)
+			}
+			if len(hostPatterns) > 0 {
+				return fmt.Errorf("--hosts can only be used with --inventory")
+			}
+			if targetName != "" {
+				target, ok := ttpCfg.Targets[targetName]
+				if !ok {
+					return fmt.Errorf("target %q is not defined in the config file", targetName)
+				}
+				ttpCfg.Target = &target
+			}
 
 			ttp, execCtx, err := blocks.LoadTTP(ttpAbsPath, foundRepo.GetFs(), &ttpCfg, argsList)
 			if err != nil {
@@ -64,7 +100,21 @@ func buildRunCommand(cfg *Config) *cobra.Command {
 				return nil
 			}
 
-			runErr := ttp.Execute(*execCtx)
+			// record what needs to be cleaned up, so that
+			// `ttpforge cleanup` can clean up this run later
+			stateDir, err := cfg.stateDir()
+			if err != nil {
+				return fmt.Errorf("could not lookup state directory: %v", err)
+			}
+			logging.L().Infof("Run ID: %v", execCtx.Cfg.RunID)
+			if stateDir != "" {
+				if err := execCtx.EnableCleanupJournal(ttp, stateDir); err != nil {
+					return fmt.Errorf("failed to create cleanup journal: %v", err)
+				}
+			}
+
+			startTime := time.Now()
+			runErr := ttp.Execute(cmd.Context(), *execCtx)
 			// Run clean up always
 			cleanupErr := ttp.RunCleanup(*execCtx)
 
@@ -72,8 +122,19 @@ func buildRunCommand(cfg *Config) *cobra.Command {
 				logging.L().Warnf("Failed to run cleanup: %v", cleanupErr)
 			}
 
+			if reportPath != "" {
+				report := blocks.NewRunReport(ttp, *execCtx)
+				report.StartTime = startTime
+				report.EndTime = time.Now()
+				report.SetErrors(runErr, cleanupErr)
+				if err := report.WriteFile(reportPath); err != nil {
+					return fmt.Errorf("failed to write report to %v: %v", reportPath, err)
+				}
+				logging.L().Infof("Wrote report for run %v to %v", execCtx.Cfg.RunID, reportPath)
+			}
+
 			if runErr != nil {
-				return fmt.Errorf("failed to run TTP at %v: %v", ttpAbsPath, err)
+				return fmt.Errorf("failed to run TTP at %v: %v", ttpAbsPath, runErr)
 			}
 			return nil
 		},
@@ -81,7 +142,44 @@ func buildRunCommand(cfg *Config) *cobra.Command {
 	runCmd.PersistentFlags().BoolVar(&ttpCfg.DryRun, "dry-run", false, "Parse arguments and validate TTP Contents, but do not actually run the TTP")
 	runCmd.PersistentFlags().BoolVar(&ttpCfg.NoCleanup, "no-cleanup", false, "Disable cleanup (useful for debugging and daisy-chaining TTPs)")
 	runCmd.PersistentFlags().UintVar(&ttpCfg.CleanupDelaySeconds, "cleanup-delay-seconds", 0, "Wait this long after TTP execution before starting cleanup")
+	runCmd.Flags().StringVar(&reportPath, "report", "", "Write a JSON report of the TTP run to this path")
+	runCmd.Flags().StringVar(&targetName, "target", "", "Run the steps of the TTP on this target from the config file, rather than locally")
+	runCmd.Flags().StringVar(&inventoryPath, "inventory", "", "Run the TTP on each host of this inventory file")
+	runCmd.Flags().StringSliceVar(&hostPatterns, "hosts", nil, "Only run the TTP on the inventory hosts whose names match these glob patterns (such as web*)")
+	runCmd.Flags().IntVar(&concurrency, "concurrency", blocks.DefaultFleetConcurrency, "Maximum number of inventory hosts on which the TTP runs at once")
+	runCmd.MarkFlagsMutuallyExclusive("target", "inventory")
 	runCmd.Flags().StringArrayVarP(&argsList, "arg", "a", []string{}, "variable input mapping for args to be used in place of inputs defined in each ttp file")
 
 	return runCmd
 }
+
+// runOnInventory runs the TTP on the selected hosts of an inventory
+// and reports the combined results of all hosts
+func runOnInventory(ctx context.Context, cfg *Config, fleet blocks.FleetRun, inventoryPath string, hostPatterns []string, reportPath string) error {
+	inv, err := targets.LoadInventory(afero.NewOsFs(), inventoryPath)
+	if err != nil {
+		return err
+	}
+	if fleet.Hosts, err = inv.Select(hostPatterns); err != nil {
+		return err
+	}
+	if fleet.StateDir, err = cfg.stateDir(); err != nil {
+		return fmt.Errorf("could not lookup state directory: %v", err)
+	}
+
+	logging.L().Infof("Running TTP on %d hosts", len(fleet.Hosts))
+	summary := fleet.Run(ctx)
+	summary.Log()
+
+	if reportPath != "" && !fleet.Cfg.DryRun {
+		if err := summary.Report().WriteFile(reportPath); err != nil {
+			return fmt.Errorf("failed to write report to %v: %v", reportPath, err)
+		}
+		logging.L().Infof("Wrote report for all hosts to %v", reportPath)
+	}
+
+	if failed := summary.FailedHosts(); len(failed) > 0 {
+		return fmt.Errorf("failed to run TTP at %v on %d of %d hosts: %v", fleet.TTPPath, len(failed), len(fleet.Hosts), strings.Join(failed, ", "))
+	}
+	return nil
+}
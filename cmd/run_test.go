@@ -21,11 +21,13 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"sync"
 	"testing"
 
+	"github.com/facebookincubator/ttpforge/pkg/blocks"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -150,6 +152,108 @@ func TestRun(t *testing.T) {
 			},
 			expectedStdout: "execute_step_1\nexecute_step_2\nexecute_step_3\nexecute_step_4\ncleanup_step_4\ncleanup_step_3\ncleanup_step_2\ncleanup_step_1\n",
 		},
+		{
+			name:        "custom-executors",
+			description: "executors can be defined in the global config file and in repo config files",
+			args: []string{
+				"-c",
+				testConfigFilePath,
+				"another-repo//custom-executors/ttp.yaml",
+			},
+			expectedStdout: "GLOBAL EXECUTOR\nrepo executor 1\ninferred executor 1 2\n",
+		},
+		{
+			name:        "dry-run-target",
+			description: "steps are validated for the target selected with `--target` without connecting to it",
+			args: []string{
+				"-c",
+				testConfigFilePath,
+				"--dry-run",
+				"--target",
+				"lab",
+				testRepoName + "//dry-run/dry-run-success.yaml",
+			},
+			expectedStdout: "",
+		},
+		{
+			name:        "dry-run-inventory",
+			description: "the TTP is validated for each selected host of the inventory, with the arguments of that host",
+			args: []string{
+				"-c",
+				testConfigFilePath,
+				"--dry-run",
+				"--inventory",
+				filepath.Join(testResourcesDir, "inventory.yaml"),
+				"--hosts",
+				"web*",
+				testRepoName + "//inventory/greet.yaml",
+			},
+			expectedStdout: "",
+		},
+		{
+			name:        "inventory-no-matching-hosts",
+			description: "`--hosts` must select at least one host of the inventory",
+			args: []string{
+				"-c",
+				testConfigFilePath,
+				"--inventory",
+				filepath.Join(testResourcesDir, "inventory.yaml"),
+				"--hosts",
+				"app*",
+				testRepoName + "//inventory/greet.yaml",
+			},
+			wantError: true,
+		},
+		{
+			name:        "inventory-unreachable-hosts",
+			description: "the run fails if the TTP fails on any host",
+			args: []string{
+				"-c",
+				testConfigFilePath,
+				"--inventory",
+				filepath.Join(testResourcesDir, "inventory.yaml"),
+				testRepoName + "//inventory/greet.yaml",
+			},
+			wantError: true,
+		},
+		{
+			name:        "hosts-without-inventory",
+			description: "`--hosts` selects hosts of an inventory",
+			args: []string{
+				"-c",
+				testConfigFilePath,
+				"--hosts",
+				"web*",
+				testRepoName + "//inventory/greet.yaml",
+			},
+			wantError: true,
+		},
+		{
+			name:        "target-and-inventory",
+			description: "`--target` and `--inventory` cannot be combined",
+			args: []string{
+				"-c",
+				testConfigFilePath,
+				"--target",
+				"lab",
+				"--inventory",
+				filepath.Join(testResourcesDir, "inventory.yaml"),
+				testRepoName + "//inventory/greet.yaml",
+			},
+			wantError: true,
+		},
+		{
+			name:        "undefined-target",
+			description: "`--target` must select a target from the config file",
+			args: []string{
+				"-c",
+				testConfigFilePath,
+				"--target",
+				"missing",
+				testRepoName + "//dry-run/dry-run-success.yaml",
+			},
+			wantError: true,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -159,6 +263,56 @@ func TestRun(t *testing.T) {
 	}
 }
 
+func TestRunReport(t *testing.T) {
+	testConfigFilePath := filepath.Join(testResourcesDir, "test-config.yaml")
+	reportPath := filepath.Join(t.TempDir(), "report.json")
+
+	checkRunCmdTestCase(t, runCmdTestCase{
+		name:        "report",
+		description: "the report should be written even if the TTP fails",
+		args: []string{
+			"-c",
+			testConfigFilePath,
+			"--report",
+			reportPath,
+			"another-repo//sub-ttp-example/ttp.yaml",
+		},
+		wantError: true,
+	})
+
+	reportBytes, err := os.ReadFile(reportPath)
+	require.NoError(t, err)
+	var report blocks.RunReport
+	err = json.Unmarshal(reportBytes, &report)
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, report.RunID)
+	assert.Equal(t, "subttp_cleanup_test", report.TTP.Name)
+	assert.Equal(t, blocks.StepFailed, report.Status)
+	assert.NotEmpty(t, report.Error)
+	assert.NotEmpty(t, report.Platform.OS)
+	assert.False(t, report.EndTime.Before(report.StartTime))
+
+	require.Len(t, report.Steps, 2)
+	first, second := report.Steps[0], report.Steps[1]
+	assert.Equal(t, "ttp", first.Action)
+	assert.Equal(t, blocks.StepSucceeded, first.Status)
+	require.Len(t, first.Steps, 2)
+	assert.Equal(t, "subttp1_step_1\n", first.Steps[0].Stdout)
+	require.NotNil(t, first.Steps[0].Cleanup)
+	assert.Equal(t, "subttp1_step_1_cleanup\n", first.Steps[0].Cleanup.Stdout)
+
+	assert.Equal(t, blocks.StepFailed, second.Status)
+	require.Len(t, second.Steps, 2)
+	failedStep := second.Steps[1]
+	assert.Equal(t, "intentional_failure", failedStep.Name)
+	assert.Equal(t, "inline", failedStep.Action)
+	assert.Equal(t, blocks.StepFailed, failedStep.Status)
+	assert.Equal(t, 127, failedStep.ExitCode)
+	assert.NotEmpty(t, failedStep.Stderr)
+	assert.Nil(t, failedStep.Cleanup, "failed steps should not be cleaned up")
+}
+
 // TestRunPathArguments checks that referencing relative paths in `--arg` values
 // when executing `ttpforge run` works as expected. One typically needs to
 // specify `type: path` in the argument specification in order to get desired
@@ -70,7 +70,7 @@ func buildTestCommand(cfg *Config) *cobra.Command {
 				if err != nil {
 					return fmt.Errorf("failed to resolve TTP reference %v: %w", ttpRef, err)
 				}
-				if err := runTestsForTTP(ttpAbsPath, timeoutSeconds); err != nil {
+				if err := runTestsForTTP(ttpAbsPath, cfg.cfgFile, timeoutSeconds); err != nil {
 					return fmt.Errorf("test(s) for TTP %v failed: %w", ttpRef, err)
 				}
 			}
@@ -82,7 +82,7 @@ func buildTestCommand(cfg *Config) *cobra.Command {
 	return runCmd
 }
 
-func runTestsForTTP(ttpAbsPath string, timeoutSeconds int) error {
+func runTestsForTTP(ttpAbsPath string, cfgFile string, timeoutSeconds int) error {
 	logging.DividerThick()
 	logging.L().Infof("TESTING TTP FILE:")
 	logging.L().Info(ttpAbsPath)
@@ -146,6 +146,10 @@ func runTestsForTTP(ttpAbsPath string, timeoutSeconds int) error {
 		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutSeconds)*time.Second)
 		defer cancel()
 		cmd := exec.CommandContext(ctx, selfPath)
+		// the config file may define executors used by the TTP
+		if cfgFile != "" {
+			cmd.Args = append(cmd.Args, "--config", cfgFile)
+		}
 		cmd.Args = append(cmd.Args, "run", ttpAbsPath)
 		for argName, argVal := range tc.Args {
 			cmd.Args = append(cmd.Args, "--arg")
@@ -0,0 +1,3 @@
+BEGIN {
+  print "awk script file inferred from its extension"
+}
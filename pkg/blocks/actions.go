@@ -19,16 +19,19 @@ THE SOFTWARE.
 
 package blocks
 
+import "context"
+
 // Action is an interface that is implemented
 // by all action types used in steps/cleanups
 // (such as create_file, inline, etc)
 type Action interface {
 	IsNil() bool
 	Validate(execCtx TTPExecutionContext) error
-	Execute(execCtx TTPExecutionContext) (*ActResult, error)
+	Execute(ctx context.Context, execCtx TTPExecutionContext) (*ActResult, error)
 	GetDescription() string
 	GetDefaultCleanupAction() Action
 	CanBeUsedInCompositeAction() bool
+	CanRunOnTarget() bool
 }
 
 // Shared action fields struct that also provides
@@ -67,3 +70,11 @@ func (ad *actionDefaults) GetDefaultCleanupAction() Action {
 func (ad *actionDefaults) CanBeUsedInCompositeAction() bool {
 	return false
 }
+
+// CanRunOnTarget provides a default implementation
+// of the CanRunOnTarget method from the Action interface.
+// Actions that can run on a remote target (see TargetSpec)
+// override it
+func (ad *actionDefaults) CanRunOnTarget() bool {
+	return false
+}
@@ -23,7 +23,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"os/exec"
 	"time"
 
 	"github.com/facebookincubator/ttpforge/pkg/logging"
@@ -32,6 +31,7 @@ import (
 )
 
 // DefaultExecutionTimeout is the default timeout for step execution.
+// It only applies if neither the step nor its TTP specify a timeout.
 const DefaultExecutionTimeout = 100 * time.Minute
 
 // BasicStep is a type that represents a basic execution step.
@@ -41,6 +41,7 @@ type BasicStep struct {
 	Inline         string                  `yaml:"inline,flow"`
 	Environment    map[string]string       `yaml:"env,omitempty"`
 	Outputs        map[string]outputs.Spec `yaml:"outputs,omitempty"`
+	ExpectExitCode ExitCodes               `yaml:"expect_exit_code,omitempty,flow"`
 }
 
 // NewBasicStep creates a new BasicStep instance with an initialized Act struct.
@@ -74,25 +75,17 @@ func (b *BasicStep) Validate(execCtx TTPExecutionContext) error {
 		return nil
 	}
 
-	// Return if ExecutorName is ExecutorBinary
-	if b.ExecutorName == ExecutorBinary {
-		return nil
-	}
-
 	// Check if the executor is in the system path
-	if _, err := exec.LookPath(b.ExecutorName); err != nil {
+	if err := validateExecutor(execCtx, b.ExecutorName); err != nil {
 		logging.L().Error(zap.Error(err))
 		return err
 	}
-
-	logging.L().Debugw("command found in path", "executor", b.ExecutorName)
-
 	return nil
 }
 
 // Execute runs the step and returns an error if one occurs.
-func (b *BasicStep) Execute(execCtx TTPExecutionContext) (*ActResult, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), DefaultExecutionTimeout)
+func (b *BasicStep) Execute(ctx context.Context, execCtx TTPExecutionContext) (*ActResult, error) {
+	ctx, cancel := processContext(ctx, DefaultExecutionTimeout)
 	defer cancel()
 
 	if b.Inline == "" {
@@ -101,12 +94,14 @@ func (b *BasicStep) Execute(execCtx TTPExecutionContext) (*ActResult, error) {
 
 	executor := NewExecutor(b.ExecutorName, b.Inline, "", nil, b.Environment)
 	result, err := executor.Execute(ctx, execCtx)
-	if err != nil {
-		return nil, err
+	if err = b.ExpectExitCode.Check(ctx, result, err); err != nil {
+		return result, err
 	}
 	result.Outputs, err = outputs.Parse(b.Outputs, result.Stdout)
-	if err != nil {
-		return nil, err
-	}
-	return result, nil
+	return result, err
+}
+
+// CanRunOnTarget enables this action to run on a remote target
+func (b *BasicStep) CanRunOnTarget() bool {
+	return true
 }
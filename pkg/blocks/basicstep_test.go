@@ -20,6 +20,7 @@ THE SOFTWARE.
 package blocks
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -91,8 +92,85 @@ outputs:
 	require.NoError(t, err)
 
 	// execute and check result
-	result, err := s.Execute(execCtx)
+	result, err := s.Execute(context.Background(), execCtx)
 	require.NoError(t, err)
 	require.Equal(t, 1, len(result.Outputs))
 	assert.Equal(t, "baz", result.Outputs["first"], "first output should be correct")
 }
+
+func TestBasicStepExpectExitCode(t *testing.T) {
+	testCases := []struct {
+		name             string
+		content          string
+		wantUnmarshalErr bool
+		wantError        bool
+		expectedExitCode int
+		expectedStdout   string
+	}{
+		{
+			name: "Failure Keeps Output And Exit Code",
+			content: `name: fails
+inline: |
+  echo partial output
+  exit 3`,
+			wantError:        true,
+			expectedExitCode: 3,
+			expectedStdout:   "partial output\n",
+		},
+		{
+			name: "Single Expected Exit Code",
+			content: `name: blocked
+inline: exit 126
+expect_exit_code: 126`,
+			expectedExitCode: 126,
+		},
+		{
+			name: "List Of Expected Exit Codes",
+			content: `name: blocked
+inline: exit 13
+expect_exit_code: [1, 13]`,
+			expectedExitCode: 13,
+		},
+		{
+			name: "Unexpected Success",
+			content: `name: not_blocked
+inline: echo not blocked
+expect_exit_code: 1`,
+			wantError:        true,
+			expectedExitCode: 0,
+			expectedStdout:   "not blocked\n",
+		},
+		{
+			name: "Invalid Expected Exit Code",
+			content: `name: invalid
+inline: exit 1
+expect_exit_code: one`,
+			wantUnmarshalErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var s BasicStep
+			execCtx := NewTTPExecutionContext()
+			err := yaml.Unmarshal([]byte(tc.content), &s)
+			if tc.wantUnmarshalErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			err = s.Validate(execCtx)
+			require.NoError(t, err)
+
+			result, err := s.Execute(context.Background(), execCtx)
+			if tc.wantError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.NotNil(t, result)
+			assert.Equal(t, tc.expectedExitCode, result.ExitCode)
+			assert.Equal(t, tc.expectedStdout, result.Stdout)
+		})
+	}
+}
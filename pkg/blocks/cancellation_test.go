@@ -0,0 +1,132 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCancellation(t *testing.T) {
+	testCases := []struct {
+		name             string
+		contentFmtStr    string
+		useShutdownChan  bool
+		expectedSignaled string
+		minDuration      time.Duration
+	}{
+		{
+			name:            "Shutdown Signal Terminates Running Step",
+			useShutdownChan: true,
+			contentFmtStr: `name: shutdown
+steps:
+  - name: first
+    inline: echo first
+    cleanup:
+      inline: echo -n cleanup_first >> %[1]v/cleanup
+  - name: long_running
+    inline: |
+      trap 'echo -n terminated > %[1]v/signaled; exit 1' TERM
+      sleep 30 &
+      wait
+  - name: never_runs
+    inline: echo never_runs`,
+			expectedSignaled: "terminated",
+		},
+		{
+			name: "Context Cancellation Terminates Running Step",
+			contentFmtStr: `name: context_cancel
+steps:
+  - name: first
+    inline: echo first
+    cleanup:
+      inline: echo -n cleanup_first >> %[1]v/cleanup
+  - name: long_running
+    inline: |
+      trap 'echo -n terminated > %[1]v/signaled; exit 1' TERM
+      sleep 30 &
+      wait`,
+			expectedSignaled: "terminated",
+		},
+		{
+			name: "Processes Ignoring SIGTERM Are Killed",
+			contentFmtStr: `name: ignores_sigterm
+steps:
+  - name: first
+    inline: echo first
+    cleanup:
+      inline: echo -n cleanup_first >> %[1]v/cleanup
+  - name: long_running
+    inline: |
+      trap '' TERM
+      sleep 30`,
+			minDuration: processKillGracePeriod,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			ttp, err := RenderTemplatedTTP(fmt.Sprintf(tc.contentFmtStr, tmpDir), RenderParameters{})
+			require.NoError(t, err)
+
+			execCtx := NewTTPExecutionContext()
+			err = ttp.Validate(execCtx)
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() {
+				time.Sleep(500 * time.Millisecond)
+				if tc.useShutdownChan {
+					execCtx.shutdownChan <- true
+				} else {
+					cancel()
+				}
+			}()
+
+			start := time.Now()
+			err = ttp.Execute(ctx, execCtx)
+			elapsed := time.Since(start)
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, ErrCancelled), "error should be a cancellation: %v", err)
+			assert.GreaterOrEqual(t, elapsed, tc.minDuration)
+			assert.Less(t, elapsed, tc.minDuration+10*time.Second, "cancelled step should have been stopped")
+
+			assert.Equal(t, tc.expectedSignaled, readFileOrEmpty(t, filepath.Join(tmpDir, "signaled")))
+			result, found := execCtx.StepResults.ByName["long_running"]
+			require.True(t, found)
+			assert.Equal(t, StepCancelled, result.Status)
+			_, found = execCtx.StepResults.ByName["never_runs"]
+			assert.False(t, found, "steps after a cancelled step should not run")
+
+			err = ttp.RunCleanup(execCtx)
+			require.NoError(t, err)
+			assert.Equal(t, "cleanup_first", readFileOrEmpty(t, filepath.Join(tmpDir, "cleanup")))
+		})
+	}
+}
@@ -20,6 +20,7 @@ THE SOFTWARE.
 package blocks
 
 import (
+	"context"
 	"errors"
 	"fmt"
 
@@ -72,7 +73,7 @@ func (step *ChangeDirectoryStep) Validate(_ TTPExecutionContext) error {
 //
 // ActResult: the result of the action
 // error: error if execution fails, nil otherwise
-func (step *ChangeDirectoryStep) Execute(ctx TTPExecutionContext) (*ActResult, error) {
+func (step *ChangeDirectoryStep) Execute(_ context.Context, execCtx TTPExecutionContext) (*ActResult, error) {
 	// If this has a parent, then it's a cleanup step, so we need to grab the previous dir from it
 	if step.PreviousCDStep != nil {
 		if step.PreviousCDStep.PreviousDir == "" {
@@ -107,8 +108,8 @@ func (step *ChangeDirectoryStep) Execute(ctx TTPExecutionContext) (*ActResult, e
 	}
 
 	// Set workdir to the current cd value and store the previous workdir
-	step.PreviousDir = ctx.Vars.WorkDir
-	ctx.Vars.WorkDir = step.Cd
+	step.PreviousDir = execCtx.Vars.WorkDir
+	execCtx.Vars.WorkDir = step.Cd
 
 	return &ActResult{}, nil
 }
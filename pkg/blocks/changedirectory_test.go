@@ -20,6 +20,7 @@ THE SOFTWARE.
 package blocks
 
 import (
+	"context"
 	"testing"
 
 	"github.com/facebookincubator/ttpforge/pkg/testutils"
@@ -97,7 +98,7 @@ func TestChangeDirectoryExecute(t *testing.T) {
 			require.NoError(t, err)
 
 			// execute and check error
-			_, err = tc.step.Execute(execCtx)
+			_, err = tc.step.Execute(context.Background(), execCtx)
 
 			if tc.expectedError && err != nil {
 				require.Error(t, err)
@@ -111,7 +112,7 @@ func TestChangeDirectoryExecute(t *testing.T) {
 			// cleanup and check error
 			err = tc.step.GetDefaultCleanupAction().Validate(execCtx)
 			require.NoError(t, err)
-			_, err = tc.step.GetDefaultCleanupAction().Execute(execCtx)
+			_, err = tc.step.GetDefaultCleanupAction().Execute(context.Background(), execCtx)
 			require.NoError(t, err)
 
 			// expect working directory to be rolled back to starting directory
@@ -0,0 +1,425 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/facebookincubator/ttpforge/pkg/logging"
+	"github.com/facebookincubator/ttpforge/pkg/repos"
+	"github.com/facebookincubator/ttpforge/pkg/targets"
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+)
+
+// cleanupJournalFileName is the name of the file in the
+// state directory of a run that holds its cleanup journal
+const cleanupJournalFileName = "cleanup-journal.json"
+
+// cleanupJournal persists everything that is needed to clean
+// up a run of a TTP at a later time - for example, because
+// `--no-cleanup` was specified or because TTPForge crashed.
+// It is rewritten every time a step of the TTP (or of one
+// of its sub TTPs) completes or is cleaned up.
+type cleanupJournal struct {
+	mu   sync.Mutex
+	dir  string
+	file journalFile
+}
+
+// journalFile is the on-disk format of the cleanup journal
+type journalFile struct {
+	RunID     string      `json:"run_id"`
+	CreatedAt time.Time   `json:"created_at"`
+	Repo      *repos.Spec `json:"repo,omitempty"`
+	// Target is the remote host that the run targeted by default
+	Target *targets.Target `json:"target,omitempty"`
+	TTP    *journalRecord  `json:"ttp"`
+}
+
+// journalRecord holds the state of a single TTP, which
+// is either the TTP that was run or one of its sub TTPs
+type journalRecord struct {
+	Name        string                 `json:"name"`
+	WorkDir     string                 `json:"work_dir"`
+	Args        map[string]interface{} `json:"args,omitempty"`
+	Environment map[string]string      `json:"environment,omitempty"`
+	// Definition is the TTP YAML with all templates rendered
+	Definition string `json:"definition"`
+	// Results is indexed like the steps of the TTP
+	Results []*ExecutionResult `json:"results"`
+	// ChildResults holds the results of the
+	// child steps of parallel groups by name
+	ChildResults map[string]*ExecutionResult `json:"child_results,omitempty"`
+	// SubTTPs holds the state of sub TTPs by step name
+	SubTTPs map[string]*journalRecord `json:"sub_ttps,omitempty"`
+}
+
+// journalNode is the handle through which the execution of a
+// single TTP updates its own record in the cleanup journal
+type journalNode struct {
+	journal *cleanupJournal
+	record  *journalRecord
+	// snapshots is the directory in which the steps of the
+	// TTP store snapshots of the paths that they change
+	snapshots string
+}
+
+// EnableCleanupJournal makes the execution of ttp record a
+// cleanup journal in a directory named after the run ID
+// within stateDir, so that the run can be cleaned up later
+// with RunDeferredCleanup. The journal is removed once the
+// run has been cleaned up completely.
+func (c *TTPExecutionContext) EnableCleanupJournal(ttp *TTP, stateDir string) error {
+	if c.Cfg.RunID == "" {
+		return errors.New("cannot record a cleanup journal for a run without an ID")
+	}
+	journal := &cleanupJournal{
+		dir: filepath.Join(stateDir, c.Cfg.RunID),
+		file: journalFile{
+			RunID:     c.Cfg.RunID,
+			CreatedAt: time.Now(),
+			TTP:       newJournalRecord(ttp, *c),
+		},
+	}
+	// the repo is needed to clean up steps
+	// whose cleanup action is a sub TTP
+	if c.Cfg.Repo != nil {
+		journal.file.Repo = &repos.Spec{
+			Name: c.Cfg.Repo.GetName(),
+			Path: c.Cfg.Repo.GetFullPath(),
+		}
+	}
+	journal.file.Target = c.Cfg.Target
+	if err := os.MkdirAll(journal.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create state directory for run %v: %w", c.Cfg.RunID, err)
+	}
+	c.journal = &journalNode{
+		journal:   journal,
+		record:    journal.file.TTP,
+		snapshots: filepath.Join(journal.dir, snapshotsDirName),
+	}
+	journal.mu.Lock()
+	defer journal.mu.Unlock()
+	return journal.save()
+}
+
+func newJournalRecord(ttp *TTP, execCtx TTPExecutionContext) *journalRecord {
+	record := &journalRecord{
+		Name:       ttp.Name,
+		WorkDir:    ttp.WorkDir,
+		Definition: ttp.definition,
+	}
+	if execCtx.Vars != nil {
+		record.Args = execCtx.Vars.Args
+	}
+	return record
+}
+
+// save writes the journal to disk - the caller must hold j.mu
+func (j *cleanupJournal) save() error {
+	journalBytes, err := json.MarshalIndent(j.file, "", "  ")
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first so that a
+	// crash never leaves a truncated journal behind
+	journalPath := filepath.Join(j.dir, cleanupJournalFileName)
+	tmpPath := journalPath + ".tmp"
+	if err := os.WriteFile(tmpPath, journalBytes, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, journalPath)
+}
+
+// update copies the current step results and environment of
+// the TTP into its record and persists the journal. Failures
+// are only logged, since they should not stop the TTP.
+func (n *journalNode) update(steps []Step, execCtx TTPExecutionContext) {
+	if n == nil {
+		return
+	}
+	n.journal.mu.Lock()
+	defer n.journal.mu.Unlock()
+
+	if execCtx.Vars != nil {
+		n.record.Environment = execCtx.Vars.Environment
+	}
+	results := execCtx.StepResults
+	// the results are copied so that the journal can be
+	// saved while other steps are still being executed
+	n.record.Results = make([]*ExecutionResult, len(results.ByIndex))
+	for idx, execResult := range results.ByIndex {
+		resultCopy := *execResult
+		n.record.Results[idx] = &resultCopy
+	}
+	n.record.ChildResults = make(map[string]*ExecutionResult)
+	for _, step := range steps {
+		parallelStep, ok := step.action.(*ParallelStep)
+		if !ok {
+			continue
+		}
+		for _, child := range parallelStep.Steps {
+			if execResult, found := results.ByName[child.Name]; found {
+				resultCopy := *execResult
+				n.record.ChildResults[child.Name] = &resultCopy
+			}
+		}
+	}
+
+	if err := n.journal.save(); err != nil {
+		logging.L().Warnf("Failed to update cleanup journal: %v", err)
+	}
+}
+
+// prepareStep must be called before a step is executed. Sub TTPs
+// are given their own record so that their steps are journaled too.
+func (n *journalNode) prepareStep(step *Step) {
+	if n == nil {
+		return
+	}
+	subTTPStep, ok := step.action.(*SubTTPStep)
+	if !ok {
+		return
+	}
+	n.journal.mu.Lock()
+	defer n.journal.mu.Unlock()
+	if n.record.SubTTPs == nil {
+		n.record.SubTTPs = make(map[string]*journalRecord)
+	}
+	// sub TTPs that are only loaded once they run
+	// fill in their record at that point
+	record := &journalRecord{}
+	if subTTPStep.ttp != nil {
+		record = newJournalRecord(subTTPStep.ttp, *subTTPStep.subExecCtx)
+	}
+	n.record.SubTTPs[step.Name] = record
+	subTTPStep.journal = n.subNode(step.Name, record)
+}
+
+// subNode returns the node of the sub TTP run by the step named stepName
+func (n *journalNode) subNode(stepName string, record *journalRecord) *journalNode {
+	return &journalNode{
+		journal:   n.journal,
+		record:    record,
+		snapshots: n.snapshotDir(stepName),
+	}
+}
+
+// snapshotDir returns the directory in which the step named stepName
+// stores snapshots, or "" if the TTP does not record a journal
+func (n *journalNode) snapshotDir(stepName string) string {
+	if n == nil {
+		return ""
+	}
+	return filepath.Join(n.snapshots, snapshotDirName(stepName))
+}
+
+// reset replaces the TTP recorded in this node,
+// which is needed when a sub TTP is reloaded
+func (n *journalNode) reset(ttp *TTP, execCtx TTPExecutionContext) {
+	if n == nil {
+		return
+	}
+	n.journal.mu.Lock()
+	defer n.journal.mu.Unlock()
+	*n.record = *newJournalRecord(ttp, execCtx)
+}
+
+// finish removes the journal if nothing is left to clean up.
+// Otherwise, it tells the user how to clean up the run later.
+func (n *journalNode) finish(t *TTP, execCtx TTPExecutionContext) {
+	if n == nil {
+		return
+	}
+	if t.hasPendingCleanup(execCtx) {
+		logging.L().Warnf("[*] Some steps were not cleaned up - to clean them up later, run: ttpforge cleanup %v", execCtx.Cfg.RunID)
+		return
+	}
+	n.journal.mu.Lock()
+	defer n.journal.mu.Unlock()
+	if err := os.RemoveAll(n.journal.dir); err != nil {
+		logging.L().Warnf("Failed to remove state directory %v: %v", n.journal.dir, err)
+	}
+}
+
+// hasPendingCleanup reports whether any step of
+// the TTP still needs to be cleaned up
+func (t *TTP) hasPendingCleanup(execCtx TTPExecutionContext) bool {
+	for stepIdx, execResult := range execCtx.StepResults.ByIndex {
+		if t.Steps[stepIdx].needsCleanup(execResult) {
+			return true
+		}
+	}
+	return false
+}
+
+// RunDeferredCleanup cleans up an earlier run of a TTP, using the
+// cleanup journal recorded in the state directory of that run.
+// Steps that were already cleaned up are not cleaned up again.
+func RunDeferredCleanup(stateDir, runID string, cfg TTPExecutionConfig) error {
+	if runID == "" || filepath.Base(runID) != runID {
+		return fmt.Errorf("invalid run ID %q", runID)
+	}
+	journalDir := filepath.Join(stateDir, runID)
+	journalBytes, err := os.ReadFile(filepath.Join(journalDir, cleanupJournalFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("no cleanup journal found for run %v - it may already have been cleaned up", runID)
+	} else if err != nil {
+		return err
+	}
+	journal := &cleanupJournal{
+		dir: journalDir,
+	}
+	if err := json.Unmarshal(journalBytes, &journal.file); err != nil {
+		return fmt.Errorf("failed to decode cleanup journal of run %v: %w", runID, err)
+	}
+	if journal.file.TTP == nil {
+		return fmt.Errorf("cleanup journal of run %v is empty", runID)
+	}
+
+	cfg.RunID = runID
+	cfg.NoCleanup = false
+	if journal.file.Target != nil && cfg.Target == nil {
+		cfg.Target = journal.file.Target
+	}
+	if journal.file.Repo != nil && cfg.Repo == nil {
+		cfg.Repo, err = journal.file.Repo.Load(afero.NewOsFs(), "")
+		if err != nil {
+			return fmt.Errorf("failed to load repo of run %v: %w", runID, err)
+		}
+	}
+	node := &journalNode{
+		journal:   journal,
+		record:    journal.file.TTP,
+		snapshots: filepath.Join(journal.dir, snapshotsDirName),
+	}
+	ttp, execCtx, err := node.restore(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to restore run %v from its cleanup journal: %w", runID, err)
+	}
+	logging.L().Infof("Cleaning up run %v of TTP %q (started at %v)", runID, ttp.Name, journal.file.CreatedAt.Format(time.RFC3339))
+	return ttp.RunCleanup(execCtx)
+}
+
+// restore reconstructs the TTP recorded in this node and an
+// execution context that holds the results of its steps
+func (n *journalNode) restore(cfg TTPExecutionConfig) (*TTP, TTPExecutionContext, error) {
+	record := n.record
+	var ttp TTP
+	if err := yaml.Unmarshal([]byte(record.Definition), &ttp); err != nil {
+		return nil, TTPExecutionContext{}, fmt.Errorf("failed to decode TTP %q: %w", record.Name, err)
+	}
+	if len(record.Results) > len(ttp.Steps) {
+		return nil, TTPExecutionContext{}, fmt.Errorf("TTP %q has fewer steps than results", record.Name)
+	}
+	ttp.WorkDir = record.WorkDir
+	ttp.definition = record.Definition
+
+	results := NewStepResultsRecord()
+	for name, execResult := range record.ChildResults {
+		results.ByName[name] = execResult
+	}
+	for idx, execResult := range record.Results {
+		results.ByName[ttp.Steps[idx].Name] = execResult
+		results.ByIndex = append(results.ByIndex, execResult)
+	}
+	execCtx := TTPExecutionContext{
+		Cfg: cfg,
+		Vars: &TTPExecutionVars{
+			WorkDir:     record.WorkDir,
+			ttpDir:      record.WorkDir,
+			Args:        record.Args,
+			Environment: record.Environment,
+			TTPName:     ttp.Name,
+			TTPUUID:     ttp.UUID,
+		},
+		StepResults: results,
+		journal:     n,
+	}
+
+	for idx, execResult := range record.Results {
+		if err := n.restoreStep(&ttp.Steps[idx], execResult, execCtx); err != nil {
+			return nil, TTPExecutionContext{}, err
+		}
+	}
+	return &ttp, execCtx, nil
+}
+
+// restoreStep prepares a step that was restored from
+// the journal so that it can be cleaned up
+func (n *journalNode) restoreStep(step *Step, execResult *ExecutionResult, execCtx TTPExecutionContext) error {
+	if execResult == nil || !step.needsCleanup(execResult) {
+		return nil
+	}
+
+	switch action := step.action.(type) {
+	case *SubTTPStep:
+		if _, ok := step.cleanup.(*subTTPCleanupAction); !ok {
+			break
+		}
+		record, found := n.record.SubTTPs[step.Name]
+		if !found {
+			// the sub TTP never started, so
+			// there is nothing to clean up
+			execResult.Cleanup = &ActResult{}
+			return nil
+		}
+		subNode := n.subNode(step.Name, record)
+		subTTP, subExecCtx, err := subNode.restore(execCtx.Cfg)
+		if err != nil {
+			return err
+		}
+		action.ttp = subTTP
+		action.subExecCtx = &subExecCtx
+		return nil
+	case *ParallelStep:
+		if _, ok := step.cleanup.(*parallelCleanupAction); !ok {
+			break
+		}
+		for childIdx := range action.Steps {
+			child := &action.Steps[childIdx]
+			if err := n.restoreStep(child, execCtx.StepResults.ByName[child.Name], execCtx); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *SpawnStep:
+		if _, ok := step.cleanup.(*killSpawnAction); !ok {
+			break
+		}
+		return action.restoreProcess(execResult)
+	}
+
+	if step.cleanup == nil {
+		return nil
+	}
+	if err := step.cleanup.Validate(execCtx); err != nil {
+		return fmt.Errorf("invalid cleanup action for step %q: %w", step.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeferredCleanup(t *testing.T) {
+	testCases := []struct {
+		name                  string
+		content               string
+		args                  map[string]interface{}
+		simulateCrash         bool
+		wantError             bool
+		expectedCleanupStdout string
+	}{
+		{
+			name: "Completed Steps Are Cleaned Up In Reverse Order",
+			content: `name: deferred
+steps:
+  - name: first
+    inline: echo first
+    cleanup:
+      print_str: cleanup_first
+  - name: group
+    parallel:
+      - name: child_one
+        inline: echo child_one
+        cleanup:
+          print_str: cleanup_child_one
+      - name: child_two
+        inline: echo child_two
+  - name: fails
+    inline: exit 1
+    cleanup:
+      print_str: cleanup_fails`,
+			wantError:             true,
+			expectedCleanupStdout: "cleanup_child_one\ncleanup_first\n",
+		},
+		{
+			name: "Variables Are Expanded With Recorded Results",
+			content: `name: variables
+args:
+  - name: target
+steps:
+  - name: discover
+    inline: echo {\"path\":\"/tmp/payload\"}
+    outputs:
+      path:
+        filters:
+        - json_path: path
+    cleanup:
+      inline: echo "removing $forge.steps.discover.outputs.path from $forge.args.target"`,
+			args: map[string]interface{}{
+				"target": "victim",
+			},
+			expectedCleanupStdout: "removing /tmp/payload from victim\n",
+		},
+		{
+			name:          "Steps That Were Already Cleaned Up Are Skipped",
+			simulateCrash: true,
+			content: `name: already_cleaned_up
+steps:
+  - name: first
+    inline: echo first
+    cleanup:
+      print_str: cleanup_first
+  - name: optional
+    inline: echo optional
+    on_failure: cleanup_and_continue
+    checks:
+      - msg: should fail
+        path_exists: /this/path/does/not/exist
+    cleanup:
+      print_str: cleanup_optional
+  - name: last
+    inline: echo last`,
+			expectedCleanupStdout: "cleanup_first\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ttp, err := RenderTemplatedTTP(tc.content, RenderParameters{
+				Args: tc.args,
+			})
+			require.NoError(t, err)
+
+			execCtx := NewTTPExecutionContext()
+			execCtx.Cfg.RunID = "test-run"
+			// when simulating a crash, TTPForge exits without cleaning up
+			execCtx.Cfg.NoCleanup = !tc.simulateCrash
+			execCtx.Vars.Args = tc.args
+			var stdoutBuf bytes.Buffer
+			execCtx.Cfg.Stdout = &stdoutBuf
+			err = ttp.Validate(execCtx)
+			require.NoError(t, err)
+
+			stateDir := t.TempDir()
+			err = execCtx.EnableCleanupJournal(ttp, stateDir)
+			require.NoError(t, err)
+
+			err = ttp.Execute(context.Background(), execCtx)
+			if tc.wantError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			if !tc.simulateCrash {
+				err = ttp.RunCleanup(execCtx)
+				require.NoError(t, err)
+			}
+			assert.FileExists(t, filepath.Join(stateDir, "test-run", cleanupJournalFileName))
+
+			// later, clean up the run from its journal
+			var cleanupStdoutBuf bytes.Buffer
+			err = RunDeferredCleanup(stateDir, "test-run", TTPExecutionConfig{
+				Stdout: &cleanupStdoutBuf,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedCleanupStdout, cleanupStdoutBuf.String())
+			_, err = os.Stat(filepath.Join(stateDir, "test-run"))
+			assert.True(t, os.IsNotExist(err), "journal should be removed once the run is cleaned up")
+		})
+	}
+}
+
+func TestDeferredCleanupErrors(t *testing.T) {
+	stateDir := t.TempDir()
+	err := RunDeferredCleanup(stateDir, "does-not-exist", TTPExecutionConfig{})
+	require.Error(t, err)
+	err = RunDeferredCleanup(stateDir, "../escape", TTPExecutionConfig{})
+	require.Error(t, err)
+
+	err = os.MkdirAll(filepath.Join(stateDir, "corrupt"), 0700)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(stateDir, "corrupt", cleanupJournalFileName), []byte("{not json"), 0600)
+	require.NoError(t, err)
+	err = RunDeferredCleanup(stateDir, "corrupt", TTPExecutionConfig{})
+	require.Error(t, err)
+}
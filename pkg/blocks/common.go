@@ -176,3 +176,19 @@ func FetchEnv(environ map[string]string) []string {
 
 	return envSlice
 }
+
+// mergeEnvironments returns a new environment variable map containing
+// the variables of base, overridden by the variables of overrides.
+func mergeEnvironments(base, overrides map[string]string) map[string]string {
+	if len(base) == 0 && len(overrides) == 0 {
+		return nil
+	}
+	merged := make(map[string]string, len(base)+len(overrides))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	return merged
+}
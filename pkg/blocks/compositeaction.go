@@ -19,7 +19,10 @@ THE SOFTWARE.
 
 package blocks
 
-import "errors"
+import (
+	"context"
+	"errors"
+)
 
 // CompositeAction is an action that executes multiple actions
 type CompositeAction struct {
@@ -41,9 +44,9 @@ func (ca *CompositeAction) Validate(execCtx TTPExecutionContext) error {
 }
 
 // Execute runs the step and returns an error if one occurs.
-func (ca *CompositeAction) Execute(execCtx TTPExecutionContext) (*ActResult, error) {
+func (ca *CompositeAction) Execute(ctx context.Context, execCtx TTPExecutionContext) (*ActResult, error) {
 	for _, a := range ca.actions {
-		if _, err := a.Execute(execCtx); err != nil {
+		if _, err := a.Execute(ctx, execCtx); err != nil {
 			return nil, err
 		}
 	}
@@ -54,3 +57,14 @@ func (ca *CompositeAction) Execute(execCtx TTPExecutionContext) (*ActResult, err
 func (ca *CompositeAction) CanBeUsedInCompositeAction() bool {
 	return true
 }
+
+// CanRunOnTarget reports whether all of the
+// actions of the composite can run on a remote target
+func (ca *CompositeAction) CanRunOnTarget() bool {
+	for _, a := range ca.actions {
+		if !a.CanRunOnTarget() {
+			return false
+		}
+	}
+	return true
+}
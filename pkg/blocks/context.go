@@ -23,27 +23,69 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"regexp"
+	"runtime"
 	"strings"
 
+	"github.com/facebookincubator/ttpforge/pkg/executors"
+	"github.com/facebookincubator/ttpforge/pkg/outputs"
 	"github.com/facebookincubator/ttpforge/pkg/repos"
+	"github.com/facebookincubator/ttpforge/pkg/targets"
 )
 
 const contextVariablePrefix = "$forge."
 
+// contextVariableRegexp matches variable references
+// (and escaped ones that start with more than one $)
+var contextVariableRegexp = regexp.MustCompile(
+	`\$*` + regexp.QuoteMeta(contextVariablePrefix) + `(?:[\w\.]|\[-?\d+\])*`,
+)
+
 // TTPExecutionConfig - pass this into RunSteps to control TTP execution
 type TTPExecutionConfig struct {
+	// RunID uniquely identifies a single run of a TTP
+	// and is shared with all of its sub TTPs
+	RunID               string
 	DryRun              bool
 	NoCleanup           bool
 	CleanupDelaySeconds uint
 	Repo                repos.Repo
-	Stdout              io.Writer
-	Stderr              io.Writer
+	// Executors holds the custom executors that steps may use
+	// in addition to the builtin ones
+	Executors *executors.Registry
+	// Target is the remote host on which steps run
+	// by default - if it is nil, they run locally
+	Target *targets.Target
+	// Targets holds the named targets from the configuration
+	// file, which steps can reference by name
+	Targets map[string]targets.Target
+	Stdout  io.Writer
+	Stderr  io.Writer
+	// sharedWorkDir is set for the runs of a fleet and for the children
+	// of parallel groups, which share the working directory of one
+	// process - their TTPs must not change it, so relative local paths
+	// are resolved against the directory of the TTP instead
+	sharedWorkDir bool
 }
 
 // TTPExecutionVars - mutable store to carry variables between steps
 type TTPExecutionVars struct {
 	WorkDir string
+	Args    map[string]interface{}
+	// TTPName and TTPUUID identify the TTP that is executing
+	TTPName string
+	TTPUUID string
+	// Environment holds the expanded TTP-level environment
+	// variables (including those inherited from parent TTPs),
+	// which are passed to every step of the TTP
+	Environment map[string]string
+	// ttpDir is the directory of the TTP file - unlike
+	// WorkDir, it does not change with cd steps
+	ttpDir string
+	// targetPlatform is the platform of the remote target
+	// of the run, once the TTP has detected it
+	targetPlatform *PlatformReport
 }
 
 // TTPExecutionContext - holds config and context for the currently executing TTP
@@ -54,6 +96,18 @@ type TTPExecutionContext struct {
 	actionResultsChan chan *ActResult
 	errorsChan        chan error
 	shutdownChan      chan bool
+	journal           *journalNode
+	// remote is set while the actions of
+	// a step that has a target are validated
+	// and (along with its connection) executed
+	remote *remoteTarget
+	// stepConn is set while a step runs, so that all of its
+	// parts share one connection to the target of the step
+	stepConn *stepConnection
+	// snapshotDir is set while a step whose cleanup restores
+	// snapshots is executed or cleaned up - it is the directory
+	// in which the action of the step takes its snapshot
+	snapshotDir string
 }
 
 // NewTTPExecutionContext creates a new TTPExecutionContext with empty config and created channels
@@ -71,6 +125,13 @@ func NewTTPExecutionContext() TTPExecutionContext {
 // and expands all of them to their appropriate values:
 //
 // * Step outputs: ($forge.steps.bar.outputs.baz)
+// * Step exit codes: ($forge.steps.bar.exit_code)
+// * TTP arguments: ($forge.args.foo)
+// * Environment variables: ($forge.env.FOO)
+// * TTP metadata: ($forge.ttp.name, $forge.ttp.uuid)
+// * Run metadata: ($forge.run.id)
+// * Platform: ($forge.platform.os, $forge.platform.arch)
+// * Directories: ($forge.workdir, $forge.tmpdir)
 //
 // **Parameters:**
 //
@@ -81,14 +142,11 @@ func NewTTPExecutionContext() TTPExecutionContext {
 // []string: the corresponding strings with variables expanded
 // error: an error if there is a problem
 func (c TTPExecutionContext) ExpandVariables(inStrs []string) ([]string, error) {
-	re := regexp.MustCompile(
-		`\$*` + regexp.QuoteMeta(contextVariablePrefix) + `[\w\.]*`,
-	)
 	var expandedStrs []string
 	for _, inStr := range inStrs {
 		var failedMatch string
 		var failedMatchError error
-		expandedStr := re.ReplaceAllStringFunc(inStr, func(match string) string {
+		expandedStr := contextVariableRegexp.ReplaceAllStringFunc(inStr, func(match string) string {
 			result, err := c.processMatch(match)
 			if err != nil {
 				failedMatch = match
@@ -104,37 +162,153 @@ func (c TTPExecutionContext) ExpandVariables(inStrs []string) ([]string, error)
 	return expandedStrs, nil
 }
 
+// expandValue expands the variables in expr. If expr consists of
+// nothing but a reference to a step result, the referenced value
+// keeps its type - so a reference to a structured output
+// yields the list or map itself rather than its JSON encoding.
+func (c TTPExecutionContext) expandValue(expr string) (interface{}, error) {
+	trimmed := strings.TrimSpace(expr)
+	if contextVariableRegexp.FindString(trimmed) == trimmed {
+		if path, ok := strings.CutPrefix(trimmed, contextVariablePrefix+"steps."); ok {
+			val, err := c.lookupStepsVariable(path)
+			if err != nil {
+				return nil, fmt.Errorf("invalid variable expression %v: %v", trimmed, err)
+			}
+			return val, nil
+		}
+	}
+	expanded, err := c.ExpandVariables([]string{expr})
+	if err != nil {
+		return nil, err
+	}
+	return expanded[0], nil
+}
+
+// commandEnv builds the environment of a command run by a step:
+// the environment of TTPForge itself, then the TTP-level environment,
+// then the environment of the step itself, each overriding the last.
+// Variables in the step environment are expanded here, while the TTP-level
+// environment was already expanded when the TTP started.
+func (c TTPExecutionContext) commandEnv(stepEnv map[string]string) ([]string, error) {
+	expandedStepEnv, err := c.ExpandVariables(FetchEnv(stepEnv))
+	if err != nil {
+		return nil, err
+	}
+	env := os.Environ()
+	if c.Vars != nil {
+		env = append(env, FetchEnv(c.Vars.Environment)...)
+	}
+	return append(env, expandedStepEnv...), nil
+}
+
 func (c TTPExecutionContext) processStepsVariable(path string) (string, error) {
+	val, err := c.lookupStepsVariable(path)
+	if err != nil {
+		return "", err
+	}
+	return outputs.FormatValue(val), nil
+}
+
+// lookupStepsVariable resolves a reference to a step result,
+// keeping the type of the referenced value
+func (c TTPExecutionContext) lookupStepsVariable(path string) (interface{}, error) {
 	tokens := strings.Split(path, ".")
 	if len(tokens) < 2 {
-		return "", fmt.Errorf("invalid step result reference: %v", "steps."+path)
+		return nil, fmt.Errorf("invalid step result reference: %v", "steps."+path)
 	}
 
 	stepName := tokens[0]
 	stepResult, ok := c.StepResults.ByName[stepName]
 	if !ok {
-		return "", fmt.Errorf("invalid step name in variable path: %v", "steps."+path)
+		return nil, fmt.Errorf("invalid step name in variable path: %v", "steps."+path)
 	}
 
 	fieldSelector := tokens[1]
 	switch fieldSelector {
 	case "stdout":
 		if len(tokens) != 2 {
-			return "", fmt.Errorf("invalid step result reference (should end at stdout): %v", "steps."+path)
+			return nil, fmt.Errorf("invalid step result reference (should end at stdout): %v", "steps."+path)
 		}
 		return stepResult.Stdout, nil
+	case "exit_code":
+		if len(tokens) != 2 {
+			return nil, fmt.Errorf("invalid step result reference (should end at exit_code): %v", "steps."+path)
+		}
+		return stepResult.ExitCode, nil
 	case "outputs":
-		if len(tokens) != 3 {
-			return "", fmt.Errorf("step output reference %v should be exactly one level deep (e.g. steps.foo.outputs.bar)", "steps."+path)
+		if len(tokens) < 3 {
+			return nil, fmt.Errorf("step output reference %v should name an output (e.g. steps.foo.outputs.bar)", "steps."+path)
 		}
-		key := tokens[2]
-		val, ok := stepResult.Outputs[key]
-		if !ok {
-			return "", fmt.Errorf("key %v not found in output of step %v", key, stepName)
+		outputPath := strings.Join(tokens[2:], ".")
+		val, err := outputs.Lookup(stepResult.Outputs, outputPath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reference to output %v of step %v: %w", outputPath, stepName, err)
 		}
 		return val, nil
 	}
-	return "", fmt.Errorf("invalid step result field selector: %v", fieldSelector)
+	return nil, fmt.Errorf("invalid step result field selector: %v", fieldSelector)
+}
+
+func (c TTPExecutionContext) processArgsVariable(argName string) (string, error) {
+	if c.Vars == nil {
+		return "", fmt.Errorf("invalid argument name in variable path: %v", "args."+argName)
+	}
+	val, ok := c.Vars.Args[argName]
+	if !ok {
+		return "", fmt.Errorf("invalid argument name in variable path: %v", "args."+argName)
+	}
+	return fmt.Sprint(val), nil
+}
+
+// processEnvVariable looks up an environment variable, preferring
+// the TTP-level environment over that of TTPForge itself
+func (c TTPExecutionContext) processEnvVariable(name string) (string, error) {
+	if c.Vars != nil {
+		if val, ok := c.Vars.Environment[name]; ok {
+			return val, nil
+		}
+	}
+	if val, ok := os.LookupEnv(name); ok {
+		return val, nil
+	}
+	return "", fmt.Errorf("environment variable %v is not set", name)
+}
+
+func (c TTPExecutionContext) processTTPVariable(field string) (string, error) {
+	if c.Vars == nil {
+		return "", fmt.Errorf("invalid TTP field in variable path: %v", "ttp."+field)
+	}
+	switch field {
+	case "name":
+		return c.Vars.TTPName, nil
+	case "uuid":
+		if c.Vars.TTPUUID == "" {
+			return "", fmt.Errorf("TTP %v does not have a uuid", c.Vars.TTPName)
+		}
+		return c.Vars.TTPUUID, nil
+	}
+	return "", fmt.Errorf("invalid TTP field in variable path: %v", "ttp."+field)
+}
+
+func (c TTPExecutionContext) processRunVariable(field string) (string, error) {
+	switch field {
+	case "id":
+		if c.Cfg.RunID == "" {
+			return "", errors.New("the current run does not have an ID")
+		}
+		return c.Cfg.RunID, nil
+	}
+	return "", fmt.Errorf("invalid run field in variable path: %v", "run."+field)
+}
+
+func processPlatformVariable(field string) (string, error) {
+	switch field {
+	case "os":
+		return runtime.GOOS, nil
+	case "arch":
+		return runtime.GOARCH, nil
+	}
+	return "", fmt.Errorf("invalid platform field in variable path: %v", "platform."+field)
 }
 
 func (c TTPExecutionContext) processMatch(match string) (string, error) {
@@ -149,14 +323,38 @@ func (c TTPExecutionContext) processMatch(match string) (string, error) {
 			return "", errors.New("leading or trailing '.' in variable expression")
 		}
 	}
+
+	// these variables have no fields
+	if len(tokens) == 1 {
+		switch tokens[0] {
+		case "workdir":
+			if c.Vars == nil {
+				return "", errors.New("the working directory is not known")
+			}
+			return c.Vars.WorkDir, nil
+		case "tmpdir":
+			return os.TempDir(), nil
+		}
+	}
 	if len(tokens) < 2 {
 		return "", fmt.Errorf("invalid variable expression: %v", match)
 	}
 
 	prefix := tokens[0]
 	path := strings.Join(tokens[1:], ".")
-	if prefix == "steps" {
+	switch prefix {
+	case "steps":
 		return c.processStepsVariable(path)
+	case "args":
+		return c.processArgsVariable(path)
+	case "env":
+		return c.processEnvVariable(path)
+	case "ttp":
+		return c.processTTPVariable(path)
+	case "run":
+		return c.processRunVariable(path)
+	case "platform":
+		return processPlatformVariable(path)
 	}
 	return "", fmt.Errorf("invalid variable prefix: %v", prefix)
 }
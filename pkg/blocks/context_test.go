@@ -20,6 +20,9 @@ THE SOFTWARE.
 package blocks
 
 import (
+	"encoding/json"
+	"os"
+	"runtime"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -36,21 +39,51 @@ func TestExpandVariablesStepResults(t *testing.T) {
 	}
 	stepResults.ByName["second_step"] = &ExecutionResult{
 		ActResult: ActResult{
-			Stdout: "world",
+			Stdout:   "world",
+			ExitCode: 3,
 		},
 	}
 	stepResults.ByName["third_step"] = &ExecutionResult{
 		ActResult: ActResult{
 			Stdout: `{"foo":{"bar":"baz"}}`,
-			Outputs: map[string]string{
+			Outputs: map[string]interface{}{
 				"myresult": "baz",
 			},
 		},
 	}
+	stepResults.ByName["discover"] = &ExecutionResult{
+		ActResult: ActResult{
+			Outputs: map[string]interface{}{
+				"users": []interface{}{
+					map[string]interface{}{"name": "alice"},
+					map[string]interface{}{"name": "bob"},
+				},
+				"port": json.Number("8080"),
+			},
+		},
+	}
 	stepResults.ByIndex = append(stepResults.ByIndex, stepResults.ByName["first_step"])
 	stepResults.ByIndex = append(stepResults.ByIndex, stepResults.ByName["second_step"])
 	stepResults.ByIndex = append(stepResults.ByIndex, stepResults.ByName["third_step"])
+	t.Setenv("TTPFORGE_TEST_SHELL_VAR", "from-shell")
+	t.Setenv("TTPFORGE_TEST_SHARED_VAR", "from-shell")
 	execCtx := TTPExecutionContext{
+		Cfg: TTPExecutionConfig{
+			RunID: "4c1e6a52-8f3d-4b7a-9e21-6d0f5b3c8a74",
+		},
+		Vars: &TTPExecutionVars{
+			WorkDir: "/tmp/ttp",
+			Args: map[string]interface{}{
+				"target": "10.0.0.1",
+				"port":   8080,
+			},
+			TTPName: "my_ttp",
+			TTPUUID: "0e7c2d9a-3b1f-4a68-8d5e-2f9b7c4a1e03",
+			Environment: map[string]string{
+				"TTPFORGE_TEST_TTP_VAR":    "from-ttp",
+				"TTPFORGE_TEST_SHARED_VAR": "from-ttp",
+			},
+		},
 		StepResults: stepResults,
 	}
 
@@ -83,6 +116,119 @@ func TestExpandVariablesStepResults(t *testing.T) {
 			},
 			wantError: false,
 		},
+		{
+			name: "Structured Output Expansion",
+			stringsToExpand: []string{
+				"$forge.steps.discover.outputs.users[1].name:$forge.steps.discover.outputs.port",
+				"found $forge.steps.discover.outputs.users.length users",
+				"$forge.steps.discover.outputs.users[-1]",
+			},
+			expectedResult: []string{
+				"bob:8080",
+				"found 2 users",
+				`{"name":"bob"}`,
+			},
+			wantError: false,
+		},
+		{
+			name: "Structured Output Index Out Of Range",
+			stringsToExpand: []string{
+				"should fail: $forge.steps.discover.outputs.users[2].name",
+			},
+			wantError: true,
+		},
+		{
+			name: "Step Exit Code Expansion",
+			stringsToExpand: []string{
+				"exit code: $forge.steps.second_step.exit_code",
+				"$forge.steps.first_step.exit_code",
+			},
+			expectedResult: []string{
+				"exit code: 3",
+				"0",
+			},
+			wantError: false,
+		},
+		{
+			name: "Arg Expansion",
+			stringsToExpand: []string{
+				"connect $forge.args.target:$forge.args.port",
+			},
+			expectedResult: []string{
+				"connect 10.0.0.1:8080",
+			},
+			wantError: false,
+		},
+		{
+			name: "Platform Expansion",
+			stringsToExpand: []string{
+				"$forge.platform.os/$forge.platform.arch",
+			},
+			expectedResult: []string{
+				runtime.GOOS + "/" + runtime.GOARCH,
+			},
+			wantError: false,
+		},
+		{
+			name: "Environment Variable Expansion",
+			stringsToExpand: []string{
+				"$forge.env.TTPFORGE_TEST_TTP_VAR $forge.env.TTPFORGE_TEST_SHELL_VAR $forge.env.TTPFORGE_TEST_SHARED_VAR",
+			},
+			expectedResult: []string{
+				"from-ttp from-shell from-ttp",
+			},
+			wantError: false,
+		},
+		{
+			name: "Run Metadata Expansion",
+			stringsToExpand: []string{
+				"$forge.ttp.name/$forge.ttp.uuid/$forge.run.id",
+			},
+			expectedResult: []string{
+				"my_ttp/0e7c2d9a-3b1f-4a68-8d5e-2f9b7c4a1e03/4c1e6a52-8f3d-4b7a-9e21-6d0f5b3c8a74",
+			},
+			wantError: false,
+		},
+		{
+			name: "Directory Expansion",
+			stringsToExpand: []string{
+				"$forge.workdir/output.txt",
+				"$forge.tmpdir/scratch",
+			},
+			expectedResult: []string{
+				"/tmp/ttp/output.txt",
+				os.TempDir() + "/scratch",
+			},
+			wantError: false,
+		},
+		{
+			name: "Unset Environment Variable",
+			stringsToExpand: []string{
+				"should fail: $forge.env.TTPFORGE_TEST_UNSET_VAR",
+			},
+			wantError: true,
+		},
+		{
+			name: "Invalid TTP Field",
+			stringsToExpand: []string{
+				"should fail: $forge.ttp.author",
+			},
+			wantError: true,
+		},
+		{
+			name: "Workdir With Field",
+			stringsToExpand: []string{
+				"should fail: $forge.workdir.foo",
+			},
+			wantError: true,
+		},
+		{
+			name: "Invalid Arg Name",
+			stringsToExpand: []string{
+				"should fail: $forge.args.missing",
+			},
+			wantError: true,
+		},
 		{
 			name: "Escape forge magic string",
 			stringsToExpand: []string{
@@ -20,7 +20,12 @@ THE SOFTWARE.
 package blocks
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
 
 	"github.com/facebookincubator/ttpforge/pkg/logging"
 	"github.com/otiai10/copy"
@@ -71,15 +76,14 @@ func (s *CopyPathStep) Validate(_ TTPExecutionContext) error {
 }
 
 // Execute runs the step and returns an error if one occurs.
-func (s *CopyPathStep) Execute(_ TTPExecutionContext) (*ActResult, error) {
+func (s *CopyPathStep) Execute(_ context.Context, execCtx TTPExecutionContext) (*ActResult, error) {
 	logging.L().Infof("Copying file(s) from %v to %v", s.Source, s.Destination)
-	fsys := s.FileSystem
-	if fsys == nil {
-		fsys = afero.NewOsFs()
-	}
+	fsys := execCtx.fileSystem(s.FileSystem)
+	source := execCtx.localPath(s.Source)
+	destination := execCtx.localPath(s.Destination)
 
 	// check if source exists.
-	sourceExists, err := afero.Exists(fsys, s.Source)
+	sourceExists, err := afero.Exists(fsys, source)
 	if err != nil {
 		return nil, err
 	}
@@ -90,7 +94,7 @@ func (s *CopyPathStep) Execute(_ TTPExecutionContext) (*ActResult, error) {
 	}
 
 	// if source is a directory but recursive is false
-	srcInfo, err := fsys.Stat(s.Source)
+	srcInfo, err := fsys.Stat(source)
 	if err != nil {
 		return nil, err
 	}
@@ -99,7 +103,7 @@ func (s *CopyPathStep) Execute(_ TTPExecutionContext) (*ActResult, error) {
 	}
 
 	// check if destination exists.
-	destExists, err := afero.Exists(fsys, s.Destination)
+	destExists, err := afero.Exists(fsys, destination)
 	if err != nil {
 		return nil, err
 	}
@@ -108,6 +112,10 @@ func (s *CopyPathStep) Execute(_ TTPExecutionContext) (*ActResult, error) {
 		return nil, fmt.Errorf("dest %v already exists and overwrite was not set", s.Destination)
 	}
 
+	if err := execCtx.takeSnapshot(fsys, destination); err != nil {
+		return nil, err
+	}
+
 	// use the default umask
 	// https://stackoverflow.com/questions/23842247/reading-default-filemode-when-using-os-o-create
 	mode := s.Mode
@@ -115,8 +123,13 @@ func (s *CopyPathStep) Execute(_ TTPExecutionContext) (*ActResult, error) {
 		mode = 0666
 	}
 
-	// Copy a file
-	err = copy.Copy(s.Source, s.Destination)
+	// Copy a file - files on remote targets
+	// can only be copied through their file system
+	if execCtx.onTarget() {
+		err = copyWithinFs(fsys, source, destination)
+	} else {
+		err = copy.Copy(source, destination)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -125,14 +138,51 @@ func (s *CopyPathStep) Execute(_ TTPExecutionContext) (*ActResult, error) {
 }
 
 // GetDefaultCleanupAction will instruct the calling code
-// to remove the path created by this action
+// to remove the path created by this action, or to restore
+// the path that it overwrote from a snapshot
 func (s *CopyPathStep) GetDefaultCleanupAction() Action {
-	return &RemovePathAction{
-		Path: s.Destination,
-	}
+	return &restorePathAction{fileSystem: &s.FileSystem}
 }
 
 // CanBeUsedInCompositeAction enables this action to be used in a composite action
 func (s *CopyPathStep) CanBeUsedInCompositeAction() bool {
 	return true
 }
+
+// CanRunOnTarget enables this action to run on a remote target
+func (s *CopyPathStep) CanRunOnTarget() bool {
+	return true
+}
+
+// copyWithinFs copies the file or directory at src to dst
+// within fsys, preserving the mode of everything it copies
+func copyWithinFs(fsys afero.Fs, src, dst string) error {
+	return afero.Walk(fsys, src, func(srcPath string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, srcPath)
+		if err != nil {
+			return err
+		}
+		dstPath := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return fsys.MkdirAll(dstPath, info.Mode().Perm())
+		}
+
+		srcFile, err := fsys.Open(srcPath)
+		if err != nil {
+			return err
+		}
+		defer srcFile.Close()
+		dstFile, err := fsys.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(dstFile, srcFile); err != nil {
+			dstFile.Close()
+			return err
+		}
+		return dstFile.Close()
+	})
+}
@@ -20,6 +20,7 @@ THE SOFTWARE.
 package blocks
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"testing"
@@ -112,7 +113,7 @@ func TestCopyPathExecute(t *testing.T) {
 
 			// execute and check error
 			var execCtx TTPExecutionContext
-			_, err = copyTestPathStep.Execute(execCtx)
+			_, err = copyTestPathStep.Execute(context.Background(), execCtx)
 			if tc.expectExecuteError {
 				require.Error(t, err)
 				return
@@ -20,11 +20,11 @@ THE SOFTWARE.
 package blocks
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 
-	"github.com/facebookincubator/ttpforge/pkg/fileutils"
 	"github.com/facebookincubator/ttpforge/pkg/logging"
 	"github.com/spf13/afero"
 )
@@ -67,16 +67,13 @@ func (s *CreateFileStep) Validate(_ TTPExecutionContext) error {
 }
 
 // Execute runs the step and returns an error if one occurs.
-func (s *CreateFileStep) Execute(_ TTPExecutionContext) (*ActResult, error) {
+func (s *CreateFileStep) Execute(_ context.Context, execCtx TTPExecutionContext) (*ActResult, error) {
 	logging.L().Infof("Creating file %v", s.Path)
-	fsys := s.FileSystem
-	if fsys == nil {
-		fsys = afero.NewOsFs()
-	}
+	fsys := execCtx.fileSystem(s.FileSystem)
 
 	// check whether path already exists and
 	// whether that is ok given the overwrite flag status
-	pathToCreate, err := fileutils.ExpandTilde(s.Path)
+	pathToCreate, err := execCtx.resolvePath(s.Path)
 	if err != nil {
 		return nil, err
 	}
@@ -88,6 +85,10 @@ func (s *CreateFileStep) Execute(_ TTPExecutionContext) (*ActResult, error) {
 		return nil, fmt.Errorf("path %v already exists and overwrite was not set", pathToCreate)
 	}
 
+	if err := execCtx.takeSnapshot(fsys, pathToCreate); err != nil {
+		return nil, err
+	}
+
 	// use the default umask
 	// https://stackoverflow.com/questions/23842247/reading-default-filemode-when-using-os-o-create
 	mode := s.Mode
@@ -120,9 +121,13 @@ func (s *CreateFileStep) Execute(_ TTPExecutionContext) (*ActResult, error) {
 }
 
 // GetDefaultCleanupAction will instruct the calling code
-// to remove the path created by this action
+// to remove the path created by this action, or to restore
+// the file that it overwrote from a snapshot
 func (s *CreateFileStep) GetDefaultCleanupAction() Action {
-	return &RemovePathAction{
-		Path: s.Path,
-	}
+	return &restorePathAction{fileSystem: &s.FileSystem}
+}
+
+// CanRunOnTarget enables this action to run on a remote target
+func (s *CreateFileStep) CanRunOnTarget() bool {
+	return true
 }
@@ -0,0 +1,66 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/facebookincubator/ttpforge/pkg/logging"
+	"github.com/spf13/afero"
+)
+
+// restoreEditAction restores the contents that the file of an
+// edit_file step had before the step edited it. The contents are
+// only held in memory, so they cannot be restored by a cleanup
+// that runs after TTPForge has exited.
+type restoreEditAction struct {
+	actionDefaults
+	step *EditStep
+}
+
+// IsNil is not needed here, as this is not a user-accessible step type
+func (a *restoreEditAction) IsNil() bool {
+	return false
+}
+
+// Validate is not needed here, as this is not a user-accessible step type
+func (a *restoreEditAction) Validate(_ TTPExecutionContext) error {
+	return nil
+}
+
+// Execute writes the original contents back to the file
+func (a *restoreEditAction) Execute(_ context.Context, execCtx TTPExecutionContext) (*ActResult, error) {
+	original := a.step.original
+	if original == nil {
+		return nil, fmt.Errorf("the original contents of %v were not recorded, so they cannot be restored - set 'backup_file:' to restore the file after TTPForge has exited", a.step.FileToEdit)
+	}
+	logging.L().Infof("Restoring original contents of %v", original.path)
+	fsys := execCtx.fileSystem(a.step.FileSystem)
+	if err := afero.WriteFile(fsys, original.path, original.contents, 0644); err != nil {
+		return nil, fmt.Errorf("could not restore %v: %w", original.path, err)
+	}
+	return &ActResult{}, nil
+}
+
+// CanRunOnTarget enables this action to restore files on a remote target
+func (a *restoreEditAction) CanRunOnTarget() bool {
+	return true
+}
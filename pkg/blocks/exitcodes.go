@@ -0,0 +1,72 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+
+	"github.com/facebookincubator/ttpforge/pkg/targets"
+	"gopkg.in/yaml.v3"
+)
+
+// ExitCodes lists the exit codes that a command is expected to
+// exit with. In YAML, it can be specified either as a single
+// exit code or as a list of exit codes.
+type ExitCodes []int
+
+// UnmarshalYAML accepts either a single exit code or a list of exit codes
+func (e *ExitCodes) UnmarshalYAML(node *yaml.Node) error {
+	var single int
+	if err := node.Decode(&single); err == nil {
+		*e = ExitCodes{single}
+		return nil
+	}
+	var list []int
+	if err := node.Decode(&list); err != nil {
+		return fmt.Errorf("expect_exit_code must be an integer or a list of integers")
+	}
+	*e = list
+	return nil
+}
+
+// Check verifies the outcome of a command against the expected exit codes.
+// If no exit codes are expected, the command must succeed as usual.
+// Otherwise, the command succeeds if and only if it exited with one of the
+// expected exit codes - a command that could not be started or that was
+// stopped because ctx expired always fails.
+func (e ExitCodes) Check(ctx context.Context, result *ActResult, err error) error {
+	if len(e) == 0 || result == nil || ctx.Err() != nil {
+		return err
+	}
+	var exitErr *exec.ExitError
+	var remoteExitErr *targets.ExitError
+	if err != nil && !errors.As(err, &exitErr) && !errors.As(err, &remoteExitErr) {
+		return err
+	}
+	for _, code := range e {
+		if result.ExitCode == code {
+			return nil
+		}
+	}
+	return fmt.Errorf("command exited with code %d but expected one of %v", result.ExitCode, []int(e))
+}
@@ -24,21 +24,28 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"time"
 
 	"github.com/Netflix/go-expect"
 	"github.com/facebookincubator/ttpforge/pkg/logging"
 	"github.com/facebookincubator/ttpforge/pkg/outputs"
+	"github.com/facebookincubator/ttpforge/pkg/targets"
 )
 
+// DefaultExpectTimeout is the default amount of time that an expect step
+// waits for each prompt, and the default timeout for the whole step
+const DefaultExpectTimeout = 120 * time.Second
+
 // ExpectStep represents an expect command.
 //
 // **Attributes:**
 //
 // Chdir: Directory to change to before executing the command.
 // Responses: List of expected prompts and responses.
-// Timeout: Timeout duration for the expect command.
+// Timeout: How long to wait for each prompt (and, as for every step,
+// the maximum amount of time that the whole step may run for).
 // Executor: Shell to use for executing the command.
 // Environment: Environment variables for the command.
 // Inline: Inline script to execute.
@@ -47,7 +54,7 @@ import (
 type ExpectStep struct {
 	actionDefaults `yaml:",inline"`
 	Chdir          string                  `yaml:"chdir,omitempty"`
-	Timeout        int                     `yaml:"timeout,omitempty"`
+	Timeout        Duration                `yaml:"timeout,omitempty"`
 	Executor       string                  `yaml:"executor,omitempty"`
 	Expect         *ExpectSpec             `yaml:"expect,omitempty"`
 	Environment    map[string]string       `yaml:"env,omitempty"`
@@ -105,7 +112,7 @@ func (s *ExpectStep) IsNil() bool {
 // **Returns:**
 //
 // error: An error if validation fails.
-func (s *ExpectStep) Validate(_ TTPExecutionContext) error {
+func (s *ExpectStep) Validate(execCtx TTPExecutionContext) error {
 	if s.Expect == nil {
 		return fmt.Errorf("expectStep is nil")
 	}
@@ -120,6 +127,11 @@ func (s *ExpectStep) Validate(_ TTPExecutionContext) error {
 		s.Executor = "bash"
 	}
 
+	// the executors of steps that run on a
+	// remote target are installed on the target
+	if execCtx.onTarget() {
+		return nil
+	}
 	if _, err := exec.LookPath(s.Executor); err != nil {
 		return fmt.Errorf("executor not found: %w", err)
 	}
@@ -138,29 +150,14 @@ func (s *ExpectStep) Validate(_ TTPExecutionContext) error {
 //
 // *ActResult: A pointer to the action result.
 // error: An error if execution fails.
-func (s *ExpectStep) Execute(execCtx TTPExecutionContext) (*ActResult, error) {
+func (s *ExpectStep) Execute(ctx context.Context, execCtx TTPExecutionContext) (*ActResult, error) {
 	if s == nil || s.Expect == nil {
 		return nil, fmt.Errorf("expect block must be provided")
 	}
 
-	originalDir, err := os.Getwd()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get current directory: %w", err)
-	}
 	if err := s.Validate(execCtx); err != nil {
 		return nil, err
 	}
-	defer func() {
-		if err := os.Chdir(originalDir); err != nil {
-			fmt.Printf("failed to change back to original directory: %v\n", err)
-		}
-	}()
-
-	if s.Chdir != "" {
-		if err := os.Chdir(s.Chdir); err != nil {
-			return nil, fmt.Errorf("failed to change directory: %w", err)
-		}
-	}
 
 	console, err := expect.NewConsole(expect.WithStdout(os.Stdout), expect.WithStdin(os.Stdin))
 	if err != nil {
@@ -168,20 +165,13 @@ func (s *ExpectStep) Execute(execCtx TTPExecutionContext) (*ActResult, error) {
 	}
 	defer console.Close()
 
-	if s.Environment != nil {
-		for k, v := range s.Environment {
-			if err := os.Setenv(k, v); err != nil {
-				return nil, fmt.Errorf("failed to set environment variable: %w", err)
-			}
-		}
+	ctx, cancel := processContext(ctx, DefaultExpectTimeout)
+	defer cancel()
+	cmd, err := s.prepareProcess(ctx, execCtx, console.Tty())
+	if err != nil {
+		return nil, err
 	}
 
-	envAsList := os.Environ()
-	cmd := s.prepareCommand(context.Background(), execCtx, envAsList, s.Expect.Inline)
-	cmd.Stdin = console.Tty()
-	cmd.Stdout = console.Tty()
-	cmd.Stderr = console.Tty()
-
 	if err := cmd.Start(); err != nil {
 		return nil, fmt.Errorf("failed to start command: %w", err)
 	}
@@ -192,11 +182,11 @@ func (s *ExpectStep) Execute(execCtx TTPExecutionContext) (*ActResult, error) {
 		for _, response := range s.Expect.Responses {
 			logging.L().Debugf("Waiting for prompt: %s\n", response.Prompt)
 			re := regexp.MustCompile(response.Prompt)
-			timeout := 120 // Default timeout is 120 seconds
+			timeout := DefaultExpectTimeout
 			if s.Timeout > 0 {
-				timeout = s.Timeout // Use the provided timeout if it is greater than 0
+				timeout = time.Duration(s.Timeout) // Use the provided timeout if it is greater than 0
 			}
-			matched, err := console.Expect(expect.Regexp(re), expect.WithTimeout(time.Duration(timeout)*time.Second))
+			matched, err := console.Expect(expect.Regexp(re), expect.WithTimeout(timeout))
 			if err != nil {
 				done <- fmt.Errorf("failed to expect %q: %w", re, err)
 				return
@@ -228,8 +218,8 @@ func (s *ExpectStep) Execute(execCtx TTPExecutionContext) (*ActResult, error) {
 		if err != nil {
 			return nil, err
 		}
-	case <-time.After(120 * time.Second):
-		return nil, fmt.Errorf("command timed out")
+	case <-ctx.Done():
+		return nil, fmt.Errorf("command timed out: %w", ctx.Err())
 	}
 
 	if _, err := console.ExpectEOF(); err != nil {
@@ -239,6 +229,72 @@ func (s *ExpectStep) Execute(execCtx TTPExecutionContext) (*ActResult, error) {
 	return &ActResult{}, nil
 }
 
+// process is a command that runs either locally or on a remote target
+type process interface {
+	Start() error
+	Wait() error
+}
+
+// prepareProcess prepares the command to be executed
+// locally or on the remote target of the step.
+//
+// **Parameters:**
+//
+// ctx: Context for the command execution.
+// execCtx: Execution context containing environment variables and working
+// directory.
+// tty: The terminal to which the command is attached.
+//
+// **Returns:**
+//
+// process: The prepared command.
+// error: An error if the command could not be prepared.
+func (s *ExpectStep) prepareProcess(ctx context.Context, execCtx TTPExecutionContext, tty *os.File) (process, error) {
+	if execCtx.onTarget() {
+		conn, err := execCtx.connection()
+		if err != nil {
+			return nil, err
+		}
+		env, err := execCtx.targetEnv(s.Environment)
+		if err != nil {
+			return nil, err
+		}
+		cmd := conn.CommandContext(ctx, s.Executor, "-c", s.Expect.Inline)
+		cmd.Dir = s.Chdir
+		cmd.Env = env
+		cmd.PTY = true
+		remoteTTY, err := os.OpenFile(tty.Name(), os.O_RDWR, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open terminal: %w", err)
+		}
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = remoteTTY, remoteTTY, remoteTTY
+		return &remoteProcess{Cmd: cmd, tty: remoteTTY}, nil
+	}
+
+	envAsList, err := execCtx.commandEnv(s.Environment)
+	if err != nil {
+		return nil, err
+	}
+	cmd := s.prepareCommand(ctx, execCtx, envAsList, s.Expect.Inline)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, tty
+	return cmd, nil
+}
+
+// remoteProcess is an expect command that runs on a remote target.
+// It relays its own handle of the terminal, which the step closes
+// once all responses have been sent - before the remote command
+// may have read the last of them.
+type remoteProcess struct {
+	*targets.Cmd
+	tty *os.File
+}
+
+// Wait waits for the remote command to exit and then releases the terminal
+func (p *remoteProcess) Wait() error {
+	defer p.tty.Close()
+	return p.Cmd.Wait()
+}
+
 // prepareCommand prepares the command to be executed.
 //
 // **Parameters:**
@@ -255,8 +311,17 @@ func (s *ExpectStep) Execute(execCtx TTPExecutionContext) (*ActResult, error) {
 func (s *ExpectStep) prepareCommand(ctx context.Context, execCtx TTPExecutionContext, envAsList []string, inline string) *exec.Cmd {
 	/* #nosec G204 */
 	cmd := exec.CommandContext(ctx, s.Executor, "-c", inline)
+	configureProcessTree(cmd)
 	cmd.Env = envAsList
+	// the command runs in chdir rather than changing the directory
+	// of TTPForge itself, which is shared by concurrent steps
 	cmd.Dir = execCtx.Vars.WorkDir
+	if s.Chdir != "" {
+		cmd.Dir = s.Chdir
+		if !filepath.IsAbs(s.Chdir) && execCtx.Vars.WorkDir != "" {
+			cmd.Dir = filepath.Join(execCtx.Vars.WorkDir, s.Chdir)
+		}
+	}
 
 	return cmd
 }
@@ -270,3 +335,12 @@ func (s *ExpectStep) prepareCommand(ctx context.Context, execCtx TTPExecutionCon
 func (s *ExpectStep) CanBeUsedInCompositeAction() bool {
 	return true
 }
+
+// CanRunOnTarget enables this action to run on a remote target.
+//
+// **Returns:**
+//
+// bool: True if the action can run on a remote target.
+func (s *ExpectStep) CanRunOnTarget() bool {
+	return true
+}
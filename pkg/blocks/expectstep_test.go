@@ -432,7 +432,7 @@ steps:
 					console.Tty().Close() // Close the tcY to signal EOF
 				}()
 
-				_, err = expectStep.Execute(execCtx)
+				_, err = expectStep.Execute(context.Background(), execCtx)
 				require.NoError(t, err)
 				<-done
 
@@ -477,7 +477,7 @@ steps:
 					console.Tty().Close() // Close the tcY to signal EOF
 				}()
 
-				_, err = expectStep.Execute(execCtx)
+				_, err = expectStep.Execute(context.Background(), execCtx)
 				require.NoError(t, err)
 				<-done
 
@@ -642,3 +642,44 @@ func TestCanBeUsedInCompositeAction(t *testing.T) {
 		t.Errorf("Expected CanBeUsedInCompositeAction to return true, got false")
 	}
 }
+
+func TestExpectStepCommandDir(t *testing.T) {
+	testCases := []struct {
+		name        string
+		chdir       string
+		expectedDir string
+	}{
+		{
+			name:        "Defaults To Working Directory",
+			expectedDir: "/work",
+		},
+		{
+			name:        "Absolute Chdir",
+			chdir:       "/tmp",
+			expectedDir: "/tmp",
+		},
+		{
+			name:        "Relative Chdir",
+			chdir:       "sub/dir",
+			expectedDir: "/work/sub/dir",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			origDir, err := os.Getwd()
+			require.NoError(t, err)
+			s := &ExpectStep{Executor: "bash", Chdir: tc.chdir}
+			execCtx := NewTTPExecutionContext()
+			execCtx.Vars.WorkDir = "/work"
+			cmd := s.prepareCommand(context.Background(), execCtx, nil, "true")
+			assert.Equal(t, tc.expectedDir, cmd.Dir)
+
+			// the directory of TTPForge itself is never changed, as
+			// it is shared by concurrent steps of parallel groups
+			currentDir, err := os.Getwd()
+			require.NoError(t, err)
+			assert.Equal(t, origDir, currentDir)
+		})
+	}
+}
@@ -20,6 +20,7 @@ THE SOFTWARE.
 package blocks
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -27,6 +28,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 
 	"github.com/facebookincubator/ttpforge/pkg/logging"
 	"github.com/spf13/afero"
@@ -81,6 +83,13 @@ func (f *FetchURIStep) Validate(execCtx TTPExecutionContext) error {
 		return err
 	}
 
+	if f.Retries != "" {
+		retries, err := strconv.Atoi(f.Retries)
+		if err != nil || retries < 0 {
+			return fmt.Errorf("invalid value for retries: %q - must be a non-negative integer", f.Retries)
+		}
+	}
+
 	if f.Proxy != "" {
 		uri, err := url.Parse(f.Proxy)
 		if err != nil {
@@ -106,7 +115,7 @@ func (f *FetchURIStep) Validate(execCtx TTPExecutionContext) error {
 }
 
 // Execute runs the step and returns an error if one occurs.
-func (f *FetchURIStep) Execute(execCtx TTPExecutionContext) (*ActResult, error) {
+func (f *FetchURIStep) Execute(ctx context.Context, execCtx TTPExecutionContext) (*ActResult, error) {
 	logging.L().Info("========= Executing ==========")
 
 	if err := f.fetchURI(execCtx); err != nil {
@@ -123,7 +132,7 @@ func (f *FetchURIStep) Execute(execCtx TTPExecutionContext) (*ActResult, error)
 // Assumes that the type is the cleanup step and is invoked by
 // f.CleanupStep.Cleanup.
 func (f *FetchURIStep) Cleanup(execCtx TTPExecutionContext) (*ActResult, error) {
-	return f.Execute(execCtx)
+	return f.Execute(context.Background(), execCtx)
 }
 
 // fetchURI executes the FetchURIStep with the specified Location, Uri, and additional arguments,
@@ -174,6 +183,11 @@ func (f *FetchURIStep) fetchURI(execCtx TTPExecutionContext) error {
 
 	_, err = io.Copy(fHandle, resp.Body)
 	if err != nil {
+		// don't leave a partial download behind,
+		// as it would prevent the step from being retried
+		if removeErr := appFs.Remove(absLocal); removeErr != nil {
+			logging.L().Warnw("could not remove partial download", "location", absLocal, zap.Error(removeErr))
+		}
 		return err
 	}
 
@@ -20,6 +20,7 @@ THE SOFTWARE.
 package blocks
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -173,6 +174,32 @@ steps:
 `,
 			wantError: false,
 		},
+		{
+			name: "retries fetch",
+			content: `
+name: test
+description: this is a test
+steps:
+  - name: retries_fetch
+    fetch_uri: http://someuri.com
+    location: ./location
+    retries: 3
+`,
+			wantError: false,
+		},
+		{
+			name: "invalid retries",
+			content: `
+name: test
+description: this is a test
+steps:
+  - name: bad_retries
+    fetch_uri: http://someuri.com
+    location: ./location
+    retries: many
+`,
+			wantError: true,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -223,7 +250,7 @@ overwrite: true
 	require.NoError(t, err)
 
 	// execute and check result
-	_, err = s.Execute(execCtx)
+	_, err = s.Execute(context.Background(), execCtx)
 	require.NoError(t, err)
 
 	f, err := os.Stat(s.Location)
@@ -22,7 +22,6 @@ package blocks
 import (
 	"context"
 	"errors"
-	"os/exec"
 
 	"github.com/facebookincubator/ttpforge/pkg/logging"
 	"github.com/facebookincubator/ttpforge/pkg/outputs"
@@ -38,6 +37,7 @@ type FileStep struct {
 	Environment    map[string]string       `yaml:"env,omitempty"`
 	Outputs        map[string]outputs.Spec `yaml:"outputs,omitempty"`
 	Args           []string                `yaml:"args,omitempty,flow"`
+	ExpectExitCode ExitCodes               `yaml:"expect_exit_code,omitempty,flow"`
 }
 
 // NewFileStep creates a new FileStep instance and returns a pointer to it.
@@ -89,32 +89,26 @@ func (f *FileStep) Validate(execCtx TTPExecutionContext) error {
 
 	// Infer executor if it's not set.
 	if f.Executor == "" {
-		f.Executor = InferExecutor(f.FilePath)
+		f.Executor = inferExecutor(execCtx.Cfg.Executors, f.FilePath)
 		logging.L().Debugw("executor set via extension", "exec", f.Executor)
 	}
 
-	if f.Executor == ExecutorBinary {
-		return nil
-	}
-
-	if _, err := exec.LookPath(f.Executor); err != nil {
+	if err := validateExecutor(execCtx, f.Executor); err != nil {
 		logging.L().Error(zap.Error(err))
 		return err
 	}
-	logging.L().Debugw("command found in path", "executor", f.Executor)
-
 	return nil
 }
 
 // Execute runs the step and returns an error if one occurs.
-func (f *FileStep) Execute(execCtx TTPExecutionContext) (*ActResult, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), DefaultExecutionTimeout)
+func (f *FileStep) Execute(ctx context.Context, execCtx TTPExecutionContext) (*ActResult, error) {
+	ctx, cancel := processContext(ctx, DefaultExecutionTimeout)
 	defer cancel()
 
 	executor := NewExecutor(f.Executor, "", f.FilePath, f.Args, f.Environment)
 	result, err := executor.Execute(ctx, execCtx)
-	if err != nil {
-		return nil, err
+	if err = f.ExpectExitCode.Check(ctx, result, err); err != nil {
+		return result, err
 	}
 	result.Outputs, err = outputs.Parse(f.Outputs, result.Stdout)
 	return result, err
@@ -125,5 +119,10 @@ func (f *FileStep) Execute(execCtx TTPExecutionContext) (*ActResult, error) {
 // f.CleanupStep.Cleanup.
 func (f *FileStep) Cleanup(execCtx TTPExecutionContext) (*ActResult, error) {
 	// TODO: why call Execute on a cleanup??
-	return f.Execute(execCtx)
+	return f.Execute(context.Background(), execCtx)
+}
+
+// CanRunOnTarget enables this action to run on a remote target
+func (f *FileStep) CanRunOnTarget() bool {
+	return true
 }
@@ -0,0 +1,427 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/facebookincubator/ttpforge/pkg/logging"
+	"github.com/facebookincubator/ttpforge/pkg/targets"
+	"github.com/spf13/afero"
+)
+
+// DefaultFleetConcurrency is the default number of
+// hosts on which a fleet run executes its TTP at once
+const DefaultFleetConcurrency = 5
+
+// FleetRun runs one TTP on many hosts of an inventory. Every host gets
+// a run of its own - with its own run ID, cleanup journal and step
+// results - whose steps run on that host, as with `ttpforge run --target`.
+type FleetRun struct {
+	// TTPPath and Fs locate the TTP, as for LoadTTP
+	TTPPath string
+	Fs      afero.Fs
+	// Cfg is the configuration shared by the runs of all hosts
+	Cfg TTPExecutionConfig
+	// Args are name=value arguments for all hosts,
+	// which override the arguments of the inventory
+	Args  []string
+	Hosts []targets.Host
+	// Concurrency bounds how many hosts run the TTP at once.
+	// Default: DefaultFleetConcurrency
+	Concurrency int
+	// StateDir is the directory in which the cleanup journals of
+	// the runs are recorded - no journals are recorded if it is empty
+	StateDir string
+}
+
+// HostRun records the run of a TTP on one host of a FleetRun
+type HostRun struct {
+	Host targets.Host
+	// TTP and ExecCtx are nil if the TTP could not be loaded for the host
+	TTP        *TTP
+	ExecCtx    *TTPExecutionContext
+	StartTime  time.Time
+	EndTime    time.Time
+	Err        error
+	CleanupErr error
+}
+
+// FleetSummary aggregates the runs of a FleetRun, in the order of its hosts
+type FleetSummary struct {
+	Runs []*HostRun
+}
+
+// Run runs the TTP on all hosts and waits for every run (including
+// its cleanup) to finish. A shutdown signal stops the runs of all
+// hosts, and hosts that have not started yet are not run at all.
+func (f *FleetRun) Run(ctx context.Context) *FleetSummary {
+	concurrency := f.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultFleetConcurrency
+	}
+
+	// the working directory belongs to the whole process, so the TTPs
+	// of the hosts do not change it themselves - it is changed once
+	// into the directory of the TTP, and restored once at the end
+	if changeBack, err := f.chdir(); err != nil {
+		logging.L().Warnf("could not change into the directory of the TTP: %v", err)
+	} else {
+		defer changeBack()
+	}
+
+	// the runs of all hosts share the output writers
+	stdout, stderr := newSyncWriter(f.Cfg.Stdout), newSyncWriter(f.Cfg.Stderr)
+	shutdown := newShutdownBroadcast(SetupSignalHandler(), len(f.Hosts))
+	defer shutdown.stop()
+
+	summary := &FleetSummary{Runs: make([]*HostRun, len(f.Hosts))}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for idx, host := range f.Hosts {
+		run := &HostRun{Host: host}
+		summary.Runs[idx] = run
+		sem <- struct{}{}
+		if shutdown.received() {
+			<-sem
+			run.Err = fmt.Errorf("not run: %w", ErrCancelled)
+			continue
+		}
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			f.runHost(ctx, run, stdout, stderr, shutdown.channels[idx])
+		}(idx)
+	}
+	wg.Wait()
+	return summary
+}
+
+// chdir changes into the working directory of the TTP and
+// returns a function that restores the original directory
+func (f *FleetRun) chdir() (func(), error) {
+	workDir, err := ttpWorkDir(f.TTPPath, f.Fs)
+	if err != nil {
+		return nil, err
+	}
+	origDir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chdir(workDir); err != nil {
+		return nil, err
+	}
+	return func() {
+		if err := os.Chdir(origDir); err != nil {
+			logging.L().Errorf("could not restore original directory %v: %v", origDir, err)
+		}
+	}, nil
+}
+
+// runHost loads the TTP for the host of run and executes it
+func (f *FleetRun) runHost(ctx context.Context, run *HostRun, stdout, stderr io.Writer, shutdownChan chan bool) {
+	host := run.Host
+	cfg := f.Cfg
+	cfg.RunID = ""
+	cfg.Target = &host.Target
+	cfg.sharedWorkDir = true
+	hostStdout, flushStdout := hostOutput(host.Name, "[STDOUT] ", stdout)
+	hostStderr, flushStderr := hostOutput(host.Name, "[STDERR] ", stderr)
+	defer flushStdout()
+	defer flushStderr()
+	cfg.Stdout, cfg.Stderr = hostStdout, hostStderr
+
+	argsList := append(host.ArgsList(), f.Args...)
+	ttp, execCtx, err := LoadTTP(f.TTPPath, f.Fs, &cfg, argsList)
+	if err != nil {
+		run.Err = fmt.Errorf("could not load TTP: %w", err)
+		logging.L().Errorf("[%v] %v", host.Name, run.Err)
+		return
+	}
+	execCtx.shutdownChan = shutdownChan
+	run.TTP, run.ExecCtx = ttp, execCtx
+	if cfg.DryRun {
+		return
+	}
+
+	logging.L().Infof("[%v] Run ID: %v", host.Name, execCtx.Cfg.RunID)
+	if f.StateDir != "" {
+		if err := execCtx.EnableCleanupJournal(ttp, f.StateDir); err != nil {
+			run.Err = fmt.Errorf("failed to create cleanup journal: %w", err)
+			return
+		}
+	}
+
+	run.StartTime = time.Now()
+	run.Err = ttp.Execute(ctx, *execCtx)
+	run.CleanupErr = ttp.RunCleanup(*execCtx)
+	run.EndTime = time.Now()
+	if run.Err != nil {
+		logging.L().Errorf("[%v] TTP failed: %v", host.Name, run.Err)
+	}
+	if run.CleanupErr != nil {
+		logging.L().Warnf("[%v] Failed to run cleanup: %v", host.Name, run.CleanupErr)
+	}
+}
+
+// StepResults returns the results of the steps
+// that ran on the host, or nil if none did
+func (r *HostRun) StepResults() *StepResultsRecord {
+	if r.ExecCtx == nil {
+		return nil
+	}
+	return r.ExecCtx.StepResults
+}
+
+// Succeeded reports whether the TTP ran successfully on the host
+func (r *HostRun) Succeeded() bool {
+	return r.Err == nil
+}
+
+// StepCounts counts the top-level steps that ran on the host by status
+func (r *HostRun) StepCounts() map[StepStatus]int {
+	counts := make(map[StepStatus]int)
+	if results := r.StepResults(); results != nil {
+		for _, result := range results.ByIndex {
+			counts[result.Status]++
+		}
+	}
+	return counts
+}
+
+// Report builds the report of the run on the host
+func (r *HostRun) Report() *RunReport {
+	var report *RunReport
+	if r.TTP == nil {
+		report = &RunReport{Status: StepSucceeded}
+	} else {
+		report = NewRunReport(r.TTP, *r.ExecCtx)
+	}
+	report.StartTime = r.StartTime
+	report.EndTime = r.EndTime
+	report.SetErrors(r.Err, r.CleanupErr)
+	return report
+}
+
+// FailedHosts returns the names of the hosts on which the TTP failed
+func (s *FleetSummary) FailedHosts() []string {
+	var failed []string
+	for _, run := range s.Runs {
+		if !run.Succeeded() {
+			failed = append(failed, run.Host.Name)
+		}
+	}
+	return failed
+}
+
+// StepCounts counts the top-level steps of all hosts by status
+func (s *FleetSummary) StepCounts() map[StepStatus]int {
+	counts := make(map[StepStatus]int)
+	for _, run := range s.Runs {
+		for status, count := range run.StepCounts() {
+			counts[status] += count
+		}
+	}
+	return counts
+}
+
+// Log logs the outcome of the run on every host,
+// followed by the number of hosts that succeeded
+func (s *FleetSummary) Log() {
+	logging.DividerThin()
+	logging.L().Info("Summary of runs on all hosts:")
+	for _, run := range s.Runs {
+		counts := formatStepCounts(run.StepCounts())
+		if run.Succeeded() {
+			logging.L().Infof("  %v: succeeded (%v)", run.Host.Name, counts)
+		} else {
+			logging.L().Errorf("  %v: failed (%v): %v", run.Host.Name, counts, run.Err)
+		}
+	}
+	succeeded := len(s.Runs) - len(s.FailedHosts())
+	logging.L().Infof("TTP succeeded on %d of %d hosts", succeeded, len(s.Runs))
+}
+
+// formatStepCounts formats step counts as "2 succeeded, 1 skipped"
+func formatStepCounts(counts map[StepStatus]int) string {
+	if len(counts) == 0 {
+		return "no steps ran"
+	}
+	var parts []string
+	for status, count := range counts {
+		parts = append(parts, fmt.Sprintf("%d %v", count, status))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+// FleetReport is a machine-readable record of a fleet run, as
+// written by `ttpforge run --inventory ... --report`
+type FleetReport struct {
+	Status         StepStatus         `json:"status"`
+	HostsSucceeded int                `json:"hosts_succeeded"`
+	HostsFailed    int                `json:"hosts_failed"`
+	Steps          map[StepStatus]int `json:"steps"`
+	Hosts          []HostReport       `json:"hosts"`
+}
+
+// HostReport records the run on one host of a fleet run
+type HostReport struct {
+	Host    string     `json:"host"`
+	Address string     `json:"address"`
+	Run     *RunReport `json:"run"`
+}
+
+// Report builds the report of the fleet run. It should be
+// called once the runs of all hosts have finished.
+func (s *FleetSummary) Report() *FleetReport {
+	report := &FleetReport{
+		Status:      StepSucceeded,
+		HostsFailed: len(s.FailedHosts()),
+		Steps:       s.StepCounts(),
+	}
+	report.HostsSucceeded = len(s.Runs) - report.HostsFailed
+	if report.HostsFailed > 0 {
+		report.Status = StepFailed
+	}
+	for _, run := range s.Runs {
+		report.Hosts = append(report.Hosts, HostReport{
+			Host:    run.Host.Name,
+			Address: run.Host.Address(),
+			Run:     run.Report(),
+		})
+	}
+	return report
+}
+
+// WriteFile writes the report to the specified path as indented JSON
+func (r *FleetReport) WriteFile(path string) error {
+	return writeJSONFile(path, r)
+}
+
+// hostOutput returns the writer for one output stream of the run on a host,
+// which prefixes every line with the name of the host so that the output
+// of concurrent runs can be told apart, along with a function that writes
+// out any incomplete last line. If w is nil, the lines are logged instead.
+func hostOutput(hostName, stream string, w io.Writer) (io.Writer, func()) {
+	prefix := "[" + hostName + "] "
+	if w == nil {
+		w = &zapWriter{prefix: prefix + stream}
+		prefix = ""
+	}
+	pw := &prefixWriter{prefix: prefix, w: w}
+	return pw, pw.flush
+}
+
+// prefixWriter writes whole lines to w, each preceded by prefix
+type prefixWriter struct {
+	prefix string
+	w      io.Writer
+	mu     sync.Mutex
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.buf = append(p.buf, b...)
+	for {
+		idx := bytes.IndexByte(p.buf, '\n')
+		if idx < 0 {
+			return len(b), nil
+		}
+		line := append([]byte(p.prefix), p.buf[:idx+1]...)
+		p.buf = p.buf[idx+1:]
+		if _, err := p.w.Write(line); err != nil {
+			return 0, err
+		}
+	}
+}
+
+func (p *prefixWriter) flush() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.buf) == 0 {
+		return
+	}
+	line := append([]byte(p.prefix), p.buf...)
+	p.buf = nil
+	if _, err := p.w.Write(append(line, '\n')); err != nil {
+		logging.L().Warnf("failed to write output: %v", err)
+	}
+}
+
+// shutdownBroadcast relays shutdown signals to the runs of all hosts,
+// since each signal is otherwise only received by one of them
+type shutdownBroadcast struct {
+	channels []chan bool
+	done     chan struct{}
+	mu       sync.Mutex
+	shutdown bool
+}
+
+func newShutdownBroadcast(signals chan bool, numRuns int) *shutdownBroadcast {
+	b := &shutdownBroadcast{
+		channels: make([]chan bool, numRuns),
+		done:     make(chan struct{}),
+	}
+	for idx := range b.channels {
+		b.channels[idx] = make(chan bool, 1)
+	}
+	go func() {
+		for {
+			select {
+			case <-signals:
+				b.mu.Lock()
+				b.shutdown = true
+				b.mu.Unlock()
+				for _, ch := range b.channels {
+					select {
+					case ch <- true:
+					default:
+					}
+				}
+			case <-b.done:
+				return
+			}
+		}
+	}()
+	return b
+}
+
+// received reports whether a shutdown signal was received
+func (b *shutdownBroadcast) received() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.shutdown
+}
+
+func (b *shutdownBroadcast) stop() {
+	close(b.done)
+}
@@ -0,0 +1,97 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/facebookincubator/ttpforge/pkg/targets"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostOutput(t *testing.T) {
+	var buf bytes.Buffer
+	w, flush := hostOutput("web01", "[STDOUT] ", &buf)
+
+	_, err := w.Write([]byte("first line\nsecond "))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("line\nincomplete"))
+	require.NoError(t, err)
+	assert.Equal(t, "[web01] first line\n[web01] second line\n", buf.String())
+
+	flush()
+	assert.Equal(t, "[web01] first line\n[web01] second line\n[web01] incomplete\n", buf.String())
+	flush()
+	assert.Equal(t, "[web01] first line\n[web01] second line\n[web01] incomplete\n", buf.String())
+}
+
+func TestFleetSummary(t *testing.T) {
+	newResults := func(statuses ...StepStatus) *TTPExecutionContext {
+		execCtx := NewTTPExecutionContext()
+		for idx, status := range statuses {
+			result := &ExecutionResult{Status: status}
+			execCtx.StepResults.ByName[fmt.Sprintf("step%d", idx)] = result
+			execCtx.StepResults.ByIndex = append(execCtx.StepResults.ByIndex, result)
+		}
+		return &execCtx
+	}
+	ttp := &TTP{PreambleFields: PreambleFields{Name: "fleet"}}
+	summary := FleetSummary{
+		Runs: []*HostRun{
+			{
+				Host:    targets.Host{Target: targets.Target{Name: "web01", Host: "10.0.0.1"}},
+				TTP:     ttp,
+				ExecCtx: newResults(StepSucceeded, StepSkipped),
+			},
+			{
+				Host:    targets.Host{Target: targets.Target{Name: "web02", Host: "10.0.0.2:2222"}},
+				TTP:     ttp,
+				ExecCtx: newResults(StepSucceeded, StepFailed),
+				Err:     fmt.Errorf("step failed"),
+			},
+			{
+				Host: targets.Host{Target: targets.Target{Name: "web03", Host: "10.0.0.3"}},
+				Err:  fmt.Errorf("could not load TTP"),
+			},
+		},
+	}
+
+	assert.Equal(t, []string{"web02", "web03"}, summary.FailedHosts())
+	assert.Equal(t, map[StepStatus]int{StepSucceeded: 2, StepSkipped: 1, StepFailed: 1}, summary.StepCounts())
+	assert.Equal(t, "1 skipped, 1 succeeded", formatStepCounts(summary.Runs[0].StepCounts()))
+	assert.Equal(t, "no steps ran", formatStepCounts(summary.Runs[2].StepCounts()))
+
+	report := summary.Report()
+	assert.Equal(t, StepFailed, report.Status)
+	assert.Equal(t, 1, report.HostsSucceeded)
+	assert.Equal(t, 2, report.HostsFailed)
+	require.Len(t, report.Hosts, 3)
+	assert.Equal(t, "web01", report.Hosts[0].Host)
+	assert.Equal(t, "10.0.0.1:22", report.Hosts[0].Address)
+	assert.Equal(t, StepSucceeded, report.Hosts[0].Run.Status)
+	assert.Equal(t, "fleet", report.Hosts[0].Run.TTP.Name)
+	assert.Equal(t, StepFailed, report.Hosts[1].Run.Status)
+	assert.Equal(t, "step failed", report.Hosts[1].Run.Error)
+	assert.Equal(t, StepFailed, report.Hosts[2].Run.Status)
+	assert.Empty(t, report.Hosts[2].Run.Steps)
+}
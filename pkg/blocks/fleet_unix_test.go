@@ -0,0 +1,298 @@
+//go:build !windows
+// +build !windows
+
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/ttpforge/pkg/targets"
+	"github.com/facebookincubator/ttpforge/pkg/testutils"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFleetRun(t *testing.T) {
+	server := testutils.StartSSHServer(t)
+	newHost := func(name, addr, greeting string) targets.Host {
+		return targets.Host{
+			Target: targets.Target{
+				Name:       name,
+				Host:       addr,
+				User:       server.User,
+				KeyFile:    server.KeyFile,
+				KnownHosts: server.KnownHosts,
+			},
+			Args: map[string]string{"greeting": greeting, "host_name": name},
+		}
+	}
+	hosts := []targets.Host{
+		newHost("web01", server.Addr, "hello"),
+		newHost("web02", server.Addr, "howdy"),
+		newHost("web03", "127.0.0.1:1", "hi"),
+	}
+
+	testCases := []struct {
+		name                string
+		args                []string
+		dryRun              bool
+		expectedFailedHosts []string
+		expectedStdout      []string
+		expectedStepCounts  map[StepStatus]int
+	}{
+		{
+			name:                "Per-Host Arguments",
+			expectedFailedHosts: []string{"web03"},
+			expectedStdout: []string{
+				"[web01] hello from web01 over ssh\n",
+				"[web02] howdy from web02 over ssh\n",
+				"[web01] cleaned up web01\n",
+				"[web02] cleaned up web02\n",
+			},
+			expectedStepCounts: map[StepStatus]int{StepSucceeded: 4, StepFailed: 1},
+		},
+		{
+			name:                "Arguments Override Inventory",
+			args:                []string{"greeting=bye"},
+			expectedFailedHosts: []string{"web03"},
+			expectedStdout: []string{
+				"[web01] bye from web01 over ssh\n",
+				"[web02] bye from web02 over ssh\n",
+			},
+			expectedStepCounts: map[StepStatus]int{StepSucceeded: 4, StepFailed: 1},
+		},
+		{
+			name:               "Dry Run",
+			dryRun:             true,
+			expectedStepCounts: map[StepStatus]int{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			ttpPath := filepath.Join(tmpDir, "ttp.yaml")
+			content := strings.ReplaceAll(`---
+name: fleet
+args:
+  - name: greeting
+  - name: host_name
+steps:
+  - name: drop
+    create_file: TMPDIR/{{.Args.host_name}}.txt
+    contents: dropped
+    cleanup: default
+  - name: greet
+    inline: |
+      test -n "$SSH_CONNECTION" && echo "{{.Args.greeting}} from {{.Args.host_name}} over ssh"
+    cleanup:
+      print_str: cleaned up {{.Args.host_name}}
+`, "TMPDIR", tmpDir)
+			require.NoError(t, os.WriteFile(ttpPath, []byte(content), 0644))
+
+			var stdoutBuf bytes.Buffer
+			fleet := FleetRun{
+				TTPPath:     ttpPath,
+				Fs:          afero.NewOsFs(),
+				Cfg:         TTPExecutionConfig{Stdout: &stdoutBuf, DryRun: tc.dryRun},
+				Args:        tc.args,
+				Hosts:       hosts,
+				Concurrency: 2,
+			}
+			summary := fleet.Run(context.Background())
+
+			require.Len(t, summary.Runs, len(hosts))
+			for idx, run := range summary.Runs {
+				assert.Equal(t, hosts[idx].Name, run.Host.Name)
+			}
+			assert.Equal(t, tc.expectedFailedHosts, summary.FailedHosts())
+			assert.Equal(t, tc.expectedStepCounts, summary.StepCounts())
+			for _, line := range tc.expectedStdout {
+				assert.Contains(t, stdoutBuf.String(), line)
+			}
+
+			// every host has a run of its own, which was cleaned up
+			runIDs := make(map[string]bool)
+			for _, run := range summary.Runs {
+				require.NotNil(t, run.ExecCtx)
+				runIDs[run.ExecCtx.Cfg.RunID] = true
+				assert.NoFileExists(t, filepath.Join(tmpDir, run.Host.Name+".txt"))
+			}
+			assert.Len(t, runIDs, len(hosts))
+
+			// the reports describe the hosts rather than this machine,
+			// so hosts that could not be reached have no platform
+			for _, run := range summary.Runs {
+				platform := run.Report().Platform
+				if tc.dryRun || !run.Succeeded() {
+					assert.Equal(t, PlatformReport{}, platform)
+					continue
+				}
+				assert.Equal(t, runtime.GOOS, platform.OS)
+				assert.Equal(t, runtime.GOARCH, platform.Arch)
+				assert.NotEmpty(t, platform.Hostname)
+			}
+		})
+	}
+}
+
+func TestFleetRunRelativePaths(t *testing.T) {
+	server := testutils.StartSSHServer(t)
+	ttpDir := filepath.Join(t.TempDir(), "ttps")
+	require.NoError(t, os.MkdirAll(filepath.Join(ttpDir, "scripts"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(ttpDir, "scripts", "hello.sh"), []byte(`#!/bin/sh
+sleep 0.2
+echo "hello from $1"
+`), 0755))
+	ttpPath := filepath.Join(ttpDir, "ttp.yaml")
+	require.NoError(t, os.WriteFile(ttpPath, []byte(`---
+name: fleet
+args:
+  - name: host_name
+steps:
+  - name: hello
+    file: scripts/hello.sh
+    args:
+      - "{{.Args.host_name}}"
+`), 0644))
+
+	var hosts []targets.Host
+	for _, name := range []string{"web01", "web02", "web03", "web04", "web05"} {
+		hosts = append(hosts, targets.Host{
+			Target: targets.Target{
+				Name:       name,
+				Host:       server.Addr,
+				User:       server.User,
+				KeyFile:    server.KeyFile,
+				KnownHosts: server.KnownHosts,
+			},
+			Args: map[string]string{"host_name": name},
+		})
+	}
+
+	origDir, err := os.Getwd()
+	require.NoError(t, err)
+	realTTPDir, err := filepath.EvalSymlinks(ttpDir)
+	require.NoError(t, err)
+
+	// record every change of the working directory during the run -
+	// hosts that finish early must not change it for the others
+	done := make(chan struct{})
+	observed := make(chan []string)
+	go func() {
+		dirs := []string{origDir}
+		record := func() {
+			if dir, err := os.Getwd(); err == nil && dir != dirs[len(dirs)-1] {
+				dirs = append(dirs, dir)
+			}
+		}
+		for {
+			select {
+			case <-done:
+				record()
+				observed <- dirs
+				return
+			case <-time.After(time.Millisecond):
+				record()
+			}
+		}
+	}()
+
+	var stdoutBuf bytes.Buffer
+	fleet := FleetRun{
+		TTPPath:     ttpPath,
+		Fs:          afero.NewOsFs(),
+		Cfg:         TTPExecutionConfig{Stdout: &stdoutBuf},
+		Hosts:       hosts,
+		Concurrency: 2,
+	}
+	summary := fleet.Run(context.Background())
+	close(done)
+	dirs := <-observed
+
+	assert.Empty(t, summary.FailedHosts())
+	for _, host := range hosts {
+		assert.Contains(t, stdoutBuf.String(), "["+host.Name+"] hello from "+host.Name+"\n")
+	}
+	for idx := range dirs {
+		dirs[idx], err = filepath.EvalSymlinks(dirs[idx])
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{origDir, realTTPDir, origDir}, dirs)
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	assert.Equal(t, origDir, cwd)
+}
+
+func TestFleetRunJournals(t *testing.T) {
+	server := testutils.StartSSHServer(t)
+	tmpDir := t.TempDir()
+	ttpPath := filepath.Join(tmpDir, "ttp.yaml")
+	require.NoError(t, os.WriteFile(ttpPath, []byte(`---
+name: fleet
+steps:
+  - name: greet
+    inline: echo hello
+    cleanup:
+      inline: echo goodbye
+`), 0644))
+
+	newHost := func(name string) targets.Host {
+		return targets.Host{Target: targets.Target{
+			Name:       name,
+			Host:       server.Addr,
+			User:       server.User,
+			KeyFile:    server.KeyFile,
+			KnownHosts: server.KnownHosts,
+		}}
+	}
+	stateDir := filepath.Join(tmpDir, "runs")
+	fleet := FleetRun{
+		TTPPath:  ttpPath,
+		Fs:       afero.NewOsFs(),
+		Cfg:      TTPExecutionConfig{NoCleanup: true},
+		Hosts:    []targets.Host{newHost("web01"), newHost("web02")},
+		StateDir: stateDir,
+	}
+	summary := fleet.Run(context.Background())
+	assert.Empty(t, summary.FailedHosts())
+
+	// each host records its own journal, so that
+	// it can be cleaned up on its own target later
+	for _, run := range summary.Runs {
+		journalBytes, err := os.ReadFile(filepath.Join(stateDir, run.ExecCtx.Cfg.RunID, cleanupJournalFileName))
+		require.NoError(t, err)
+		var journal journalFile
+		require.NoError(t, json.Unmarshal(journalBytes, &journal))
+		require.NotNil(t, journal.Target)
+		assert.Equal(t, run.Host.Name, journal.Target.Name)
+	}
+}
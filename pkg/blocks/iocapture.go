@@ -25,6 +25,7 @@ import (
 	"os/exec"
 
 	"github.com/facebookincubator/ttpforge/pkg/logging"
+	"github.com/facebookincubator/ttpforge/pkg/targets"
 )
 
 type zapWriter struct {
@@ -51,7 +52,9 @@ func (z *zapWriter) Write(b []byte) (int, error) {
 	return n, nil
 }
 
-func streamAndCapture(cmd exec.Cmd, stdout, stderr io.Writer) (*ActResult, error) {
+// outputWriters returns the writers to which the output of a command
+// is streamed, defaulting to logging each line of output
+func outputWriters(stdout, stderr io.Writer) (io.Writer, io.Writer) {
 	if stdout == nil {
 		stdout = &zapWriter{
 			prefix: "[STDOUT] ",
@@ -62,21 +65,41 @@ func streamAndCapture(cmd exec.Cmd, stdout, stderr io.Writer) (*ActResult, error
 			prefix: "[STDERR] ",
 		}
 	}
+	return stdout, stderr
+}
 
+func streamAndCapture(cmd *exec.Cmd, stdout, stderr io.Writer) (*ActResult, error) {
+	stdout, stderr = outputWriters(stdout, stderr)
 	var stdoutBuf, stderrBuf bytes.Buffer
 	cmd.Stdout = io.MultiWriter(stdout, &stdoutBuf)
 	cmd.Stderr = io.MultiWriter(stderr, &stderrBuf)
 
+	// the output is kept even if the command fails,
+	// as it often explains why the command failed
 	err := cmd.Run()
-	if err != nil {
-		return nil, err
+	result := ActResult{
+		Stdout:   stdoutBuf.String(),
+		Stderr:   stderrBuf.String(),
+		ExitCode: -1,
 	}
-	outStr, errStr := stdoutBuf.String(), stderrBuf.String()
-	result := ActResult{}
-	result.Stdout = outStr
-	result.Stderr = errStr
-	if err != nil {
-		return nil, err
+	if cmd.ProcessState != nil {
+		result.ExitCode = cmd.ProcessState.ExitCode()
 	}
-	return &result, nil
+	return &result, err
+}
+
+// streamAndCaptureRemote is the equivalent of
+// streamAndCapture for commands that run on a remote target
+func streamAndCaptureRemote(cmd *targets.Cmd, stdout, stderr io.Writer) (*ActResult, error) {
+	stdout, stderr = outputWriters(stdout, stderr)
+	var stdoutBuf, stderrBuf bytes.Buffer
+	cmd.Stdout = io.MultiWriter(stdout, &stdoutBuf)
+	cmd.Stderr = io.MultiWriter(stderr, &stderrBuf)
+
+	err := cmd.Run()
+	return &ActResult{
+		Stdout:   stdoutBuf.String(),
+		Stderr:   stderrBuf.String(),
+		ExitCode: cmd.ExitCode(),
+	}, err
 }
@@ -32,6 +32,7 @@ import (
 	"github.com/facebookincubator/ttpforge/pkg/args"
 	"github.com/facebookincubator/ttpforge/pkg/logging"
 	"github.com/facebookincubator/ttpforge/pkg/preprocess"
+	"github.com/google/uuid"
 	"github.com/spf13/afero"
 	"gopkg.in/yaml.v3"
 )
@@ -80,6 +81,7 @@ func RenderTemplatedTTP(ttpStr string, rp RenderParameters) (*TTP, error) {
 		logging.DividerThin()
 		return nil, err
 	}
+	ttp.definition = result.String()
 	return &ttp, nil
 }
 
@@ -132,28 +134,19 @@ func LoadTTP(ttpFilePath string, fsys afero.Fs, execCfg *TTPExecutionConfig, arg
 		return nil, nil, err
 	}
 
-	// embedded fs has no notion of workdirs
-	// so we should only set workdir to the TTP's directory
-	// if we are using an OsFs
-	switch fsys.(type) {
-	case *afero.OsFs:
-		absPath, err := filepath.Abs(ttpFilePath)
-		if err != nil {
-			return nil, nil, err
-		}
-		ttp.WorkDir = filepath.Dir(absPath)
-	default:
-		wd, err := os.Getwd()
-		if err != nil {
-			return nil, nil, err
-		}
-		ttp.WorkDir = wd
+	ttp.WorkDir, err = ttpWorkDir(ttpFilePath, fsys)
+	if err != nil {
+		return nil, nil, err
 	}
 
 	execCtx := TTPExecutionContext{
 		Cfg: *execCfg,
 		Vars: &TTPExecutionVars{
 			WorkDir: ttp.WorkDir,
+			ttpDir:  ttp.WorkDir,
+			Args:    argValues,
+			TTPName: ttp.Name,
+			TTPUUID: ttp.UUID,
 		},
 		StepResults:       NewStepResultsRecord(),
 		actionResultsChan: make(chan *ActResult, 1),
@@ -161,6 +154,10 @@ func LoadTTP(ttpFilePath string, fsys afero.Fs, execCfg *TTPExecutionConfig, arg
 		shutdownChan:      SetupSignalHandler(),
 	}
 
+	if execCtx.Cfg.RunID == "" {
+		execCtx.Cfg.RunID = uuid.NewString()
+	}
+
 	err = ttp.Validate(execCtx)
 	if err != nil {
 		return nil, nil, err
@@ -186,3 +183,17 @@ func readTTPBytes(ttpFilePath string, system afero.Fs) ([]byte, error) {
 	}
 	return contents, nil
 }
+
+// ttpWorkDir returns the working directory of the TTP at ttpFilePath.
+// Embedded file systems have no notion of working directories, so
+// only TTPs on an OsFs run in the directory that contains them.
+func ttpWorkDir(ttpFilePath string, fsys afero.Fs) (string, error) {
+	if _, ok := fsys.(*afero.OsFs); !ok {
+		return os.Getwd()
+	}
+	absPath, err := filepath.Abs(ttpFilePath)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(absPath), nil
+}
@@ -0,0 +1,244 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/facebookincubator/ttpforge/pkg/logging"
+)
+
+// ParallelStep runs a group of child steps concurrently
+// and waits for all of them to finish before the TTP
+// moves on to its next step.
+type ParallelStep struct {
+	actionDefaults `yaml:",inline"`
+	Steps          []Step `yaml:"parallel,omitempty"`
+}
+
+// NewParallelStep creates a new ParallelStep and returns a pointer to it.
+func NewParallelStep() *ParallelStep {
+	return &ParallelStep{}
+}
+
+// IsNil checks if the step is nil or empty and returns a boolean value.
+func (p *ParallelStep) IsNil() bool {
+	return len(p.Steps) == 0
+}
+
+// Validate validates every child step of the group.
+// Child steps that change the working directory are rejected
+// because the working directory is shared by the whole group.
+func (p *ParallelStep) Validate(execCtx TTPExecutionContext) error {
+	if len(p.Steps) == 0 {
+		return errors.New("parallel must contain at least one step")
+	}
+	for _, child := range p.Steps {
+		if _, ok := child.action.(*ChangeDirectoryStep); ok {
+			return fmt.Errorf("step %q: cd cannot be used inside a parallel group", child.Name)
+		}
+		childCopy := child
+		if err := childCopy.Validate(execCtx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Execute runs all child steps concurrently and waits for them to finish.
+// The result of every successful child is recorded under its own name
+// so that later steps can reference its outputs.
+func (p *ParallelStep) Execute(ctx context.Context, execCtx TTPExecutionContext) (*ActResult, error) {
+	logging.L().Infof("[*] Executing %d steps in parallel", len(p.Steps))
+
+	// the children share the output writers, which
+	// are not necessarily safe for concurrent use
+	execCtx.Cfg.Stdout = newSyncWriter(execCtx.Cfg.Stdout)
+	execCtx.Cfg.Stderr = newSyncWriter(execCtx.Cfg.Stderr)
+	// sub TTPs in the group must not change
+	// the working directory of the process
+	execCtx.Cfg.sharedWorkDir = true
+
+	// every child has its own connection to its target
+	childCtxs := make([]TTPExecutionContext, len(p.Steps))
+	for idx := range p.Steps {
+		childCtxs[idx] = execCtx
+		childCtxs[idx].stepConn = &stepConnection{}
+		defer childCtxs[idx].stepConn.close()
+	}
+
+	// child conditions are evaluated up front, as the
+	// children cannot depend on the outputs of each other -
+	// children whose condition could not be evaluated fail
+	// without running, according to their on_failure policy
+	skipped := make([]bool, len(p.Steps))
+	errs := make([]error, len(p.Steps))
+	for idx := range p.Steps {
+		shouldRun, err := p.Steps[idx].ShouldRun(ctx, childCtxs[idx])
+		errs[idx] = err
+		skipped[idx] = err == nil && !shouldRun
+	}
+
+	for idx := range p.Steps {
+		if !skipped[idx] && errs[idx] == nil {
+			execCtx.journal.prepareStep(&p.Steps[idx])
+		}
+	}
+
+	results := make([]*ActResult, len(p.Steps))
+	requirementResults := make([][]CheckResult, len(p.Steps))
+	var wg sync.WaitGroup
+	for idx := range p.Steps {
+		if skipped[idx] || errs[idx] != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			// children wait for their own requirements
+			// without holding up the rest of the group
+			var shouldRun bool
+			shouldRun, requirementResults[idx], errs[idx] = p.Steps[idx].AwaitRequirements(ctx, childCtxs[idx])
+			if errs[idx] != nil {
+				return
+			}
+			if !shouldRun {
+				skipped[idx] = true
+				return
+			}
+			results[idx], errs[idx] = p.Steps[idx].Execute(ctx, childCtxs[idx])
+		}(idx)
+	}
+	wg.Wait()
+
+	// record results only once every child is done, so that the
+	// shared results record is never written concurrently
+	var actResults []*ActResult
+	var childErrs []error
+	for idx := range p.Steps {
+		child := &p.Steps[idx]
+		if skipped[idx] {
+			execCtx.StepResults.ByName[child.Name] = &ExecutionResult{
+				Status:       StepSkipped,
+				Requirements: requirementResults[idx],
+			}
+			continue
+		}
+		if errs[idx] != nil {
+			execResult := &ExecutionResult{
+				Status:       statusForError(errs[idx]),
+				Error:        errs[idx].Error(),
+				Requirements: requirementResults[idx],
+			}
+			if results[idx] != nil {
+				execResult.ActResult = *results[idx]
+			}
+			execCtx.StepResults.ByName[child.Name] = execResult
+			p.handleChildFailure(childCtxs[idx], idx, fmt.Errorf("step %q failed: %w", child.Name, errs[idx]), &childErrs)
+			continue
+		}
+
+		execResult := &ExecutionResult{
+			ActResult:    *results[idx],
+			Status:       StepSucceeded,
+			Requirements: requirementResults[idx],
+		}
+		execCtx.StepResults.ByName[child.Name] = execResult
+		actResults = append(actResults, results[idx])
+
+		var err error
+		if execResult.Checks, err = child.RunChecks(ctx, childCtxs[idx], results[idx]); err != nil {
+			execResult.Status = StepChecksFailed
+			execResult.Error = err.Error()
+			p.handleChildFailure(childCtxs[idx], idx, err, &childErrs)
+		}
+	}
+
+	result := aggregateResults(actResults)
+	if len(childErrs) > 0 {
+		return result, errors.Join(childErrs...)
+	}
+	return result, nil
+}
+
+// handleChildFailure applies the on_failure policy of a failed child.
+// Failures of children that may fail are only logged; all other
+// failures are appended to childErrs and will fail the whole group.
+func (p *ParallelStep) handleChildFailure(execCtx TTPExecutionContext, idx int, err error, childErrs *[]error) {
+	child := &p.Steps[idx]
+	switch child.OnFailure {
+	case FailurePolicyContinue:
+		logging.L().Warnf("[*] %v, continuing as requested by its on_failure policy", err)
+	case FailurePolicyCleanupAndContinue:
+		logging.L().Warnf("[*] %v, continuing as requested by its on_failure policy", err)
+		// the child is cleaned up right away and, once its
+		// cleanup is recorded, skipped by the group cleanup
+		if execCtx.Cfg.NoCleanup {
+			return
+		}
+		// children whose requirements were not met never ran
+		if execResult, ok := execCtx.StepResults.ByName[child.Name]; ok && !execResult.requirementsMet() {
+			return
+		}
+		cleanupResult, cleanupErr := child.Cleanup(execCtx)
+		if cleanupErr != nil {
+			logging.L().Errorf("Error cleaning up failed step %v: %v", child.Name, cleanupErr)
+		}
+		if execResult, ok := execCtx.StepResults.ByName[child.Name]; ok {
+			execResult.Cleanup = attemptedCleanup(cleanupResult)
+		}
+	default:
+		*childErrs = append(*childErrs, err)
+	}
+}
+
+// GetDefaultCleanupAction will instruct the calling code
+// to cleanup all child steps of this group
+func (p *ParallelStep) GetDefaultCleanupAction() Action {
+	return &parallelCleanupAction{
+		step: p,
+	}
+}
+
+// syncWriter serializes writes to an underlying io.Writer
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// newSyncWriter wraps w so that it can be shared by concurrent steps.
+// A nil writer is returned unchanged so that the executors
+// still fall back to their default logging writers.
+func newSyncWriter(w io.Writer) io.Writer {
+	if w == nil {
+		return nil
+	}
+	return &syncWriter{w: w}
+}
+
+func (s *syncWriter) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(b)
+}
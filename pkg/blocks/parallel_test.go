@@ -0,0 +1,262 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestParallelStepUnmarshal(t *testing.T) {
+	testCases := []struct {
+		name      string
+		content   string
+		wantError bool
+	}{
+		{
+			name: "Valid Parallel Group",
+			content: `name: group
+parallel:
+  - name: first
+    inline: echo first
+  - name: second
+    print_str: second`,
+		},
+		{
+			name: "Child Step Without Name",
+			content: `name: group
+parallel:
+  - inline: echo first`,
+			wantError: true,
+		},
+		{
+			name: "Ambiguous Parallel Step",
+			content: `name: group
+inline: echo oops
+parallel:
+  - name: first
+    inline: echo first`,
+			wantError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var s Step
+			err := yaml.Unmarshal([]byte(tc.content), &s)
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			_, ok := s.action.(*ParallelStep)
+			assert.True(t, ok, "step should be decoded as a parallel group")
+		})
+	}
+}
+
+func TestParallelStepValidate(t *testing.T) {
+	content := `name: group
+parallel:
+  - name: first
+    inline: echo first
+  - name: change_dir
+    cd: /tmp`
+	var s Step
+	err := yaml.Unmarshal([]byte(content), &s)
+	require.NoError(t, err)
+	err = s.Validate(NewTTPExecutionContext())
+	require.Error(t, err, "cd should not be allowed inside a parallel group")
+}
+
+func TestParallelStepExecution(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	testCases := []struct {
+		name                  string
+		content               string
+		expectedByNameOut     map[string]string
+		wantError             bool
+		expectedCleanupStdout string
+	}{
+		{
+			name: "Children Run Concurrently",
+			content: fmt.Sprintf(`name: concurrency
+steps:
+  - name: group
+    parallel:
+      - name: waiter
+        inline: |
+          for i in $(seq 100); do
+            [ -f %[1]v/ready ] && break
+            sleep 0.05
+          done
+          [ -f %[1]v/ready ]
+          echo waited
+      - name: signaller
+        inline: |
+          touch %[1]v/ready
+          echo signalled`, tmpDir),
+			expectedByNameOut: map[string]string{
+				"waiter":    "waited\n",
+				"signaller": "signalled\n",
+			},
+		},
+		{
+			name: "Later Steps Can Reference Child Outputs",
+			content: `name: outputs
+steps:
+  - name: group
+    parallel:
+      - name: discover
+        inline: echo {\"user\":\"alice\"}
+        outputs:
+          user:
+            filters:
+            - json_path: user
+      - name: beacon
+        inline: echo beacon
+  - name: use_output
+    inline: echo "found $forge.steps.discover.outputs.user"`,
+			expectedByNameOut: map[string]string{
+				"beacon":     "beacon\n",
+				"use_output": "found alice\n",
+			},
+		},
+		{
+			name: "Group Is Cleaned Up In Reverse Order",
+			content: `name: cleanup
+steps:
+  - name: before
+    inline: echo before
+    cleanup:
+      print_str: cleanup_before
+  - name: group
+    parallel:
+      - name: first
+        inline: echo first
+        cleanup:
+          print_str: cleanup_first
+      - name: second
+        inline: echo second
+      - name: third
+        inline: echo third
+        cleanup:
+          print_str: cleanup_third`,
+			expectedCleanupStdout: "cleanup_third\ncleanup_first\ncleanup_before\n",
+		},
+		{
+			name: "Failed Child Fails Group But Siblings Are Cleaned Up",
+			content: `name: failure
+steps:
+  - name: group
+    parallel:
+      - name: good
+        inline: echo good
+        cleanup:
+          print_str: cleanup_good
+      - name: bad
+        inline: THIS WILL FAIL ON PURPOSE
+        cleanup:
+          print_str: cleanup_bad
+  - name: never_runs
+    inline: echo should_not_run`,
+			wantError:             true,
+			expectedCleanupStdout: "cleanup_good\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ttp, err := RenderTemplatedTTP(tc.content, RenderParameters{})
+			require.NoError(t, err)
+
+			execCtx := NewTTPExecutionContext()
+			var stdoutBuf bytes.Buffer
+			execCtx.Cfg.Stdout = &stdoutBuf
+			err = ttp.Validate(execCtx)
+			require.NoError(t, err)
+
+			err = ttp.Execute(context.Background(), execCtx)
+			if tc.wantError {
+				require.Error(t, err)
+				_, found := execCtx.StepResults.ByName["never_runs"]
+				assert.False(t, found, "steps after a failed group should not run")
+			} else {
+				require.NoError(t, err)
+			}
+
+			for name, output := range tc.expectedByNameOut {
+				result, found := execCtx.StepResults.ByName[name]
+				require.True(t, found, "missing result for step %v", name)
+				assert.Equal(t, output, result.Stdout)
+			}
+
+			if tc.expectedCleanupStdout == "" {
+				return
+			}
+			// the order in which the children print is not
+			// deterministic, but the cleanup order must be
+			err = ttp.RunCleanup(execCtx)
+			require.NoError(t, err)
+			assert.True(t, strings.HasSuffix(stdoutBuf.String(), tc.expectedCleanupStdout), "unexpected cleanup output: %q", stdoutBuf.String())
+		})
+	}
+}
+
+func TestParallelStepCleanupUsesContextResults(t *testing.T) {
+	content := `name: group
+parallel:
+  - name: first
+    inline: echo first
+    cleanup:
+      print_str: cleanup_first
+  - name: second
+    inline: echo second
+    cleanup:
+      print_str: cleanup_second`
+	var s Step
+	require.NoError(t, yaml.Unmarshal([]byte(content), &s))
+	execCtx := NewTTPExecutionContext()
+	execCtx.Cfg.Stdout = &bytes.Buffer{}
+	require.NoError(t, s.Validate(execCtx))
+	_, err := s.Execute(context.Background(), execCtx)
+	require.NoError(t, err)
+
+	// the parsed step keeps no state of its own, so another
+	// run of it only cleans up the children that ran there
+	otherCtx := NewTTPExecutionContext()
+	var stdoutBuf bytes.Buffer
+	otherCtx.Cfg.Stdout = &stdoutBuf
+	otherCtx.StepResults.ByName["second"] = &ExecutionResult{Status: StepSucceeded}
+	otherCtx.StepResults.ByName["first"] = &ExecutionResult{Status: StepSkipped}
+	_, err = s.Cleanup(otherCtx)
+	require.NoError(t, err)
+	assert.Equal(t, "cleanup_second\n", stdoutBuf.String())
+	assert.NotNil(t, otherCtx.StepResults.ByName["second"].Cleanup)
+	assert.Nil(t, execCtx.StepResults.ByName["first"].Cleanup)
+}
@@ -0,0 +1,119 @@
+//go:build !windows
+// +build !windows
+
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/ttpforge/pkg/repos"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParallelSubTTPsKeepWorkingDirectory(t *testing.T) {
+	repoDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, repos.RepoConfigFileName), []byte(`ttp_search_paths: ["ttps"]`), 0644))
+	for name, delay := range map[string]string{"a": "0.5", "b": "0.2"} {
+		ttpDir := filepath.Join(repoDir, "ttps", name)
+		require.NoError(t, os.MkdirAll(ttpDir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(ttpDir, "ttp.yaml"), []byte(`---
+name: `+name+`
+steps:
+  - name: wait
+    inline: sleep `+delay+`
+  - name: marker
+    create_file: marker.txt
+    contents: `+name+`
+    checks:
+      - msg: the marker was not created in the directory of the TTP
+        path_exists: marker.txt
+`), 0644))
+	}
+	repo, err := (&repos.Spec{Name: "default", Path: repoDir}).Load(afero.NewOsFs(), "")
+	require.NoError(t, err)
+
+	ttp, err := RenderTemplatedTTP(`name: parent
+steps:
+  - name: group
+    parallel:
+      - name: sub_a
+        ttp: a/ttp.yaml
+      - name: sub_b
+        ttp: b/ttp.yaml`, RenderParameters{})
+	require.NoError(t, err)
+	ttp.WorkDir = repoDir
+
+	origDir, err := os.Getwd()
+	require.NoError(t, err)
+
+	// record every change of the working directory during the run -
+	// the sub TTPs must not change it while the others are running
+	done := make(chan struct{})
+	observed := make(chan []string)
+	go func() {
+		dirs := []string{origDir}
+		record := func() {
+			if dir, err := os.Getwd(); err == nil && dir != dirs[len(dirs)-1] {
+				dirs = append(dirs, dir)
+			}
+		}
+		for {
+			select {
+			case <-done:
+				record()
+				observed <- dirs
+				return
+			case <-time.After(time.Millisecond):
+				record()
+			}
+		}
+	}()
+
+	execCtx := NewTTPExecutionContext()
+	execCtx.Cfg.Repo = repo
+	execCtx.Cfg.NoCleanup = true
+	execCtx.Vars.WorkDir = repoDir
+	require.NoError(t, ttp.Validate(execCtx))
+	err = ttp.Execute(context.Background(), execCtx)
+	close(done)
+	dirs := <-observed
+	require.NoError(t, err)
+
+	realRepoDir, err := filepath.EvalSymlinks(repoDir)
+	require.NoError(t, err)
+	for idx := range dirs {
+		dirs[idx], err = filepath.EvalSymlinks(dirs[idx])
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{origDir, realRepoDir, origDir}, dirs)
+	for _, name := range []string{"a", "b"} {
+		contents, err := os.ReadFile(filepath.Join(repoDir, "ttps", name, "marker.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, name, string(contents))
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"context"
+
+	"github.com/facebookincubator/ttpforge/pkg/logging"
+)
+
+// parallelCleanupAction cleans up the child
+// steps of a parallel group in reverse order
+type parallelCleanupAction struct {
+	actionDefaults
+	step *ParallelStep
+}
+
+// IsNil is not needed here, as this is not a user-accessible step type
+func (a *parallelCleanupAction) IsNil() bool {
+	return false
+}
+
+// Validate is not needed here, as this is not a user-accessible step type
+func (a *parallelCleanupAction) Validate(execCtx TTPExecutionContext) error {
+	return nil
+}
+
+// Execute cleans up every child step that needs it, according to
+// the results recorded for the children in the execution context.
+// As with regular TTP cleanup, a failing child cleanup is logged
+// and does not prevent the other children from being cleaned up.
+func (a *parallelCleanupAction) Execute(_ context.Context, execCtx TTPExecutionContext) (*ActResult, error) {
+	var cleanupResults []*ActResult
+	for childIdx := len(a.step.Steps) - 1; childIdx >= 0; childIdx-- {
+		child := &a.step.Steps[childIdx]
+		execResult := execCtx.StepResults.ByName[child.Name]
+		if execResult == nil || !child.needsCleanup(execResult) {
+			continue
+		}
+		logging.L().Infof("Cleaning Up Parallel Step %q", child.Name)
+		cleanupResult, err := child.Cleanup(execCtx)
+		if err != nil {
+			logging.L().Errorf("error cleaning up parallel step %v: %v", child.Name, err)
+			logging.L().Errorf("will continue to try to cleanup other steps")
+			continue
+		}
+		execResult.Cleanup = cleanupResult
+		cleanupResults = append(cleanupResults, cleanupResult)
+	}
+	return aggregateResults(cleanupResults), nil
+}
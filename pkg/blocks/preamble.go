@@ -36,6 +36,7 @@ import (
 // MitreAttackMapping: A MitreAttack object containing mappings to the MITRE ATT&CK framework.
 // Requirements: The Requirements to run the TTP
 // ArgSpecs: An slice of argument specifications for the TTP.
+// Timeout: The maximum amount of time that the steps of the TTP may run for.
 type PreambleFields struct {
 	APIVersion         string              `yaml:"api_version,omitempty"`
 	UUID               string              `yaml:"uuid,omitempty"`
@@ -44,6 +45,7 @@ type PreambleFields struct {
 	MitreAttackMapping *MitreAttack        `yaml:"mitre,omitempty"`
 	Requirements       *RequirementsConfig `yaml:"requirements,omitempty"`
 	ArgSpecs           []args.Spec         `yaml:"args,omitempty,flow"`
+	Timeout            Duration            `yaml:"timeout,omitempty"`
 }
 
 // Validate validates the preamble fields.
@@ -59,6 +61,10 @@ func (pf *PreambleFields) Validate(strict bool) error {
 		return fmt.Errorf("TTP '%s' has a MitreAttackMapping but no Tactic is defined", pf.Name)
 	}
 
+	if pf.Timeout < 0 {
+		return fmt.Errorf("TTP '%s' has a negative timeout", pf.Name)
+	}
+
 	// validate requirements
 	if err := pf.Requirements.Validate(); err != nil {
 		return fmt.Errorf("TTP '%s' has an invalid requirements section: %w", pf.Name, err)
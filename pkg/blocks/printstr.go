@@ -21,6 +21,7 @@ package blocks
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -56,7 +57,7 @@ func (s *PrintStrAction) Validate(_ TTPExecutionContext) error {
 }
 
 // Execute runs the step and returns an error if one occurs.
-func (s *PrintStrAction) Execute(execCtx TTPExecutionContext) (*ActResult, error) {
+func (s *PrintStrAction) Execute(_ context.Context, execCtx TTPExecutionContext) (*ActResult, error) {
 	// needs to be overwritable to capture output during testing
 	stdout := execCtx.Cfg.Stdout
 	if stdout == nil {
@@ -74,3 +75,9 @@ func (s *PrintStrAction) Execute(execCtx TTPExecutionContext) (*ActResult, error
 	}
 	return result, nil
 }
+
+// CanRunOnTarget allows steps that run on a remote target to
+// print messages, which are always printed locally
+func (s *PrintStrAction) CanRunOnTarget() bool {
+	return true
+}
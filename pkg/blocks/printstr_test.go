@@ -20,6 +20,7 @@ THE SOFTWARE.
 package blocks
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -68,7 +69,7 @@ func TestPrintStrExecute(t *testing.T) {
 			}
 
 			// execute and check error
-			result, err := tc.action.Execute(execCtx)
+			result, err := tc.action.Execute(context.Background(), execCtx)
 			if tc.expectExecuteError {
 				require.Error(t, err)
 				return
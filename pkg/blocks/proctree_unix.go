@@ -0,0 +1,48 @@
+//go:build !windows
+// +build !windows
+
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// configureProcessTree ensures that cancelling the context of cmd
+// stops cmd along with every process that it started, rather than
+// leaving orphaned grandchildren behind. The processes are asked
+// to terminate with SIGTERM and are killed with SIGKILL if they
+// are still running after processKillGracePeriod.
+func configureProcessTree(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		// a negative pid signals the whole process group
+		pgid := -cmd.Process.Pid
+		time.AfterFunc(processKillGracePeriod, func() {
+			// fails harmlessly if the group is already gone
+			_ = syscall.Kill(pgid, syscall.SIGKILL)
+		})
+		return syscall.Kill(pgid, syscall.SIGTERM)
+	}
+	cmd.WaitDelay = processKillGracePeriod + processWaitDelay
+}
@@ -20,9 +20,9 @@ THE SOFTWARE.
 package blocks
 
 import (
+	"context"
 	"fmt"
 
-	"github.com/facebookincubator/ttpforge/pkg/fileutils"
 	"github.com/facebookincubator/ttpforge/pkg/logging"
 	"github.com/spf13/afero"
 )
@@ -62,15 +62,12 @@ func (s *RemovePathAction) Validate(_ TTPExecutionContext) error {
 }
 
 // Execute runs the step and returns an error if one occurs.
-func (s *RemovePathAction) Execute(_ TTPExecutionContext) (*ActResult, error) {
+func (s *RemovePathAction) Execute(_ context.Context, execCtx TTPExecutionContext) (*ActResult, error) {
 	logging.L().Infof("Removing path %v", s.Path)
-	fsys := s.FileSystem
-	if fsys == nil {
-		fsys = afero.NewOsFs()
-	}
+	fsys := execCtx.fileSystem(s.FileSystem)
 
 	// cannot remove a non-existent path
-	pathToRemove, err := fileutils.ExpandTilde(s.Path)
+	pathToRemove, err := execCtx.resolvePath(s.Path)
 	if err != nil {
 		return nil, err
 	}
@@ -96,6 +93,10 @@ func (s *RemovePathAction) Execute(_ TTPExecutionContext) (*ActResult, error) {
 		return nil, fmt.Errorf("path %v is a directory and `recursive: true` was not specified - refusing to remove", s.Path)
 	}
 
+	if err := execCtx.takeSnapshot(fsys, pathToRemove); err != nil {
+		return nil, err
+	}
+
 	// actually remove the file
 	err = fsys.RemoveAll(pathToRemove)
 	if err != nil {
@@ -104,7 +105,18 @@ func (s *RemovePathAction) Execute(_ TTPExecutionContext) (*ActResult, error) {
 	return &ActResult{}, nil
 }
 
+// GetDefaultCleanupAction will instruct the calling code
+// to restore the removed path from a snapshot
+func (s *RemovePathAction) GetDefaultCleanupAction() Action {
+	return &restorePathAction{fileSystem: &s.FileSystem}
+}
+
 // CanBeUsedInCompositeAction enables this action to be used in a composite action
 func (s *RemovePathAction) CanBeUsedInCompositeAction() bool {
 	return true
 }
+
+// CanRunOnTarget enables this action to run on a remote target
+func (s *RemovePathAction) CanRunOnTarget() bool {
+	return true
+}
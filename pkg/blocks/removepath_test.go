@@ -20,6 +20,7 @@ THE SOFTWARE.
 package blocks
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -110,7 +111,7 @@ func TestRemovePathExecute(t *testing.T) {
 
 			// execute and check error
 			var execCtx TTPExecutionContext
-			_, err := tc.step.Execute(execCtx)
+			_, err := tc.step.Execute(context.Background(), execCtx)
 			if tc.expectExecuteError {
 				require.Error(t, err)
 				return
@@ -0,0 +1,245 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"encoding/json"
+	"os"
+	"runtime"
+	"time"
+)
+
+// RunReport is a machine-readable record of a single
+// run of a TTP, as written by `ttpforge run --report`
+type RunReport struct {
+	RunID        string                 `json:"run_id"`
+	TTP          TTPReport              `json:"ttp"`
+	Args         map[string]interface{} `json:"args"`
+	Platform     PlatformReport         `json:"platform"`
+	Status       StepStatus             `json:"status"`
+	Error        string                 `json:"error,omitempty"`
+	CleanupError string                 `json:"cleanup_error,omitempty"`
+	StartTime    time.Time              `json:"start_time"`
+	EndTime      time.Time              `json:"end_time"`
+	Steps        []StepReport           `json:"steps"`
+}
+
+// TTPReport identifies the TTP that was run
+type TTPReport struct {
+	UUID        string       `json:"uuid,omitempty"`
+	Name        string       `json:"name"`
+	Description string       `json:"description,omitempty"`
+	Mitre       *MitreAttack `json:"mitre,omitempty"`
+}
+
+// PlatformReport describes the system on which the TTP was run
+type PlatformReport struct {
+	OS       string `json:"os"`
+	Arch     string `json:"arch"`
+	Hostname string `json:"hostname,omitempty"`
+}
+
+// ResultReport is the report representation of an ActResult
+type ResultReport struct {
+	StartTime       *time.Time             `json:"start_time,omitempty"`
+	EndTime         *time.Time             `json:"end_time,omitempty"`
+	DurationSeconds float64                `json:"duration_seconds"`
+	ExitCode        int                    `json:"exit_code"`
+	Stdout          string                 `json:"stdout"`
+	Stderr          string                 `json:"stderr"`
+	Outputs         map[string]interface{} `json:"outputs,omitempty"`
+}
+
+// StepReport records what happened to a single step. The child
+// steps of parallel groups and sub TTPs are nested under Steps.
+type StepReport struct {
+	Name        string     `json:"name"`
+	Action      string     `json:"action"`
+	Description string     `json:"description,omitempty"`
+	Status      StepStatus `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	ResultReport
+	Requirements []CheckResult `json:"requirements,omitempty"`
+	Checks       []CheckResult `json:"checks,omitempty"`
+	Cleanup      *ResultReport `json:"cleanup,omitempty"`
+	Steps        []StepReport  `json:"steps,omitempty"`
+}
+
+// NewRunReport builds a report from the results recorded in execCtx.
+// It should be called once cleanup has finished, so that the
+// cleanup results are included. The caller is responsible for
+// setting the status and timing of the run as a whole.
+func NewRunReport(ttp *TTP, execCtx TTPExecutionContext) *RunReport {
+	hostname, _ := os.Hostname()
+	report := &RunReport{
+		RunID: execCtx.Cfg.RunID,
+		TTP: TTPReport{
+			UUID:        ttp.UUID,
+			Name:        ttp.Name,
+			Description: ttp.Description,
+			Mitre:       ttp.MitreAttackMapping,
+		},
+		Platform: PlatformReport{
+			OS:       runtime.GOOS,
+			Arch:     runtime.GOARCH,
+			Hostname: hostname,
+		},
+		Status: StepSucceeded,
+	}
+	if execCtx.Vars != nil {
+		report.Args = execCtx.Vars.Args
+	}
+	// runs on a remote target describe the target instead,
+	// which is unknown if it could not be reached
+	if execCtx.Cfg.Target != nil {
+		report.Platform = PlatformReport{}
+		if execCtx.Vars != nil && execCtx.Vars.targetPlatform != nil {
+			report.Platform = *execCtx.Vars.targetPlatform
+		}
+	}
+	report.Steps = reportSteps(ttp.Steps, execCtx.StepResults, true)
+	return report
+}
+
+// SetErrors records the errors returned by
+// TTP.Execute(...) and TTP.RunCleanup(...)
+func (r *RunReport) SetErrors(runErr, cleanupErr error) {
+	if runErr != nil {
+		r.Status = StepFailed
+		r.Error = runErr.Error()
+	}
+	if cleanupErr != nil {
+		r.CleanupError = cleanupErr.Error()
+	}
+}
+
+// WriteFile writes the report to the specified path as indented JSON
+func (r *RunReport) WriteFile(path string) error {
+	return writeJSONFile(path, r)
+}
+
+// writeJSONFile writes a report to the specified path as indented JSON
+func writeJSONFile(path string, report interface{}) error {
+	reportBytes, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(reportBytes, '\n'), 0600)
+}
+
+// reportSteps builds the reports of the specified steps.
+// The results of top-level steps are looked up by index, as
+// step names need not be unique; child steps are looked up by name.
+func reportSteps(steps []Step, results *StepResultsRecord, byIndex bool) []StepReport {
+	stepReports := make([]StepReport, len(steps))
+	for stepIdx := range steps {
+		step := &steps[stepIdx]
+		var execResult *ExecutionResult
+		if results != nil {
+			if byIndex && stepIdx < len(results.ByIndex) {
+				execResult = results.ByIndex[stepIdx]
+			} else if !byIndex {
+				execResult = results.ByName[step.Name]
+			}
+		}
+		stepReports[stepIdx] = reportStep(step, execResult, results)
+	}
+	return stepReports
+}
+
+func reportStep(step *Step, execResult *ExecutionResult, results *StepResultsRecord) StepReport {
+	stepReport := StepReport{
+		Name:        step.Name,
+		Action:      actionName(step.action),
+		Description: step.action.GetDescription(),
+		Status:      StepNotRun,
+	}
+	if execResult != nil {
+		stepReport.Status = execResult.Status
+		stepReport.Error = execResult.Error
+		stepReport.ResultReport = reportResult(&execResult.ActResult)
+		stepReport.Requirements = execResult.Requirements
+		stepReport.Checks = execResult.Checks
+		if execResult.Cleanup != nil {
+			cleanupReport := reportResult(execResult.Cleanup)
+			stepReport.Cleanup = &cleanupReport
+		}
+	}
+
+	switch action := step.action.(type) {
+	case *ParallelStep:
+		stepReport.Steps = reportSteps(action.Steps, results, false)
+	case *SubTTPStep:
+		if action.ttp != nil && action.subExecCtx != nil {
+			stepReport.Steps = reportSteps(action.ttp.Steps, action.subExecCtx.StepResults, true)
+		}
+	}
+	return stepReport
+}
+
+func reportResult(result *ActResult) ResultReport {
+	resultReport := ResultReport{
+		DurationSeconds: result.Duration.Seconds(),
+		ExitCode:        result.ExitCode,
+		Stdout:          result.Stdout,
+		Stderr:          result.Stderr,
+		Outputs:         result.Outputs,
+	}
+	if !result.StartTime.IsZero() {
+		startTime, endTime := result.StartTime, result.EndTime
+		resultReport.StartTime = &startTime
+		resultReport.EndTime = &endTime
+	}
+	return resultReport
+}
+
+// actionName returns the YAML key that
+// identifies the type of the specified action
+func actionName(action Action) string {
+	switch action.(type) {
+	case *BasicStep:
+		return "inline"
+	case *FileStep:
+		return "file"
+	case *SubTTPStep:
+		return "ttp"
+	case *ParallelStep:
+		return "parallel"
+	case *EditStep:
+		return "edit_file"
+	case *FetchURIStep:
+		return "fetch_uri"
+	case *CreateFileStep:
+		return "create_file"
+	case *CopyPathStep:
+		return "copy_path"
+	case *RemovePathAction:
+		return "remove_path"
+	case *PrintStrAction:
+		return "print_str"
+	case *ExpectStep:
+		return "expect"
+	case *ChangeDirectoryStep:
+		return "cd"
+	case *SpawnStep:
+		return "spawn"
+	}
+	return "unknown"
+}
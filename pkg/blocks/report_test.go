@@ -0,0 +1,136 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunReport(t *testing.T) {
+	content := `api_version: 2.0
+uuid: 3f1c1a52-2b7d-4f11-9d0e-6a3c5b8e2f47
+name: report_test
+mitre:
+  tactics:
+    - TA0002 Execution
+steps:
+  - name: group
+    parallel:
+      - name: child
+        inline: echo child
+        cleanup:
+          print_str: cleanup_child
+  - name: checked
+    inline: echo checked
+    on_failure: continue
+    checks:
+      - msg: first check
+        path_exists: /
+      - msg: second check
+        path_exists: /this/path/does/not/exist
+  - name: unmet
+    inline: echo unmet
+    requires:
+      - msg: required file
+        path_exists: /this/path/does/not/exist
+    on_unmet: skip
+  - name: fails
+    description: this step fails on purpose
+    inline: exit 4
+  - name: never_runs
+    print_str: should_not_run`
+
+	ttp, err := RenderTemplatedTTP(content, RenderParameters{})
+	require.NoError(t, err)
+	execCtx := NewTTPExecutionContext()
+	execCtx.Cfg.RunID = "test-run"
+	execCtx.Vars.Args = map[string]interface{}{"target": "localhost"}
+	err = ttp.Validate(execCtx)
+	require.NoError(t, err)
+
+	runErr := ttp.Execute(context.Background(), execCtx)
+	require.Error(t, runErr)
+	err = ttp.RunCleanup(execCtx)
+	require.NoError(t, err)
+
+	report := NewRunReport(ttp, execCtx)
+	report.SetErrors(runErr, nil)
+	assert.Equal(t, "test-run", report.RunID)
+	assert.Equal(t, "3f1c1a52-2b7d-4f11-9d0e-6a3c5b8e2f47", report.TTP.UUID)
+	require.NotNil(t, report.TTP.Mitre)
+	assert.Equal(t, []string{"TA0002 Execution"}, report.TTP.Mitre.Tactics)
+	assert.Equal(t, "localhost", report.Args["target"])
+	assert.Equal(t, StepFailed, report.Status)
+
+	require.Len(t, report.Steps, 5)
+	group := report.Steps[0]
+	assert.Equal(t, "parallel", group.Action)
+	require.Len(t, group.Steps, 1)
+	assert.Equal(t, "child\n", group.Steps[0].Stdout)
+	require.NotNil(t, group.Steps[0].Cleanup)
+	assert.Equal(t, "cleanup_child\n", group.Steps[0].Cleanup.Stdout)
+
+	checked := report.Steps[1]
+	assert.Equal(t, StepChecksFailed, checked.Status)
+	require.Len(t, checked.Checks, 2)
+	assert.True(t, checked.Checks[0].Passed)
+	assert.False(t, checked.Checks[1].Passed)
+	assert.Equal(t, "second check", checked.Checks[1].Msg)
+	assert.NotEmpty(t, checked.Checks[1].Error)
+
+	unmet := report.Steps[2]
+	assert.Equal(t, StepSkipped, unmet.Status)
+	require.Len(t, unmet.Requirements, 1)
+	assert.False(t, unmet.Requirements[0].Passed)
+	assert.Equal(t, "required file", unmet.Requirements[0].Msg)
+	assert.Nil(t, unmet.StartTime)
+
+	fails := report.Steps[3]
+	assert.Equal(t, StepFailed, fails.Status)
+	assert.Equal(t, "this step fails on purpose", fails.Description)
+	assert.Equal(t, 4, fails.ExitCode)
+	require.NotNil(t, fails.StartTime)
+	assert.Nil(t, fails.Cleanup)
+
+	notRun := report.Steps[4]
+	assert.Equal(t, StepNotRun, notRun.Status)
+	assert.Equal(t, "print_str", notRun.Action)
+	assert.Nil(t, notRun.StartTime)
+
+	// the report must survive a round trip through its file format
+	reportPath := filepath.Join(t.TempDir(), "report.json")
+	err = report.WriteFile(reportPath)
+	require.NoError(t, err)
+	reportBytes, err := os.ReadFile(reportPath)
+	require.NoError(t, err)
+	var decoded RunReport
+	err = json.Unmarshal(reportBytes, &decoded)
+	require.NoError(t, err)
+	assert.Equal(t, report.Steps[3].ExitCode, decoded.Steps[3].ExitCode)
+	assert.Equal(t, report.Steps[2].Requirements, decoded.Steps[2].Requirements)
+	assert.Equal(t, report.Steps[1].Checks, decoded.Steps[1].Checks)
+}
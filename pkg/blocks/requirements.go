@@ -20,14 +20,20 @@ THE SOFTWARE.
 package blocks
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"os/exec"
 	"runtime"
+	"strings"
+	"time"
 
 	"github.com/facebookincubator/ttpforge/pkg/checks"
 	"github.com/facebookincubator/ttpforge/pkg/logging"
 	"github.com/facebookincubator/ttpforge/pkg/platforms"
+	"github.com/facebookincubator/ttpforge/pkg/targets"
+	"github.com/spf13/afero"
 )
 
 // RequirementsConfig specifies the prerequisites that must be
@@ -36,9 +42,20 @@ import (
 // **Attributes:**
 //
 // ExpectSuperuser: Whether the TTP assumes superuser privileges
+// Platforms: The platforms with which the TTP is compatible
+// Commands: Commands that must be present in PATH
+// Env: Environment variables that must be set
+// Distro: The linux distributions with which the TTP is compatible
+// Kernel: A constraint on the version of the linux kernel
+// Capabilities: Linux capabilities that TTPForge must have
 type RequirementsConfig struct {
-	ExpectSuperuser bool             `yaml:"superuser,omitempty"`
-	Platforms       []platforms.Spec `yaml:"platforms,omitempty"`
+	ExpectSuperuser bool                   `yaml:"superuser,omitempty"`
+	Platforms       []platforms.Spec       `yaml:"platforms,omitempty"`
+	Commands        []string               `yaml:"commands,omitempty"`
+	Env             []string               `yaml:"env,omitempty"`
+	Distro          []platforms.DistroSpec `yaml:"distro,omitempty"`
+	Kernel          string                 `yaml:"kernel,omitempty"`
+	Capabilities    []string               `yaml:"capabilities,omitempty"`
 }
 
 // Validate checks that the requirements section
@@ -55,53 +72,232 @@ func (rc *RequirementsConfig) Validate() error {
 			return err
 		}
 	}
+	for _, command := range rc.Commands {
+		if command == "" {
+			return errors.New("required commands must not be empty")
+		}
+	}
+	for _, name := range rc.Env {
+		if name == "" {
+			return errors.New("required environment variables must not be empty")
+		}
+	}
+	for _, distro := range rc.Distro {
+		if err := distro.Validate(); err != nil {
+			return err
+		}
+	}
+	if rc.Kernel != "" {
+		if _, err := platforms.ParseVersionConstraint(rc.Kernel); err != nil {
+			return err
+		}
+	}
+	for _, capability := range rc.Capabilities {
+		if _, err := platforms.ParseCapability(capability); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 // Verify checks that the requirements specified
 // in the requirements section are actually satisfied by the environment in
-// which the TTP is currently running.
+// which the TTP is currently running. Every requirement is checked, and
+// the returned error describes all of the requirements that are not met.
 func (rc *RequirementsConfig) Verify(ctx checks.VerificationContext) error {
 	// simplifies things a bit for callers
 	if rc == nil {
 		return nil
 	}
+	if ctx.FileSystem == nil {
+		ctx.FileSystem = afero.NewOsFs()
+	}
+
+	var unmet []error
+	for _, verify := range []func(checks.VerificationContext) error{
+		rc.verifyPlatforms,
+		rc.verifySuperuser,
+		rc.verifyCommands,
+		rc.verifyEnv,
+		rc.verifyDistro,
+		rc.verifyKernel,
+		rc.verifyCapabilities,
+	} {
+		if err := verify(ctx); err != nil {
+			logging.L().Errorf("Unmet requirement: %v", err)
+			unmet = append(unmet, err)
+		}
+	}
+	return errors.Join(unmet...)
+}
 
+func (rc *RequirementsConfig) verifyPlatforms(ctx checks.VerificationContext) error {
 	// check platform compatibility:
 	// if there are no platforms specified, then we assume
 	// that the TTP is compatible with all platforms
 	// (even though it probably isn't, but there
 	//  are a lot of existing TTPs from before this feature
 	// existed that don't explicitly declare supported platforms)
-	if len(rc.Platforms) > 0 {
-		var ttpIsCompatibleWithCurrentPlatform bool
-		for _, platform := range rc.Platforms {
-			if platform.IsCompatibleWith(ctx.Platform) {
-				ttpIsCompatibleWithCurrentPlatform = true
-				break
-			}
+	if len(rc.Platforms) == 0 {
+		return nil
+	}
+	for _, platform := range rc.Platforms {
+		if platform.IsCompatibleWith(ctx.Platform) {
+			return nil
 		}
-		if !ttpIsCompatibleWithCurrentPlatform {
-			logging.L().Errorf("The current platform %q is not compatible with this TTP", ctx.Platform.String())
-			logging.L().Errorf("Supported platforms are:")
-			for _, p := range rc.Platforms {
-				logging.L().Errorf("\t%v", p.String())
-			}
-			return fmt.Errorf("the current platform is not compatible with this TTP")
+	}
+	logging.L().Errorf("The current platform %q is not compatible with this TTP", ctx.Platform.String())
+	logging.L().Errorf("Supported platforms are:")
+	for _, p := range rc.Platforms {
+		logging.L().Errorf("\t%v", p.String())
+	}
+	return fmt.Errorf("the current platform is not compatible with this TTP")
+}
+
+func (rc *RequirementsConfig) verifySuperuser(ctx checks.VerificationContext) error {
+	if !rc.ExpectSuperuser {
+		return nil
+	}
+	if ctx.Host != nil {
+		stdout, err := runOnHost(ctx, "id -u")
+		if err != nil {
+			return err
 		}
+		if strings.TrimSpace(stdout) != "0" {
+			return errors.New("must be root (UID 0) on the target to run this TTP")
+		}
+		return nil
+	}
+	if runtime.GOOS == "windows" {
+		logging.L().Warnf("not enforcing superuser requirement because it is not supported on windows yet")
+		return nil
+	}
+	if os.Geteuid() != 0 {
+		return errors.New("must be root (UID 0) to run this TTP")
 	}
+	logging.L().Debug("[+] Running as root")
+	return nil
+}
 
-	// check superuser requirement
-	if rc.ExpectSuperuser {
-		if runtime.GOOS == "windows" {
-			logging.L().Warnf("not enforcing superuser requirement because it is not supported on windows yet")
-		} else {
-			if os.Geteuid() != 0 {
-				err := errors.New("must be root (UID 0) to run this TTP")
-				return err
+func (rc *RequirementsConfig) verifyCommands(ctx checks.VerificationContext) error {
+	var missing []string
+	for _, command := range rc.Commands {
+		if ctx.Host != nil {
+			if _, err := runOnHost(ctx, "command -v "+targets.ShellQuote(command)); err != nil {
+				missing = append(missing, command)
 			}
-			logging.L().Debug("[+] Running as root")
+			continue
+		}
+		if _, err := exec.LookPath(command); err != nil {
+			missing = append(missing, command)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("required commands not found in PATH: %v", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// verifyEnv checks the environment in which the steps run: that of
+// TTPForge itself (or of the user on the remote target), merged
+// with the TTP-level environment
+func (rc *RequirementsConfig) verifyEnv(ctx checks.VerificationContext) error {
+	var missing []string
+	for _, name := range rc.Env {
+		_, ok, err := ctx.LookupEnv(name)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("required environment variables are not set: %v", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func (rc *RequirementsConfig) verifyDistro(ctx checks.VerificationContext) error {
+	if len(rc.Distro) == 0 {
+		return nil
+	}
+	osRelease, err := platforms.ReadOSRelease(ctx.FileSystem)
+	if err != nil {
+		return err
+	}
+	var supported []string
+	for _, distro := range rc.Distro {
+		matches, err := distro.Matches(osRelease)
+		if err != nil {
+			return err
+		}
+		if matches {
+			return nil
+		}
+		supported = append(supported, distro.String())
+	}
+	return fmt.Errorf("the current distribution (%v %v) is not one of the supported distributions: %v",
+		osRelease["ID"], osRelease["VERSION_ID"], strings.Join(supported, ", "))
+}
+
+func (rc *RequirementsConfig) verifyKernel(ctx checks.VerificationContext) error {
+	if rc.Kernel == "" {
+		return nil
+	}
+	constraint, err := platforms.ParseVersionConstraint(rc.Kernel)
+	if err != nil {
+		return err
+	}
+	release, err := platforms.KernelRelease(ctx.FileSystem)
+	if err != nil {
+		return err
+	}
+	ok, err := constraint.Check(release)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("the kernel version %v does not satisfy %q", release, constraint)
+	}
+	return nil
+}
+
+func (rc *RequirementsConfig) verifyCapabilities(ctx checks.VerificationContext) error {
+	if len(rc.Capabilities) == 0 {
+		return nil
+	}
+	effective, err := platforms.EffectiveCapabilities(ctx.FileSystem)
+	if err != nil {
+		return err
+	}
+	var missing []string
+	for _, capability := range rc.Capabilities {
+		number, err := platforms.ParseCapability(capability)
+		if err != nil {
+			return err
+		}
+		if effective&(1<<number) == 0 {
+			missing = append(missing, capability)
 		}
 	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing linux capabilities: %v", strings.Join(missing, ", "))
+	}
 	return nil
 }
+
+// runOnHost runs a command on the remote host of ctx and
+// returns its standard output, or an error if it fails
+func runOnHost(ctx checks.VerificationContext, command string) (string, error) {
+	cmdCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	stdout, exitCode, err := ctx.Host.Run(cmdCtx, command, ctx.Environment)
+	if err != nil {
+		return "", err
+	}
+	if exitCode != 0 {
+		return "", fmt.Errorf("command %q exited with code %d", command, exitCode)
+	}
+	return string(stdout), nil
+}
@@ -20,8 +20,13 @@ THE SOFTWARE.
 package blocks
 
 import (
+	"context"
+	"strings"
 	"testing"
 
+	"github.com/facebookincubator/ttpforge/pkg/checks"
+	"github.com/facebookincubator/ttpforge/pkg/platforms"
+	"github.com/facebookincubator/ttpforge/pkg/testutils"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/yaml.v3"
@@ -73,6 +78,38 @@ steps:
 			expectedRequirements: &RequirementsConfig{
 				ExpectSuperuser: true,
 			},
+		}, {
+			name: "Required environment variable set by the TTP",
+			content: `
+name: TestTTP
+description: Test description
+env:
+  TTPFORGE_TEST_TTP_ENV: set
+requirements:
+  env:
+    - TTPFORGE_TEST_TTP_ENV
+steps:
+  - name: hello
+    print_str: hello world`,
+			expectedRequirements: &RequirementsConfig{
+				Env: []string{"TTPFORGE_TEST_TTP_ENV"},
+			},
+		},
+		{
+			name: "Required environment variable not set",
+			content: `
+name: TestTTP
+description: Test description
+requirements:
+  env:
+    - TTPFORGE_TEST_TTP_ENV
+steps:
+  - name: hello
+    print_str: hello world`,
+			expectExecuteError: true,
+			expectedRequirements: &RequirementsConfig{
+				Env: []string{"TTPFORGE_TEST_TTP_ENV"},
+			},
 		},
 	}
 
@@ -89,7 +126,7 @@ steps:
 			}
 			require.NoError(t, err)
 
-			err = ttp.Execute(ctx)
+			err = ttp.Execute(context.Background(), ctx)
 			if tc.expectExecuteError {
 				assert.Error(t, err)
 				return
@@ -98,3 +135,112 @@ steps:
 		})
 	}
 }
+
+func TestRequirementsVerify(t *testing.T) {
+	t.Setenv("TTPFORGE_TEST_REQUIRED_ENV", "set")
+	fsysContents := map[string][]byte{
+		"/etc/os-release":            []byte("ID=ubuntu\nVERSION_ID=\"22.04\"\n"),
+		"/proc/sys/kernel/osrelease": []byte("5.15.0-91-generic\n"),
+		// CAP_NET_BIND_SERVICE and CAP_NET_RAW
+		"/proc/self/status": []byte("Name:\tttpforge\nCapEff:\t0000000000002400\n"),
+	}
+
+	testCases := []struct {
+		name                string
+		content             string
+		expectValidateError bool
+		expectedUnmet       []string
+	}{
+		{
+			name: "All Requirements Met",
+			content: `commands:
+  - sh
+env:
+  - TTPFORGE_TEST_REQUIRED_ENV
+distro:
+  - id: fedora
+  - id: ubuntu
+    version: ">= 20.04"
+kernel: ">= 5.4, < 6"
+capabilities:
+  - CAP_NET_RAW
+  - net_bind_service`,
+		},
+		{
+			name: "Every Unmet Requirement Is Reported",
+			content: `platforms:
+  - os: plan9
+commands:
+  - sh
+  - ttpforge-no-such-command
+env:
+  - TTPFORGE_TEST_REQUIRED_ENV
+  - TTPFORGE_TEST_MISSING_ENV
+distro:
+  - id: ubuntu
+    version: ">= 24.04"
+kernel: ">= 6.1"
+capabilities:
+  - CAP_NET_RAW
+  - CAP_SYS_ADMIN`,
+			expectedUnmet: []string{
+				"the current platform is not compatible with this TTP",
+				"required commands not found in PATH: ttpforge-no-such-command",
+				"required environment variables are not set: TTPFORGE_TEST_MISSING_ENV",
+				"the current distribution (ubuntu 22.04) is not one of the supported distributions: ubuntu >= 24.04",
+				`the kernel version 5.15.0-91-generic does not satisfy ">= 6.1"`,
+				"missing linux capabilities: CAP_SYS_ADMIN",
+			},
+		},
+		{
+			name:                "Invalid Kernel Constraint",
+			content:             `kernel: "latest"`,
+			expectValidateError: true,
+		},
+		{
+			name: "Invalid Distro",
+			content: `distro:
+  - version: ">= 1"`,
+			expectValidateError: true,
+		},
+		{
+			name: "Invalid Capability",
+			content: `capabilities:
+  - CAP_TIME_TRAVEL`,
+			expectValidateError: true,
+		},
+		{
+			name: "Empty Command",
+			content: `commands:
+  - ""`,
+			expectValidateError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var rc RequirementsConfig
+			err := yaml.Unmarshal([]byte(tc.content), &rc)
+			require.NoError(t, err)
+			err = rc.Validate()
+			if tc.expectValidateError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			fsys, err := testutils.MakeAferoTestFs(fsysContents)
+			require.NoError(t, err)
+			err = rc.Verify(checks.VerificationContext{
+				Platform:   platforms.GetCurrentPlatformSpec(),
+				FileSystem: fsys,
+			})
+			if len(tc.expectedUnmet) == 0 {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, strings.Join(tc.expectedUnmet, "\n"), err.Error())
+		})
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/facebookincubator/ttpforge/pkg/logging"
+)
+
+// ErrRequirementsNotMet is wrapped by the errors of steps
+// that were not executed because their requirements were not met
+var ErrRequirementsNotMet = errors.New("requirements not met")
+
+// errSkippedByRequirements signals that a step was
+// skipped because of its requirements and `on_unmet: skip`
+var errSkippedByRequirements = errors.New("step skipped because its requirements are not met")
+
+// defaultWaitTimeout is how long a step with `on_unmet: wait`
+// waits for its requirements if it does not specify wait_timeout
+const defaultWaitTimeout = time.Minute
+
+// requirementPollInterval is how often the requirements of
+// a step with `on_unmet: wait` are verified again
+var requirementPollInterval = time.Second
+
+// UnmetPolicy specifies what happens when
+// the requirements of a step are not met
+type UnmetPolicy string
+
+const (
+	// UnmetPolicyFail fails the step without executing it (the default)
+	UnmetPolicyFail UnmetPolicy = "fail"
+	// UnmetPolicySkip skips the step, just like a false `if:` condition
+	UnmetPolicySkip UnmetPolicy = "skip"
+	// UnmetPolicyWait verifies the requirements again until they are
+	// met, and fails the step if they are still unmet after wait_timeout
+	UnmetPolicyWait UnmetPolicy = "wait"
+)
+
+// Validate checks that the policy is one of the supported values
+func (p UnmetPolicy) Validate() error {
+	switch p {
+	case "", UnmetPolicyFail, UnmetPolicySkip, UnmetPolicyWait:
+		return nil
+	}
+	return fmt.Errorf("invalid on_unmet value %q - must be one of %q, %q, or %q", p, UnmetPolicyFail, UnmetPolicySkip, UnmetPolicyWait)
+}
+
+// validateRequirements checks that the fields that
+// control the requirements of this step are consistent
+func (s *Step) validateRequirements() error {
+	if err := s.OnUnmet.Validate(); err != nil {
+		return fmt.Errorf("step %q: %w", s.Name, err)
+	}
+	if s.OnUnmet != "" && len(s.Requires) == 0 {
+		return fmt.Errorf("step %q specifies on_unmet but has no requirements", s.Name)
+	}
+	if s.WaitTimeout < 0 {
+		return fmt.Errorf("step %q has a negative wait_timeout", s.Name)
+	}
+	if s.WaitTimeout != 0 && s.OnUnmet != UnmetPolicyWait {
+		return fmt.Errorf("step %q specifies wait_timeout, which requires `on_unmet: wait`", s.Name)
+	}
+	return nil
+}
+
+// AwaitRequirements verifies the `requires:` conditions of this step
+// before it executes, and returns whether the step should run along
+// with the result of each requirement. Unmet requirements are handled
+// according to the on_unmet policy of the step: the step is skipped,
+// the requirements are verified again until wait_timeout passes,
+// or (by default) an error wrapping ErrRequirementsNotMet is returned.
+func (s *Step) AwaitRequirements(ctx context.Context, execCtx TTPExecutionContext) (bool, []CheckResult, error) {
+	if len(s.Requires) == 0 {
+		return true, nil, nil
+	}
+
+	var deadline <-chan time.Time
+	waitTimeout := time.Duration(s.WaitTimeout)
+	if s.OnUnmet == UnmetPolicyWait {
+		if waitTimeout == 0 {
+			waitTimeout = defaultWaitTimeout
+		}
+		timer := time.NewTimer(waitTimeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	// steps on remote targets keep a single connection
+	// to their target while they wait for requirements
+	verificationCtx, release, err := s.verificationContext(ctx, execCtx)
+	if err != nil {
+		return false, nil, err
+	}
+	defer release()
+
+	for {
+		results, err := s.runConditions(verificationCtx, nil, s.Requires, "requirement")
+		if err == nil {
+			return true, results, nil
+		}
+
+		switch s.OnUnmet {
+		case UnmetPolicySkip:
+			logging.L().Infof("Skipping step %q because its requirements are not met: %v", s.Name, err)
+			return false, results, nil
+		case UnmetPolicyWait:
+			logging.L().Debugf("Waiting for the requirements of step %q: %v", s.Name, err)
+			select {
+			case <-time.After(requirementPollInterval):
+				continue
+			case <-deadline:
+				return false, results, fmt.Errorf("%w after waiting %v: %w", ErrRequirementsNotMet, waitTimeout, err)
+			case <-ctx.Done():
+				return false, results, markInterrupted(ctx, s.Name, fmt.Errorf("%w: %w", ErrRequirementsNotMet, err))
+			}
+		}
+		return false, results, fmt.Errorf("%w: %w", ErrRequirementsNotMet, err)
+	}
+}
@@ -0,0 +1,355 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStepRequirements(t *testing.T) {
+	// keep the tests of on_unmet: wait fast
+	defer func(interval time.Duration) { requirementPollInterval = interval }(requirementPollInterval)
+	requirementPollInterval = 10 * time.Millisecond
+
+	testCases := []struct {
+		name                  string
+		content               string
+		expectedStatuses      map[string]StepStatus
+		expectedErrors        map[string]string
+		expectedRequirements  map[string][]bool
+		wantValidateError     bool
+		wantError             bool
+		expectedStdout        string
+		expectedCleanupStdout string
+	}{
+		{
+			name: "Requirements Met",
+			content: `name: met
+steps:
+  - name: first
+    requires:
+      - msg: target file must exist
+        path_exists: TMPDIR/exists.txt
+      - msg: HOME must be set
+        env_var: HOME
+    inline: echo first
+    cleanup:
+      print_str: cleanup_first`,
+			expectedStatuses: map[string]StepStatus{
+				"first": StepSucceeded,
+			},
+			expectedRequirements: map[string][]bool{
+				"first": {true, true},
+			},
+			expectedStdout:        "first\n",
+			expectedCleanupStdout: "cleanup_first\n",
+		},
+		{
+			name: "Fail Is The Default",
+			content: `name: fail
+steps:
+  - name: first
+    inline: echo first
+    cleanup:
+      print_str: cleanup_first
+  - name: needs_file
+    requires:
+      - msg: target file must exist
+        path_exists: TMPDIR/missing.txt
+    inline: echo should_not_run
+    cleanup:
+      print_str: should_not_clean_up
+  - name: never_runs
+    inline: echo should_not_run`,
+			expectedStatuses: map[string]StepStatus{
+				"first":      StepSucceeded,
+				"needs_file": StepFailed,
+			},
+			expectedErrors: map[string]string{
+				"needs_file": `requirements not met: requirement 1 of step "needs_file" failed`,
+			},
+			expectedRequirements: map[string][]bool{
+				"needs_file": {false},
+			},
+			wantError:             true,
+			expectedStdout:        "first\n",
+			expectedCleanupStdout: "cleanup_first\n",
+		},
+		{
+			name: "Skip",
+			content: `name: skip
+steps:
+  - name: needs_file
+    requires:
+      - msg: HOME must be set
+        env_var: HOME
+      - msg: target file must exist
+        path_exists: TMPDIR/missing.txt
+    on_unmet: skip
+    inline: echo should_not_run
+    cleanup:
+      print_str: should_not_clean_up
+  - name: last
+    inline: echo last`,
+			expectedStatuses: map[string]StepStatus{
+				"needs_file": StepSkipped,
+				"last":       StepSucceeded,
+			},
+			expectedRequirements: map[string][]bool{
+				"needs_file": {true, false},
+			},
+			expectedStdout: "last\n",
+		},
+		{
+			name: "Unmet Requirements Are Never Cleaned Up",
+			content: `name: cleanup_and_continue
+steps:
+  - name: needs_file
+    requires:
+      - msg: target file must exist
+        path_exists: TMPDIR/missing.txt
+    on_failure: cleanup_and_continue
+    inline: echo should_not_run
+    cleanup:
+      print_str: should_not_clean_up
+  - name: last
+    inline: echo last`,
+			expectedStatuses: map[string]StepStatus{
+				"needs_file": StepFailed,
+				"last":       StepSucceeded,
+			},
+			expectedStdout: "last\n",
+		},
+		{
+			name: "Wait Until Met",
+			content: `name: wait
+steps:
+  - name: group
+    parallel:
+      - name: waits
+        requires:
+          - msg: file must be created by the other step
+            path_exists: TMPDIR/created.txt
+        on_unmet: wait
+        wait_timeout: 10s
+        inline: echo waited
+      - name: creates
+        inline: sleep 0.2 && touch TMPDIR/created.txt`,
+			expectedStatuses: map[string]StepStatus{
+				"waits":   StepSucceeded,
+				"creates": StepSucceeded,
+			},
+			expectedRequirements: map[string][]bool{
+				"waits": {true},
+			},
+			expectedStdout: "waited\n",
+		},
+		{
+			name: "Wait Times Out",
+			content: `name: wait_timeout
+steps:
+  - name: waits
+    requires:
+      - msg: target file must exist
+        path_exists: TMPDIR/missing.txt
+    on_unmet: wait
+    wait_timeout: 100ms
+    on_failure: continue
+    inline: echo should_not_run
+  - name: last
+    inline: echo last`,
+			expectedStatuses: map[string]StepStatus{
+				"waits": StepFailed,
+				"last":  StepSucceeded,
+			},
+			expectedErrors: map[string]string{
+				"waits": "requirements not met after waiting 100ms",
+			},
+			expectedRequirements: map[string][]bool{
+				"waits": {false},
+			},
+			expectedStdout: "last\n",
+		},
+		{
+			name: "Wait Is Bounded By TTP Timeout",
+			content: `name: ttp_timeout
+timeout: 100ms
+steps:
+  - name: waits
+    requires:
+      - msg: target file must exist
+        path_exists: TMPDIR/missing.txt
+    on_unmet: wait
+    inline: echo should_not_run`,
+			expectedStatuses: map[string]StepStatus{
+				"waits": StepTimedOut,
+			},
+			wantError: true,
+		},
+		{
+			name: "Parallel Child Skipped",
+			content: `name: parallel_skip
+steps:
+  - name: group
+    parallel:
+      - name: skipped
+        requires:
+          - msg: target file must exist
+            path_exists: TMPDIR/missing.txt
+        on_unmet: skip
+        inline: echo should_not_run
+        cleanup:
+          print_str: should_not_clean_up
+      - name: runs
+        inline: echo runs
+        cleanup:
+          print_str: cleanup_runs`,
+			expectedStatuses: map[string]StepStatus{
+				"group":   StepSucceeded,
+				"skipped": StepSkipped,
+				"runs":    StepSucceeded,
+			},
+			expectedRequirements: map[string][]bool{
+				"skipped": {false},
+			},
+			expectedStdout:        "runs\n",
+			expectedCleanupStdout: "cleanup_runs\n",
+		},
+		{
+			name: "Parallel Child Fails",
+			content: `name: parallel_fail
+steps:
+  - name: group
+    parallel:
+      - name: fails
+        requires:
+          - msg: target file must exist
+            path_exists: TMPDIR/missing.txt
+        on_failure: cleanup_and_continue
+        inline: echo should_not_run
+        cleanup:
+          print_str: should_not_clean_up
+      - name: runs
+        inline: echo runs`,
+			expectedStatuses: map[string]StepStatus{
+				"group": StepSucceeded,
+				"fails": StepFailed,
+				"runs":  StepSucceeded,
+			},
+			expectedStdout: "runs\n",
+		},
+		{
+			name: "Invalid Policy",
+			content: `name: invalid
+steps:
+  - name: step1
+    requires:
+      - msg: HOME must be set
+        env_var: HOME
+    on_unmet: ignore
+    inline: echo step1`,
+			wantValidateError: true,
+		},
+		{
+			name: "Policy Without Requirements",
+			content: `name: invalid
+steps:
+  - name: step1
+    on_unmet: skip
+    inline: echo step1`,
+			wantValidateError: true,
+		},
+		{
+			name: "Wait Timeout Without Wait",
+			content: `name: invalid
+steps:
+  - name: step1
+    requires:
+      - msg: HOME must be set
+        env_var: HOME
+    on_unmet: skip
+    wait_timeout: 5s
+    inline: echo step1`,
+			wantValidateError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "exists.txt"), []byte("foo"), 0644))
+			content := strings.ReplaceAll(tc.content, "TMPDIR", tmpDir)
+
+			ttp, err := RenderTemplatedTTP(content, RenderParameters{})
+			require.NoError(t, err)
+
+			execCtx := NewTTPExecutionContext()
+			var stdoutBuf bytes.Buffer
+			execCtx.Cfg.Stdout = &stdoutBuf
+			err = ttp.Validate(execCtx)
+			if tc.wantValidateError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			err = ttp.Execute(context.Background(), execCtx)
+			if tc.wantError {
+				require.Error(t, err)
+				_, found := execCtx.StepResults.ByName["never_runs"]
+				assert.False(t, found, "steps after a failed step should not run")
+			} else {
+				require.NoError(t, err)
+			}
+
+			for name, status := range tc.expectedStatuses {
+				result, found := execCtx.StepResults.ByName[name]
+				require.True(t, found, "missing result for step %v", name)
+				assert.Equal(t, status, result.Status, "unexpected status for step %v", name)
+			}
+			for name, expectedError := range tc.expectedErrors {
+				assert.Contains(t, execCtx.StepResults.ByName[name].Error, expectedError)
+			}
+			for name, expectedPassed := range tc.expectedRequirements {
+				requirements := execCtx.StepResults.ByName[name].Requirements
+				require.Len(t, requirements, len(expectedPassed), "unexpected requirements for step %v", name)
+				for idx, passed := range expectedPassed {
+					assert.Equal(t, passed, requirements[idx].Passed, "unexpected result of requirement %d of step %v", idx+1, name)
+					assert.NotEmpty(t, requirements[idx].Msg)
+				}
+			}
+			assert.Equal(t, tc.expectedStdout, stdoutBuf.String())
+
+			stdoutBuf.Reset()
+			err = ttp.RunCleanup(execCtx)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedCleanupStdout, stdoutBuf.String())
+		})
+	}
+}
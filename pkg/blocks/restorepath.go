@@ -0,0 +1,84 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/spf13/afero"
+)
+
+// restorePathAction is the default cleanup action of the actions
+// that overwrite or remove paths: it restores the path from the
+// snapshot that the action took before changing it
+type restorePathAction struct {
+	actionDefaults
+	// fileSystem points to the file system field of the action
+	fileSystem *afero.Fs
+	// tempDir holds the snapshot of runs that do not
+	// record a cleanup journal in a state directory
+	tempDir string
+}
+
+// IsNil is not needed here, as this is not a user-accessible step type
+func (a *restorePathAction) IsNil() bool {
+	return false
+}
+
+// Validate is not needed here, as this is not a user-accessible step type
+func (a *restorePathAction) Validate(_ TTPExecutionContext) error {
+	return nil
+}
+
+// Execute restores the path from the snapshot of the step
+func (a *restorePathAction) Execute(_ context.Context, execCtx TTPExecutionContext) (*ActResult, error) {
+	if execCtx.snapshotDir == "" {
+		return nil, errors.New("no snapshot directory was set for this step")
+	}
+	if err := restoreSnapshot(execCtx.fileSystem(*a.fileSystem), execCtx.snapshotDir); err != nil {
+		return nil, err
+	}
+	return &ActResult{}, nil
+}
+
+// CanRunOnTarget enables this action to restore paths on a remote target
+func (a *restorePathAction) CanRunOnTarget() bool {
+	return true
+}
+
+// snapshotDir returns the directory in which the step stores the snapshot
+// that this action restores: the snapshot directory of the step in the
+// state directory of the run if it records a cleanup journal, or else
+// a temporary directory
+func (a *restorePathAction) snapshotDir(execCtx TTPExecutionContext, stepName string) (string, error) {
+	if dir := execCtx.journal.snapshotDir(stepName); dir != "" {
+		return dir, nil
+	}
+	if a.tempDir == "" {
+		tempDir, err := os.MkdirTemp("", "ttpforge-snapshot-")
+		if err != nil {
+			return "", err
+		}
+		a.tempDir = tempDir
+	}
+	return a.tempDir, nil
+}
@@ -19,20 +19,123 @@ THE SOFTWARE.
 
 package blocks
 
+import (
+	"errors"
+	"time"
+)
+
+// ErrTimedOut is wrapped by the errors of
+// steps that did not finish before their timeout
+var ErrTimedOut = errors.New("timed out")
+
+// ErrCancelled is wrapped by the errors of steps
+// that were stopped because TTPForge is shutting down
+var ErrCancelled = errors.New("cancelled")
+
 // ActResult contains common fields produced
 // from both the execution of steps and their
 // associated cleanup actions
 type ActResult struct {
-	Stdout  string
-	Stderr  string
-	Outputs map[string]string
+	Stdout string
+	Stderr string
+	// Outputs holds the values extracted from Stdout, which
+	// keep their type if they were extracted from JSON or YAML
+	Outputs map[string]interface{}
+
+	// ExitCode is the exit code of the process run by the
+	// action, or -1 if the process could not be started or
+	// was killed by a signal. It is 0 for actions that
+	// do not run a process.
+	ExitCode int
+
+	// StartTime, EndTime and Duration record
+	// when the action was executed
+	StartTime time.Time
+	EndTime   time.Time
+	Duration  time.Duration
+}
+
+// StepStatus describes what happened to a step
+// when the TTP was executed
+type StepStatus string
+
+const (
+	// StepSucceeded means that the step ran successfully
+	StepSucceeded StepStatus = "succeeded"
+	// StepSkipped means that the step was neither executed nor
+	// cleaned up, because its `if:` condition was false, it does
+	// not support the current platform, or its requirements
+	// were not met and it specifies `on_unmet: skip`
+	StepSkipped StepStatus = "skipped"
+	// StepFailed means that the step returned an error
+	StepFailed StepStatus = "failed"
+	// StepTimedOut means that the step was killed
+	// because it exceeded its timeout or that of its TTP
+	StepTimedOut StepStatus = "timed_out"
+	// StepCancelled means that the step was killed
+	// because TTPForge received a shutdown signal
+	StepCancelled StepStatus = "cancelled"
+	// StepChecksFailed means that the step ran successfully,
+	// but at least one of its checks failed afterward
+	StepChecksFailed StepStatus = "checks_failed"
+	// StepNotRun is used in reports for steps that were never
+	// reached, because an earlier step stopped the TTP
+	StepNotRun StepStatus = "not_run"
+)
+
+// statusForError determines the status of a step that returned err
+func statusForError(err error) StepStatus {
+	if errors.Is(err, ErrTimedOut) {
+		return StepTimedOut
+	}
+	if errors.Is(err, ErrCancelled) {
+		return StepCancelled
+	}
+	return StepFailed
+}
+
+// CheckResult records the outcome of one of the checks of a step
+type CheckResult struct {
+	Msg    string `json:"msg"`
+	Passed bool   `json:"passed"`
+	Error  string `json:"error,omitempty"`
 }
 
 // ExecutionResult stores the results/outputs
 // generated by executing a Step
 type ExecutionResult struct {
 	ActResult
-	Cleanup *ActResult
+	Status StepStatus
+	// Error holds the error message of
+	// steps that did not succeed
+	Error string
+	// Requirements holds the results of the `requires:`
+	// conditions that were verified before the step ran
+	Requirements []CheckResult
+	Checks       []CheckResult
+	Cleanup      *ActResult
+}
+
+// requirementsMet reports whether every requirement of the step that
+// produced this result was met, and hence whether the step was executed
+func (r *ExecutionResult) requirementsMet() bool {
+	for _, requirement := range r.Requirements {
+		if !requirement.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// needsCleanup reports whether the step that produced this result
+// still has to be cleaned up. Steps that failed are not cleaned up,
+// but steps that ran and then failed their checks are.
+func (r *ExecutionResult) needsCleanup() bool {
+	if r.Cleanup != nil {
+		// already cleaned up right after it failed
+		return false
+	}
+	return r.Status == StepSucceeded || r.Status == StepChecksFailed
 }
 
 // StepResultsRecord provides convenient accessors
@@ -0,0 +1,67 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// RetryPolicy controls how many times a failing step
+// is executed and how long to wait between attempts.
+type RetryPolicy struct {
+	// Attempts is the total number of times the step may be executed
+	Attempts int `yaml:"attempts,omitempty"`
+	// Delay is how long to wait before the second attempt
+	Delay Duration `yaml:"delay,omitempty"`
+	// Backoff multiplies the delay after every attempt
+	Backoff float64 `yaml:"backoff,omitempty"`
+	// RetryOnCheckFailure also retries the step if it
+	// executed successfully but its checks failed
+	RetryOnCheckFailure bool `yaml:"retry_on_check_failure,omitempty"`
+}
+
+// Validate ensures that the retry policy is sensible
+func (r *RetryPolicy) Validate() error {
+	if r.Attempts < 1 {
+		return errors.New("retry attempts must be at least 1")
+	}
+	if r.Delay < 0 {
+		return errors.New("retry delay must not be negative")
+	}
+	if r.Backoff != 0 && r.Backoff < 1 {
+		return errors.New("retry backoff multiplier must be at least 1")
+	}
+	return nil
+}
+
+// delayBeforeAttempt returns how long to wait before
+// the specified attempt (numbered from 1)
+func (r *RetryPolicy) delayBeforeAttempt(attempt int) time.Duration {
+	if attempt <= 1 {
+		return 0
+	}
+	backoff := r.Backoff
+	if backoff == 0 {
+		backoff = 1
+	}
+	return time.Duration(float64(r.Delay) * math.Pow(backoff, float64(attempt-2)))
+}
@@ -0,0 +1,280 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/ttpforge/pkg/repos"
+	"github.com/facebookincubator/ttpforge/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestDurationUnmarshal(t *testing.T) {
+	testCases := []struct {
+		name      string
+		content   string
+		expected  time.Duration
+		wantError bool
+	}{
+		{
+			name:     "Integer Seconds",
+			content:  "5",
+			expected: 5 * time.Second,
+		},
+		{
+			name:     "Fractional Seconds",
+			content:  "0.5",
+			expected: 500 * time.Millisecond,
+		},
+		{
+			name:     "Go Duration String",
+			content:  "1m30s",
+			expected: 90 * time.Second,
+		},
+		{
+			name:      "Invalid Duration",
+			content:   "soon",
+			wantError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var d Duration
+			err := yaml.Unmarshal([]byte(tc.content), &d)
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, time.Duration(d))
+		})
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{
+		Attempts: 4,
+		Delay:    Duration(time.Second),
+		Backoff:  2,
+	}
+	assert.Equal(t, time.Duration(0), policy.delayBeforeAttempt(1))
+	assert.Equal(t, time.Second, policy.delayBeforeAttempt(2))
+	assert.Equal(t, 2*time.Second, policy.delayBeforeAttempt(3))
+	assert.Equal(t, 4*time.Second, policy.delayBeforeAttempt(4))
+
+	policy.Backoff = 0
+	assert.Equal(t, time.Second, policy.delayBeforeAttempt(4), "delay should be constant without backoff")
+}
+
+func TestRetryPolicyFromFetchURIRetries(t *testing.T) {
+	content := `name: fetch
+fetch_uri: http://localhost:1/file
+location: /tmp/ttpforge-retry-test-fetch
+retries: "2"`
+	var s Step
+	err := yaml.Unmarshal([]byte(content), &s)
+	require.NoError(t, err)
+	assert.Equal(t, 3, s.retryPolicy().Attempts)
+
+	content += `
+retry:
+  attempts: 5`
+	err = yaml.Unmarshal([]byte(content), &s)
+	require.NoError(t, err)
+	assert.Equal(t, 5, s.retryPolicy().Attempts, "explicit retry policy should take precedence")
+}
+
+func TestStepRetry(t *testing.T) {
+	testCases := []struct {
+		name              string
+		contentFmtStr     string
+		wantValidateError bool
+		wantError         bool
+		expectedStdout    string
+		expectedAttempts  string
+	}{
+		{
+			name: "Succeeds On Third Attempt",
+			contentFmtStr: `name: flaky
+inline: |
+  echo -n x >> %[1]v/attempts
+  [ "$(cat %[1]v/attempts)" = "xxx" ]
+  echo finally
+retry:
+  attempts: 5
+  delay: 10ms
+  backoff: 2`,
+			expectedStdout:   "finally\n",
+			expectedAttempts: "xxx",
+		},
+		{
+			name: "Runs Out Of Attempts",
+			contentFmtStr: `name: always_fails
+inline: |
+  echo -n x >> %[1]v/attempts
+  false
+retry:
+  attempts: 3`,
+			wantError:        true,
+			expectedAttempts: "xxx",
+		},
+		{
+			name: "Retries When Checks Fail",
+			contentFmtStr: `name: eventually_creates_file
+inline: |
+  echo -n x >> %[1]v/attempts
+  if [ "$(tr -d c < %[1]v/attempts)" = "xx" ]; then touch %[1]v/created; fi
+  echo done
+checks:
+  - msg: file was not created
+    path_exists: %[1]v/created
+retry:
+  attempts: 3
+  retry_on_check_failure: true
+cleanup:
+  inline: echo -n c >> %[1]v/attempts`,
+			expectedStdout:   "done\n",
+			expectedAttempts: "xcx",
+		},
+		{
+			name: "Check Failures Are Not Retried By Default",
+			contentFmtStr: `name: no_check_retry
+inline: echo -n x >> %[1]v/attempts
+checks:
+  - msg: file was not created
+    path_exists: %[1]v/never_created
+retry:
+  attempts: 3`,
+			expectedAttempts: "x",
+		},
+		{
+			name: "Invalid Attempts",
+			contentFmtStr: `name: bad_policy
+inline: echo -n x >> %[1]v/attempts
+retry:
+  attempts: 0`,
+			wantValidateError: true,
+		},
+		{
+			name: "Invalid Backoff",
+			contentFmtStr: `name: bad_policy
+inline: echo -n x >> %[1]v/attempts
+retry:
+  attempts: 2
+  backoff: 0.5`,
+			wantValidateError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			var s Step
+			err := yaml.Unmarshal([]byte(fmt.Sprintf(tc.contentFmtStr, tmpDir)), &s)
+			require.NoError(t, err)
+
+			execCtx := NewTTPExecutionContext()
+			var stdoutBuf bytes.Buffer
+			execCtx.Cfg.Stdout = &stdoutBuf
+			err = s.Validate(execCtx)
+			if tc.wantValidateError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			result, err := s.Execute(context.Background(), execCtx)
+			attempts := readFileOrEmpty(t, filepath.Join(tmpDir, "attempts"))
+			assert.Equal(t, tc.expectedAttempts, attempts)
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedStdout, result.Stdout)
+		})
+	}
+}
+
+func TestSubTTPRetry(t *testing.T) {
+	tmpDir := t.TempDir()
+	fsys, err := testutils.MakeAferoTestFs(map[string][]byte{
+		"repo/" + repos.RepoConfigFileName: []byte(`ttp_search_paths: ["ttps"]`),
+		"repo/ttps/flaky.yaml": []byte(fmt.Sprintf(`name: flaky
+steps:
+  - name: first
+    inline: echo -n 1 >> %[1]v/log
+    cleanup:
+      inline: echo -n c >> %[1]v/log
+  - name: second
+    inline: |
+      if [ ! -f %[1]v/marker ]; then touch %[1]v/marker; exit 1; fi
+      echo -n 2 >> %[1]v/log`, tmpDir)),
+	})
+	require.NoError(t, err)
+	spec := repos.Spec{
+		Name: "default",
+		Path: "repo",
+	}
+	repo, err := spec.Load(fsys, "")
+	require.NoError(t, err)
+
+	execCtx := NewTTPExecutionContext()
+	execCtx.Cfg.Repo = repo
+
+	content := `name: retry_sub_ttp
+ttp: flaky.yaml
+retry:
+  attempts: 2`
+	var s Step
+	err = yaml.Unmarshal([]byte(content), &s)
+	require.NoError(t, err)
+	err = s.Validate(execCtx)
+	require.NoError(t, err)
+
+	_, err = s.Execute(context.Background(), execCtx)
+	require.NoError(t, err)
+
+	// the failed first attempt must be cleaned up
+	// before the sub TTP is executed again
+	assert.Equal(t, "1c12", readFileOrEmpty(t, filepath.Join(tmpDir, "log")))
+	subStep, ok := s.action.(*SubTTPStep)
+	require.True(t, ok)
+	assert.Len(t, subStep.subExecCtx.StepResults.ByIndex, 2, "results of the failed attempt should be discarded")
+}
+
+func readFileOrEmpty(t *testing.T, path string) string {
+	contents, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ""
+	}
+	require.NoError(t, err)
+	return string(contents)
+}
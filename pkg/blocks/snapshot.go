@@ -0,0 +1,286 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/ttpforge/pkg/logging"
+	"github.com/pkg/sftp"
+	"github.com/spf13/afero"
+)
+
+const (
+	// snapshotsDirName is the name of the directory in the state
+	// directory of a run that holds the snapshots of its steps
+	snapshotsDirName = "snapshots"
+	// snapshotManifestName is the name of the file that describes
+	// a snapshot - it is written last, so a snapshot without
+	// it is incomplete
+	snapshotManifestName = "snapshot.json"
+	// snapshotFilesDirName is the name of the directory that
+	// holds the contents of the files of a snapshot
+	snapshotFilesDirName = "files"
+)
+
+// pathSnapshot records the state of a path before an action
+// overwrote or removed it, so that the path can be restored on
+// cleanup. Directories are recorded with everything they contain.
+type pathSnapshot struct {
+	Path string `json:"path"`
+	// Exists is false if there was nothing at the path,
+	// in which case restoring the snapshot removes the path
+	Exists  bool            `json:"exists"`
+	Entries []snapshotEntry `json:"entries,omitempty"`
+}
+
+// snapshotEntry is a file, directory or symlink within a snapshot.
+// The contents of the file at index i of the entries are stored
+// in the file named i within the files directory of the snapshot.
+type snapshotEntry struct {
+	// Path is relative to the path of the snapshot
+	Path    string      `json:"path"`
+	Mode    fs.FileMode `json:"mode"`
+	ModTime time.Time   `json:"mod_time"`
+	Owner   *fileOwner  `json:"owner,omitempty"`
+	// LinkTarget is the target of symlinks
+	LinkTarget string `json:"link_target,omitempty"`
+}
+
+// fileOwner holds the user and group that own a file
+type fileOwner struct {
+	UID int `json:"uid"`
+	GID int `json:"gid"`
+}
+
+// ownerOf returns the owner of a file on a remote target or
+// the local file system, or nil if it cannot be determined
+func ownerOf(info fs.FileInfo) *fileOwner {
+	if stat, ok := info.Sys().(*sftp.FileStat); ok {
+		return &fileOwner{UID: int(stat.UID), GID: int(stat.GID)}
+	}
+	return localOwnerOf(info)
+}
+
+// snapshotDirName turns a step name (which may contain
+// any character) into the name of a directory
+func snapshotDirName(stepName string) string {
+	return strings.ReplaceAll(url.PathEscape(stepName), ".", "%2E")
+}
+
+// takeSnapshot records the state of filePath in the snapshot directory
+// of the running step. Nothing is recorded if the cleanup of the step
+// does not restore snapshots, or if an earlier attempt of the step
+// already recorded the state of the path.
+func (c TTPExecutionContext) takeSnapshot(fsys afero.Fs, filePath string) error {
+	if c.snapshotDir == "" {
+		return nil
+	}
+	manifestPath := filepath.Join(c.snapshotDir, snapshotManifestName)
+	if _, err := os.Stat(manifestPath); err == nil {
+		return nil
+	}
+	// discard whatever an incomplete snapshot left behind
+	if err := os.RemoveAll(c.snapshotDir); err != nil {
+		return err
+	}
+	filesDir := filepath.Join(c.snapshotDir, snapshotFilesDirName)
+	if err := os.MkdirAll(filesDir, 0700); err != nil {
+		return err
+	}
+
+	snapshot := pathSnapshot{Path: filePath}
+	_, err := lstat(fsys, filePath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return err
+	default:
+		snapshot.Exists = true
+		err = afero.Walk(fsys, filePath, func(entryPath string, info fs.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			relPath, err := filepath.Rel(filePath, entryPath)
+			if err != nil {
+				return err
+			}
+			entry := snapshotEntry{
+				Path:    filepath.ToSlash(relPath),
+				Mode:    info.Mode(),
+				ModTime: info.ModTime(),
+				Owner:   ownerOf(info),
+			}
+			switch {
+			case info.Mode()&fs.ModeSymlink != 0:
+				linkReader, ok := fsys.(afero.LinkReader)
+				if !ok {
+					return fmt.Errorf("cannot read symlink %v", entryPath)
+				}
+				if entry.LinkTarget, err = linkReader.ReadlinkIfPossible(entryPath); err != nil {
+					return err
+				}
+			case info.Mode().IsRegular():
+				contentsPath := filepath.Join(filesDir, strconv.Itoa(len(snapshot.Entries)))
+				if err := copyToSnapshot(fsys, entryPath, contentsPath); err != nil {
+					return err
+				}
+			case !info.IsDir():
+				logging.L().Warnf("Not recording %v in snapshot: unsupported file type %v", entryPath, info.Mode().Type())
+				return nil
+			}
+			snapshot.Entries = append(snapshot.Entries, entry)
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("could not take snapshot of %v: %w", filePath, err)
+		}
+	}
+
+	manifest, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(manifestPath, manifest, 0600)
+}
+
+func lstat(fsys afero.Fs, filePath string) (fs.FileInfo, error) {
+	if lstater, ok := fsys.(afero.Lstater); ok {
+		info, _, err := lstater.LstatIfPossible(filePath)
+		return info, err
+	}
+	return fsys.Stat(filePath)
+}
+
+func copyToSnapshot(fsys afero.Fs, src, dst string) error {
+	srcFile, err := fsys.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+	dstFile, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dstFile, srcFile); err != nil {
+		dstFile.Close()
+		return err
+	}
+	return dstFile.Close()
+}
+
+// restoreSnapshot restores the path recorded in snapshotDir to its
+// recorded state and then removes the snapshot. Ownership that cannot
+// be restored (for lack of privileges) is only logged.
+func restoreSnapshot(fsys afero.Fs, snapshotDir string) error {
+	manifest, err := os.ReadFile(filepath.Join(snapshotDir, snapshotManifestName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("no snapshot was found in %v", snapshotDir)
+	} else if err != nil {
+		return err
+	}
+	var snapshot pathSnapshot
+	if err := json.Unmarshal(manifest, &snapshot); err != nil {
+		return fmt.Errorf("failed to decode snapshot in %v: %w", snapshotDir, err)
+	}
+
+	if !snapshot.Exists {
+		logging.L().Infof("Removing path %v", snapshot.Path)
+	} else {
+		logging.L().Infof("Restoring %v from snapshot", snapshot.Path)
+	}
+	if err := fsys.RemoveAll(snapshot.Path); err != nil {
+		return err
+	}
+	entryPaths := make([]string, len(snapshot.Entries))
+	for idx, entry := range snapshot.Entries {
+		entryPaths[idx] = filepath.Join(snapshot.Path, filepath.FromSlash(entry.Path))
+		if err := restoreEntry(fsys, entryPaths[idx], entry, filepath.Join(snapshotDir, snapshotFilesDirName, strconv.Itoa(idx))); err != nil {
+			return fmt.Errorf("could not restore %v: %w", entryPaths[idx], err)
+		}
+	}
+	// modification times are restored last, since creating the
+	// contents of a directory changes its modification time
+	for idx := len(snapshot.Entries) - 1; idx >= 0; idx-- {
+		entry := snapshot.Entries[idx]
+		if entry.Mode&fs.ModeSymlink != 0 {
+			continue
+		}
+		if err := fsys.Chtimes(entryPaths[idx], entry.ModTime, entry.ModTime); err != nil {
+			return fmt.Errorf("could not restore modification time of %v: %w", entryPaths[idx], err)
+		}
+	}
+	return os.RemoveAll(snapshotDir)
+}
+
+func restoreEntry(fsys afero.Fs, entryPath string, entry snapshotEntry, contentsPath string) error {
+	perm := entry.Mode & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+	switch {
+	case entry.Mode&fs.ModeSymlink != 0:
+		linker, ok := fsys.(afero.Linker)
+		if !ok {
+			return errors.New("symlinks are not supported by the file system")
+		}
+		return linker.SymlinkIfPossible(entry.LinkTarget, entryPath)
+	case entry.Mode.IsDir():
+		if err := fsys.Mkdir(entryPath, perm.Perm()); err != nil {
+			return err
+		}
+	default:
+		if err := restoreContents(fsys, entryPath, contentsPath, perm.Perm()); err != nil {
+			return err
+		}
+	}
+	// changing the owner clears the setuid and setgid bits,
+	// so the owner is restored before the mode
+	if entry.Owner != nil {
+		if err := fsys.Chown(entryPath, entry.Owner.UID, entry.Owner.GID); err != nil {
+			logging.L().Warnf("Could not restore owner of %v: %v", entryPath, err)
+		}
+	}
+	return fsys.Chmod(entryPath, perm)
+}
+
+func restoreContents(fsys afero.Fs, dst, src string, perm fs.FileMode) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+	dstFile, err := fsys.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dstFile, srcFile); err != nil {
+		dstFile.Close()
+		return err
+	}
+	return dstFile.Close()
+}
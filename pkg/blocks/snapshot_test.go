@@ -0,0 +1,226 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"bytes"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/ttpforge/pkg/testutils"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshots(t *testing.T) {
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	testCases := []struct {
+		name          string
+		fsysContents  map[string][]byte
+		snapshotPath  string
+		change        func(fsys afero.Fs) error
+		expectedFiles map[string]string
+		expectedDirs  []string
+		wantAbsent    bool
+	}{
+		{
+			name:         "Overwritten File",
+			fsysContents: map[string][]byte{"/etc/hosts": []byte("127.0.0.1 localhost\n")},
+			snapshotPath: "/etc/hosts",
+			change: func(fsys afero.Fs) error {
+				return afero.WriteFile(fsys, "/etc/hosts", []byte("10.0.0.1 evil\n"), 0644)
+			},
+			expectedFiles: map[string]string{"/etc/hosts": "127.0.0.1 localhost\n"},
+		},
+		{
+			name: "Removed Directory",
+			fsysContents: map[string][]byte{
+				"/home/user/.ssh/authorized_keys": []byte("ssh-ed25519 AAAA"),
+				"/home/user/.ssh/keys/id_rsa":     []byte("secret"),
+			},
+			snapshotPath: "/home/user/.ssh",
+			change: func(fsys afero.Fs) error {
+				return fsys.RemoveAll("/home/user/.ssh")
+			},
+			expectedFiles: map[string]string{
+				"/home/user/.ssh/authorized_keys": "ssh-ed25519 AAAA",
+				"/home/user/.ssh/keys/id_rsa":     "secret",
+			},
+			expectedDirs: []string{"/home/user/.ssh", "/home/user/.ssh/keys"},
+		},
+		{
+			name:         "Created File",
+			fsysContents: map[string][]byte{"/tmp/other": []byte("untouched")},
+			snapshotPath: "/tmp/created",
+			change: func(fsys afero.Fs) error {
+				return afero.WriteFile(fsys, "/tmp/created", []byte("new"), 0644)
+			},
+			expectedFiles: map[string]string{"/tmp/other": "untouched"},
+			wantAbsent:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fsys, err := testutils.MakeAferoTestFs(tc.fsysContents)
+			require.NoError(t, err)
+			for path := range tc.fsysContents {
+				require.NoError(t, fsys.Chmod(path, 0600))
+				require.NoError(t, fsys.Chtimes(path, modTime, modTime))
+			}
+			for _, dir := range tc.expectedDirs {
+				require.NoError(t, fsys.Chmod(dir, fs.ModeDir|0750))
+				require.NoError(t, fsys.Chtimes(dir, modTime, modTime))
+			}
+
+			execCtx := NewTTPExecutionContext()
+			execCtx.snapshotDir = filepath.Join(t.TempDir(), "snapshot")
+			require.NoError(t, execCtx.takeSnapshot(fsys, tc.snapshotPath))
+			require.NoError(t, tc.change(fsys))
+			// later attempts keep the original snapshot
+			require.NoError(t, execCtx.takeSnapshot(fsys, tc.snapshotPath))
+
+			require.NoError(t, restoreSnapshot(fsys, execCtx.snapshotDir))
+			for path, expectedContents := range tc.expectedFiles {
+				contents, err := afero.ReadFile(fsys, path)
+				require.NoError(t, err)
+				assert.Equal(t, expectedContents, string(contents))
+				info, err := fsys.Stat(path)
+				require.NoError(t, err)
+				assert.Equal(t, fs.FileMode(0600), info.Mode().Perm(), path)
+				assert.True(t, modTime.Equal(info.ModTime()), path)
+			}
+			for _, dir := range tc.expectedDirs {
+				info, err := fsys.Stat(dir)
+				require.NoError(t, err)
+				assert.True(t, info.IsDir())
+				assert.Equal(t, fs.FileMode(0750), info.Mode().Perm(), dir)
+				assert.True(t, modTime.Equal(info.ModTime()), dir)
+			}
+			exists, err := afero.Exists(fsys, tc.snapshotPath)
+			require.NoError(t, err)
+			assert.Equal(t, !tc.wantAbsent, exists)
+
+			// the snapshot is removed once it is restored
+			assert.NoDirExists(t, execCtx.snapshotDir)
+			require.Error(t, restoreSnapshot(fsys, execCtx.snapshotDir))
+		})
+	}
+}
+
+func TestDefaultCleanupRestoresSnapshots(t *testing.T) {
+	testCases := []struct {
+		name     string
+		journal  bool
+		deferred bool
+	}{
+		{
+			name: "Without Journal",
+		},
+		{
+			name:    "With Journal",
+			journal: true,
+		},
+		{
+			name:     "Deferred Cleanup",
+			journal:  true,
+			deferred: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			history := filepath.Join(dir, "bash_history")
+			hosts := filepath.Join(dir, "hosts")
+			config := filepath.Join(dir, "config")
+			created := filepath.Join(dir, "created")
+			require.NoError(t, os.WriteFile(history, []byte("ls\n"), 0600))
+			require.NoError(t, os.WriteFile(hosts, []byte("127.0.0.1 localhost\n"), 0644))
+			require.NoError(t, os.WriteFile(config, []byte("original"), 0640))
+			ttp, err := RenderTemplatedTTP(`name: snapshots
+args:
+  - name: dir
+steps:
+  - name: remove_history
+    remove_path: {{.Args.dir}}/bash_history
+    cleanup: default
+  - name: replace_hosts
+    create_file: {{.Args.dir}}/hosts
+    contents: 10.0.0.1 localhost
+    overwrite: true
+    cleanup: default
+  - name: create
+    create_file: {{.Args.dir}}/created
+    contents: new
+    cleanup: default
+  - name: overwrite_config
+    copy_path: {{.Args.dir}}/created
+    to: {{.Args.dir}}/config
+    overwrite: true
+    cleanup: default`, RenderParameters{
+				Args: map[string]interface{}{"dir": dir},
+			})
+			require.NoError(t, err)
+
+			execCtx := NewTTPExecutionContext()
+			execCtx.Cfg.RunID = "test-run"
+			execCtx.Cfg.NoCleanup = tc.deferred
+			execCtx.Cfg.Stdout = &bytes.Buffer{}
+			require.NoError(t, ttp.Validate(execCtx))
+			stateDir := t.TempDir()
+			if tc.journal {
+				require.NoError(t, execCtx.EnableCleanupJournal(ttp, stateDir))
+			}
+			require.NoError(t, ttp.Execute(context.Background(), execCtx))
+			assert.NoFileExists(t, history)
+			contents, err := os.ReadFile(config)
+			require.NoError(t, err)
+			assert.Equal(t, "new", string(contents))
+
+			if tc.journal {
+				assert.FileExists(t, filepath.Join(stateDir, "test-run", snapshotsDirName, "remove_history", snapshotManifestName))
+			}
+			if tc.deferred {
+				require.NoError(t, RunDeferredCleanup(stateDir, "test-run", TTPExecutionConfig{}))
+			} else {
+				require.NoError(t, ttp.RunCleanup(execCtx))
+			}
+
+			for path, expected := range map[string]string{
+				history: "ls\n",
+				hosts:   "127.0.0.1 localhost\n",
+				config:  "original",
+			} {
+				contents, err := os.ReadFile(path)
+				require.NoError(t, err)
+				assert.Equal(t, expected, string(contents))
+			}
+			assert.NoFileExists(t, created)
+			assert.NoDirExists(t, filepath.Join(stateDir, "test-run"))
+		})
+	}
+}
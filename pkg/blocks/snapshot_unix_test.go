@@ -0,0 +1,75 @@
+//go:build !windows
+// +build !windows
+
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotsOnLocalFileSystem(t *testing.T) {
+	modTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	root := filepath.Join(t.TempDir(), "victim")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "bin"), 0755))
+	script := filepath.Join(root, "bin", "run.sh")
+	require.NoError(t, os.WriteFile(script, []byte("#!/bin/sh\n"), 0755))
+	require.NoError(t, os.Chmod(script, 0755|os.ModeSetgid))
+	link := filepath.Join(root, "current")
+	require.NoError(t, os.Symlink("bin/run.sh", link))
+	for _, path := range []string{script, filepath.Join(root, "bin"), root} {
+		require.NoError(t, os.Chtimes(path, modTime, modTime))
+	}
+
+	fsys := afero.NewOsFs()
+	execCtx := NewTTPExecutionContext()
+	execCtx.snapshotDir = filepath.Join(t.TempDir(), "snapshot")
+	require.NoError(t, execCtx.takeSnapshot(fsys, root))
+	require.NoError(t, os.RemoveAll(root))
+	require.NoError(t, restoreSnapshot(fsys, execCtx.snapshotDir))
+
+	info, err := os.Stat(script)
+	require.NoError(t, err)
+	assert.Equal(t, 0755|os.ModeSetgid, info.Mode())
+	assert.True(t, modTime.Equal(info.ModTime()))
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	require.True(t, ok)
+	assert.Equal(t, os.Getuid(), int(stat.Uid))
+
+	target, err := os.Readlink(link)
+	require.NoError(t, err)
+	assert.Equal(t, "bin/run.sh", target)
+
+	for _, dir := range []string{root, filepath.Join(root, "bin")} {
+		info, err := os.Stat(dir)
+		require.NoError(t, err)
+		assert.Equal(t, os.ModeDir|0755, info.Mode(), dir)
+		assert.True(t, modTime.Equal(info.ModTime()), dir)
+	}
+}
@@ -0,0 +1,351 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/facebookincubator/ttpforge/pkg/fileutils"
+	"github.com/facebookincubator/ttpforge/pkg/logging"
+)
+
+// DefaultSpawnWaitTimeout is how long a spawn step waits for the output
+// of its process to match wait_for_output, unless the step or its TTP
+// specify a timeout
+const DefaultSpawnWaitTimeout = 60 * time.Second
+
+// spawnPollInterval is how often the output of a spawned
+// process is checked against wait_for_output
+const spawnPollInterval = 100 * time.Millisecond
+
+// SpawnStep starts a long-lived process in the background - such as an
+// implant stand-in or a reverse shell listener - and moves on to the next
+// step without waiting for it to exit. The ID of the process is available
+// as $forge.steps.<name>.outputs.pid (and the file to which its output is
+// written as $forge.steps.<name>.outputs.log), and the process is killed along with
+// every process that it started when the step is cleaned up.
+type SpawnStep struct {
+	actionDefaults `yaml:",inline"`
+	Spawn          string            `yaml:"spawn,omitempty"`
+	ExecutorName   string            `yaml:"executor,omitempty"`
+	Environment    map[string]string `yaml:"env,omitempty"`
+	// WaitForOutput is a regular expression that the output of the
+	// process must match before the step completes - ^ and $ match
+	// at the start and end of each line
+	WaitForOutput string `yaml:"wait_for_output,omitempty"`
+	// LogTo is the file to which the output of the process is
+	// written - by default, it is written to a temporary file
+	// that is removed when the process is killed
+	LogTo string `yaml:"log_to,omitempty"`
+	// KillSignal is the signal that asks the processes to exit
+	// on cleanup, before they are forcibly killed
+	KillSignal string `yaml:"kill_signal,omitempty"`
+
+	waitRegexp *regexp.Regexp
+	killSignal syscall.Signal
+	process    *spawnedProcess
+}
+
+// spawnedProcess is a process started by a spawn step
+type spawnedProcess struct {
+	pid int
+	// startTime identifies the process along with its ID, which may
+	// be reused once it has exited - it is empty if it is unknown
+	startTime string
+	logPath   string
+	// tempFiles are removed once the process has been killed
+	tempFiles []string
+	// exited is closed once the process has exited - it is nil for
+	// processes restored from a cleanup journal, which TTPForge
+	// cannot wait for since they are not its children
+	exited chan struct{}
+}
+
+// NewSpawnStep creates a new SpawnStep instance and returns a pointer to it.
+func NewSpawnStep() *SpawnStep {
+	return &SpawnStep{}
+}
+
+// IsNil checks if the step is nil or empty and returns a boolean value.
+func (s *SpawnStep) IsNil() bool {
+	switch {
+	case s.Spawn == "":
+		return true
+	default:
+		return false
+	}
+}
+
+// Validate validates the step, checking for the necessary attributes and dependencies.
+func (s *SpawnStep) Validate(execCtx TTPExecutionContext) error {
+	if s.Spawn == "" {
+		return errors.New("spawn must be provided")
+	}
+	if s.ExecutorName == "" {
+		s.ExecutorName = ExecutorBash
+	}
+	if err := validateExecutor(execCtx, s.ExecutorName); err != nil {
+		return err
+	}
+	if s.WaitForOutput != "" {
+		// ^ and $ match at the start and end of each line of output
+		waitRegexp, err := regexp.Compile("(?m)" + s.WaitForOutput)
+		if err != nil {
+			return fmt.Errorf("invalid wait_for_output regex %q: %w", s.WaitForOutput, err)
+		}
+		s.waitRegexp = waitRegexp
+	}
+	killSignal, err := parseKillSignal(s.KillSignal)
+	if err != nil {
+		return err
+	}
+	s.killSignal = killSignal
+	return nil
+}
+
+// Execute starts the process and waits until its output
+// matches wait_for_output, if specified
+func (s *SpawnStep) Execute(ctx context.Context, execCtx TTPExecutionContext) (*ActResult, error) {
+	ctx, cancel := processContext(ctx, DefaultSpawnWaitTimeout)
+	defer cancel()
+
+	process, err := s.start(execCtx)
+	if err != nil {
+		return nil, err
+	}
+	s.process = process
+	logging.L().Infof("Spawned process %d (output: %v)", process.pid, process.logPath)
+
+	if s.waitRegexp != nil {
+		if err := process.waitForOutput(ctx, s.waitRegexp); err != nil {
+			// failed steps are not cleaned up,
+			// so the process is killed right away
+			if killErr := s.kill(); killErr != nil {
+				logging.L().Errorf("Failed to kill process %d: %v", process.pid, killErr)
+			}
+			return nil, err
+		}
+	}
+	return &ActResult{
+		Outputs: map[string]interface{}{
+			"pid":            process.pid,
+			"pid_start_time": process.startTime,
+			"log":            process.logPath,
+		},
+	}, nil
+}
+
+// start starts the process, with its output redirected to a file
+// rather than to TTPForge, so that it keeps running (and writing
+// output) even if TTPForge exits without cleaning it up
+func (s *SpawnStep) start(execCtx TTPExecutionContext) (*spawnedProcess, error) {
+	expandedInlines, err := execCtx.ExpandVariables([]string{s.Spawn})
+	if err != nil {
+		return nil, err
+	}
+	env, err := execCtx.commandEnv(s.Environment)
+	if err != nil {
+		return nil, err
+	}
+	process := &spawnedProcess{exited: make(chan struct{})}
+	logFile, err := s.openLog(process)
+	if err != nil {
+		return nil, err
+	}
+	defer logFile.Close()
+
+	def := lookupExecutor(execCtx.Cfg.Executors, s.ExecutorName)
+	body := def.Wrap(expandedInlines[0])
+	// the process must outlive the step, so
+	// its command is not bound to any context
+	var command []string
+	if def.UsesFile() {
+		scriptPath, err := writeScriptFile(body, def.ScriptExtension())
+		if err != nil {
+			process.removeTempFiles()
+			return nil, err
+		}
+		process.tempFiles = append(process.tempFiles, scriptPath)
+		command = def.InlineCommand(scriptPath)
+	} else {
+		command = def.InlineCommand("")
+	}
+	// @lint-ignore G204
+	cmd := exec.Command(command[0], command[1:]...)
+	if !def.UsesFile() {
+		cmd.Stdin = strings.NewReader(body)
+	}
+	startProcessTree(cmd)
+	cmd.Env = env
+	cmd.Dir = execCtx.Vars.WorkDir
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Start(); err != nil {
+		process.removeTempFiles()
+		return nil, fmt.Errorf("failed to start process: %w", err)
+	}
+	process.pid = cmd.Process.Pid
+	// the process has not been reaped yet, so it is
+	// still listed even if it has already exited
+	if process.startTime, err = processStartTime(process.pid); err != nil {
+		logging.L().Warnf("Failed to record the start time of process %d: %v", process.pid, err)
+	}
+	go func() {
+		// reap the process once it exits
+		_ = cmd.Wait()
+		close(process.exited)
+	}()
+	return process, nil
+}
+
+// openLog creates the file to which the output of the process is written
+func (s *SpawnStep) openLog(process *spawnedProcess) (*os.File, error) {
+	if s.LogTo == "" {
+		logFile, err := os.CreateTemp("", "ttpforge-spawn-*.log")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create log file: %w", err)
+		}
+		process.logPath = logFile.Name()
+		process.tempFiles = append(process.tempFiles, logFile.Name())
+		return logFile, nil
+	}
+	logPath, err := fileutils.ExpandTilde(s.LogTo)
+	if err != nil {
+		return nil, err
+	}
+	logFile, err := os.OpenFile(logPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	process.logPath = logPath
+	return logFile, nil
+}
+
+// waitForOutput waits until the output of the process matches waitRegexp
+func (p *spawnedProcess) waitForOutput(ctx context.Context, waitRegexp *regexp.Regexp) error {
+	ticker := time.NewTicker(spawnPollInterval)
+	defer ticker.Stop()
+	for {
+		output, err := os.ReadFile(p.logPath)
+		if err != nil {
+			return fmt.Errorf("failed to read output of process %d: %w", p.pid, err)
+		}
+		if waitRegexp.Match(output) {
+			return nil
+		}
+		select {
+		case <-p.exited:
+			// the output may have been written right before the process exited
+			if output, err := os.ReadFile(p.logPath); err == nil && waitRegexp.Match(output) {
+				return nil
+			}
+			return fmt.Errorf("process %d exited before its output matched %q", p.pid, strings.TrimPrefix(waitRegexp.String(), "(?m)"))
+		case <-ctx.Done():
+			return fmt.Errorf("output of process %d did not match %q: %w", p.pid, strings.TrimPrefix(waitRegexp.String(), "(?m)"), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// kill kills the process of the step along with every process that it started
+func (s *SpawnStep) kill() error {
+	process := s.process
+	if process == nil {
+		return errors.New("no process was spawned by this step")
+	}
+	if process.reused() {
+		logging.L().Warnf("Not killing process %d: it has exited, and its ID now belongs to another process", process.pid)
+	} else {
+		logging.L().Infof("Killing process %d and its descendants", process.pid)
+		if err := killProcessTree(process.pid, s.killSignal, process.exited); err != nil {
+			return fmt.Errorf("failed to kill process %d: %w", process.pid, err)
+		}
+	}
+	process.removeTempFiles()
+	s.process = nil
+	return nil
+}
+
+// reused reports whether the ID of the process now belongs to a
+// process with a different start time, which must not be killed.
+// If the start time could not be read when the process was
+// spawned, reused IDs cannot be detected.
+func (p *spawnedProcess) reused() bool {
+	if p.startTime == "" {
+		return false
+	}
+	startTime, err := processStartTime(p.pid)
+	if err != nil {
+		// the processes that the process started may outlive it,
+		// and the ID of their process group cannot be reused
+		if !errors.Is(err, os.ErrNotExist) {
+			logging.L().Warnf("Failed to check the start time of process %d: %v", p.pid, err)
+		}
+		return false
+	}
+	return startTime != p.startTime
+}
+
+func (p *spawnedProcess) removeTempFiles() {
+	for _, tempFile := range p.tempFiles {
+		if err := os.Remove(tempFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logging.L().Warnf("Failed to remove %v: %v", tempFile, err)
+		}
+	}
+}
+
+// restoreProcess restores the process that the step spawned
+// from the result recorded in a cleanup journal, so that
+// the process can be killed by a deferred cleanup
+func (s *SpawnStep) restoreProcess(execResult *ExecutionResult) error {
+	// numbers are decoded from the journal as float64
+	pid, ok := execResult.Outputs["pid"].(float64)
+	if !ok {
+		return errors.New("the cleanup journal does not record the ID of the spawned process")
+	}
+	killSignal, err := parseKillSignal(s.KillSignal)
+	if err != nil {
+		return err
+	}
+	s.killSignal = killSignal
+	// the start time is empty if it could not be read when the process
+	// was spawned - for example, because ps failed where there is no procfs
+	startTime, _ := execResult.Outputs["pid_start_time"].(string)
+	s.process = &spawnedProcess{pid: int(pid), startTime: startTime}
+	if logPath, ok := execResult.Outputs["log"].(string); ok && s.LogTo == "" {
+		s.process.logPath = logPath
+		s.process.tempFiles = []string{logPath}
+	}
+	return nil
+}
+
+// GetDefaultCleanupAction will instruct the calling code
+// to kill the spawned process and its descendants
+func (s *SpawnStep) GetDefaultCleanupAction() Action {
+	return &killSpawnAction{step: s}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestSpawnStepParse(t *testing.T) {
+	testCases := []struct {
+		name               string
+		content            string
+		wantUnmarshalError bool
+		wantValidateError  bool
+		wantCustomCleanup  bool
+	}{
+		{
+			name: "Spawn With Default Cleanup",
+			content: `name: listener
+spawn: sleep 30
+wait_for_output: listening
+log_to: /tmp/listener.log`,
+		},
+		{
+			name: "Spawn With Custom Cleanup",
+			content: `name: listener
+spawn: sleep 30
+cleanup:
+  inline: echo custom`,
+			wantCustomCleanup: true,
+		},
+		{
+			name: "Spawn And Inline",
+			content: `name: listener
+spawn: sleep 30
+inline: echo ambiguous`,
+			wantUnmarshalError: true,
+		},
+		{
+			name: "Invalid Regex",
+			content: `name: listener
+spawn: sleep 30
+wait_for_output: "(unclosed"`,
+			wantValidateError: true,
+		},
+		{
+			name: "Unsupported Kill Signal",
+			content: `name: listener
+spawn: sleep 30
+kill_signal: SIGNOPE`,
+			wantValidateError: true,
+		},
+		{
+			name: "Missing Executor",
+			content: `name: listener
+spawn: sleep 30
+executor: does-not-exist`,
+			wantValidateError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var step Step
+			err := yaml.Unmarshal([]byte(tc.content), &step)
+			if tc.wantUnmarshalError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			spawnStep, ok := step.action.(*SpawnStep)
+			require.True(t, ok, "step should be a spawn step")
+			assert.Equal(t, "spawn", actionName(spawnStep))
+			_, isKill := step.cleanup.(*killSpawnAction)
+			assert.Equal(t, !tc.wantCustomCleanup, isKill)
+
+			err = step.Validate(NewTTPExecutionContext())
+			if tc.wantValidateError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, ExecutorBash, spawnStep.ExecutorName)
+		})
+	}
+}
@@ -0,0 +1,124 @@
+//go:build !windows
+// +build !windows
+
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// killSignals are the signals that spawn steps accept as kill_signal
+var killSignals = map[string]syscall.Signal{
+	"TERM": syscall.SIGTERM,
+	"KILL": syscall.SIGKILL,
+	"INT":  syscall.SIGINT,
+	"HUP":  syscall.SIGHUP,
+	"QUIT": syscall.SIGQUIT,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+// parseKillSignal parses the name of a signal, with or without
+// the SIG prefix - the default signal is SIGTERM
+func parseKillSignal(name string) (syscall.Signal, error) {
+	if name == "" {
+		return syscall.SIGTERM, nil
+	}
+	signal, ok := killSignals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !ok {
+		return 0, fmt.Errorf("unsupported kill_signal %q", name)
+	}
+	return signal, nil
+}
+
+// startProcessTree starts cmd in a process group of its own,
+// so that killProcessTree can kill every process that it starts
+func startProcessTree(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcessTree sends signal to the process group of pid, and kills
+// the processes with SIGKILL if they are still running after
+// processKillGracePeriod. Processes that have already exited
+// are not treated as an error.
+func killProcessTree(pid int, signal syscall.Signal, exited <-chan struct{}) error {
+	// a negative pid signals the whole process group
+	pgid := -pid
+	if err := syscall.Kill(pgid, signal); err != nil {
+		if errors.Is(err, syscall.ESRCH) {
+			return nil
+		}
+		return err
+	}
+	deadline := time.Now().Add(processKillGracePeriod)
+	for time.Now().Before(deadline) {
+		// signal 0 only checks whether any process of the group is left
+		if err := syscall.Kill(pgid, 0); errors.Is(err, syscall.ESRCH) {
+			return nil
+		}
+		time.Sleep(spawnPollInterval)
+	}
+	if err := syscall.Kill(pgid, syscall.SIGKILL); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return err
+	}
+	if exited != nil {
+		<-exited
+	}
+	return nil
+}
+
+// processStartTime returns the start time of the process with the
+// specified ID, in a format that is only meant to be compared with
+// other start times. The returned error wraps os.ErrNotExist if
+// there is no such process.
+func processStartTime(pid int) (string, error) {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err == nil {
+		// the start time (in clock ticks since boot) is the 22nd
+		// field, and the 20th after the parenthesized command name
+		fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+		if len(fields) < 20 {
+			return "", fmt.Errorf("unexpected contents of /proc/%d/stat", pid)
+		}
+		return fields[19], nil
+	}
+	if _, procErr := os.Stat("/proc/self/stat"); procErr == nil {
+		return "", err
+	}
+
+	// without procfs (as on macOS), ps prints the start time - or
+	// nothing at all if there is no such process
+	output, _ := exec.Command("ps", "-o", "lstart=", "-p", strconv.Itoa(pid)).Output()
+	startTime := strings.TrimSpace(string(output))
+	if startTime == "" {
+		return "", fmt.Errorf("process %d: %w", pid, os.ErrNotExist)
+	}
+	return startTime, nil
+}
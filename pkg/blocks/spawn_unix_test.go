@@ -0,0 +1,305 @@
+//go:build !windows
+// +build !windows
+
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// processAlive reports whether the process with the specified ID is
+// running. Killed grandchildren are reparented to init, and may
+// linger as zombies in containers whose init does not reap them.
+func processAlive(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		// no procfs (e.g. on macOS)
+		return true
+	}
+	// the state follows the parenthesized command name
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	return len(fields) == 0 || fields[0] != "Z"
+}
+
+// childPID extracts the ID of the process that a
+// spawned script reported with "child <pid>"
+func childPID(t *testing.T, logPath string) int {
+	output, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	match := regexp.MustCompile(`child (\d+)`).FindSubmatch(output)
+	require.NotNil(t, match, "output should contain the child pid: %s", output)
+	pid, err := strconv.Atoi(string(match[1]))
+	require.NoError(t, err)
+	return pid
+}
+
+func TestSpawnStepExecute(t *testing.T) {
+	testCases := []struct {
+		name             string
+		step             *SpawnStep
+		logTo            bool
+		timeout          time.Duration
+		wantExecuteError bool
+		expectedLog      string
+	}{
+		{
+			name: "Kills Process Tree",
+			step: &SpawnStep{
+				Spawn: `sleep 300 &
+echo "child $!"
+echo ready
+wait`,
+				WaitForOutput: "^ready",
+			},
+		},
+		{
+			name: "Without Readiness Probe",
+			step: &SpawnStep{
+				Spawn: `sleep 300 &
+echo "child $!"
+wait`,
+			},
+		},
+		{
+			name: "Log To File With Custom Kill Signal",
+			step: &SpawnStep{
+				Spawn: `trap 'echo "got INT"; exit 0' INT
+sleep 300 &
+echo "child $!"
+echo "listening on $PORT"
+while true; do sleep 0.1; done`,
+				Environment:   map[string]string{"PORT": "4444"},
+				WaitForOutput: `listening on \d+`,
+				KillSignal:    "SIGINT",
+			},
+			logTo: true,
+			// the trap proves that the process received SIGINT
+			expectedLog: "listening on 4444\ngot INT\n",
+		},
+		{
+			name: "Process Exits Before Ready",
+			step: &SpawnStep{
+				Spawn:         "echo starting",
+				WaitForOutput: "ready",
+			},
+			wantExecuteError: true,
+		},
+		{
+			name: "Readiness Probe Times Out",
+			step: &SpawnStep{
+				Spawn: `sleep 300 &
+echo "child $!"
+wait`,
+				WaitForOutput: "ready",
+			},
+			timeout:          500 * time.Millisecond,
+			wantExecuteError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			execCtx := NewTTPExecutionContext()
+			if tc.logTo {
+				tc.step.LogTo = filepath.Join(t.TempDir(), "spawn.log")
+			}
+			require.NoError(t, tc.step.Validate(execCtx))
+
+			ctx := context.Background()
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+			result, err := tc.step.Execute(ctx, execCtx)
+			if tc.wantExecuteError {
+				require.Error(t, err)
+				assert.Nil(t, tc.step.process, "failed steps should kill their process")
+				return
+			}
+			require.NoError(t, err)
+
+			pid, ok := result.Outputs["pid"].(int)
+			require.True(t, ok)
+			logPath, ok := result.Outputs["log"].(string)
+			require.True(t, ok)
+			if tc.logTo {
+				assert.Equal(t, tc.step.LogTo, logPath)
+			}
+			assert.True(t, processAlive(pid))
+			// the process keeps running after the step completes
+			require.Eventually(t, func() bool {
+				output, err := os.ReadFile(logPath)
+				return err == nil && bytes.Contains(output, []byte("child "))
+			}, 5*time.Second, 10*time.Millisecond)
+			grandchild := childPID(t, logPath)
+			assert.True(t, processAlive(grandchild))
+
+			_, err = tc.step.GetDefaultCleanupAction().Execute(context.Background(), execCtx)
+			require.NoError(t, err)
+			assert.False(t, processAlive(pid))
+			// SIGKILL is delivered asynchronously
+			assert.Eventually(t, func() bool {
+				return !processAlive(grandchild)
+			}, time.Second, 10*time.Millisecond)
+			if tc.logTo {
+				output, err := os.ReadFile(logPath)
+				require.NoError(t, err)
+				assert.Contains(t, string(output), tc.expectedLog)
+			} else {
+				assert.NoFileExists(t, logPath)
+			}
+
+			// cleaning up twice fails, as there is no process left
+			_, err = tc.step.GetDefaultCleanupAction().Execute(context.Background(), execCtx)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestSpawnDeferredCleanup(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	ttp, err := RenderTemplatedTTP(`name: spawn
+args:
+  - name: pid_file
+steps:
+  - name: listener
+    spawn: |
+      echo ready
+      sleep 300
+    wait_for_output: ready
+  - name: record
+    inline: echo $forge.steps.listener.outputs.pid > {{.Args.pid_file}}`, RenderParameters{
+		Args: map[string]interface{}{"pid_file": pidFile},
+	})
+	require.NoError(t, err)
+
+	execCtx := NewTTPExecutionContext()
+	execCtx.Cfg.RunID = "test-run"
+	execCtx.Cfg.NoCleanup = true
+	execCtx.Cfg.Stdout = &bytes.Buffer{}
+	require.NoError(t, ttp.Validate(execCtx))
+	stateDir := t.TempDir()
+	require.NoError(t, execCtx.EnableCleanupJournal(ttp, stateDir))
+	require.NoError(t, ttp.Execute(context.Background(), execCtx))
+
+	contents, err := os.ReadFile(pidFile)
+	require.NoError(t, err)
+	pid, err := strconv.Atoi(string(bytes.TrimSpace(contents)))
+	require.NoError(t, err)
+	assert.True(t, processAlive(pid))
+	logPath := execCtx.StepResults.ByName["listener"].Outputs["log"].(string)
+	assert.FileExists(t, logPath)
+
+	require.NoError(t, RunDeferredCleanup(stateDir, "test-run", TTPExecutionConfig{}))
+	assert.False(t, processAlive(pid))
+	assert.NoFileExists(t, logPath)
+}
+
+func TestSpawnCleanupChecksStartTime(t *testing.T) {
+	testCases := []struct {
+		name string
+		// startTime returns the start time recorded
+		// in the journal for the process with pid
+		startTime  func(t *testing.T, pid int) string
+		wantKilled bool
+	}{
+		{
+			name: "Same Process",
+			startTime: func(t *testing.T, pid int) string {
+				startTime, err := processStartTime(pid)
+				require.NoError(t, err)
+				return startTime
+			},
+			wantKilled: true,
+		},
+		{
+			name: "Reused Process ID",
+			startTime: func(_ *testing.T, _ int) string {
+				return "1"
+			},
+		},
+		{
+			// the start time could not be read when the process was spawned
+			name: "Unknown Start Time",
+			startTime: func(_ *testing.T, _ int) string {
+				return ""
+			},
+			wantKilled: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// this process stands in for the one that now has the ID
+			cmd := exec.Command("sleep", "30")
+			startProcessTree(cmd)
+			require.NoError(t, cmd.Start())
+			exited := make(chan struct{})
+			go func() {
+				_ = cmd.Wait()
+				close(exited)
+			}()
+			t.Cleanup(func() {
+				_ = cmd.Process.Kill()
+				<-exited
+			})
+
+			outputs := map[string]interface{}{"pid": float64(cmd.Process.Pid)}
+			if startTime := tc.startTime(t, cmd.Process.Pid); startTime != "" {
+				outputs["pid_start_time"] = startTime
+			}
+			step := NewSpawnStep()
+			require.NoError(t, step.restoreProcess(&ExecutionResult{
+				ActResult: ActResult{Outputs: outputs},
+			}))
+			require.NoError(t, step.kill())
+
+			if tc.wantKilled {
+				select {
+				case <-exited:
+				case <-time.After(5 * time.Second):
+					t.Fatal("the process should have been killed")
+				}
+				return
+			}
+			assert.True(t, processAlive(cmd.Process.Pid))
+		})
+	}
+}
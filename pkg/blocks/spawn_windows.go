@@ -0,0 +1,80 @@
+//go:build windows
+// +build windows
+
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// parseKillSignal only accepts SIGKILL, as processes
+// on Windows cannot be asked to exit with signals
+func parseKillSignal(name string) (syscall.Signal, error) {
+	switch strings.TrimPrefix(strings.ToUpper(name), "SIG") {
+	case "", "KILL":
+		return syscall.SIGKILL, nil
+	}
+	return 0, fmt.Errorf("unsupported kill_signal %q: only KILL is supported on windows", name)
+}
+
+// startProcessTree is a no-op, as taskkill
+// finds the descendants of the process itself
+func startProcessTree(_ *exec.Cmd) {}
+
+// killProcessTree kills pid along with every process that it started.
+// Processes that have already exited are not treated as an error.
+func killProcessTree(pid int, _ syscall.Signal, exited <-chan struct{}) error {
+	// taskkill /T terminates the child processes as well
+	err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(pid)).Run()
+	if err != nil {
+		if _, findErr := os.FindProcess(pid); findErr != nil {
+			return nil
+		}
+		return err
+	}
+	if exited != nil {
+		<-exited
+	}
+	return nil
+}
+
+// processStartTime returns the start time of the process with the
+// specified ID, in a format that is only meant to be compared with
+// other start times. The returned error wraps os.ErrNotExist if
+// there is no such process.
+func processStartTime(pid int) (string, error) {
+	script := fmt.Sprintf("$p = Get-Process -Id %d -ErrorAction SilentlyContinue; if ($p) { $p.StartTime.ToFileTimeUtc() }", pid)
+	output, err := exec.Command("powershell", "-NoProfile", "-Command", script).Output()
+	if err != nil {
+		return "", err
+	}
+	startTime := strings.TrimSpace(string(output))
+	if startTime == "" {
+		return "", fmt.Errorf("process %d: %w", pid, os.ErrNotExist)
+	}
+	return startTime, nil
+}
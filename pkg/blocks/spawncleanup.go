@@ -0,0 +1,47 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import "context"
+
+// killSpawnAction kills the process started by a spawn step,
+// along with every process that it started
+type killSpawnAction struct {
+	actionDefaults
+	step *SpawnStep
+}
+
+// IsNil is not needed here, as this is not a user-accessible step type
+func (a *killSpawnAction) IsNil() bool {
+	return false
+}
+
+// Validate is not needed here, as this is not a user-accessible step type
+func (a *killSpawnAction) Validate(_ TTPExecutionContext) error {
+	return nil
+}
+
+// Execute kills the process tree
+func (a *killSpawnAction) Execute(_ context.Context, _ TTPExecutionContext) (*ActResult, error) {
+	if err := a.step.kill(); err != nil {
+		return nil, err
+	}
+	return &ActResult{}, nil
+}
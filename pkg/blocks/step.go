@@ -20,12 +20,16 @@ THE SOFTWARE.
 package blocks
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/facebookincubator/ttpforge/pkg/checks"
+	"github.com/facebookincubator/ttpforge/pkg/expressions"
 	"github.com/facebookincubator/ttpforge/pkg/logging"
-	"github.com/spf13/afero"
+	"github.com/facebookincubator/ttpforge/pkg/platforms"
 	"gopkg.in/yaml.v3"
 )
 
@@ -36,6 +40,35 @@ type CommonStepFields struct {
 	Name   string         `yaml:"name,omitempty"`
 	Checks []checks.Check `yaml:"checks,omitempty"`
 
+	// If is an optional condition that is evaluated
+	// at run time - the step is skipped when it is false
+	If string `yaml:"if,omitempty"`
+
+	// Platforms optionally restricts the platforms on which
+	// the step runs - it is skipped on all other platforms
+	Platforms []platforms.Spec `yaml:"platforms,omitempty"`
+
+	// Target optionally runs the step on a remote host over SSH
+	Target *TargetSpec `yaml:"target,omitempty"`
+
+	// Requires lists conditions that must be met before the
+	// step executes - OnUnmet controls what happens if they
+	// are not, and WaitTimeout bounds how long to wait for them
+	Requires    []checks.Check `yaml:"requires,omitempty"`
+	OnUnmet     UnmetPolicy    `yaml:"on_unmet,omitempty"`
+	WaitTimeout Duration       `yaml:"wait_timeout,omitempty"`
+
+	// Retry optionally re-executes the step if it fails
+	Retry *RetryPolicy `yaml:"retry,omitempty"`
+
+	// Timeout optionally bounds how long each
+	// attempt to execute the step may run for
+	Timeout Duration `yaml:"timeout,omitempty"`
+
+	// OnFailure controls whether the TTP keeps
+	// going if this step (or its checks) fail
+	OnFailure FailurePolicy `yaml:"on_failure,omitempty"`
+
 	// CleanupSpec is exported so that UnmarshalYAML
 	// can see it - however, it should be considered
 	// to be a private detail of this file
@@ -43,6 +76,30 @@ type CommonStepFields struct {
 	CleanupSpec yaml.Node `yaml:"cleanup,omitempty"`
 }
 
+// FailurePolicy specifies what happens to the
+// rest of the TTP when a step fails
+type FailurePolicy string
+
+const (
+	// FailurePolicyStop stops the TTP and cleans up the
+	// steps that completed before the failed step (the default)
+	FailurePolicyStop FailurePolicy = "stop"
+	// FailurePolicyContinue moves on to the next step
+	FailurePolicyContinue FailurePolicy = "continue"
+	// FailurePolicyCleanupAndContinue immediately runs the cleanup
+	// action of the failed step, then moves on to the next step
+	FailurePolicyCleanupAndContinue FailurePolicy = "cleanup_and_continue"
+)
+
+// Validate checks that the failure policy is one of the supported values
+func (p FailurePolicy) Validate() error {
+	switch p {
+	case "", FailurePolicyStop, FailurePolicyContinue, FailurePolicyCleanupAndContinue:
+		return nil
+	}
+	return fmt.Errorf("invalid on_failure value %q - must be one of %q, %q, or %q", p, FailurePolicyStop, FailurePolicyContinue, FailurePolicyCleanupAndContinue)
+}
+
 // Step contains a TTPForge executable action
 // and its associated cleanup action (if specified)
 type Step struct {
@@ -78,7 +135,27 @@ func isDefaultCleanup(cleanupNode *yaml.Node) (bool, error) {
 // However, certain step types (especially SubTTPs) need to run cleanup even if they fail
 func (s *Step) ShouldCleanupOnFailure() bool {
 	switch s.action.(type) {
-	case *SubTTPStep:
+	case *SubTTPStep, *ParallelStep:
+		return true
+	default:
+		return false
+	}
+}
+
+// needsCleanup reports whether this step still has to be
+// cleaned up, given the result of executing it. Steps
+// that must be cleaned up even if they failed (see
+// ShouldCleanupOnFailure) need cleanup unless they never ran,
+// such as when they were skipped or their requirements were not met.
+func (s *Step) needsCleanup(execResult *ExecutionResult) bool {
+	if execResult.needsCleanup() {
+		return true
+	}
+	if execResult.Cleanup != nil || !s.ShouldCleanupOnFailure() || !execResult.requirementsMet() {
+		return false
+	}
+	switch execResult.Status {
+	case StepFailed, StepTimedOut, StepCancelled:
 		return true
 	default:
 		return false
@@ -89,10 +166,12 @@ func (s *Step) ShouldCleanupOnFailure() bool {
 // to make subTTPs always run their default
 // cleanup process even when `cleanup: default` is
 // not explicitly specified - this is purely for backward
-// compatibility
+// compatibility. Parallel groups follow the same rule
+// so that their child steps are always cleaned up, and
+// so do spawn steps so that their processes are always killed.
 func ShouldUseImplicitDefaultCleanup(action Action) bool {
 	switch action.(type) {
-	case *SubTTPStep:
+	case *SubTTPStep, *ParallelStep, *SpawnStep:
 		return true
 	default:
 		return false
@@ -153,8 +232,44 @@ func (s *Step) UnmarshalYAML(node *yaml.Node) error {
 }
 
 // Validate checks that both the step action and cleanup
-// action are valid
+// action are valid. The actions of local steps that do not
+// support the current platform are not validated, since they
+// may depend on tools that only exist on other platforms.
+// Steps that run on a remote target are always validated,
+// since its platform is only detected once the step runs.
 func (s *Step) Validate(execCtx TTPExecutionContext) error {
+	for _, platform := range s.Platforms {
+		if err := platform.Validate(); err != nil {
+			return fmt.Errorf("invalid platforms for step %q: %w", s.Name, err)
+		}
+	}
+	if s.If != "" {
+		if err := expressions.Validate(s.If); err != nil {
+			return fmt.Errorf("invalid if condition for step %q: %w", s.Name, err)
+		}
+	}
+	if err := s.validateRequirements(); err != nil {
+		return err
+	}
+	if s.Retry != nil {
+		if err := s.Retry.Validate(); err != nil {
+			return fmt.Errorf("invalid retry policy for step %q: %w", s.Name, err)
+		}
+	}
+	if s.Timeout < 0 {
+		return fmt.Errorf("step %q has a negative timeout", s.Name)
+	}
+	if err := s.OnFailure.Validate(); err != nil {
+		return fmt.Errorf("step %q: %w", s.Name, err)
+	}
+	if s.targetSpec(execCtx.Cfg) == nil && !s.SupportsPlatform(platforms.GetCurrentPlatformSpec()) {
+		logging.L().Debugf("Not validating the actions of step %q, which does not support the current platform", s.Name)
+		return nil
+	}
+	execCtx, err := s.validateTarget(execCtx)
+	if err != nil {
+		return err
+	}
 	if err := s.action.Validate(execCtx); err != nil {
 		return err
 	}
@@ -166,37 +281,230 @@ func (s *Step) Validate(execCtx TTPExecutionContext) error {
 	return nil
 }
 
-// Execute runs the action associated with this step and sends result/error to channels of the context
-func (s *Step) Execute(execCtx TTPExecutionContext) (*ActResult, error) {
+// SupportsPlatform reports whether the step should run on the specified
+// platform. Steps that do not specify any platforms run everywhere.
+func (s *Step) SupportsPlatform(platform platforms.Spec) bool {
+	if len(s.Platforms) == 0 {
+		return true
+	}
+	for _, supported := range s.Platforms {
+		if supported.IsCompatibleWith(platform) {
+			return true
+		}
+	}
+	return false
+}
+
+// platform returns the platform on which the step runs. The platform of
+// remote targets is only detected if the step is limited to some platforms.
+func (s *Step) platform(ctx context.Context, execCtx TTPExecutionContext) (platforms.Spec, error) {
+	if len(s.Platforms) == 0 || s.targetSpec(execCtx.Cfg) == nil {
+		return platforms.GetCurrentPlatformSpec(), nil
+	}
+	execCtx, closeTarget, err := s.connectTarget(ctx, execCtx)
+	if err != nil {
+		return platforms.Spec{}, fmt.Errorf("could not detect the platform of the target of step %q: %w", s.Name, err)
+	}
+	defer closeTarget()
+	platform, err := targetPlatform(ctx, execCtx.remote.conn)
+	if err != nil {
+		return platforms.Spec{}, err
+	}
+	return platform.spec(), nil
+}
+
+// ShouldRun checks that the step supports the current platform and
+// evaluates its `if:` condition. Variables in the condition are resolved
+// in the same way as in ExpandVariables, so the condition can depend on
+// the outputs of earlier steps. Steps without a condition always run.
+func (s *Step) ShouldRun(ctx context.Context, execCtx TTPExecutionContext) (bool, error) {
+	currentPlatform, err := s.platform(ctx, execCtx)
+	if err != nil {
+		return false, err
+	}
+	if !s.SupportsPlatform(currentPlatform) {
+		logging.L().Infof("Skipping step %q because it does not support the current platform %v", s.Name, currentPlatform.String())
+		return false, nil
+	}
+	if s.If == "" {
+		return true, nil
+	}
+	shouldRun, err := expressions.Evaluate(s.If, execCtx.processMatch)
+	if err != nil {
+		return false, fmt.Errorf("could not evaluate if condition of step %q: %w", s.Name, err)
+	}
+	if !shouldRun {
+		logging.L().Infof("Skipping step %q because its condition is false: %v", s.Name, s.If)
+	}
+	return shouldRun, nil
+}
+
+// Execute runs the action associated with this step.
+// If the step has a retry policy, the action is re-executed
+// until it succeeds or the policy runs out of attempts.
+func (s *Step) Execute(ctx context.Context, execCtx TTPExecutionContext) (*ActResult, error) {
 	desc := s.action.GetDescription()
 	if desc != "" {
 		logging.L().Infof("Description: %v", desc)
 	}
-	result, err := s.action.Execute(execCtx)
-	if err != nil {
-		logging.L().Errorf("Failed to execute step %v: %v", s.Name, err)
-		execCtx.errorsChan <- err
-	} else {
+
+	policy := s.retryPolicy()
+	var result *ActResult
+	var err error
+	for attempt := 1; attempt <= policy.Attempts; attempt++ {
+		if attempt > 1 {
+			delay := policy.delayBeforeAttempt(attempt)
+			logging.L().Infof("Retrying step %v in %v (attempt %d of %d)", s.Name, delay, attempt, policy.Attempts)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				// the whole TTP timed out or was cancelled
+				return result, markInterrupted(ctx, s.Name, fmt.Errorf("could not be retried: %w", err))
+			}
+		}
+
+		result, err = s.executeAttempt(ctx, execCtx)
+		if err != nil {
+			logging.L().Errorf("Failed to execute step %v: %v", s.Name, err)
+			if attempt < policy.Attempts {
+				if s.ShouldCleanupOnFailure() {
+					s.cleanupFailedAttempt(execCtx)
+				}
+				// the next attempt reconnects to the target,
+				// in case the connection itself was the problem
+				execCtx.stepConn.close()
+			}
+			continue
+		}
+
+		// the checks of the last attempt are left
+		// for the caller to verify, so that a step
+		// which ran but failed its checks still
+		// gets cleaned up like any other step
+		if policy.RetryOnCheckFailure && attempt < policy.Attempts {
+			if checkErr := s.VerifyChecks(ctx, execCtx, result); checkErr != nil {
+				logging.L().Warnf("Step %v executed but its checks failed: %v", s.Name, checkErr)
+				s.cleanupFailedAttempt(execCtx)
+				continue
+			}
+		}
 		logging.L().Debugf("Successfully executed step %v", s.Name)
-		execCtx.actionResultsChan <- result
+		return result, nil
 	}
-
 	return result, err
 }
 
-// Cleanup runs the cleanup action associated with this step
+// executeAttempt runs the action of this step once,
+// bounded by the timeout of the step (if any)
+func (s *Step) executeAttempt(ctx context.Context, execCtx TTPExecutionContext) (*ActResult, error) {
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(s.Timeout))
+		defer cancel()
+	}
+	startTime := time.Now()
+	execCtx, closeTarget, err := s.connectTarget(ctx, execCtx)
+	if err != nil {
+		return nil, markInterrupted(ctx, s.Name, err)
+	}
+	defer closeTarget()
+	if execCtx, err = s.withSnapshotDir(execCtx); err != nil {
+		return nil, err
+	}
+	result, err := s.action.Execute(ctx, execCtx)
+	if result != nil {
+		result.StartTime = startTime
+		result.EndTime = time.Now()
+		result.Duration = result.EndTime.Sub(startTime)
+	}
+	if err != nil {
+		return result, markInterrupted(ctx, s.Name, err)
+	}
+	return result, nil
+}
+
+// markInterrupted wraps the error of a step to record
+// that the step was stopped because ctx timed out or was cancelled
+func markInterrupted(ctx context.Context, stepName string, err error) error {
+	// errors from nested steps (such as those of sub
+	// TTPs) may already have been marked
+	if errors.Is(err, ErrTimedOut) || errors.Is(err, ErrCancelled) {
+		return err
+	}
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("step %q %w: %w", stepName, ErrTimedOut, err)
+	case errors.Is(ctx.Err(), context.Canceled):
+		return fmt.Errorf("step %q was %w: %w", stepName, ErrCancelled, err)
+	}
+	return err
+}
+
+// retryPolicy returns the retry policy that applies to this step.
+// The legacy `retries` field of fetch_uri is honored
+// when no explicit retry policy is specified.
+func (s *Step) retryPolicy() RetryPolicy {
+	if s.Retry != nil {
+		return *s.Retry
+	}
+	if fetchStep, ok := s.action.(*FetchURIStep); ok && fetchStep.Retries != "" {
+		// the value was checked by FetchURIStep.Validate
+		if retries, err := strconv.Atoi(fetchStep.Retries); err == nil {
+			return RetryPolicy{Attempts: retries + 1}
+		}
+	}
+	return RetryPolicy{Attempts: 1}
+}
+
+// cleanupFailedAttempt undoes a failed attempt
+// so that the next attempt starts from a clean slate
+func (s *Step) cleanupFailedAttempt(execCtx TTPExecutionContext) {
+	logging.L().Infof("[+] Cleaning up failed attempt of step %s", s.Name)
+	if _, err := s.Cleanup(execCtx); err != nil {
+		logging.L().Errorf("Error cleaning up failed attempt of step %v: %v", s.Name, err)
+	}
+}
+
+// Cleanup runs the cleanup action associated with this step.
+// Cleanup is not bounded by the timeouts of the step or the TTP
+// and cannot be cancelled, since it must still run after
+// the TTP has timed out or been interrupted.
 func (s *Step) Cleanup(execCtx TTPExecutionContext) (*ActResult, error) {
 	if s.cleanup != nil {
 		desc := s.cleanup.GetDescription()
 		if desc != "" {
 			logging.L().Infof("Description: %v", desc)
 		}
-		return s.cleanup.Execute(execCtx)
+		execCtx, closeTarget, err := s.connectTarget(context.Background(), execCtx)
+		if err != nil {
+			return nil, err
+		}
+		defer closeTarget()
+		if execCtx, err = s.withSnapshotDir(execCtx); err != nil {
+			return nil, err
+		}
+		return s.cleanup.Execute(context.Background(), execCtx)
 	}
 	logging.L().Infof("No Cleanup Action Defined for Step %v", s.Name)
 	return &ActResult{}, nil
 }
 
+// withSnapshotDir sets the directory in which the action of the
+// step takes a snapshot of the path that it changes, if the cleanup
+// of the step restores the path from that snapshot
+func (s *Step) withSnapshotDir(execCtx TTPExecutionContext) (TTPExecutionContext, error) {
+	restoreAction, ok := s.cleanup.(*restorePathAction)
+	if !ok {
+		return execCtx, nil
+	}
+	snapshotDir, err := restoreAction.snapshotDir(execCtx, s.Name)
+	if err != nil {
+		return execCtx, fmt.Errorf("could not create snapshot directory for step %q: %w", s.Name, err)
+	}
+	execCtx.snapshotDir = snapshotDir
+	return execCtx, nil
+}
+
 // ParseAction decodes an action (from step or cleanup) in YAML
 // format into the appropriate struct
 func (s *Step) ParseAction(node *yaml.Node) (Action, error) {
@@ -206,6 +514,8 @@ func (s *Step) ParseAction(node *yaml.Node) (Action, error) {
 		TTP       string     `yaml:"ttp"`
 		EditFile  string     `yaml:"edit_file"`
 		Responses []Response `yaml:"responses"`
+		Parallel  yaml.Node  `yaml:"parallel"`
+		Spawn     string     `yaml:"spawn"`
 	}
 
 	if err := node.Decode(&typeField); err != nil {
@@ -226,10 +536,27 @@ func (s *Step) ParseAction(node *yaml.Node) (Action, error) {
 	if typeField.EditFile != "" {
 		typesCount++
 	}
+	if !typeField.Parallel.IsZero() {
+		typesCount++
+	}
+	if typeField.Spawn != "" {
+		typesCount++
+	}
 	if typesCount > 1 {
 		return nil, fmt.Errorf("step %v has ambiguous type", s.Name)
 	}
 
+	// Parallel groups are decoded explicitly so that
+	// errors in their child steps are reported instead
+	// of being swallowed by the candidate matching below
+	if !typeField.Parallel.IsZero() {
+		parallelStep := NewParallelStep()
+		if err := node.Decode(parallelStep); err != nil {
+			return nil, err
+		}
+		return parallelStep, nil
+	}
+
 	// Check for ExpectStep
 	if len(typeField.Responses) > 0 {
 		expectStep := NewExpectStep()
@@ -260,6 +587,7 @@ func (s *Step) ParseAction(node *yaml.Node) (Action, error) {
 		NewRemovePathAction(),
 		NewPrintStrAction(),
 		NewExpectStep(),
+		NewSpawnStep(),
 	}
 
 	var action Action
@@ -289,19 +617,74 @@ func (s *Step) ParseAction(node *yaml.Node) (Action, error) {
 }
 
 // VerifyChecks runs all checks and returns an error if any of them fail
-func (s *Step) VerifyChecks() error {
+func (s *Step) VerifyChecks(ctx context.Context, execCtx TTPExecutionContext, result *ActResult) error {
+	_, err := s.RunChecks(ctx, execCtx, result)
+	return err
+}
+
+// RunChecks runs all checks against the result of the step and
+// records the result of each one. Every check is run even if an
+// earlier one fails, but the returned error only describes the
+// first failed check.
+func (s *Step) RunChecks(ctx context.Context, execCtx TTPExecutionContext, result *ActResult) ([]CheckResult, error) {
 	if len(s.Checks) == 0 {
 		logging.L().Debugf("No checks defined for step %v", s.Name)
-		return nil
+		return nil, nil
+	}
+	verificationCtx, release, err := s.verificationContext(ctx, execCtx)
+	if err != nil {
+		return nil, err
 	}
+	defer release()
+	return s.runConditions(verificationCtx, result, s.Checks, "success check")
+}
+
+// verificationContext returns the context in which the checks and
+// requirements of the step are verified, along with a function that
+// releases it. Steps on remote targets verify the state of their target,
+// so a connection to the target is kept open until it is released.
+func (s *Step) verificationContext(ctx context.Context, execCtx TTPExecutionContext) (checks.VerificationContext, func(), error) {
 	verificationCtx := checks.VerificationContext{
-		FileSystem: afero.NewOsFs(),
+		FileSystem: execCtx.fileSystem(nil),
+	}
+	release := func() {}
+	if s.targetSpec(execCtx.Cfg) != nil {
+		var err error
+		execCtx, release, err = s.connectTarget(ctx, execCtx)
+		if err != nil {
+			return verificationCtx, nil, fmt.Errorf("could not verify the checks of step %q on its target: %w", s.Name, err)
+		}
+		verificationCtx = targetVerificationContext(execCtx.remote.conn)
+	}
+	if execCtx.Vars != nil {
+		if !execCtx.onTarget() {
+			verificationCtx.WorkDir = execCtx.Vars.WorkDir
+		}
+		verificationCtx.Environment = execCtx.Vars.Environment
+	}
+	return verificationCtx, release, nil
+}
+
+// runConditions verifies the specified checks (or requirements,
+// as described by kind) and records the result of each one
+func (s *Step) runConditions(verificationCtx checks.VerificationContext, result *ActResult, conditions []checks.Check, kind string) ([]CheckResult, error) {
+	if result != nil {
+		verificationCtx.Stdout = result.Stdout
+		verificationCtx.Outputs = result.Outputs
 	}
-	for checkIdx, check := range s.Checks {
+	var firstErr error
+	checkResults := make([]CheckResult, len(conditions))
+	for checkIdx, check := range conditions {
+		checkResults[checkIdx].Msg = check.Msg
 		if err := check.Verify(verificationCtx); err != nil {
-			return fmt.Errorf("success check %d of step %q failed: %w", checkIdx+1, s.Name, err)
+			checkResults[checkIdx].Error = err.Error()
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%v %d of step %q failed: %w", kind, checkIdx+1, s.Name, err)
+			}
+			continue
 		}
-		logging.L().Debugf("Success check %d (%q) of step %q PASSED", checkIdx+1, check.Msg, s.Name)
+		checkResults[checkIdx].Passed = true
+		logging.L().Debugf("The %v %d (%q) of step %q PASSED", kind, checkIdx+1, check.Msg, s.Name)
 	}
-	return nil
+	return checkResults, firstErr
 }
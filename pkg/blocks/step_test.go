@@ -20,6 +20,7 @@ THE SOFTWARE.
 package blocks
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"testing"
@@ -127,7 +128,7 @@ cleanup: default`,
 			require.NoError(t, err)
 
 			// execute the step and check output
-			result, err := s.Execute(execCtx)
+			result, err := s.Execute(context.Background(), execCtx)
 			if tc.wantExecuteError {
 				require.Error(t, err)
 				return
@@ -213,7 +214,7 @@ cleanup:
 			require.NoError(t, err)
 
 			// execute the step and check file contents
-			_, err = s.Execute(execCtx)
+			_, err = s.Execute(context.Background(), execCtx)
 			if tc.wantExecuteError {
 				require.Error(t, err)
 				return
@@ -20,7 +20,11 @@ THE SOFTWARE.
 package blocks
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/facebookincubator/ttpforge/pkg/logging"
@@ -34,6 +38,12 @@ type SubTTPStep struct {
 
 	ttp        *TTP
 	subExecCtx *TTPExecutionContext
+	// loadedArgs holds the expanded arguments
+	// with which the sub TTP was last loaded
+	loadedArgs []string
+	// journal is the cleanup journal record of the sub TTP,
+	// which is set by the parent TTP before this step runs
+	journal *journalNode
 }
 
 // NewSubTTPStep creates a new SubTTPStep and returns a pointer to it.
@@ -58,11 +68,19 @@ func (s *SubTTPStep) IsNil() bool {
 // The TTP file path is not empty.
 // The steps within the TTP file do not contain any nested SubTTPSteps.
 // If any of these conditions are not met, an error is returned.
+// Sub TTPs whose arguments reference values that are only known
+// at run time (such as the outputs of earlier steps) are loaded
+// and validated once the step executes.
 func (s *SubTTPStep) Validate(execCtx TTPExecutionContext) error {
 	if s.TtpRef == "" {
 		return errors.New("a TTP reference is required and must not be empty")
 	}
 
+	if _, err := s.processSubTTPArgs(execCtx); err != nil {
+		logging.L().Debugf("Deferring loading of sub TTP %v until it runs: %v", s.TtpRef, err)
+		return nil
+	}
+
 	if err := s.loadSubTTP(execCtx); err != nil {
 		return err
 	}
@@ -72,9 +90,23 @@ func (s *SubTTPStep) Validate(execCtx TTPExecutionContext) error {
 
 // Execute runs each step of the TTP file associated with the SubTTPStep
 // and manages the outputs and cleanup steps.
-func (s *SubTTPStep) Execute(_ TTPExecutionContext) (*ActResult, error) {
+func (s *SubTTPStep) Execute(ctx context.Context, execCtx TTPExecutionContext) (*ActResult, error) {
 	logging.L().Infof("[*] Executing Sub TTP: %s", s.TtpRef)
-	runErr := s.ttp.RunSteps(*s.subExecCtx)
+	// start from scratch in case this step is being retried
+	if s.subExecCtx != nil {
+		s.subExecCtx.StepResults = NewStepResultsRecord()
+	}
+	if err := s.reloadIfArgsChanged(execCtx); err != nil {
+		return &ActResult{}, err
+	}
+	// the sub TTP may have been loaded before it was
+	// known whether it shares the working directory
+	s.subExecCtx.Cfg.sharedWorkDir = execCtx.Cfg.sharedWorkDir
+	// the sub TTP inherits the environment of its parent
+	if err := s.ttp.initVars(*s.subExecCtx, execCtx.Vars.Environment); err != nil {
+		return &ActResult{}, err
+	}
+	runErr := s.ttp.RunSteps(ctx, *s.subExecCtx)
 	if runErr != nil {
 		return &ActResult{}, runErr
 	}
@@ -85,7 +117,13 @@ func (s *SubTTPStep) Execute(_ TTPExecutionContext) (*ActResult, error) {
 	for index, execResult := range s.subExecCtx.StepResults.ByIndex {
 		actResults[index] = &execResult.ActResult
 	}
-	return aggregateResults(actResults), nil
+	result := aggregateResults(actResults)
+	// the outputs declared by the sub TTP become the outputs of this step
+	var err error
+	if result.Outputs, err = s.ttp.resolveOutputs(*s.subExecCtx); err != nil {
+		return result, err
+	}
+	return result, nil
 }
 
 // GetDefaultCleanupAction will instruct the calling code
@@ -100,6 +138,10 @@ func aggregateResults(results []*ActResult) *ActResult {
 	var subStdouts []string
 	var subStderrs []string
 	for _, result := range results {
+		// steps that were not cleaned up have no result
+		if result == nil {
+			continue
+		}
 		subStdouts = append(subStdouts, result.Stdout)
 		subStderrs = append(subStderrs, result.Stderr)
 	}
@@ -115,6 +157,8 @@ func (s *SubTTPStep) processSubTTPArgs(execCtx TTPExecutionContext) ([]string, e
 	for k, v := range s.Args {
 		argKvStrs = append(argKvStrs, k+"="+v)
 	}
+	// sorted so that the expanded arguments can be compared
+	sort.Strings(argKvStrs)
 
 	expandedArgKvStrs, err := execCtx.ExpandVariables(argKvStrs)
 	if err != nil {
@@ -127,6 +171,9 @@ func (s *SubTTPStep) processSubTTPArgs(execCtx TTPExecutionContext) ([]string, e
 // and validates the contained steps.
 func (s *SubTTPStep) loadSubTTP(execCtx TTPExecutionContext) error {
 	repo := execCtx.Cfg.Repo
+	if repo == nil {
+		return fmt.Errorf("cannot load sub TTP %v without a repo", s.TtpRef)
+	}
 	subTTPAbsPath, err := repo.FindTTP(s.TtpRef)
 	if err != nil {
 		return err
@@ -143,6 +190,30 @@ func (s *SubTTPStep) loadSubTTP(execCtx TTPExecutionContext) error {
 	}
 	s.ttp = ttps
 	s.subExecCtx = ctx
+	s.loadedArgs = subArgsKv
 
 	return nil
 }
+
+// reloadIfArgsChanged (re)loads the sub TTP if it was not loaded during
+// validation, or if its arguments now expand to different values than
+// they did back then - for example, because they reference the outputs
+// of earlier steps or the working directory after a cd step.
+func (s *SubTTPStep) reloadIfArgsChanged(execCtx TTPExecutionContext) error {
+	if s.ttp != nil {
+		subArgsKv, err := s.processSubTTPArgs(execCtx)
+		if err != nil {
+			return err
+		}
+		if slices.Equal(subArgsKv, s.loadedArgs) {
+			s.subExecCtx.journal = s.journal
+			return nil
+		}
+	}
+	if err := s.loadSubTTP(execCtx); err != nil {
+		return err
+	}
+	s.subExecCtx.journal = s.journal
+	s.journal.reset(s.ttp, *s.subExecCtx)
+	return nil
+}
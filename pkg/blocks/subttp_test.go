@@ -20,6 +20,7 @@ THE SOFTWARE.
 package blocks
 
 import (
+	"context"
 	"testing"
 
 	"github.com/facebookincubator/ttpforge/pkg/repos"
@@ -50,6 +51,32 @@ steps:
 - name: testing_sub_ttp
   inline: |
     echo -n {{ .Args.arg_number_one}} {{ .Args.arg_number_two}} {{ .Args.arg_number_three }}`),
+		"repos/a/myttps/library/create-user.yaml": []byte(`name: create_user
+description: test sub ttp that declares outputs
+args:
+- name: prefix
+  default: ttpforge
+outputs:
+  username: $forge.steps.create.outputs.user.name
+  home: /home/$forge.steps.create.outputs.user.name
+  groups: $forge.steps.create.outputs.user.groups
+steps:
+- name: create
+  inline: |
+    echo '{"user":{"name":"{{ .Args.prefix }}-user","groups":["wheel","staff"]}}'
+  outputs:
+    user:
+      filters:
+      - json_path: user`),
+		"repos/a/myttps/env.yaml": []byte(`name: env
+description: test sub ttp environment
+env:
+  SUB_VAR: from-sub
+  SHARED_VAR: overridden-by-sub
+steps:
+- name: testing_sub_ttp_env
+  inline: |
+    echo -n "$PARENT_VAR $SUB_VAR $SHARED_VAR"`),
 		"repos/b/" + repos.RepoConfigFileName: []byte(`ttp_search_paths: ["ttps"]`),
 		"repos/b/ttps/with/cleanup.yaml": []byte(`name: with-cleanup
 description: test sub ttp with cleanup steps
@@ -75,6 +102,7 @@ func TestSubTTPExecution(t *testing.T) {
 		spec           repos.Spec
 		fsys           afero.Fs
 		stepYAML       string
+		parentEnv      map[string]string
 		expectError    bool
 		expectedOutput string
 	}{
@@ -114,6 +142,21 @@ args:
 ttp: with/cleanup.yaml`,
 			expectedOutput: "sub_step_1_output\nsub_step_2_output\n",
 		},
+		{
+			name: "Sub TTP Inherits Parent Environment",
+			spec: repos.Spec{
+				Name: "default",
+				Path: "repos/a",
+			},
+			fsys: makeTestFsForSubTTPs(t),
+			stepYAML: `name: with-env
+ttp: env.yaml`,
+			parentEnv: map[string]string{
+				"PARENT_VAR": "from-parent",
+				"SHARED_VAR": "from-parent",
+			},
+			expectedOutput: "from-parent from-sub overridden-by-sub",
+		},
 	}
 
 	for _, tc := range tests {
@@ -129,13 +172,130 @@ ttp: with/cleanup.yaml`,
 			execCtx.Cfg = TTPExecutionConfig{
 				Repo: repo,
 			}
+			execCtx.Vars.Environment = tc.parentEnv
 
 			err = step.Validate(execCtx)
 			require.NoError(t, err, "step failed to validate")
 
-			result, err := step.Execute(execCtx)
+			result, err := step.Execute(context.Background(), execCtx)
 			require.NoError(t, err)
 			assert.Equal(t, tc.expectedOutput, result.Stdout)
 		})
 	}
 }
+
+func TestSubTTPOutputs(t *testing.T) {
+	spec := repos.Spec{
+		Name: "default",
+		Path: "repos/a",
+	}
+	repo, err := spec.Load(makeTestFsForSubTTPs(t), "")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name              string
+		content           string
+		expectedStdout    map[string]string
+		wantValidateError bool
+	}{
+		{
+			name: "Parent References Sub TTP Outputs",
+			content: `name: parent
+steps:
+  - name: make_user
+    ttp: library/create-user.yaml
+    args:
+      prefix: temp
+  - name: use_user
+    inline: echo "$forge.steps.make_user.outputs.username $forge.steps.make_user.outputs.home $forge.steps.make_user.outputs.groups[1] $forge.steps.make_user.outputs.groups.length"`,
+			expectedStdout: map[string]string{
+				"use_user": "temp-user /home/temp-user staff 2\n",
+			},
+		},
+		{
+			name: "Sub TTP Outputs In Parallel Group",
+			content: `name: parent
+steps:
+  - name: group
+    parallel:
+      - name: make_user
+        ttp: library/create-user.yaml
+  - name: use_user
+    inline: echo "$forge.steps.make_user.outputs.username"`,
+			expectedStdout: map[string]string{
+				"use_user": "ttpforge-user\n",
+			},
+		},
+		{
+			name: "Output References Unknown Step",
+			content: `name: bad_outputs
+outputs:
+  username: $forge.steps.missing.outputs.name
+steps:
+  - name: create
+    inline: echo hello`,
+			wantValidateError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ttp, err := RenderTemplatedTTP(tc.content, RenderParameters{})
+			require.NoError(t, err)
+
+			execCtx := NewTTPExecutionContext()
+			execCtx.Cfg.Repo = repo
+			err = ttp.Validate(execCtx)
+			if tc.wantValidateError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			err = ttp.Execute(context.Background(), execCtx)
+			require.NoError(t, err)
+
+			for name, stdout := range tc.expectedStdout {
+				result, found := execCtx.StepResults.ByName[name]
+				require.True(t, found, "missing result for step %v", name)
+				assert.Equal(t, stdout, result.Stdout)
+			}
+		})
+	}
+}
+
+func TestSubTTPRuntimeArgs(t *testing.T) {
+	spec := repos.Spec{
+		Name: "default",
+		Path: "repos/a",
+	}
+	repo, err := spec.Load(makeTestFsForSubTTPs(t), "")
+	require.NoError(t, err)
+
+	content := `name: parent
+steps:
+  - name: discover
+    inline: echo {\"user\":\"alice\"}
+    outputs:
+      user:
+        filters:
+        - json_path: user
+  - name: sub
+    ttp: another/args.yaml
+    args:
+      arg_number_one: $forge.steps.discover.outputs.user
+      arg_number_two: $forge.ttp.name`
+	ttp, err := RenderTemplatedTTP(content, RenderParameters{})
+	require.NoError(t, err)
+
+	execCtx := NewTTPExecutionContext()
+	execCtx.Cfg.Repo = repo
+	execCtx.Cfg.RunID = "4c1e6a52-8f3d-4b7a-9e21-6d0f5b3c8a74"
+	err = ttp.Validate(execCtx)
+	require.NoError(t, err, "arguments that reference step outputs should only be expanded at run time")
+	err = ttp.Execute(context.Background(), execCtx)
+	require.NoError(t, err)
+
+	result, found := execCtx.StepResults.ByName["sub"]
+	require.True(t, found)
+	assert.Equal(t, "alice parent victory", result.Stdout)
+}
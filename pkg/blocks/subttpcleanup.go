@@ -19,6 +19,8 @@ THE SOFTWARE.
 
 package blocks
 
+import "context"
+
 // subTTPCleanupAction ensures that individual
 // steps of the subTTP are appropriately cleaned up
 type subTTPCleanupAction struct {
@@ -37,7 +39,11 @@ func (a *subTTPCleanupAction) Validate(execCtx TTPExecutionContext) error {
 }
 
 // Execute will cleanup the subTTP starting from the last successful step
-func (a *subTTPCleanupAction) Execute(_ TTPExecutionContext) (*ActResult, error) {
+func (a *subTTPCleanupAction) Execute(_ context.Context, _ TTPExecutionContext) (*ActResult, error) {
+	// the sub TTP may have failed to load when it was executed
+	if a.step.ttp == nil {
+		return &ActResult{}, nil
+	}
 	cleanupResults, err := a.step.ttp.startCleanupForCompletedSteps(*a.step.subExecCtx)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,378 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/facebookincubator/ttpforge/pkg/checks"
+	"github.com/facebookincubator/ttpforge/pkg/fileutils"
+	"github.com/facebookincubator/ttpforge/pkg/logging"
+	"github.com/facebookincubator/ttpforge/pkg/platforms"
+	"github.com/facebookincubator/ttpforge/pkg/targets"
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+)
+
+// TargetSpec selects the remote host on which a step runs. In YAML,
+// it is either the name of a target from the configuration file or
+// a mapping of connection settings. Variables in either form are
+// expanded when the step runs, so they can reference TTP arguments.
+type TargetSpec struct {
+	Name     string
+	Settings *targets.Target
+}
+
+// remoteTarget holds the connection to the target of
+// a step - which is nil while the step is validated
+type remoteTarget struct {
+	conn *targets.Connection
+}
+
+// UnmarshalYAML accepts either a target name or connection settings
+func (ts *TargetSpec) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&ts.Name)
+	}
+	var settings targets.Target
+	if err := node.Decode(&settings); err != nil {
+		return fmt.Errorf("target must be a target name or connection settings: %w", err)
+	}
+	ts.Settings = &settings
+	return nil
+}
+
+// Validate checks the parts of the spec that
+// do not depend on variables expanded at run time
+func (ts TargetSpec) Validate(cfg TTPExecutionConfig) error {
+	if ts.Settings != nil {
+		return ts.Settings.Validate()
+	}
+	if ts.Name == "" {
+		return errors.New("target name must not be empty")
+	}
+	if strings.Contains(ts.Name, contextVariablePrefix) {
+		return nil
+	}
+	if _, ok := cfg.Targets[ts.Name]; !ok {
+		return fmt.Errorf("target %q is not defined in the configuration file", ts.Name)
+	}
+	return nil
+}
+
+// resolve expands the variables in the spec and looks up named targets
+func (ts TargetSpec) resolve(execCtx TTPExecutionContext) (targets.Target, error) {
+	if ts.Settings == nil {
+		expanded, err := execCtx.ExpandVariables([]string{ts.Name})
+		if err != nil {
+			return targets.Target{}, err
+		}
+		target, ok := execCtx.Cfg.Targets[expanded[0]]
+		if !ok {
+			return targets.Target{}, fmt.Errorf("target %q is not defined in the configuration file", expanded[0])
+		}
+		return target, nil
+	}
+
+	target := *ts.Settings
+	fields := []*string{&target.Host, &target.User, &target.KeyFile, &target.KnownHosts}
+	for _, field := range fields {
+		expanded, err := execCtx.ExpandVariables([]string{*field})
+		if err != nil {
+			return targets.Target{}, err
+		}
+		*field = expanded[0]
+	}
+	return target, target.Validate()
+}
+
+// targetSpec returns the spec of the target that the step runs on, or
+// nil if it runs locally. Steps without a target of their own run on
+// the target of the run (if any) - except for sub TTPs and parallel
+// groups, whose own steps run on that target instead.
+func (s *Step) targetSpec(cfg TTPExecutionConfig) *TargetSpec {
+	if s.Target != nil {
+		return s.Target
+	}
+	if cfg.Target == nil {
+		return nil
+	}
+	switch s.action.(type) {
+	case *SubTTPStep, *ParallelStep:
+		return nil
+	}
+	return &TargetSpec{Settings: cfg.Target}
+}
+
+// validateTarget checks the target of the step (if any) and returns
+// the execution context with which its actions should be validated
+func (s *Step) validateTarget(execCtx TTPExecutionContext) (TTPExecutionContext, error) {
+	spec := s.targetSpec(execCtx.Cfg)
+	if spec == nil {
+		return execCtx, nil
+	}
+	if err := spec.Validate(execCtx.Cfg); err != nil {
+		return execCtx, fmt.Errorf("invalid target for step %q: %w", s.Name, err)
+	}
+	for _, action := range []Action{s.action, s.cleanup} {
+		if action != nil && !action.CanRunOnTarget() {
+			return execCtx, fmt.Errorf("step %q cannot run on a remote target: its action only runs locally", s.Name)
+		}
+	}
+	execCtx.remote = &remoteTarget{}
+	return execCtx, nil
+}
+
+// connectTarget connects to the target of the step (if any) and returns
+// the execution context with which its actions should run, along with
+// a function that closes the connection
+func (s *Step) connectTarget(ctx context.Context, execCtx TTPExecutionContext) (TTPExecutionContext, func(), error) {
+	spec := s.targetSpec(execCtx.Cfg)
+	if spec == nil {
+		return execCtx, func() {}, nil
+	}
+	target, err := spec.resolve(execCtx)
+	if err != nil {
+		return execCtx, nil, fmt.Errorf("invalid target for step %q: %w", s.Name, err)
+	}
+	if execCtx.stepConn != nil {
+		conn, err := execCtx.stepConn.connect(ctx, target)
+		if err != nil {
+			return execCtx, nil, err
+		}
+		execCtx.remote = &remoteTarget{conn: conn}
+		return execCtx, func() {}, nil
+	}
+	conn, err := connect(ctx, target)
+	if err != nil {
+		return execCtx, nil, err
+	}
+	execCtx.remote = &remoteTarget{conn: conn}
+	return execCtx, func() { closeConnection(conn) }, nil
+}
+
+func connect(ctx context.Context, target targets.Target) (*targets.Connection, error) {
+	logging.L().Infof("Connecting to target %v", target)
+	return target.Connect(ctx)
+}
+
+func closeConnection(conn *targets.Connection) {
+	if err := conn.Close(); err != nil {
+		logging.L().Warnf("Failed to close connection to target %v: %v", conn.Target(), err)
+	}
+}
+
+// stepConnection is the connection to the target of a running step,
+// which is opened when it is first needed and then shared by the
+// platform check, requirements, attempts, checks and immediate
+// cleanup of the step. It is closed once the step is done.
+type stepConnection struct {
+	mu   sync.Mutex
+	conn *targets.Connection
+}
+
+// connect returns the connection to target, connecting to it with
+// ctx unless an earlier part of the step already did so
+func (c *stepConnection) connect(ctx context.Context, target targets.Target) (*targets.Connection, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		return c.conn, nil
+	}
+	conn, err := connect(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	return conn, nil
+}
+
+// close closes the connection (if it was opened), so
+// that the next part of the step that needs it reconnects
+func (c *stepConnection) close() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil {
+		closeConnection(c.conn)
+		c.conn = nil
+	}
+}
+
+// onTarget reports whether actions run on a remote target
+func (c TTPExecutionContext) onTarget() bool {
+	return c.remote != nil
+}
+
+// connection returns the connection to the remote target
+// of the running step, which is only available during execution
+func (c TTPExecutionContext) connection() (*targets.Connection, error) {
+	if c.remote == nil || c.remote.conn == nil {
+		return nil, errors.New("not connected to a remote target")
+	}
+	return c.remote.conn, nil
+}
+
+// fileSystem returns the file system that file actions should use:
+// fsys if it was set (for example by tests), the file system of the
+// remote target if there is one, or the local file system otherwise
+func (c TTPExecutionContext) fileSystem(fsys afero.Fs) afero.Fs {
+	if fsys != nil {
+		return fsys
+	}
+	if c.remote != nil && c.remote.conn != nil {
+		return c.remote.conn.FileSystem()
+	}
+	if c.Cfg.sharedWorkDir {
+		return ttpDirFs{execCtx: c}
+	}
+	return afero.NewOsFs()
+}
+
+// resolvePath expands a leading ~/ in filePath to the home directory
+// of the user on the remote target, or of the local user - local
+// relative paths are resolved as described for localPath
+func (c TTPExecutionContext) resolvePath(filePath string) (string, error) {
+	if c.remote == nil || c.remote.conn == nil {
+		expanded, err := fileutils.ExpandTilde(filePath)
+		if err != nil {
+			return "", err
+		}
+		return c.localPath(expanded), nil
+	}
+	if rest, ok := strings.CutPrefix(filePath, "~/"); ok {
+		return path.Join(c.remote.conn.HomeDir(), rest), nil
+	}
+	return filePath, nil
+}
+
+// targetEnv builds the environment variables that are set for a
+// command on a remote target: the TTP-level environment followed by
+// the environment of the step. Unlike commandEnv, it does not include
+// the environment of TTPForge itself, which belongs to the local machine.
+func (c TTPExecutionContext) targetEnv(stepEnv map[string]string) ([]string, error) {
+	expandedStepEnv, err := c.ExpandVariables(FetchEnv(stepEnv))
+	if err != nil {
+		return nil, err
+	}
+	var env []string
+	if c.Vars != nil {
+		env = append(env, FetchEnv(c.Vars.Environment)...)
+	}
+	return append(env, expandedStepEnv...), nil
+}
+
+// targetHost runs the commands of checks and requirements on a remote target
+type targetHost struct {
+	conn *targets.Connection
+}
+
+// Run implements checks.RemoteHost
+func (h targetHost) Run(ctx context.Context, command string, env map[string]string) ([]byte, int, error) {
+	var stdout bytes.Buffer
+	cmd := h.conn.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = FetchEnv(env)
+	cmd.Stdout = &stdout
+	err := cmd.Run()
+	var exitErr *targets.ExitError
+	if errors.As(err, &exitErr) {
+		return stdout.Bytes(), exitErr.Code, nil
+	}
+	if err != nil {
+		return nil, -1, err
+	}
+	return stdout.Bytes(), 0, nil
+}
+
+// targetVerificationContext returns a context in which
+// conditions are verified on the remote target of conn
+func targetVerificationContext(conn *targets.Connection) checks.VerificationContext {
+	return checks.VerificationContext{
+		FileSystem: conn.FileSystem(),
+		Host:       targetHost{conn: conn},
+	}
+}
+
+// targetPlatform detects the platform of the remote target of conn
+// with uname, translating its output to GOOS and GOARCH values
+func targetPlatform(ctx context.Context, conn *targets.Connection) (PlatformReport, error) {
+	stdout, exitCode, err := targetHost{conn: conn}.Run(ctx, "uname -snm", nil)
+	if err == nil && exitCode != 0 {
+		err = fmt.Errorf("uname exited with code %d", exitCode)
+	}
+	if err != nil {
+		return PlatformReport{}, fmt.Errorf("failed to detect the platform of target %v: %w", conn.Target(), err)
+	}
+	fields := strings.Fields(string(stdout))
+	if len(fields) != 3 {
+		return PlatformReport{}, fmt.Errorf("unexpected output of uname on target %v: %q", conn.Target(), stdout)
+	}
+	return PlatformReport{
+		OS:       unameOS(fields[0]),
+		Hostname: fields[1],
+		Arch:     unameArch(fields[2]),
+	}, nil
+}
+
+// spec returns the platform specification that the report describes
+func (r PlatformReport) spec() platforms.Spec {
+	return platforms.Spec{OS: r.OS, Arch: r.Arch}
+}
+
+// unameOS translates the kernel name printed by uname -s to a GOOS value
+func unameOS(kernel string) string {
+	switch kernel {
+	case "Linux":
+		return "linux"
+	case "Darwin":
+		return "darwin"
+	case "FreeBSD":
+		return "freebsd"
+	case "OpenBSD":
+		return "openbsd"
+	case "NetBSD":
+		return "netbsd"
+	}
+	return strings.ToLower(kernel)
+}
+
+// unameArch translates the machine name printed by uname -m to a GOARCH value
+func unameArch(machine string) string {
+	switch machine {
+	case "x86_64", "amd64":
+		return "amd64"
+	case "aarch64", "arm64":
+		return "arm64"
+	case "i386", "i486", "i586", "i686", "x86":
+		return "386"
+	}
+	if strings.HasPrefix(machine, "armv") {
+		return "arm"
+	}
+	return machine
+}
@@ -0,0 +1,488 @@
+//go:build !windows
+// +build !windows
+
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/facebookincubator/ttpforge/pkg/targets"
+	"github.com/facebookincubator/ttpforge/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestTargetSpecUnmarshal(t *testing.T) {
+	testCases := []struct {
+		name             string
+		content          string
+		expectedName     string
+		expectedSettings *targets.Target
+		wantError        bool
+	}{
+		{
+			name:         "Target Name",
+			content:      `lab-host`,
+			expectedName: "lab-host",
+		},
+		{
+			name: "Connection Settings",
+			content: `host: 10.0.0.5:2222
+user: root
+key_file: ~/.ssh/id_ed25519`,
+			expectedSettings: &targets.Target{
+				Host:    "10.0.0.5:2222",
+				User:    "root",
+				KeyFile: "~/.ssh/id_ed25519",
+			},
+		},
+		{
+			name:      "Invalid Settings",
+			content:   `[a, b]`,
+			wantError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var spec TargetSpec
+			err := yaml.Unmarshal([]byte(tc.content), &spec)
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedName, spec.Name)
+			assert.Equal(t, tc.expectedSettings, spec.Settings)
+		})
+	}
+}
+
+func TestStepTargets(t *testing.T) {
+	server := testutils.StartSSHServer(t)
+	labTarget := targets.Target{
+		Name:       "lab",
+		Host:       server.Addr,
+		User:       server.User,
+		KeyFile:    server.KeyFile,
+		KnownHosts: server.KnownHosts,
+	}
+
+	testCases := []struct {
+		name              string
+		content           string
+		runTarget         *targets.Target
+		env               map[string]string
+		wantValidateError bool
+		wantError         bool
+		expectedStdout    string
+		// files that exist after execution, and no longer exist after cleanup
+		expectedFiles map[string]string
+		// restoredFiles are removed by the TTP and restored on cleanup
+		restoredFiles []string
+	}{
+		{
+			name: "Inline Step",
+			content: `name: inline
+steps:
+  - name: remote
+    target:
+      host: HOST
+      user: USER
+      key_file: KEYFILE
+      known_hosts: KNOWNHOSTS
+    inline: |
+      test -n "$SSH_CONNECTION" && echo "remote $GREETING ${TTPFORGE_TEST_LOCAL_ONLY:-unset}"
+    env:
+      GREETING: hello
+    outputs:
+      greeting:
+        filters:
+          - regex: ^remote (\w+)
+  - name: local
+    inline: |
+      echo "${SSH_CONNECTION:-local} $forge.steps.remote.outputs.greeting"`,
+			env:            map[string]string{"TTPFORGE_TEST_LOCAL_ONLY": "yes"},
+			expectedStdout: "remote hello unset\nlocal hello\n",
+		},
+		{
+			name: "File Step",
+			content: `name: file
+steps:
+  - name: remote
+    target:
+      host: HOST
+      user: USER
+      key_file: KEYFILE
+      known_hosts: KNOWNHOSTS
+    file: TMPDIR/script.sh
+    args:
+      - first arg
+      - second`,
+			expectedStdout: "remote: first arg second\n",
+		},
+		{
+			name: "File Actions",
+			content: `name: files
+steps:
+  - name: create
+    target:
+      host: HOST
+      user: USER
+      key_file: KEYFILE
+      known_hosts: KNOWNHOSTS
+    create_file: TMPDIR/created.txt
+    contents: foo bar
+    cleanup: default
+  - name: copy
+    target:
+      host: HOST
+      user: USER
+      key_file: KEYFILE
+      known_hosts: KNOWNHOSTS
+    copy_path: TMPDIR/created.txt
+    to: TMPDIR/copied.txt
+    cleanup: default
+  - name: edit
+    target:
+      host: HOST
+      user: USER
+      key_file: KEYFILE
+      known_hosts: KNOWNHOSTS
+    edit_file: TMPDIR/copied.txt
+    edits:
+      - old: bar
+        new: baz
+  - name: remove
+    target:
+      host: HOST
+      user: USER
+      key_file: KEYFILE
+      known_hosts: KNOWNHOSTS
+    remove_path: TMPDIR/script.sh
+    cleanup: default`,
+			expectedFiles: map[string]string{
+				"created.txt": "foo bar",
+				"copied.txt":  "foo baz",
+			},
+			restoredFiles: []string{"script.sh"},
+		},
+		{
+			name: "Named Target From Environment",
+			content: `name: named
+steps:
+  - name: remote
+    target: $forge.env.TTPFORGE_TEST_TARGET
+    inline: test -n "$SSH_CONNECTION" && echo remote`,
+			env:            map[string]string{"TTPFORGE_TEST_TARGET": "lab"},
+			expectedStdout: "remote\n",
+		},
+		{
+			name: "Run Target",
+			content: `name: run_target
+steps:
+  - name: remote
+    inline: test -n "$SSH_CONNECTION" && echo remote
+  - name: printed
+    print_str: printed locally`,
+			runTarget:      &labTarget,
+			expectedStdout: "remote\nprinted locally\n",
+		},
+		{
+			name: "Checks And Requirements On Target",
+			content: `name: checks
+steps:
+  - name: remote
+    target:
+      host: HOST
+      user: USER
+      key_file: KEYFILE
+      known_hosts: KNOWNHOSTS
+    platforms:
+      - os: linux
+    requires:
+      - msg: "the requirement was verified locally"
+        command_succeeds: test -n "$SSH_CONNECTION"
+      - msg: "the variable was looked up locally"
+        not:
+          env_var: TTPFORGE_TEST_LOCAL_ONLY
+    inline: test -n "$SSH_CONNECTION" && echo remote > TMPDIR/remote.txt
+    checks:
+      - msg: "the check was verified locally"
+        command_succeeds: test -n "$SSH_CONNECTION"
+        stdout_matches: ^$
+      - msg: "the file was not created"
+        path_exists: TMPDIR/remote.txt
+  - name: local
+    inline: echo local
+    checks:
+      - msg: "the check was verified remotely"
+        command_succeeds: test -z "$SSH_CONNECTION"`,
+			env:            map[string]string{"TTPFORGE_TEST_LOCAL_ONLY": "yes"},
+			expectedStdout: "local\n",
+		},
+		{
+			name: "Run Target Requirements",
+			content: `name: requirements
+requirements:
+  platforms:
+    - os: linux
+  commands:
+    - sh
+  env:
+    - SSH_CONNECTION
+steps:
+  - name: remote
+    inline: echo remote`,
+			runTarget:      &labTarget,
+			expectedStdout: "remote\n",
+		},
+		{
+			name: "Run Target Requirements Not Met",
+			content: `name: requirements
+requirements:
+  env:
+    - TTPFORGE_TEST_LOCAL_ONLY
+steps:
+  - name: remote
+    inline: echo remote`,
+			env:       map[string]string{"TTPFORGE_TEST_LOCAL_ONLY": "yes"},
+			runTarget: &labTarget,
+			wantError: true,
+		},
+		{
+			name: "Run Target With Local Only Action",
+			content: `name: local_only
+steps:
+  - name: change_dir
+    cd: TMPDIR`,
+			runTarget:         &labTarget,
+			wantValidateError: true,
+		},
+		{
+			name: "Step For Other Platform On Target Is Validated",
+			content: `name: other_platform
+steps:
+  - name: change_dir
+    target: lab
+    platforms:
+      - os: windows
+    cd: TMPDIR`,
+			wantValidateError: true,
+		},
+		{
+			name: "Undefined Target Name",
+			content: `name: undefined
+steps:
+  - name: remote
+    target: missing
+    inline: echo remote`,
+			wantValidateError: true,
+		},
+		{
+			name: "Invalid Target Settings",
+			content: `name: invalid
+steps:
+  - name: remote
+    target:
+      host: HOST
+    inline: echo remote`,
+			wantValidateError: true,
+		},
+		{
+			name: "Unreachable Target",
+			content: `name: unreachable
+steps:
+  - name: remote
+    target:
+      host: 127.0.0.1:1
+      user: USER
+      key_file: KEYFILE
+      known_hosts: KNOWNHOSTS
+    inline: echo remote`,
+			wantError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "script.sh"), []byte(`#!/bin/sh
+test -n "$SSH_CONNECTION" && echo "remote: $1 $2"
+`), 0755))
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+			content := strings.NewReplacer(
+				"TMPDIR", tmpDir,
+				"HOST", server.Addr,
+				"USER", server.User,
+				"KEYFILE", server.KeyFile,
+				"KNOWNHOSTS", server.KnownHosts,
+			).Replace(tc.content)
+
+			ttp, err := RenderTemplatedTTP(content, RenderParameters{})
+			require.NoError(t, err)
+
+			execCtx := NewTTPExecutionContext()
+			var stdoutBuf bytes.Buffer
+			execCtx.Cfg.Stdout = &stdoutBuf
+			execCtx.Cfg.Target = tc.runTarget
+			execCtx.Cfg.Targets = map[string]targets.Target{"lab": labTarget}
+			err = ttp.Validate(execCtx)
+			if tc.wantValidateError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			err = ttp.Execute(context.Background(), execCtx)
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedStdout, stdoutBuf.String())
+
+			for name, expectedContents := range tc.expectedFiles {
+				contents, err := os.ReadFile(filepath.Join(tmpDir, name))
+				require.NoError(t, err)
+				assert.Equal(t, expectedContents, string(contents))
+			}
+
+			require.NoError(t, ttp.RunCleanup(execCtx))
+			for name := range tc.expectedFiles {
+				assert.NoFileExists(t, filepath.Join(tmpDir, name))
+			}
+			for _, name := range tc.restoredFiles {
+				info, err := os.Stat(filepath.Join(tmpDir, name))
+				require.NoError(t, err)
+				assert.Equal(t, os.FileMode(0755), info.Mode())
+			}
+		})
+	}
+}
+
+func TestStepTargetConnections(t *testing.T) {
+	server := testutils.StartSSHServer(t)
+	content := strings.NewReplacer(
+		"HOST", server.Addr,
+		"USER", server.User,
+		"KEYFILE", server.KeyFile,
+		"KNOWNHOSTS", server.KnownHosts,
+	).Replace(`name: connections
+steps:
+  - name: verified
+    platforms:
+      - os: linux
+    requires:
+      - msg: "the requirement was not verified on the target"
+        command_succeeds: test -n "$SSH_CONNECTION"
+    inline: echo verified
+    checks:
+      - msg: "the check was not verified on the target"
+        command_succeeds: test -n "$SSH_CONNECTION"
+  - name: cleaned_up
+    inline: echo cleaned_up
+    on_failure: cleanup_and_continue
+    checks:
+      - msg: "the check failed as expected"
+        command_succeeds: "false"
+    cleanup:
+      inline: echo cleanup
+  - name: group
+    parallel:
+      - name: first_child
+        inline: echo first_child
+        checks:
+          - msg: "the check was not verified on the target"
+            command_succeeds: test -n "$SSH_CONNECTION"
+      - name: second_child
+        inline: sleep 0.1 && echo second_child
+        checks:
+          - msg: "the check was not verified on the target"
+            command_succeeds: test -n "$SSH_CONNECTION"`)
+	ttp, err := RenderTemplatedTTP(content, RenderParameters{})
+	require.NoError(t, err)
+
+	execCtx := NewTTPExecutionContext()
+	var stdoutBuf bytes.Buffer
+	execCtx.Cfg.Stdout = &stdoutBuf
+	execCtx.Cfg.Target = &targets.Target{
+		Host:       server.Addr,
+		User:       server.User,
+		KeyFile:    server.KeyFile,
+		KnownHosts: server.KnownHosts,
+	}
+	require.NoError(t, ttp.Validate(execCtx))
+	require.NoError(t, ttp.Execute(context.Background(), execCtx))
+	assert.Equal(t, "verified\ncleaned_up\ncleanup\nfirst_child\nsecond_child\n", stdoutBuf.String())
+
+	// one connection to detect the platform of the run target, and
+	// one for each step that runs on it - whose platform check,
+	// requirements, checks and immediate cleanup all share it
+	assert.Equal(t, 1+2+2, server.Connections())
+}
+
+func TestExpectStepOnTarget(t *testing.T) {
+	server := testutils.StartSSHServer(t)
+	content := `name: expect
+steps:
+  - name: remote
+    target:
+      host: HOST
+      user: USER
+      key_file: KEYFILE
+      known_hosts: KNOWNHOSTS
+    expect:
+      inline: |
+        printf 'Name: '
+        read name
+        test -n "$SSH_CONNECTION" && echo "Hello $name" > TMPDIR/greeting.txt
+      responses:
+        - prompt: "Name: "
+          response: John`
+	tmpDir := t.TempDir()
+	content = strings.NewReplacer(
+		"TMPDIR", tmpDir,
+		"HOST", server.Addr,
+		"USER", server.User,
+		"KEYFILE", server.KeyFile,
+		"KNOWNHOSTS", server.KnownHosts,
+	).Replace(content)
+
+	ttp, err := RenderTemplatedTTP(content, RenderParameters{})
+	require.NoError(t, err)
+	execCtx := NewTTPExecutionContext()
+	require.NoError(t, ttp.Validate(execCtx))
+	require.NoError(t, ttp.Execute(context.Background(), execCtx))
+
+	greeting, err := os.ReadFile(filepath.Join(tmpDir, "greeting.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "Hello John\n", string(greeting))
+}
@@ -0,0 +1,173 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeouts(t *testing.T) {
+	testCases := []struct {
+		name              string
+		contentFmtStr     string
+		wantValidateError bool
+		expectedStatuses  map[string]StepStatus
+		expectedCleanup   string
+	}{
+		{
+			name: "Step Timeout",
+			contentFmtStr: `name: step_timeout
+steps:
+  - name: first
+    inline: echo first
+    cleanup:
+      inline: echo -n cleanup_first >> %[1]v/cleanup
+  - name: hangs
+    inline: sleep 30
+    timeout: 200ms
+    cleanup:
+      inline: echo -n cleanup_hangs >> %[1]v/cleanup
+  - name: never_runs
+    inline: echo never_runs`,
+			expectedStatuses: map[string]StepStatus{
+				"first": StepSucceeded,
+				"hangs": StepTimedOut,
+			},
+			expectedCleanup: "cleanup_first",
+		},
+		{
+			name: "TTP Timeout",
+			contentFmtStr: `name: ttp_timeout
+timeout: 500ms
+steps:
+  - name: quick
+    inline: sleep 0.1
+    cleanup:
+      inline: echo -n cleanup_quick >> %[1]v/cleanup
+  - name: slow
+    inline: sleep 30
+    timeout: 1m`,
+			expectedStatuses: map[string]StepStatus{
+				"quick": StepSucceeded,
+				"slow":  StepTimedOut,
+			},
+			expectedCleanup: "cleanup_quick",
+		},
+		{
+			name: "Retried Step Times Out On Every Attempt",
+			contentFmtStr: `name: retry_timeout
+steps:
+  - name: hangs
+    inline: |
+      echo -n x >> %[1]v/attempts
+      sleep 30
+    timeout: 100ms
+    retry:
+      attempts: 2`,
+			expectedStatuses: map[string]StepStatus{
+				"hangs": StepTimedOut,
+			},
+		},
+		{
+			name: "Negative Step Timeout",
+			contentFmtStr: `name: negative_timeout
+steps:
+  - name: step1
+    inline: echo %[1]v
+    timeout: -1s`,
+			wantValidateError: true,
+		},
+		{
+			name: "Negative TTP Timeout",
+			contentFmtStr: `name: negative_timeout
+timeout: -1
+steps:
+  - name: step1
+    inline: echo %[1]v`,
+			wantValidateError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			ttp, err := RenderTemplatedTTP(fmt.Sprintf(tc.contentFmtStr, tmpDir), RenderParameters{})
+			require.NoError(t, err)
+
+			execCtx := NewTTPExecutionContext()
+			err = ttp.Validate(execCtx)
+			if tc.wantValidateError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			start := time.Now()
+			err = ttp.Execute(context.Background(), execCtx)
+			require.Error(t, err)
+			assert.True(t, errors.Is(err, ErrTimedOut), "error should be a timeout: %v", err)
+			assert.Less(t, time.Since(start), 10*time.Second, "timed out step should have been killed")
+
+			for name, status := range tc.expectedStatuses {
+				result, found := execCtx.StepResults.ByName[name]
+				require.True(t, found, "missing result for step %v", name)
+				assert.Equal(t, status, result.Status, "unexpected status for step %v", name)
+			}
+
+			err = ttp.RunCleanup(execCtx)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedCleanup, readFileOrEmpty(t, filepath.Join(tmpDir, "cleanup")))
+		})
+	}
+}
+
+func TestTimeoutKillsProcessTree(t *testing.T) {
+	tmpDir := t.TempDir()
+	survivorPath := filepath.Join(tmpDir, "survived")
+	content := fmt.Sprintf(`name: process_tree
+steps:
+  - name: spawns_grandchild
+    inline: |
+      (sleep 1; echo -n survived > %v) &
+      wait
+    timeout: 200ms`, survivorPath)
+	ttp, err := RenderTemplatedTTP(content, RenderParameters{})
+	require.NoError(t, err)
+
+	execCtx := NewTTPExecutionContext()
+	err = ttp.Validate(execCtx)
+	require.NoError(t, err)
+	err = ttp.Execute(context.Background(), execCtx)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrTimedOut), "error should be a timeout: %v", err)
+
+	// give the grandchild enough time to
+	// write its file if it was not killed
+	time.Sleep(1500 * time.Millisecond)
+	assert.Empty(t, readFileOrEmpty(t, survivorPath), "grandchild process should have been killed")
+}
@@ -21,9 +21,12 @@ package blocks
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/facebookincubator/ttpforge/pkg/checks"
@@ -38,14 +41,20 @@ import (
 // **Attributes:**
 //
 // Environment: A map of environment variables to be set for the TTP.
+// Outputs: A map of output names to expressions over the results of the TTP's steps.
 // Steps: An slice of steps to be executed for the TTP.
 // WorkDir: The working directory for the TTP.
 type TTP struct {
 	PreambleFields `yaml:",inline"`
 	Environment    map[string]string `yaml:"env,flow,omitempty"`
+	Outputs        map[string]string `yaml:"outputs,omitempty"`
 	Steps          []Step            `yaml:"steps,omitempty,flow"`
 	// Omit WorkDir, but expose for testing.
 	WorkDir string `yaml:"-"`
+
+	// definition is the TTP YAML with all templates
+	// rendered, which is recorded in cleanup journals
+	definition string
 }
 
 // MitreAttack represents mappings to the MITRE ATT&CK framework.
@@ -56,9 +65,9 @@ type TTP struct {
 // Techniques: A string slice containing the MITRE ATT&CK technique(s) associated with the TTP.
 // SubTechniques: A string slice containing the MITRE ATT&CK sub-technique(s) associated with the TTP.
 type MitreAttack struct {
-	Tactics       []string `yaml:"tactics,omitempty"`
-	Techniques    []string `yaml:"techniques,omitempty"`
-	SubTechniques []string `yaml:"subtechniques,omitempty"`
+	Tactics       []string `yaml:"tactics,omitempty" json:"tactics,omitempty"`
+	Techniques    []string `yaml:"techniques,omitempty" json:"techniques,omitempty"`
+	SubTechniques []string `yaml:"subtechniques,omitempty" json:"subtechniques,omitempty"`
 }
 
 // MarshalYAML is a custom marshalling implementation for the TTP structure.
@@ -127,92 +136,275 @@ func (t *TTP) Validate(execCtx TTPExecutionContext) error {
 			return err
 		}
 	}
+
+	if err := t.validateOutputs(); err != nil {
+		return err
+	}
 	logging.L().Debug("...finished validating TTP.")
 	return nil
 }
 
+// validateOutputs checks that the TTP-level outputs
+// only reference steps that exist in the TTP
+func (t *TTP) validateOutputs() error {
+	if len(t.Outputs) == 0 {
+		return nil
+	}
+	stepNames := make(map[string]bool)
+	for _, step := range t.Steps {
+		stepNames[step.Name] = true
+		if parallelStep, ok := step.action.(*ParallelStep); ok {
+			for _, child := range parallelStep.Steps {
+				stepNames[child.Name] = true
+			}
+		}
+	}
+	for name, expr := range t.Outputs {
+		for _, match := range contextVariableRegexp.FindAllString(expr, -1) {
+			path, ok := strings.CutPrefix(match, contextVariablePrefix+"steps.")
+			if !ok {
+				continue
+			}
+			stepName, _, _ := strings.Cut(path, ".")
+			if !stepNames[stepName] {
+				return fmt.Errorf("output %q of TTP %q references unknown step %q", name, t.Name, stepName)
+			}
+		}
+	}
+	return nil
+}
+
+// resolveOutputs evaluates the TTP-level outputs once
+// all steps of the TTP have completed successfully
+func (t *TTP) resolveOutputs(execCtx TTPExecutionContext) (map[string]interface{}, error) {
+	if len(t.Outputs) == 0 {
+		return nil, nil
+	}
+	resolved := make(map[string]interface{}, len(t.Outputs))
+	for name, expr := range t.Outputs {
+		val, err := execCtx.expandValue(expr)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve output %q of TTP %q: %w", name, t.Name, err)
+		}
+		resolved[name] = val
+	}
+	return resolved, nil
+}
+
 // Execute executes all of the steps in the given TTP,
 // then runs cleanup if appropriate
-func (t *TTP) Execute(execCtx TTPExecutionContext) error {
+func (t *TTP) Execute(ctx context.Context, execCtx TTPExecutionContext) error {
 	logging.L().Infof("RUNNING TTP: %v", t.Name)
 
-	if err := t.verifyPlatform(); err != nil {
-		return fmt.Errorf("TTP requirements not met: %w", err)
+	if err := t.initVars(execCtx, execCtx.Vars.Environment); err != nil {
+		return err
 	}
 
-	err := t.RunSteps(execCtx)
+	// requirements are verified once the TTP-level environment is
+	// known, as it may provide the required environment variables
+	if err := t.verifyPlatform(ctx, execCtx); err != nil {
+		return err
+	}
+
+	err := t.RunSteps(ctx, execCtx)
 	if err == nil {
 		logging.L().Info("All TTP steps completed successfully! ✅")
 	}
 	return err
 }
 
+// initVars records the metadata of the TTP in the execution
+// variables and expands the variables in the TTP-level environment,
+// which is merged over the inherited environment (that of the parent
+// TTP, for sub TTPs). The result applies to every step of the TTP.
+func (t *TTP) initVars(execCtx TTPExecutionContext, inherited map[string]string) error {
+	execCtx.Vars.TTPName = t.Name
+	execCtx.Vars.TTPUUID = t.UUID
+
+	expanded := make(map[string]string, len(t.Environment))
+	for k, v := range t.Environment {
+		expandedValues, err := execCtx.ExpandVariables([]string{v})
+		if err != nil {
+			return fmt.Errorf("failed to expand TTP environment variable %v: %w", k, err)
+		}
+		expanded[k] = expandedValues[0]
+	}
+	execCtx.Vars.Environment = mergeEnvironments(inherited, expanded)
+	return nil
+}
+
 // RunSteps executes all of the steps in the given TTP.
-func (t *TTP) RunSteps(execCtx TTPExecutionContext) error {
+// Running steps are cancelled if ctx is cancelled, if
+// the TTP times out, or if a shutdown signal is received.
+func (t *TTP) RunSteps(ctx context.Context, execCtx TTPExecutionContext) error {
 	// go to the configuration directory for this TTP
-	changeBack, err := t.chdir()
+	changeBack, err := t.chdir(execCtx)
 	if err != nil {
 		return err
 	}
 	defer changeBack()
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if t.Timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, time.Duration(t.Timeout))
+		defer cancelTimeout()
+	}
+
 	var stepError error
 	var verifyError error
 	var shutdownFlag bool
+	var toleratedFailures int
+
+	// everything that a step does on its target uses one
+	// connection, which is closed once the next step starts
+	execCtx.stepConn = &stepConnection{}
+	defer execCtx.stepConn.close()
 
 	// actually run all the steps
 	for stepIdx, step := range t.Steps {
 		logging.DividerThin()
 		logging.L().Infof("Executing Step #%d: %q", stepIdx+1, step.Name)
-		// core execution - run the step action
-		go func(step Step) {
-			_, err := step.Execute(execCtx)
-			if err != nil {
-				// This error was logged by the step itself
-				logging.L().Debugf("Error executing step %s: %v", step.Name, err)
-			}
-		}(step)
-
-		// await one of three outcomes:
-		// 1. step execution successful
-		// 2. step execution failed
-		// 3. shutdown signal received
-		select {
-		case stepResult := <-execCtx.actionResultsChan:
-			// step execution successful - record results
+		execCtx.stepConn.close()
+
+		if ctx.Err() != nil {
+			stepError = markInterrupted(ctx, step.Name, errors.New("step was not started"))
+			break
+		}
+
+		// steps whose condition is false are recorded
+		// as skipped so that ByIndex stays aligned with t.Steps
+		shouldRun, conditionErr := step.ShouldRun(ctx, execCtx)
+		if conditionErr == nil && !shouldRun {
 			execResult := &ExecutionResult{
-				ActResult: *stepResult,
+				Status: StepSkipped,
 			}
 			execCtx.StepResults.ByName[step.Name] = execResult
 			execCtx.StepResults.ByIndex = append(execCtx.StepResults.ByIndex, execResult)
+			execCtx.journal.update(t.Steps, execCtx)
+			continue
+		}
 
-		case stepError = <-execCtx.errorsChan:
-			// this part is tricky - SubTTP steps
-			// must be cleaned up even on failure
-			// (because substeps may have succeeded)
-			// so in those cases, we need to save the result
-			// even if nil
-			if step.ShouldCleanupOnFailure() {
-				logging.L().Infof("[+] Cleaning up failed step %s", step.Name)
-				logging.L().Infof("[+] Full Cleanup will Run Afterward")
-				_, cleanupErr := step.Cleanup(execCtx)
-				if cleanupErr != nil {
-					logging.L().Errorf("Error cleaning up failed step %v: %v", step.Name, cleanupErr)
+		// core execution - run the step action
+		// failedStepResult holds whatever the step produced
+		// before it failed (such as its output and exit code)
+		var failedStepResult *ActResult
+		// the requirements are verified in the same goroutine as the
+		// step, so that waiting for them can be interrupted as well
+		var requirementResults []CheckResult
+		var stepResult *ActResult
+		if conditionErr != nil {
+			// a step whose condition could not be evaluated
+			// fails like any other, according to its on_failure policy
+			stepError = conditionErr
+		} else {
+			execCtx.journal.prepareStep(&step)
+			go func(step Step) {
+				shouldRun, reqResults, err := step.AwaitRequirements(ctx, execCtx)
+				requirementResults = reqResults
+				if err == nil && !shouldRun {
+					err = errSkippedByRequirements
+				}
+				if err != nil {
+					execCtx.errorsChan <- err
+					return
+				}
+				result, err := step.Execute(ctx, execCtx)
+				if err != nil {
+					// This error was logged by the step itself
+					logging.L().Debugf("Error executing step %s: %v", step.Name, err)
+					failedStepResult = result
+					execCtx.errorsChan <- err
+					return
+				}
+				execCtx.actionResultsChan <- result
+			}(step)
+
+			// await one of three outcomes:
+			// 1. step execution successful
+			// 2. step execution failed
+			// 3. shutdown signal received - the step is cancelled,
+			//    and we wait for it to be terminated so that
+			//    no processes are left running during cleanup
+			select {
+			case stepResult = <-execCtx.actionResultsChan:
+			case stepError = <-execCtx.errorsChan:
+			case shutdownFlag = <-execCtx.shutdownChan:
+				logging.L().Warn("Shutting down due to signal received")
+				cancel()
+				select {
+				case stepResult = <-execCtx.actionResultsChan:
+				case stepError = <-execCtx.errorsChan:
 				}
 			}
+		}
 
-		case shutdownFlag = <-execCtx.shutdownChan:
-			// TODO[nesusvet]: We should propagate signal to child processes if any
-			logging.L().Warn("Shutting down due to signal received")
+		var execResult *ExecutionResult
+		if errors.Is(stepError, errSkippedByRequirements) {
+			// skipped steps are not failures
+			execResult = &ExecutionResult{
+				Status: StepSkipped,
+			}
+			stepError = nil
+		} else if stepError == nil {
+			// step execution successful - record results
+			execResult = &ExecutionResult{
+				ActResult: *stepResult,
+				Status:    StepSucceeded,
+			}
+			// if the user specified custom success checks, run them now
+			execResult.Checks, verifyError = step.RunChecks(ctx, execCtx, stepResult)
+			if verifyError != nil {
+				execResult.Status = StepChecksFailed
+				execResult.Error = verifyError.Error()
+			}
+		} else {
+			// record the failure so that it shows up
+			// in the results - failed steps are not
+			// included in the regular cleanup process
+			execResult = &ExecutionResult{
+				Status: statusForError(stepError),
+				Error:  stepError.Error(),
+			}
+			if failedStepResult != nil {
+				execResult.ActResult = *failedStepResult
+			}
 		}
+		execResult.Requirements = requirementResults
+		execCtx.StepResults.ByName[step.Name] = execResult
+		execCtx.StepResults.ByIndex = append(execCtx.StepResults.ByIndex, execResult)
+		execCtx.journal.update(t.Steps, execCtx)
 
-		// if the user specified custom success checks, run them now
-		verifyError = step.VerifyChecks()
+		if stepError == nil && verifyError == nil && !shutdownFlag {
+			continue
+		}
 
-		if stepError != nil || verifyError != nil || shutdownFlag {
-			logging.L().Debug("[*] Stopping TTP Early")
-			break
+		// this part is tricky - SubTTP steps
+		// must be cleaned up even on failure
+		// (because substeps may have succeeded)
+		// and the step itself may ask to be
+		// cleaned up right away
+		cleanupNow := stepError != nil && step.ShouldCleanupOnFailure()
+		if step.OnFailure == FailurePolicyCleanupAndContinue && !shutdownFlag {
+			cleanupNow = true
+		}
+		// steps whose requirements were not met never ran
+		if cleanupNow && execResult.requirementsMet() {
+			t.cleanupFailedStep(execCtx, step, execResult)
+			execCtx.journal.update(t.Steps, execCtx)
+		}
+
+		if !shutdownFlag && (step.OnFailure == FailurePolicyContinue || step.OnFailure == FailurePolicyCleanupAndContinue) {
+			logging.L().Warnf("[*] Step %q failed, continuing as requested by its on_failure policy (%v)", step.Name, step.OnFailure)
+			toleratedFailures++
+			stepError = nil
+			verifyError = nil
+			continue
 		}
+
+		logging.L().Debug("[*] Stopping TTP Early")
+		break
 	}
 
 	logging.DividerThin()
@@ -227,14 +419,45 @@ func (t *TTP) RunSteps(execCtx TTPExecutionContext) error {
 	if shutdownFlag {
 		return fmt.Errorf("[*] Shutting Down now")
 	}
+	if toleratedFailures > 0 {
+		logging.L().Warnf("[*] %d step(s) failed but were allowed to fail by their on_failure policy", toleratedFailures)
+	}
 
 	return nil
 }
 
+// cleanupFailedStep immediately cleans up a step that
+// failed, rather than waiting for the rest of the TTP to finish
+func (t *TTP) cleanupFailedStep(execCtx TTPExecutionContext, step Step, execResult *ExecutionResult) {
+	if execCtx.Cfg.NoCleanup {
+		logging.L().Infof("[*] Not cleaning up failed step %s as requested by Config", step.Name)
+		return
+	}
+	logging.L().Infof("[+] Cleaning up failed step %s", step.Name)
+	cleanupResult, err := step.Cleanup(execCtx)
+	if err != nil {
+		logging.L().Errorf("Error cleaning up failed step %v: %v", step.Name, err)
+	}
+	execResult.Cleanup = attemptedCleanup(cleanupResult)
+}
+
+// attemptedCleanup returns the result to record for a cleanup that
+// has run: a cleanup that failed is recorded as well (with whatever
+// it produced), so that the step is not cleaned up a second time
+func attemptedCleanup(cleanupResult *ActResult) *ActResult {
+	if cleanupResult == nil {
+		return &ActResult{}
+	}
+	return cleanupResult
+}
+
 // RunCleanup executes all required cleanup for steps in the given TTP.
 func (t *TTP) RunCleanup(execCtx TTPExecutionContext) error {
 	if execCtx.Cfg.NoCleanup {
 		logging.L().Info("[*] Skipping Cleanup as requested by Config")
+		if execCtx.journal != nil {
+			logging.L().Infof("[*] To clean up later, run: ttpforge cleanup %v", execCtx.Cfg.RunID)
+		}
 		return nil
 	}
 
@@ -244,26 +467,23 @@ func (t *TTP) RunCleanup(execCtx TTPExecutionContext) error {
 	}
 
 	// TODO[nesusvet]: We also should catch signals in clean ups
-	cleanupResults, err := t.startCleanupForCompletedSteps(execCtx)
-	if err != nil {
+	if _, err := t.startCleanupForCompletedSteps(execCtx); err != nil {
 		return err
 	}
-	// since ByIndex and ByName both contain pointers to
-	// the same underlying struct, this will update both
-	for cleanupIdx, cleanupResult := range cleanupResults {
-		execCtx.StepResults.ByIndex[cleanupIdx].Cleanup = cleanupResult
-	}
-
+	execCtx.journal.finish(t, execCtx)
 	return nil
 }
 
-func (t *TTP) chdir() (func(), error) {
+func (t *TTP) chdir(execCtx TTPExecutionContext) (func(), error) {
 	// note: t.WorkDir may not be set in tests but should
 	// be set when actually using `ttpforge run`
 	if t.WorkDir == "" {
 		logging.L().Info("Not changing working directory in tests")
 		return func() {}, nil
 	}
+	if execCtx.Cfg.sharedWorkDir {
+		return func() {}, nil
+	}
 	origDir, err := os.Getwd()
 	if err != nil {
 		return nil, err
@@ -278,20 +498,47 @@ func (t *TTP) chdir() (func(), error) {
 	}, nil
 }
 
-// verify that we actually meet the necessary requirements to execute this TTP
-func (t *TTP) verifyPlatform() error {
+// verify that we actually meet the necessary requirements to execute this TTP.
+// When the whole TTP runs on a remote target, so do its requirements -
+// and the platform of the target is recorded for the report of the run.
+func (t *TTP) verifyPlatform(ctx context.Context, execCtx TTPExecutionContext) error {
 	verificationCtx := checks.VerificationContext{
 		Platform: platforms.Spec{
 			OS:   runtime.GOOS,
 			Arch: runtime.GOARCH,
 		},
 	}
-	return t.Requirements.Verify(verificationCtx)
+	if target := execCtx.Cfg.Target; target != nil {
+		logging.L().Infof("Connecting to target %v to detect its platform", target)
+		conn, err := target.Connect(ctx)
+		if err == nil {
+			defer conn.Close()
+			var platform PlatformReport
+			if platform, err = targetPlatform(ctx, conn); err == nil {
+				execCtx.Vars.targetPlatform = &platform
+				verificationCtx = targetVerificationContext(conn)
+				verificationCtx.Platform = platform.spec()
+			}
+		}
+		// without requirements, the steps report
+		// the failure to reach the target themselves
+		if err != nil {
+			if t.Requirements != nil {
+				return err
+			}
+			logging.L().Warnf("Could not detect the platform of target %v: %v", target, err)
+		}
+	}
+	verificationCtx.Environment = execCtx.Vars.Environment
+	if err := t.Requirements.Verify(verificationCtx); err != nil {
+		return fmt.Errorf("TTP requirements not met: %w", err)
+	}
+	return nil
 }
 
 func (t *TTP) startCleanupForCompletedSteps(execCtx TTPExecutionContext) ([]*ActResult, error) {
 	// go to the configuration directory for this TTP
-	changeBack, err := t.chdir()
+	changeBack, err := t.chdir(execCtx)
 	if err != nil {
 		return nil, err
 	}
@@ -303,6 +550,10 @@ func (t *TTP) startCleanupForCompletedSteps(execCtx TTPExecutionContext) ([]*Act
 	cleanupResults := make([]*ActResult, n)
 	for cleanupIdx := n - 1; cleanupIdx >= 0; cleanupIdx-- {
 		stepToCleanup := t.Steps[cleanupIdx]
+		if execResult := execCtx.StepResults.ByIndex[cleanupIdx]; !stepToCleanup.needsCleanup(execResult) {
+			logging.L().Debugf("Step #%d: %q (%v) does not need to be cleaned up", cleanupIdx+1, stepToCleanup.Name, execResult.Status)
+			continue
+		}
 		logging.DividerThin()
 		logging.L().Infof("Cleaning Up Step #%d: %q", cleanupIdx+1, stepToCleanup.Name)
 		cleanupResult, err := stepToCleanup.Cleanup(execCtx)
@@ -313,6 +564,11 @@ func (t *TTP) startCleanupForCompletedSteps(execCtx TTPExecutionContext) ([]*Act
 			logging.L().Errorf("will continue to try to cleanup other steps")
 			continue
 		}
+		// since ByIndex and ByName both contain pointers to
+		// the same underlying struct, this will update both.
+		// This also records the cleanup results of sub TTPs.
+		execCtx.StepResults.ByIndex[cleanupIdx].Cleanup = cleanupResult
+		execCtx.journal.update(t.Steps, execCtx)
 	}
 	logging.DividerThin()
 	logging.L().Info("Finished Cleanup Successfully ✅")
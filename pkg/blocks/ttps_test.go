@@ -20,6 +20,11 @@ THE SOFTWARE.
 package blocks
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -321,7 +326,8 @@ steps:
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			// Render the templated TTP first
-			ttp, err := RenderTemplatedTTP(tc.content, RenderParameters{
+			content := strings.NewReplacer("CURRENT_OS", runtime.GOOS, "CURRENT_ARCH", runtime.GOARCH).Replace(tc.content)
+			ttp, err := RenderTemplatedTTP(content, RenderParameters{
 				Args: tc.args,
 			})
 			if err != nil {
@@ -335,7 +341,7 @@ steps:
 			require.NoError(t, err)
 
 			// run it
-			err = ttp.Execute(execCtx)
+			err = ttp.Execute(context.Background(), execCtx)
 			if tc.wantError {
 				require.Error(t, err)
 				return
@@ -404,3 +410,748 @@ mitre:
 		})
 	}
 }
+
+func TestStepConditions(t *testing.T) {
+	testCases := []struct {
+		name                  string
+		content               string
+		args                  map[string]interface{}
+		expectedStatuses      map[string]StepStatus
+		wantValidateError     bool
+		wantError             bool
+		expectedCleanupStdout string
+	}{
+		{
+			name: "Branch On Earlier Step Output",
+			content: `name: branch_on_output
+steps:
+  - name: discover
+    inline: echo found_target
+  - name: exploit
+    if: $forge.steps.discover.stdout contains "found_target"
+    inline: echo exploiting
+    cleanup:
+      print_str: cleanup_exploit
+  - name: fallback
+    if: '!($forge.steps.discover.stdout contains "found_target")'
+    inline: echo falling back
+    cleanup:
+      print_str: cleanup_fallback`,
+			expectedStatuses: map[string]StepStatus{
+				"discover": StepSucceeded,
+				"exploit":  StepSucceeded,
+				"fallback": StepSkipped,
+			},
+			expectedCleanupStdout: "cleanup_exploit\n",
+		},
+		{
+			name: "Condition On Structured Output",
+			content: `name: structured_output
+steps:
+  - name: discover
+    inline: |
+      echo '{"hosts":[{"name":"web","port":80}]}'
+    outputs:
+      hosts:
+        filters:
+        - json_path: hosts
+  - name: scan
+    if: $forge.steps.discover.outputs.hosts.length > 0 && $forge.steps.discover.outputs.hosts[0].port == 80
+    inline: echo scanning $forge.steps.discover.outputs.hosts[0].name
+  - name: no_hosts
+    if: $forge.steps.discover.outputs.hosts.length == 0
+    inline: echo no hosts`,
+			expectedStatuses: map[string]StepStatus{
+				"discover": StepSucceeded,
+				"scan":     StepSucceeded,
+				"no_hosts": StepSkipped,
+			},
+		},
+		{
+			name: "Condition On Args And Platform",
+			content: `name: args_and_platform
+args:
+- name: enabled
+  type: bool
+steps:
+  - name: gated
+    if: $forge.args.enabled && $forge.platform.os != ""
+    inline: echo gated
+  - name: not_gated
+    if: '!$forge.args.enabled'
+    inline: echo not_gated`,
+			args: map[string]interface{}{
+				"enabled": true,
+			},
+			expectedStatuses: map[string]StepStatus{
+				"gated":     StepSucceeded,
+				"not_gated": StepSkipped,
+			},
+		},
+		{
+			name: "Skipped Parallel Child",
+			content: `name: parallel_condition
+steps:
+  - name: group
+    parallel:
+      - name: first
+        inline: echo first
+      - name: second
+        if: "false"
+        inline: echo second
+        cleanup:
+          print_str: cleanup_second`,
+			expectedStatuses: map[string]StepStatus{
+				"group":  StepSucceeded,
+				"first":  StepSucceeded,
+				"second": StepSkipped,
+			},
+		},
+		{
+			name: "Step Platforms",
+			content: `name: step_platforms
+steps:
+  - name: current_os
+    platforms:
+      - os: CURRENT_OS
+    inline: echo current
+    cleanup:
+      print_str: cleanup_current
+  - name: other_os
+    platforms:
+      - os: plan9
+    executor: ttpforge-plan9-shell
+    inline: echo other
+    cleanup:
+      print_str: cleanup_other
+  - name: any_of_several
+    platforms:
+      - os: plan9
+      - os: CURRENT_OS
+        arch: CURRENT_ARCH
+    inline: echo several
+  - name: group
+    parallel:
+      - name: child_current_os
+        platforms:
+          - os: CURRENT_OS
+        inline: echo child
+      - name: child_other_os
+        platforms:
+          - os: plan9
+        inline: echo child`,
+			expectedStatuses: map[string]StepStatus{
+				"current_os":       StepSucceeded,
+				"other_os":         StepSkipped,
+				"any_of_several":   StepSucceeded,
+				"group":            StepSucceeded,
+				"child_current_os": StepSucceeded,
+				"child_other_os":   StepSkipped,
+			},
+			expectedCleanupStdout: "cleanup_current\n",
+		},
+		{
+			name: "Missing Executor On Current Platform",
+			content: `name: missing_executor
+steps:
+  - name: current_os
+    platforms:
+      - os: CURRENT_OS
+    executor: ttpforge-no-such-shell
+    inline: echo current`,
+			wantValidateError: true,
+		},
+		{
+			name: "Invalid Step Platform",
+			content: `name: invalid_platform
+steps:
+  - name: step1
+    platforms:
+      - os: beos
+    inline: echo step1`,
+			wantValidateError: true,
+		},
+		{
+			name: "Malformed Condition",
+			content: `name: malformed
+steps:
+  - name: step1
+    if: $forge.steps.foo.stdout ==
+    inline: echo step1`,
+			wantValidateError: true,
+		},
+		{
+			name: "Unresolvable Condition",
+			content: `name: unresolvable
+steps:
+  - name: step1
+    if: $forge.steps.missing.stdout == "x"
+    inline: echo step1`,
+			wantError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			content := strings.NewReplacer("CURRENT_OS", runtime.GOOS, "CURRENT_ARCH", runtime.GOARCH).Replace(tc.content)
+			ttp, err := RenderTemplatedTTP(content, RenderParameters{
+				Args: tc.args,
+			})
+			require.NoError(t, err)
+
+			execCtx := NewTTPExecutionContext()
+			execCtx.Vars.Args = tc.args
+			var stdoutBuf bytes.Buffer
+			execCtx.Cfg.Stdout = &stdoutBuf
+			err = ttp.Validate(execCtx)
+			if tc.wantValidateError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			err = ttp.Execute(context.Background(), execCtx)
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			for name, status := range tc.expectedStatuses {
+				result, found := execCtx.StepResults.ByName[name]
+				require.True(t, found, "missing result for step %v", name)
+				assert.Equal(t, status, result.Status, "unexpected status for step %v", name)
+			}
+
+			stdoutBuf.Reset()
+			err = ttp.RunCleanup(execCtx)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedCleanupStdout, stdoutBuf.String())
+		})
+	}
+}
+
+func TestFailurePolicies(t *testing.T) {
+	testCases := []struct {
+		name                  string
+		content               string
+		expectedStatuses      map[string]StepStatus
+		expectedErrors        map[string]string
+		wantValidateError     bool
+		wantError             bool
+		expectedStdout        string
+		expectedCleanupStdout string
+	}{
+		{
+			name: "Continue After Failure",
+			content: `name: continue
+steps:
+  - name: first
+    inline: echo first
+    cleanup:
+      print_str: cleanup_first
+  - name: optional
+    inline: exit 3
+    on_failure: continue
+    cleanup:
+      print_str: cleanup_optional
+  - name: last
+    inline: echo last`,
+			expectedStatuses: map[string]StepStatus{
+				"first":    StepSucceeded,
+				"optional": StepFailed,
+				"last":     StepSucceeded,
+			},
+			expectedErrors: map[string]string{
+				"optional": "exit status 3",
+			},
+			expectedStdout:        "first\nlast\n",
+			expectedCleanupStdout: "cleanup_first\n",
+		},
+		{
+			name: "Cleanup And Continue After Failed Checks",
+			content: `name: cleanup_and_continue
+steps:
+  - name: first
+    inline: echo first
+    cleanup:
+      print_str: cleanup_first
+  - name: optional
+    inline: echo optional
+    on_failure: cleanup_and_continue
+    checks:
+      - msg: file should exist
+        path_exists: /this/path/does/not/exist
+    cleanup:
+      print_str: cleanup_optional
+  - name: last
+    inline: echo last`,
+			expectedStatuses: map[string]StepStatus{
+				"first":    StepSucceeded,
+				"optional": StepChecksFailed,
+				"last":     StepSucceeded,
+			},
+			expectedErrors: map[string]string{
+				"optional": "does not exist",
+			},
+			expectedStdout:        "first\noptional\ncleanup_optional\nlast\n",
+			expectedCleanupStdout: "cleanup_first\n",
+		},
+		{
+			name: "Failed Cleanup After Failed Checks Runs Once",
+			content: `name: failed_cleanup
+steps:
+  - name: optional
+    inline: echo optional
+    on_failure: cleanup_and_continue
+    checks:
+      - msg: file should exist
+        path_exists: /this/path/does/not/exist
+    cleanup:
+      inline: |
+        echo cleanup_optional
+        exit 1
+  - name: last
+    inline: echo last`,
+			expectedStatuses: map[string]StepStatus{
+				"optional": StepChecksFailed,
+				"last":     StepSucceeded,
+			},
+			expectedStdout: "optional\ncleanup_optional\nlast\n",
+		},
+		{
+			name: "Failed Cleanup Of Failed Group Runs Once",
+			content: `name: failed_group_cleanup
+steps:
+  - name: group
+    on_failure: cleanup_and_continue
+    parallel:
+      - name: bad
+        inline: exit 1
+    cleanup:
+      inline: |
+        echo cleanup_group
+        exit 1
+  - name: last
+    inline: echo last`,
+			expectedStatuses: map[string]StepStatus{
+				"group": StepFailed,
+				"last":  StepSucceeded,
+			},
+			expectedStdout: "cleanup_group\nlast\n",
+		},
+		{
+			name: "Continue After Failed Checks Still Cleans Up",
+			content: `name: checks_continue
+steps:
+  - name: optional
+    inline: echo optional
+    on_failure: continue
+    checks:
+      - msg: file should exist
+        path_exists: /this/path/does/not/exist
+    cleanup:
+      print_str: cleanup_optional
+  - name: last
+    inline: echo last`,
+			expectedStatuses: map[string]StepStatus{
+				"optional": StepChecksFailed,
+				"last":     StepSucceeded,
+			},
+			expectedStdout:        "optional\nlast\n",
+			expectedCleanupStdout: "cleanup_optional\n",
+		},
+		{
+			name: "Checks See Step Output And TTP Environment",
+			content: `name: checks_context
+env:
+  MARKER: from_ttp
+steps:
+  - name: passes
+    inline: echo "user=backdoor"
+    outputs:
+      user:
+        filters:
+          - regex: 'user=(\w+)'
+    checks:
+      - msg: stdout should match
+        output_matches: '^user='
+      - msg: output should match
+        output_matches: '^backdoor$'
+        output: user
+      - msg: TTP environment should be visible
+        env_var: MARKER
+        equals: from_ttp
+      - msg: command should see TTP environment
+        command_succeeds: '[ "$MARKER" = from_ttp ]'
+  - name: fails
+    inline: echo "user=root"
+    on_failure: continue
+    checks:
+      - msg: stdout should match
+        output_matches: 'backdoor'`,
+			expectedStatuses: map[string]StepStatus{
+				"passes": StepSucceeded,
+				"fails":  StepChecksFailed,
+			},
+			expectedErrors: map[string]string{
+				"fails": `step output does not match "backdoor"`,
+			},
+			expectedStdout: "user=backdoor\nuser=root\n",
+		},
+		{
+			name: "Exit Code Of Failed Step Can Be Referenced",
+			content: `name: exit_code
+steps:
+  - name: optional
+    inline: |
+      echo trying
+      exit 7
+    on_failure: continue
+  - name: report
+    inline: echo "optional exited with $forge.steps.optional.exit_code"`,
+			expectedStatuses: map[string]StepStatus{
+				"optional": StepFailed,
+				"report":   StepSucceeded,
+			},
+			expectedStdout: "trying\noptional exited with 7\n",
+		},
+		{
+			name: "Stop Is The Default",
+			content: `name: stop
+steps:
+  - name: first
+    inline: echo first
+  - name: fails
+    inline: exit 1
+    on_failure: stop
+  - name: never_runs
+    inline: echo should_not_run`,
+			expectedStatuses: map[string]StepStatus{
+				"first": StepSucceeded,
+				"fails": StepFailed,
+			},
+			wantError: true,
+		},
+		{
+			name: "Tolerated Parallel Child",
+			content: `name: parallel_continue
+steps:
+  - name: group
+    parallel:
+      - name: good
+        inline: echo good
+        cleanup:
+          print_str: cleanup_good
+      - name: bad
+        inline: exit 1
+        on_failure: cleanup_and_continue
+        cleanup:
+          print_str: cleanup_bad
+  - name: last
+    inline: echo last`,
+			expectedStatuses: map[string]StepStatus{
+				"group": StepSucceeded,
+				"good":  StepSucceeded,
+				"bad":   StepFailed,
+				"last":  StepSucceeded,
+			},
+			expectedErrors: map[string]string{
+				"bad": "exit status 1",
+			},
+			expectedCleanupStdout: "cleanup_good\n",
+		},
+		{
+			name: "Failed Cleanup Of Tolerated Parallel Child Runs Once",
+			content: `name: failed_child_cleanup
+steps:
+  - name: group
+    parallel:
+      - name: bad
+        inline: echo bad
+        on_failure: cleanup_and_continue
+        checks:
+          - msg: file should exist
+            path_exists: /this/path/does/not/exist
+        cleanup:
+          inline: |
+            echo cleanup_bad
+            exit 1
+  - name: last
+    inline: echo last`,
+			expectedStatuses: map[string]StepStatus{
+				"group": StepSucceeded,
+				"bad":   StepChecksFailed,
+				"last":  StepSucceeded,
+			},
+			expectedStdout: "bad\ncleanup_bad\nlast\n",
+		},
+		{
+			name: "Invalid Policy",
+			content: `name: invalid
+steps:
+  - name: step1
+    inline: echo step1
+    on_failure: ignore`,
+			wantValidateError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ttp, err := RenderTemplatedTTP(tc.content, RenderParameters{})
+			require.NoError(t, err)
+
+			execCtx := NewTTPExecutionContext()
+			var stdoutBuf bytes.Buffer
+			execCtx.Cfg.Stdout = &stdoutBuf
+			err = ttp.Validate(execCtx)
+			if tc.wantValidateError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			err = ttp.Execute(context.Background(), execCtx)
+			if tc.wantError {
+				require.Error(t, err)
+				_, found := execCtx.StepResults.ByName["never_runs"]
+				assert.False(t, found, "steps after a failed step should not run")
+			} else {
+				require.NoError(t, err)
+			}
+
+			for name, status := range tc.expectedStatuses {
+				result, found := execCtx.StepResults.ByName[name]
+				require.True(t, found, "missing result for step %v", name)
+				assert.Equal(t, status, result.Status, "unexpected status for step %v", name)
+				assert.False(t, result.StartTime.IsZero(), "start time of step %v should be recorded", name)
+				assert.False(t, result.EndTime.Before(result.StartTime), "end time of step %v should not precede its start time", name)
+			}
+			for name, expectedError := range tc.expectedErrors {
+				assert.Contains(t, execCtx.StepResults.ByName[name].Error, expectedError)
+			}
+			if tc.expectedStdout != "" {
+				assert.Equal(t, tc.expectedStdout, stdoutBuf.String())
+			}
+
+			stdoutBuf.Reset()
+			err = ttp.RunCleanup(execCtx)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedCleanupStdout, stdoutBuf.String())
+		})
+	}
+}
+
+func TestConditionErrors(t *testing.T) {
+	testCases := []struct {
+		name             string
+		content          string
+		expectedStatuses []StepStatus
+		wantError        bool
+		expectedStdout   string
+	}{
+		{
+			name: "Stops By Default",
+			content: `name: stop
+steps:
+  - name: first
+    inline: echo first
+  - name: broken
+    if: $forge.steps.missing.stdout == "x"
+    inline: echo broken
+  - name: never_runs
+    inline: echo never_runs`,
+			expectedStatuses: []StepStatus{StepSucceeded, StepFailed},
+			wantError:        true,
+			expectedStdout:   "first\n",
+		},
+		{
+			name: "Continues As Requested By On Failure Policy",
+			content: `name: continue
+steps:
+  - name: first
+    inline: echo first
+  - name: broken
+    if: $forge.steps.missing.stdout == "x"
+    inline: echo broken
+    on_failure: continue
+  - name: last
+    inline: echo last`,
+			expectedStatuses: []StepStatus{StepSucceeded, StepFailed, StepSucceeded},
+			expectedStdout:   "first\nlast\n",
+		},
+		{
+			name: "Parallel Child Continues As Requested By On Failure Policy",
+			content: `name: parallel_continue
+steps:
+  - name: group
+    parallel:
+      - name: good
+        inline: echo good
+      - name: broken
+        if: $forge.steps.missing.stdout == "x"
+        inline: echo broken
+        on_failure: continue
+  - name: last
+    inline: echo last`,
+			expectedStatuses: []StepStatus{StepSucceeded, StepSucceeded},
+			expectedStdout:   "good\nlast\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ttp, err := RenderTemplatedTTP(tc.content, RenderParameters{})
+			require.NoError(t, err)
+
+			execCtx := NewTTPExecutionContext()
+			var stdoutBuf bytes.Buffer
+			execCtx.Cfg.Stdout = &stdoutBuf
+			require.NoError(t, ttp.Validate(execCtx))
+
+			err = ttp.Execute(context.Background(), execCtx)
+			if tc.wantError {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			var statuses []StepStatus
+			for _, execResult := range execCtx.StepResults.ByIndex {
+				statuses = append(statuses, execResult.Status)
+			}
+			assert.Equal(t, tc.expectedStatuses, statuses)
+			broken, found := execCtx.StepResults.ByName["broken"]
+			require.True(t, found, "the step whose condition failed should be recorded")
+			assert.Equal(t, StepFailed, broken.Status)
+			assert.Contains(t, broken.Error, "could not evaluate if condition")
+			assert.Equal(t, tc.expectedStdout, stdoutBuf.String())
+		})
+	}
+}
+
+func TestTTPEnvironment(t *testing.T) {
+	testCases := []struct {
+		name           string
+		content        string
+		args           map[string]interface{}
+		expectedStdout string
+		wantError      bool
+	}{
+		{
+			name: "TTP Environment Applies To Every Step",
+			content: `name: ttp_env
+env:
+  TARGET_USER: alice
+steps:
+  - name: first
+    inline: echo "first $TARGET_USER"
+  - name: second
+    inline: echo "second $TARGET_USER"`,
+			expectedStdout: "first alice\nsecond alice\n",
+		},
+		{
+			name: "Step Environment Overrides TTP Environment",
+			content: `name: step_env
+env:
+  TARGET_USER: alice
+  TARGET_HOST: localhost
+steps:
+  - name: override
+    inline: echo "$TARGET_USER@$TARGET_HOST"
+    env:
+      TARGET_USER: bob
+  - name: default
+    inline: echo "$TARGET_USER@$TARGET_HOST"`,
+			expectedStdout: "bob@localhost\nalice@localhost\n",
+		},
+		{
+			name: "TTP Environment Expands Arguments",
+			content: `name: args_env
+env:
+  TARGET_USER: $forge.args.user
+steps:
+  - name: first
+    inline: echo "$TARGET_USER"`,
+			args: map[string]interface{}{
+				"user": "carol",
+			},
+			expectedStdout: "carol\n",
+		},
+		{
+			name: "TTP Environment Applies To Cleanup",
+			content: `name: cleanup_env
+env:
+  TARGET_USER: alice
+steps:
+  - name: first
+    inline: echo "first $TARGET_USER"
+    cleanup:
+      inline: echo "cleanup $TARGET_USER"`,
+			expectedStdout: "first alice\ncleanup alice\n",
+		},
+		{
+			name: "Invalid Variable In TTP Environment",
+			content: `name: bad_env
+env:
+  TARGET_USER: $forge.args.missing
+steps:
+  - name: first
+    inline: echo "$TARGET_USER"`,
+			wantError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ttp, err := RenderTemplatedTTP(tc.content, RenderParameters{})
+			require.NoError(t, err)
+
+			execCtx := NewTTPExecutionContext()
+			execCtx.Vars.Args = tc.args
+			var stdoutBuf bytes.Buffer
+			execCtx.Cfg.Stdout = &stdoutBuf
+			err = ttp.Validate(execCtx)
+			require.NoError(t, err)
+
+			err = ttp.Execute(context.Background(), execCtx)
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			err = ttp.RunCleanup(execCtx)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedStdout, stdoutBuf.String())
+		})
+	}
+}
+
+func TestRuntimeVariables(t *testing.T) {
+	tmpDir := t.TempDir()
+	content := fmt.Sprintf(`name: runtime_vars
+uuid: 0e7c2d9a-3b1f-4a68-8d5e-2f9b7c4a1e03
+env:
+  ARTIFACT_TAG: $forge.ttp.name-$forge.run.id
+steps:
+  - name: change_dir
+    cd: %v
+  - name: use_vars
+    inline: echo "$forge.workdir $forge.ttp.uuid $ARTIFACT_TAG $forge.env.ARTIFACT_TAG"`, tmpDir)
+
+	ttp, err := RenderTemplatedTTP(content, RenderParameters{})
+	require.NoError(t, err)
+
+	execCtx := NewTTPExecutionContext()
+	execCtx.Cfg.RunID = "4c1e6a52-8f3d-4b7a-9e21-6d0f5b3c8a74"
+	err = ttp.Validate(execCtx)
+	require.NoError(t, err)
+	err = ttp.Execute(context.Background(), execCtx)
+	require.NoError(t, err)
+
+	tag := "runtime_vars-4c1e6a52-8f3d-4b7a-9e21-6d0f5b3c8a74"
+	result, found := execCtx.StepResults.ByName["use_vars"]
+	require.True(t, found)
+	assert.Equal(t, fmt.Sprintf("%v 0e7c2d9a-3b1f-4a68-8d5e-2f9b7c4a1e03 %v %v\n", tmpDir, tag, tag), result.Stdout)
+}
@@ -0,0 +1,116 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package blocks
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// localPath resolves a relative path on the local machine against the
+// directory of the TTP if the TTP shares the working directory of the
+// process (see TTPExecutionConfig.sharedWorkDir) and therefore cannot
+// change into its own directory. Other paths are returned unchanged.
+func (c TTPExecutionContext) localPath(filePath string) string {
+	if !c.Cfg.sharedWorkDir || c.onTarget() || c.Vars == nil || c.Vars.ttpDir == "" {
+		return filePath
+	}
+	if filePath == "" || filepath.IsAbs(filePath) {
+		return filePath
+	}
+	return filepath.Join(c.Vars.ttpDir, filePath)
+}
+
+// ttpDirFs is the local file system as seen from the directory of a
+// TTP that shares the working directory of the process: relative
+// paths are resolved against the directory of the TTP.
+type ttpDirFs struct {
+	afero.OsFs
+	execCtx TTPExecutionContext
+}
+
+func (fsys ttpDirFs) path(name string) string {
+	return fsys.execCtx.localPath(name)
+}
+
+func (fsys ttpDirFs) Create(name string) (afero.File, error) {
+	return fsys.OsFs.Create(fsys.path(name))
+}
+
+func (fsys ttpDirFs) Mkdir(name string, perm os.FileMode) error {
+	return fsys.OsFs.Mkdir(fsys.path(name), perm)
+}
+
+func (fsys ttpDirFs) MkdirAll(name string, perm os.FileMode) error {
+	return fsys.OsFs.MkdirAll(fsys.path(name), perm)
+}
+
+func (fsys ttpDirFs) Open(name string) (afero.File, error) {
+	return fsys.OsFs.Open(fsys.path(name))
+}
+
+func (fsys ttpDirFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	return fsys.OsFs.OpenFile(fsys.path(name), flag, perm)
+}
+
+func (fsys ttpDirFs) Remove(name string) error {
+	return fsys.OsFs.Remove(fsys.path(name))
+}
+
+func (fsys ttpDirFs) RemoveAll(name string) error {
+	return fsys.OsFs.RemoveAll(fsys.path(name))
+}
+
+func (fsys ttpDirFs) Rename(oldname, newname string) error {
+	return fsys.OsFs.Rename(fsys.path(oldname), fsys.path(newname))
+}
+
+func (fsys ttpDirFs) Stat(name string) (os.FileInfo, error) {
+	return fsys.OsFs.Stat(fsys.path(name))
+}
+
+func (fsys ttpDirFs) Chmod(name string, mode os.FileMode) error {
+	return fsys.OsFs.Chmod(fsys.path(name), mode)
+}
+
+func (fsys ttpDirFs) Chown(name string, uid, gid int) error {
+	return fsys.OsFs.Chown(fsys.path(name), uid, gid)
+}
+
+func (fsys ttpDirFs) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return fsys.OsFs.Chtimes(fsys.path(name), atime, mtime)
+}
+
+func (fsys ttpDirFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	return fsys.OsFs.LstatIfPossible(fsys.path(name))
+}
+
+// SymlinkIfPossible resolves only the path of the link itself,
+// as relative link targets are relative to the link
+func (fsys ttpDirFs) SymlinkIfPossible(oldname, newname string) error {
+	return fsys.OsFs.SymlinkIfPossible(oldname, fsys.path(newname))
+}
+
+func (fsys ttpDirFs) ReadlinkIfPossible(name string) (string, error) {
+	return fsys.OsFs.ReadlinkIfPossible(fsys.path(name))
+}
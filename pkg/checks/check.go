@@ -69,26 +69,10 @@ func (c *Check) UnmarshalYAML(node *yaml.Node) error {
 		return errors.New("no msg specified for check")
 	}
 
-	candidateTypeInstances := []Condition{
-		&PathExists{},
-	}
-	for _, candidateTypeInstance := range candidateTypeInstances {
-		err := node.Decode(candidateTypeInstance)
-		if err == nil {
-			if c.condition != nil {
-				// Must catch conditions with ambiguous types, such as:
-				// - path_exists: foo
-				//   command_succeeds: bar
-				//
-				// This is a problem because we can't tell into
-				// which concrete type we should decode
-				return fmt.Errorf("check %q has ambiguous type", c.Msg)
-			}
-			c.condition = candidateTypeInstance
-		}
-	}
-	if c.condition == nil {
-		return fmt.Errorf("condition with msg %q did not match any valid condition type", c.Msg)
+	condition, _, err := decodeCondition(node)
+	if err != nil {
+		return fmt.Errorf("check %q is invalid: %w", c.Msg, err)
 	}
+	c.condition = condition
 	return nil
 }
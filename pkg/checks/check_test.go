@@ -20,6 +20,7 @@ THE SOFTWARE.
 package checks
 
 import (
+	"context"
 	"testing"
 
 	"github.com/facebookincubator/ttpforge/pkg/testutils"
@@ -104,3 +105,81 @@ checksum:
 	}
 
 }
+
+// checkTestCase describes a check that is decoded from contentStr
+// and then verified against the given verification context
+type checkTestCase struct {
+	name                 string
+	contentStr           string
+	fsysContents         map[string][]byte
+	ctx                  VerificationContext
+	expectUnmarshalError bool
+	expectVerifyError    bool
+}
+
+func runCheckTestCases(t *testing.T, testCases []checkTestCase) {
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var check Check
+			err := yaml.Unmarshal([]byte(tc.contentStr), &check)
+			if tc.expectUnmarshalError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			ctx := tc.ctx
+			if tc.fsysContents != nil {
+				ctx.FileSystem, err = testutils.MakeAferoTestFs(tc.fsysContents)
+				require.NoError(t, err)
+			}
+			err = check.Verify(ctx)
+			if tc.expectVerifyError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+// fakeHost is a remote host on which each
+// command has a fixed output and exit code
+type fakeHost map[string]fakeCommand
+
+type fakeCommand struct {
+	stdout   string
+	exitCode int
+}
+
+func (h fakeHost) Run(_ context.Context, command string, _ map[string]string) ([]byte, int, error) {
+	result, ok := h[command]
+	if !ok {
+		return nil, 127, nil
+	}
+	return []byte(result.stdout), result.exitCode, nil
+}
+
+func TestCheckUnmarshalErrors(t *testing.T) {
+	runCheckTestCases(t, []checkTestCase{
+		{
+			name: "Ambiguous Condition Type",
+			contentStr: `msg: ambiguous
+path_exists: foo.txt
+file_contains: foo.txt
+text: foo`,
+			expectUnmarshalError: true,
+		},
+		{
+			name:                 "Missing Message",
+			contentStr:           `path_exists: foo.txt`,
+			expectUnmarshalError: true,
+		},
+		{
+			name: "Unknown Condition Type",
+			contentStr: `msg: unknown
+file_is_shiny: foo.txt`,
+			expectUnmarshalError: true,
+		},
+	})
+}
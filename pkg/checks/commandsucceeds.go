@@ -0,0 +1,114 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package checks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"time"
+)
+
+// commandCheckTimeout bounds how long the
+// command of a CommandSucceeds check may run for
+const commandCheckTimeout = time.Minute
+
+// CommandSucceeds is a condition that runs a command and verifies that
+// it exits with the expected exit code (zero by default). It can also
+// verify that the standard output of the command matches a regular expression.
+type CommandSucceeds struct {
+	Command       string `yaml:"command_succeeds"`
+	ExitCode      int    `yaml:"exit_code"`
+	StdoutMatches string `yaml:"stdout_matches"`
+}
+
+// Validate checks that the condition is well-formed
+func (c *CommandSucceeds) Validate() error {
+	if c.StdoutMatches != "" {
+		if _, err := regexp.Compile(c.StdoutMatches); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Verify checks the condition and returns an error if it fails
+func (c *CommandSucceeds) Verify(ctx VerificationContext) error {
+	cmdCtx, cancel := context.WithTimeout(context.Background(), commandCheckTimeout)
+	defer cancel()
+
+	stdout, exitCode, err := c.run(cmdCtx, ctx)
+	if err != nil {
+		return err
+	}
+	if exitCode != c.ExitCode {
+		return fmt.Errorf("command %q exited with code %d instead of %d", c.Command, exitCode, c.ExitCode)
+	}
+
+	if c.StdoutMatches != "" {
+		re, err := regexp.Compile(c.StdoutMatches)
+		if err != nil {
+			return err
+		}
+		if !re.Match(stdout) {
+			return fmt.Errorf("output of command %q does not match %q", c.Command, c.StdoutMatches)
+		}
+	}
+	return nil
+}
+
+// run runs the command on the verified host and
+// returns its standard output and exit code
+func (c *CommandSucceeds) run(cmdCtx context.Context, ctx VerificationContext) ([]byte, int, error) {
+	if ctx.Host != nil {
+		stdout, exitCode, err := ctx.Host.Run(cmdCtx, c.Command, ctx.Environment)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to run command %q: %w", c.Command, err)
+		}
+		return stdout, exitCode, nil
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(cmdCtx, "powershell", "-Command", c.Command)
+	} else {
+		cmd = exec.CommandContext(cmdCtx, "bash", "-c", c.Command)
+	}
+	cmd.Dir = ctx.WorkDir
+	cmd.Env = os.Environ()
+	for k, v := range ctx.Environment {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	stdout, err := cmd.Output()
+	exitCode := 0
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || cmdCtx.Err() != nil {
+			return nil, 0, fmt.Errorf("failed to run command %q: %w", c.Command, err)
+		}
+		exitCode = exitErr.ExitCode()
+	}
+	return stdout, exitCode, nil
+}
@@ -0,0 +1,101 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package checks
+
+import (
+	"testing"
+)
+
+func TestCommandSucceeds(t *testing.T) {
+	tmpDir := t.TempDir()
+	runCheckTestCases(t, []checkTestCase{
+		{
+			name: "Command Succeeds",
+			contentStr: `msg: command failed
+command_succeeds: "true"`,
+		},
+		{
+			name: "Command Fails",
+			contentStr: `msg: command failed
+command_succeeds: "false"`,
+			expectVerifyError: true,
+		},
+		{
+			name: "Expected Exit Code",
+			contentStr: `msg: command did not exit with 3
+command_succeeds: exit 3
+exit_code: 3`,
+		},
+		{
+			name: "Unexpected Exit Code",
+			contentStr: `msg: command did not exit with 3
+command_succeeds: exit 4
+exit_code: 3`,
+			expectVerifyError: true,
+		},
+		{
+			name: "Stdout Matches",
+			contentStr: `msg: wrong output
+command_succeeds: echo "uid=0(root)"
+stdout_matches: '^uid=0\('`,
+		},
+		{
+			name: "Stdout Does Not Match",
+			contentStr: `msg: wrong output
+command_succeeds: echo "uid=1000(user)"
+stdout_matches: '^uid=0\('`,
+			expectVerifyError: true,
+		},
+		{
+			name: "Runs in Working Directory with Environment",
+			contentStr: `msg: wrong directory or environment
+command_succeeds: '[ "$(pwd)" = "$EXPECTED_DIR" ]'`,
+			ctx: VerificationContext{
+				WorkDir:     tmpDir,
+				Environment: map[string]string{"EXPECTED_DIR": tmpDir},
+			},
+		},
+		{
+			name: "Runs on Remote Host",
+			contentStr: `msg: wrong output
+command_succeeds: hostname
+stdout_matches: ^target\n`,
+			ctx: VerificationContext{
+				Host: fakeHost{"hostname": {stdout: "target\n"}},
+			},
+		},
+		{
+			name: "Fails on Remote Host",
+			contentStr: `msg: command failed
+command_succeeds: "true"`,
+			ctx: VerificationContext{
+				Host: fakeHost{"true": {exitCode: 1}},
+			},
+			expectVerifyError: true,
+		},
+		{
+			name: "Invalid Stdout Regex",
+			contentStr: `msg: invalid
+command_succeeds: "true"
+stdout_matches: '(unclosed'`,
+			expectUnmarshalError: true,
+		},
+	})
+}
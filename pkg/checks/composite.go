@@ -0,0 +1,124 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package checks
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// subCondition is a condition nested inside of a composite
+// condition, along with the key that identifies its type
+type subCondition struct {
+	condition Condition
+	typeKey   string
+}
+
+// UnmarshalYAML decodes the nested condition
+func (s *subCondition) UnmarshalYAML(node *yaml.Node) error {
+	var err error
+	s.condition, s.typeKey, err = decodeCondition(node)
+	return err
+}
+
+// describe identifies the sub condition at index idx
+// in error messages, such as "condition 2 (path_exists)"
+func (s *subCondition) describe(idx int) string {
+	return fmt.Sprintf("condition %d (%v)", idx+1, s.typeKey)
+}
+
+// AllOf is a condition that is met if all
+// of the conditions that it contains are met
+type AllOf struct {
+	Conditions []subCondition `yaml:"all_of"`
+}
+
+// Validate checks that the condition is well-formed
+func (c *AllOf) Validate() error {
+	if len(c.Conditions) == 0 {
+		return errors.New("all_of must contain at least one condition")
+	}
+	return nil
+}
+
+// Verify checks the condition and returns an error
+// describing the first contained condition that fails
+func (c *AllOf) Verify(ctx VerificationContext) error {
+	for idx, sub := range c.Conditions {
+		if err := sub.condition.Verify(ctx); err != nil {
+			return fmt.Errorf("%v of all_of failed: %w", sub.describe(idx), err)
+		}
+	}
+	return nil
+}
+
+// AnyOf is a condition that is met if at least
+// one of the conditions that it contains is met
+type AnyOf struct {
+	Conditions []subCondition `yaml:"any_of"`
+}
+
+// Validate checks that the condition is well-formed
+func (c *AnyOf) Validate() error {
+	if len(c.Conditions) == 0 {
+		return errors.New("any_of must contain at least one condition")
+	}
+	return nil
+}
+
+// Verify checks the condition and returns an error
+// describing every contained condition if they all fail
+func (c *AnyOf) Verify(ctx VerificationContext) error {
+	var failures []string
+	for idx, sub := range c.Conditions {
+		err := sub.condition.Verify(ctx)
+		if err == nil {
+			return nil
+		}
+		failures = append(failures, fmt.Sprintf("%v: %v", sub.describe(idx), err))
+	}
+	return fmt.Errorf("no condition of any_of was met: %v", strings.Join(failures, "; "))
+}
+
+// Not is a condition that is met if
+// the condition that it contains fails
+type Not struct {
+	Condition *subCondition `yaml:"not"`
+}
+
+// Validate checks that the condition is well-formed
+func (c *Not) Validate() error {
+	if c.Condition == nil {
+		return errors.New("not must contain a condition")
+	}
+	return nil
+}
+
+// Verify checks the condition and returns
+// an error if the contained condition is met
+func (c *Not) Verify(ctx VerificationContext) error {
+	if err := c.Condition.condition.Verify(ctx); err != nil {
+		return nil
+	}
+	return fmt.Errorf("negated %v condition was met", c.Condition.typeKey)
+}
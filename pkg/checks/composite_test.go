@@ -0,0 +1,209 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package checks
+
+import (
+	"testing"
+
+	"github.com/facebookincubator/ttpforge/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestCompositeConditions(t *testing.T) {
+	fsysContents := map[string][]byte{
+		"exists.txt": []byte("PermitRootLogin no\n"),
+	}
+	runCheckTestCases(t, []checkTestCase{
+		{
+			name: "Not (Path Does Not Exist)",
+			contentStr: `msg: the hardened policy did not block the write
+not:
+  path_exists: blocked.txt`,
+			fsysContents: fsysContents,
+		},
+		{
+			name: "Not (Path Exists)",
+			contentStr: `msg: the hardened policy did not block the write
+not:
+  path_exists: exists.txt`,
+			fsysContents:      fsysContents,
+			expectVerifyError: true,
+		},
+		{
+			name: "All Of (All Met)",
+			contentStr: `msg: root login is not disabled
+all_of:
+  - path_exists: exists.txt
+  - file_contains: exists.txt
+    text: PermitRootLogin no`,
+			fsysContents: fsysContents,
+		},
+		{
+			name: "All Of (One Failed)",
+			contentStr: `msg: root login is not disabled
+all_of:
+  - path_exists: exists.txt
+  - file_contains: exists.txt
+    text: PermitRootLogin yes`,
+			fsysContents:      fsysContents,
+			expectVerifyError: true,
+		},
+		{
+			name: "Any Of (One Met)",
+			contentStr: `msg: no config file exists
+any_of:
+  - path_exists: missing.txt
+  - path_exists: exists.txt`,
+			fsysContents: fsysContents,
+		},
+		{
+			name: "Any Of (None Met)",
+			contentStr: `msg: no config file exists
+any_of:
+  - path_exists: missing.txt
+  - path_exists: also-missing.txt`,
+			fsysContents:      fsysContents,
+			expectVerifyError: true,
+		},
+		{
+			name: "Nested Composition",
+			contentStr: `msg: exactly one of the files should exist
+any_of:
+  - all_of:
+      - path_exists: exists.txt
+      - not:
+          path_exists: missing.txt
+  - all_of:
+      - path_exists: missing.txt
+      - not:
+          path_exists: exists.txt`,
+			fsysContents: fsysContents,
+		},
+		{
+			name: "Double Negation",
+			contentStr: `msg: file should exist
+not:
+  not:
+    path_exists: exists.txt`,
+			fsysContents: fsysContents,
+		},
+		{
+			name: "Empty All Of",
+			contentStr: `msg: invalid
+all_of: []`,
+			expectUnmarshalError: true,
+		},
+		{
+			name: "Empty Any Of",
+			contentStr: `msg: invalid
+any_of: []`,
+			expectUnmarshalError: true,
+		},
+		{
+			name: "Empty Not",
+			contentStr: `msg: invalid
+not:`,
+			expectUnmarshalError: true,
+		},
+		{
+			name: "Invalid Nested Condition",
+			contentStr: `msg: invalid
+all_of:
+  - path_exists: exists.txt
+  - file_mode: exists.txt
+    mode: "0999"`,
+			expectUnmarshalError: true,
+		},
+		{
+			name: "Unknown Nested Condition",
+			contentStr: `msg: invalid
+not:
+  file_is_shiny: exists.txt`,
+			expectUnmarshalError: true,
+		},
+		{
+			name: "Ambiguous Nested Condition",
+			contentStr: `msg: invalid
+any_of:
+  - path_exists: exists.txt
+    env_var: HOME`,
+			expectUnmarshalError: true,
+		},
+	})
+}
+
+func TestCompositeConditionErrors(t *testing.T) {
+	fsys, err := testutils.MakeAferoTestFs(map[string][]byte{"exists.txt": []byte("foo")})
+	require.NoError(t, err)
+	ctx := VerificationContext{FileSystem: fsys}
+
+	testCases := []struct {
+		name          string
+		contentStr    string
+		expectedError string
+	}{
+		{
+			name: "All Of Reports First Failed Condition",
+			contentStr: `msg: all
+all_of:
+  - path_exists: exists.txt
+  - path_exists: missing.txt
+  - path_exists: also-missing.txt`,
+			expectedError: `condition 2 (path_exists) of all_of failed: file "missing.txt" does not exist`,
+		},
+		{
+			name: "Any Of Reports Every Failed Condition",
+			contentStr: `msg: any
+any_of:
+  - path_exists: missing.txt
+  - file_contains: exists.txt
+    text: bar`,
+			expectedError: `no condition of any_of was met: condition 1 (path_exists): file "missing.txt" does not exist; condition 2 (file_contains): file "exists.txt" does not contain "bar"`,
+		},
+		{
+			name: "Not Reports Negated Condition",
+			contentStr: `msg: not
+not:
+  path_exists: exists.txt`,
+			expectedError: "negated path_exists condition was met",
+		},
+		{
+			name: "Nested Failures Are Reported",
+			contentStr: `msg: nested
+all_of:
+  - any_of:
+      - path_exists: missing.txt
+  - path_exists: exists.txt`,
+			expectedError: `condition 1 (any_of) of all_of failed: no condition of any_of was met: condition 1 (path_exists): file "missing.txt" does not exist`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var check Check
+			require.NoError(t, yaml.Unmarshal([]byte(tc.contentStr), &check))
+			err := check.Verify(ctx)
+			require.Error(t, err)
+			assert.Equal(t, tc.expectedError, err.Error())
+		})
+	}
+}
@@ -19,8 +19,76 @@ THE SOFTWARE.
 
 package checks
 
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
 // Condition is the common interface
 // implemented by all condition types
 type Condition interface {
+	Validate() error
 	Verify(ctx VerificationContext) error
 }
+
+// conditionTypes maps the key that identifies each type of
+// condition to a function that creates an empty condition of that type
+var conditionTypes = map[string]func() Condition{
+	"path_exists":      func() Condition { return &PathExists{} },
+	"file_contains":    func() Condition { return &FileContains{} },
+	"file_mode":        func() Condition { return &FileMode{} },
+	"file_owner":       func() Condition { return &FileOwner{} },
+	"command_succeeds": func() Condition { return &CommandSucceeds{} },
+	"process_running":  func() Condition { return &ProcessRunning{} },
+	"port_listening":   func() Condition { return &PortListening{} },
+	"env_var":          func() Condition { return &EnvVar{} },
+	"output_matches":   func() Condition { return &OutputMatches{} },
+	"all_of":           func() Condition { return &AllOf{} },
+	"any_of":           func() Condition { return &AnyOf{} },
+	"not":              func() Condition { return &Not{} },
+}
+
+// decodeCondition determines the type of a condition from the
+// key that identifies it, then decodes and validates the condition.
+// It also returns that key, which is used to describe the condition.
+func decodeCondition(node *yaml.Node) (Condition, string, error) {
+	var fields map[string]yaml.Node
+	if err := node.Decode(&fields); err != nil {
+		return nil, "", err
+	}
+
+	var typeKeys []string
+	for key := range fields {
+		if _, ok := conditionTypes[key]; ok {
+			typeKeys = append(typeKeys, key)
+		}
+	}
+	switch len(typeKeys) {
+	case 0:
+		return nil, "", errors.New("condition does not match any known condition type")
+	case 1:
+	default:
+		// Must catch conditions with ambiguous types, such as:
+		// - path_exists: foo
+		//   command_succeeds: bar
+		//
+		// This is a problem because we can't tell into
+		// which concrete type we should decode
+		sort.Strings(typeKeys)
+		return nil, "", fmt.Errorf("condition has ambiguous type (%v)", strings.Join(typeKeys, ", "))
+	}
+
+	typeKey := typeKeys[0]
+	condition := conditionTypes[typeKey]()
+	if err := node.Decode(condition); err != nil {
+		return nil, "", err
+	}
+	if err := condition.Validate(); err != nil {
+		return nil, "", fmt.Errorf("invalid %v condition: %w", typeKey, err)
+	}
+	return condition, typeKey, nil
+}
@@ -20,7 +20,13 @@ THE SOFTWARE.
 package checks
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+
 	"github.com/facebookincubator/ttpforge/pkg/platforms"
+	"github.com/facebookincubator/ttpforge/pkg/targets"
 
 	"github.com/spf13/afero"
 )
@@ -31,4 +37,52 @@ import (
 type VerificationContext struct {
 	Platform   platforms.Spec
 	FileSystem afero.Fs
+
+	// WorkDir is the directory in which commands are run
+	WorkDir string
+	// Environment holds variables that are set in addition to
+	// (and take precedence over) the environment of TTPForge
+	Environment map[string]string
+
+	// Stdout and Outputs hold the results
+	// of the step whose checks are verified
+	Stdout  string
+	Outputs map[string]interface{}
+
+	// Host is the remote host whose state is verified, or nil if
+	// the state of the local host is verified. FileSystem must then
+	// be the file system of the remote host.
+	Host RemoteHost
+}
+
+// RemoteHost runs the commands of conditions on a remote host
+type RemoteHost interface {
+	// Run runs a shell command on the host with the specified
+	// environment variables set, and returns its standard
+	// output and exit code
+	Run(ctx context.Context, command string, env map[string]string) ([]byte, int, error)
+}
+
+// LookupEnv looks up an environment variable of the verified host.
+// Variables in Environment take precedence over the environment of the
+// host, which is that of TTPForge itself unless the host is remote.
+func (ctx VerificationContext) LookupEnv(name string) (string, bool, error) {
+	if val, ok := ctx.Environment[name]; ok {
+		return val, true, nil
+	}
+	if ctx.Host == nil {
+		val, ok := os.LookupEnv(name)
+		return val, ok, nil
+	}
+	cmdCtx, cancel := context.WithTimeout(context.Background(), commandCheckTimeout)
+	defer cancel()
+	// printenv exits with code 1 if the variable is not set
+	stdout, exitCode, err := ctx.Host.Run(cmdCtx, "printenv "+targets.ShellQuote(name), nil)
+	switch {
+	case err != nil:
+		return "", false, fmt.Errorf("failed to look up environment variable %v: %w", name, err)
+	case exitCode != 0:
+		return "", false, nil
+	}
+	return string(bytes.TrimSuffix(stdout, []byte("\n"))), true, nil
 }
@@ -0,0 +1,53 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package checks
+
+import (
+	"fmt"
+)
+
+// EnvVar is a condition that verifies that an environment variable
+// is set, and optionally that it has a given value. Variables set by
+// the TTP take precedence over the environment of TTPForge itself
+// (or, for steps on remote targets, of the user on the target).
+type EnvVar struct {
+	Name   string  `yaml:"env_var"`
+	Equals *string `yaml:"equals"`
+}
+
+// Validate checks that the condition is well-formed
+func (c *EnvVar) Validate() error {
+	return nil
+}
+
+// Verify checks the condition and returns an error if it fails
+func (c *EnvVar) Verify(ctx VerificationContext) error {
+	val, ok, err := ctx.LookupEnv(c.Name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("environment variable %v is not set", c.Name)
+	}
+	if c.Equals != nil && val != *c.Equals {
+		return fmt.Errorf("environment variable %v is %q instead of %q", c.Name, val, *c.Equals)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package checks
+
+import (
+	"testing"
+)
+
+func TestEnvVar(t *testing.T) {
+	t.Setenv("TTPFORGE_TEST_ENV_VAR", "from-process")
+	runCheckTestCases(t, []checkTestCase{
+		{
+			name: "Variable Is Set",
+			contentStr: `msg: variable is not set
+env_var: TTPFORGE_TEST_ENV_VAR`,
+		},
+		{
+			name: "Variable Is Not Set",
+			contentStr: `msg: variable is not set
+env_var: TTPFORGE_TEST_UNSET_ENV_VAR`,
+			expectVerifyError: true,
+		},
+		{
+			name: "Variable Has Value",
+			contentStr: `msg: variable has the wrong value
+env_var: TTPFORGE_TEST_ENV_VAR
+equals: from-process`,
+		},
+		{
+			name: "Variable Has Wrong Value",
+			contentStr: `msg: variable has the wrong value
+env_var: TTPFORGE_TEST_ENV_VAR
+equals: something-else`,
+			expectVerifyError: true,
+		},
+		{
+			name: "TTP Environment Takes Precedence",
+			contentStr: `msg: variable has the wrong value
+env_var: TTPFORGE_TEST_ENV_VAR
+equals: from-ttp`,
+			ctx: VerificationContext{
+				Environment: map[string]string{"TTPFORGE_TEST_ENV_VAR": "from-ttp"},
+			},
+		},
+		{
+			name: "Variable Equals Empty String",
+			contentStr: `msg: variable is not empty
+env_var: TTPFORGE_TEST_EMPTY
+equals: ""`,
+			ctx: VerificationContext{
+				Environment: map[string]string{"TTPFORGE_TEST_EMPTY": ""},
+			},
+		},
+		{
+			name: "Variable Is Set on Remote Host",
+			contentStr: `msg: variable has the wrong value
+env_var: TTPFORGE_TEST_REMOTE_ENV_VAR
+equals: from-host`,
+			ctx: VerificationContext{
+				Host: fakeHost{
+					"printenv TTPFORGE_TEST_REMOTE_ENV_VAR": {stdout: "from-host\n"},
+				},
+			},
+		},
+		{
+			name: "Local Variable Is Not Set on Remote Host",
+			contentStr: `msg: variable is not set
+env_var: TTPFORGE_TEST_ENV_VAR`,
+			ctx: VerificationContext{
+				Host: fakeHost{
+					"printenv TTPFORGE_TEST_ENV_VAR": {exitCode: 1},
+				},
+			},
+			expectVerifyError: true,
+		},
+	})
+}
@@ -0,0 +1,92 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package checks
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// FileContains is a condition that verifies that a file
+// contains a literal string or a match of a regular expression
+type FileContains struct {
+	Path  string `yaml:"file_contains"`
+	Text  string `yaml:"text"`
+	Regex string `yaml:"regex"`
+}
+
+// Validate checks that the condition is well-formed
+func (c *FileContains) Validate() error {
+	return validateTextOrRegex(c.Text, c.Regex)
+}
+
+// Verify checks the condition and returns an error if it fails
+func (c *FileContains) Verify(ctx VerificationContext) error {
+	contents, err := afero.ReadFile(ctx.FileSystem, c.Path)
+	if err != nil {
+		return err
+	}
+	found, err := containsTextOrRegex(string(contents), c.Text, c.Regex)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("file %q does not contain %v", c.Path, describeTextOrRegex(c.Text, c.Regex))
+	}
+	return nil
+}
+
+// validateTextOrRegex checks that exactly one of
+// text and regex is set and that regex compiles
+func validateTextOrRegex(text, regex string) error {
+	if (text == "") == (regex == "") {
+		return errors.New("exactly one of text and regex must be specified")
+	}
+	if regex != "" {
+		if _, err := regexp.Compile(regex); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// containsTextOrRegex reports whether s contains text
+// or a match of regex, whichever one is set
+func containsTextOrRegex(s, text, regex string) (bool, error) {
+	if regex == "" {
+		return strings.Contains(s, text), nil
+	}
+	re, err := regexp.Compile(regex)
+	if err != nil {
+		return false, err
+	}
+	return re.MatchString(s), nil
+}
+
+func describeTextOrRegex(text, regex string) string {
+	if regex == "" {
+		return fmt.Sprintf("%q", text)
+	}
+	return fmt.Sprintf("a match of %q", regex)
+}
@@ -0,0 +1,89 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package checks
+
+import (
+	"testing"
+)
+
+func TestFileContains(t *testing.T) {
+	fsysContents := map[string][]byte{"config.txt": []byte("PermitRootLogin yes\nPort 2222\n")}
+	runCheckTestCases(t, []checkTestCase{
+		{
+			name: "Text Found",
+			contentStr: `msg: root login is not permitted
+file_contains: config.txt
+text: PermitRootLogin yes`,
+			fsysContents: fsysContents,
+		},
+		{
+			name: "Text Not Found",
+			contentStr: `msg: root login is not forbidden
+file_contains: config.txt
+text: PermitRootLogin no`,
+			fsysContents:      fsysContents,
+			expectVerifyError: true,
+		},
+		{
+			name: "Regex Found",
+			contentStr: `msg: port was not changed
+file_contains: config.txt
+regex: '(?m)^Port 2\d+$'`,
+			fsysContents: fsysContents,
+		},
+		{
+			name: "Regex Not Found",
+			contentStr: `msg: port was not changed
+file_contains: config.txt
+regex: '(?m)^Port 22$'`,
+			fsysContents:      fsysContents,
+			expectVerifyError: true,
+		},
+		{
+			name: "File Does Not Exist",
+			contentStr: `msg: missing file
+file_contains: missing.txt
+text: foo`,
+			fsysContents:      fsysContents,
+			expectVerifyError: true,
+		},
+		{
+			name: "Both Text and Regex",
+			contentStr: `msg: invalid
+file_contains: config.txt
+text: foo
+regex: foo`,
+			expectUnmarshalError: true,
+		},
+		{
+			name: "Neither Text nor Regex",
+			contentStr: `msg: invalid
+file_contains: config.txt`,
+			expectUnmarshalError: true,
+		},
+		{
+			name: "Invalid Regex",
+			contentStr: `msg: invalid
+file_contains: config.txt
+regex: '(unclosed'`,
+			expectUnmarshalError: true,
+		},
+	})
+}
@@ -0,0 +1,80 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package checks
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// FileMode is a condition that verifies the
+// permission bits of a file, such as 0600
+type FileMode struct {
+	Path string `yaml:"file_mode"`
+	Mode string `yaml:"mode"`
+}
+
+// Validate checks that the condition is well-formed
+func (c *FileMode) Validate() error {
+	_, err := c.parseMode()
+	return err
+}
+
+func (c *FileMode) parseMode() (uint32, error) {
+	mode, err := strconv.ParseUint(c.Mode, 8, 32)
+	if err != nil || mode > 0o7777 {
+		return 0, fmt.Errorf("mode %q should be an octal number such as 0644", c.Mode)
+	}
+	return uint32(mode), nil
+}
+
+// Verify checks the condition and returns an error if it fails
+func (c *FileMode) Verify(ctx VerificationContext) error {
+	expected, err := c.parseMode()
+	if err != nil {
+		return err
+	}
+	info, err := ctx.FileSystem.Stat(c.Path)
+	if err != nil {
+		return err
+	}
+	actual := unixMode(info.Mode())
+	if actual != expected {
+		return fmt.Errorf("file %q has mode %04o instead of %04o", c.Path, actual, expected)
+	}
+	return nil
+}
+
+// unixMode converts a file mode to the numeric
+// form used by chmod, including the special bits
+func unixMode(mode os.FileMode) uint32 {
+	unixMode := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		unixMode |= 0o4000
+	}
+	if mode&os.ModeSetgid != 0 {
+		unixMode |= 0o2000
+	}
+	if mode&os.ModeSticky != 0 {
+		unixMode |= 0o1000
+	}
+	return unixMode
+}
@@ -0,0 +1,103 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package checks
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileMode(t *testing.T) {
+	fsys := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fsys, "secret.key", []byte("foo"), 0600))
+	require.NoError(t, afero.WriteFile(fsys, "setuid-binary", []byte("foo"), 0755))
+	require.NoError(t, fsys.Chmod("setuid-binary", 0755|os.ModeSetuid))
+
+	runCheckTestCases(t, []checkTestCase{
+		{
+			name: "Mode Matches",
+			contentStr: `msg: key is readable by others
+file_mode: secret.key
+mode: "0600"`,
+			ctx: VerificationContext{FileSystem: fsys},
+		},
+		{
+			name: "Mode Without Leading Zero",
+			contentStr: `msg: key is readable by others
+file_mode: secret.key
+mode: "600"`,
+			ctx: VerificationContext{FileSystem: fsys},
+		},
+		{
+			name: "Mode Does Not Match",
+			contentStr: `msg: key is not world readable
+file_mode: secret.key
+mode: "0644"`,
+			ctx:               VerificationContext{FileSystem: fsys},
+			expectVerifyError: true,
+		},
+		{
+			name: "Setuid Bit",
+			contentStr: `msg: binary is not setuid
+file_mode: setuid-binary
+mode: "4755"`,
+			ctx: VerificationContext{FileSystem: fsys},
+		},
+		{
+			name: "Setuid Bit Missing",
+			contentStr: `msg: binary is setuid
+file_mode: setuid-binary
+mode: "0755"`,
+			ctx:               VerificationContext{FileSystem: fsys},
+			expectVerifyError: true,
+		},
+		{
+			name: "File Does Not Exist",
+			contentStr: `msg: missing file
+file_mode: missing.key
+mode: "0600"`,
+			ctx:               VerificationContext{FileSystem: fsys},
+			expectVerifyError: true,
+		},
+		{
+			name: "Mode Is Not Octal",
+			contentStr: `msg: invalid
+file_mode: secret.key
+mode: "0800"`,
+			expectUnmarshalError: true,
+		},
+		{
+			name: "Mode Is Too Large",
+			contentStr: `msg: invalid
+file_mode: secret.key
+mode: "17777"`,
+			expectUnmarshalError: true,
+		},
+		{
+			name: "Mode Is Missing",
+			contentStr: `msg: invalid
+file_mode: secret.key`,
+			expectUnmarshalError: true,
+		},
+	})
+}
@@ -0,0 +1,112 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package checks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/facebookincubator/ttpforge/pkg/targets"
+	"github.com/pkg/sftp"
+)
+
+// FileOwner is a condition that verifies the user and optionally
+// the group that own a file. Both may be given as names or as IDs.
+type FileOwner struct {
+	Path  string `yaml:"file_owner"`
+	Owner string `yaml:"owner"`
+	Group string `yaml:"group"`
+}
+
+// Validate checks that the condition is well-formed
+func (c *FileOwner) Validate() error {
+	if c.Owner == "" && c.Group == "" {
+		return errors.New("at least one of owner and group must be specified")
+	}
+	return nil
+}
+
+// Verify checks the condition and returns an error if it fails
+func (c *FileOwner) Verify(ctx VerificationContext) error {
+	info, err := ctx.FileSystem.Stat(c.Path)
+	if err != nil {
+		return err
+	}
+	uid, gid, err := ownerIDs(info)
+	if err != nil {
+		return err
+	}
+
+	if c.Owner != "" && c.Owner != uid {
+		name := lookupOwnerName(ctx, "passwd", uid)
+		if name != c.Owner {
+			return fmt.Errorf("file %q is owned by user %v instead of %v", c.Path, name, c.Owner)
+		}
+	}
+	if c.Group != "" && c.Group != gid {
+		name := lookupOwnerName(ctx, "group", gid)
+		if name != c.Group {
+			return fmt.Errorf("file %q is owned by group %v instead of %v", c.Path, name, c.Group)
+		}
+	}
+	return nil
+}
+
+// ownerIDs returns the IDs of the user and group that own a
+// file, which may be a local file or a file on a remote host
+func ownerIDs(info os.FileInfo) (string, string, error) {
+	if stat, ok := info.Sys().(*sftp.FileStat); ok {
+		return strconv.FormatUint(uint64(stat.UID), 10), strconv.FormatUint(uint64(stat.GID), 10), nil
+	}
+	return fileOwnership(info)
+}
+
+// lookupOwnerName returns the name of the user (database "passwd") or
+// group (database "group") with the specified ID on the verified host,
+// or the ID itself if it has no name
+func lookupOwnerName(ctx VerificationContext, database string, id string) string {
+	if ctx.Host == nil {
+		if database == "passwd" {
+			if u, err := user.LookupId(id); err == nil {
+				return u.Username
+			}
+		} else if g, err := user.LookupGroupId(id); err == nil {
+			return g.Name
+		}
+		return id
+	}
+	cmdCtx, cancel := context.WithTimeout(context.Background(), commandCheckTimeout)
+	defer cancel()
+	// entries look like name:x:id:...
+	stdout, exitCode, err := ctx.Host.Run(cmdCtx, "getent "+database+" "+targets.ShellQuote(id), nil)
+	if err != nil || exitCode != 0 {
+		return id
+	}
+	name, _, _ := strings.Cut(string(stdout), ":")
+	if name == "" {
+		return id
+	}
+	return name
+}
@@ -0,0 +1,102 @@
+//go:build !windows
+// +build !windows
+
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package checks
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileOwner(t *testing.T) {
+	tmpDir := t.TempDir()
+	filePath := filepath.Join(tmpDir, "owned.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("foo"), 0644))
+
+	uid := strconv.Itoa(os.Getuid())
+	gid := strconv.Itoa(os.Getgid())
+	currentUser, err := user.Current()
+	require.NoError(t, err)
+	otherUID := strconv.Itoa(os.Getuid() + 1)
+
+	osCtx := VerificationContext{FileSystem: afero.NewOsFs()}
+	runCheckTestCases(t, []checkTestCase{
+		{
+			name: "Owner ID Matches",
+			contentStr: `msg: wrong owner
+file_owner: ` + filePath + `
+owner: "` + uid + `"`,
+			ctx: osCtx,
+		},
+		{
+			name: "Owner Name Matches",
+			contentStr: `msg: wrong owner
+file_owner: ` + filePath + `
+owner: ` + currentUser.Username,
+			ctx: osCtx,
+		},
+		{
+			name: "Owner and Group IDs Match",
+			contentStr: `msg: wrong owner
+file_owner: ` + filePath + `
+owner: "` + uid + `"
+group: "` + gid + `"`,
+			ctx: osCtx,
+		},
+		{
+			name: "Owner Does Not Match",
+			contentStr: `msg: wrong owner
+file_owner: ` + filePath + `
+owner: "` + otherUID + `"`,
+			ctx:               osCtx,
+			expectVerifyError: true,
+		},
+		{
+			name: "File Does Not Exist",
+			contentStr: `msg: missing file
+file_owner: ` + filepath.Join(tmpDir, "missing.txt") + `
+owner: "` + uid + `"`,
+			ctx:               osCtx,
+			expectVerifyError: true,
+		},
+		{
+			name: "Ownership Not Available",
+			contentStr: `msg: in-memory files have no owner
+file_owner: owned.txt
+owner: "` + uid + `"`,
+			fsysContents:      map[string][]byte{"owned.txt": []byte("foo")},
+			expectVerifyError: true,
+		},
+		{
+			name: "Neither Owner nor Group",
+			contentStr: `msg: invalid
+file_owner: ` + filePath,
+			expectUnmarshalError: true,
+		},
+	})
+}
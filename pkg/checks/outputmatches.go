@@ -0,0 +1,63 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package checks
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/facebookincubator/ttpforge/pkg/outputs"
+)
+
+// OutputMatches is a condition that verifies that the standard output
+// of the step matches a regular expression. If Output is set, the named
+// output of the step is matched instead.
+type OutputMatches struct {
+	Regex  string `yaml:"output_matches"`
+	Output string `yaml:"output"`
+}
+
+// Validate checks that the condition is well-formed
+func (c *OutputMatches) Validate() error {
+	_, err := regexp.Compile(c.Regex)
+	return err
+}
+
+// Verify checks the condition and returns an error if it fails
+func (c *OutputMatches) Verify(ctx VerificationContext) error {
+	re, err := regexp.Compile(c.Regex)
+	if err != nil {
+		return err
+	}
+	if c.Output == "" {
+		if !re.MatchString(ctx.Stdout) {
+			return fmt.Errorf("step output does not match %q", c.Regex)
+		}
+		return nil
+	}
+	val, err := outputs.Lookup(ctx.Outputs, c.Output)
+	if err != nil {
+		return fmt.Errorf("invalid reference to output %v: %w", c.Output, err)
+	}
+	if !re.MatchString(outputs.FormatValue(val)) {
+		return fmt.Errorf("output %v does not match %q", c.Output, c.Regex)
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package checks
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestOutputMatches(t *testing.T) {
+	ctx := VerificationContext{
+		Stdout: "created user backdoor with uid 1337\n",
+		Outputs: map[string]interface{}{
+			"uid": json.Number("1337"),
+			"user": map[string]interface{}{
+				"name":   "backdoor",
+				"groups": []interface{}{"wheel", "docker"},
+			},
+		},
+	}
+	runCheckTestCases(t, []checkTestCase{
+		{
+			name: "Stdout Matches",
+			contentStr: `msg: user was not created
+output_matches: 'created user \w+'`,
+			ctx: ctx,
+		},
+		{
+			name: "Stdout Does Not Match",
+			contentStr: `msg: user was not deleted
+output_matches: 'deleted user \w+'`,
+			ctx:               ctx,
+			expectVerifyError: true,
+		},
+		{
+			name: "Named Output Matches",
+			contentStr: `msg: wrong uid
+output_matches: '^1337$'
+output: uid`,
+			ctx: ctx,
+		},
+		{
+			name: "Nested Output Matches",
+			contentStr: `msg: user is not in wheel
+output_matches: '^wheel$'
+output: user.groups[0]`,
+			ctx: ctx,
+		},
+		{
+			name: "Named Output Does Not Match",
+			contentStr: `msg: wrong user name
+output_matches: '^root$'
+output: user.name`,
+			ctx:               ctx,
+			expectVerifyError: true,
+		},
+		{
+			name: "Output Does Not Exist",
+			contentStr: `msg: missing output
+output_matches: '.*'
+output: gid`,
+			ctx:               ctx,
+			expectVerifyError: true,
+		},
+		{
+			name: "Invalid Regex",
+			contentStr: `msg: invalid
+output_matches: '(unclosed'`,
+			expectUnmarshalError: true,
+		},
+	})
+}
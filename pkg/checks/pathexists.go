@@ -32,6 +32,11 @@ type PathExists struct {
 	Checksum *Checksum `yaml:"checksum"`
 }
 
+// Validate checks that the condition is well-formed
+func (c *PathExists) Validate() error {
+	return nil
+}
+
 // Verify checks the condition and returns an error if it fails
 func (c *PathExists) Verify(ctx VerificationContext) error {
 	fsys := ctx.FileSystem
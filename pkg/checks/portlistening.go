@@ -0,0 +1,102 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package checks
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// socket states in /proc/net/{tcp,udp}
+const (
+	tcpStateListen      = "0A"
+	udpStateUnconnected = "07"
+)
+
+// PortListening is a condition that verifies that a TCP (the default) or
+// UDP port is open for connections on any local address. The sockets are
+// read from /proc/net, so this condition requires linux.
+type PortListening struct {
+	Port     int    `yaml:"port_listening"`
+	Protocol string `yaml:"protocol"`
+}
+
+// Validate checks that the condition is well-formed
+func (c *PortListening) Validate() error {
+	if c.Port < 1 || c.Port > 65535 {
+		return fmt.Errorf("port %d is out of range", c.Port)
+	}
+	switch c.Protocol {
+	case "", "tcp", "udp":
+		return nil
+	}
+	return fmt.Errorf("protocol must be tcp or udp, not %q", c.Protocol)
+}
+
+// Verify checks the condition and returns an error if it fails
+func (c *PortListening) Verify(ctx VerificationContext) error {
+	if err := requireProc(ctx.FileSystem); err != nil {
+		return err
+	}
+	protocol, state := "tcp", tcpStateListen
+	if c.Protocol == "udp" {
+		protocol, state = "udp", udpStateUnconnected
+	}
+	for _, table := range []string{protocol, protocol + "6"} {
+		tableBytes, err := afero.ReadFile(ctx.FileSystem, path.Join(procRoot, "net", table))
+		if err != nil {
+			// the IPv6 table is missing if IPv6 is disabled
+			continue
+		}
+		if hasSocket(tableBytes, c.Port, state) {
+			return nil
+		}
+	}
+	return fmt.Errorf("no process is listening on %v port %d", protocol, c.Port)
+}
+
+// hasSocket reports whether a /proc/net socket table contains
+// a socket with the given local port and state
+func hasSocket(tableBytes []byte, port int, state string) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(tableBytes))
+	// skip the header
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 || fields[3] != state {
+			continue
+		}
+		_, portHex, found := strings.Cut(fields[1], ":")
+		if !found {
+			continue
+		}
+		localPort, err := strconv.ParseUint(portHex, 16, 16)
+		if err == nil && int(localPort) == port {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package checks
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// port 8080 (0x1F90) listens on 127.0.0.1 and port 22 (0x16) has
+// an established connection, port 443 (0x1BB) listens on ::
+const fakeTCPTable = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 12345 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:0016 0100007F:D431 01 00000000:00000000 00:00000000 00000000     0        0 12346 1 0000000000000000 20 4 30 10 -1
+`
+
+const fakeTCP6Table = `  sl  local_address                         remote_address                        st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000000000000000000000000000:01BB 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 22345 1 0000000000000000 100 0 0 10 0
+`
+
+// port 53 (0x35) is bound
+const fakeUDPTable = `   sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+  100: 3500007F:0035 00000000:0000 07 00000000:00000000 00:00000000 00000000   101        0 32345 2 0000000000000000 0
+`
+
+func TestPortListening(t *testing.T) {
+	runCheckTestCases(t, []checkTestCase{
+		{
+			name: "TCP Port Listening",
+			contentStr: `msg: nothing listens on 8080
+port_listening: 8080`,
+			fsysContents: fakeProcContents,
+		},
+		{
+			name: "TCP6 Port Listening",
+			contentStr: `msg: nothing listens on 443
+port_listening: 443
+protocol: tcp`,
+			fsysContents: fakeProcContents,
+		},
+		{
+			name: "Established Connection Is Not Listening",
+			contentStr: `msg: nothing listens on 22
+port_listening: 22`,
+			fsysContents:      fakeProcContents,
+			expectVerifyError: true,
+		},
+		{
+			name: "UDP Port Bound",
+			contentStr: `msg: nothing listens on 53
+port_listening: 53
+protocol: udp`,
+			fsysContents: fakeProcContents,
+		},
+		{
+			name: "UDP Port Not Bound",
+			contentStr: `msg: nothing listens on 8080
+port_listening: 8080
+protocol: udp`,
+			fsysContents:      fakeProcContents,
+			expectVerifyError: true,
+		},
+		{
+			name: "No /proc",
+			contentStr: `msg: nothing listens on 8080
+port_listening: 8080`,
+			fsysContents:      map[string][]byte{"/etc/hostname": []byte("foo")},
+			expectVerifyError: true,
+		},
+		{
+			name: "Port Out of Range",
+			contentStr: `msg: invalid
+port_listening: 70000`,
+			expectUnmarshalError: true,
+		},
+		{
+			name: "Invalid Protocol",
+			contentStr: `msg: invalid
+port_listening: 8080
+protocol: sctp`,
+			expectUnmarshalError: true,
+		},
+	})
+}
+
+func TestHasSocket(t *testing.T) {
+	table := []byte(fakeTCPTable)
+	assert.True(t, hasSocket(table, 8080, tcpStateListen))
+	assert.False(t, hasSocket(table, 22, tcpStateListen))
+	assert.True(t, hasSocket(table, 22, "01"))
+	assert.False(t, hasSocket([]byte("header only\n"), 8080, tcpStateListen))
+	assert.False(t, hasSocket([]byte("header\n   0: garbage 0A\n"), 8080, tcpStateListen))
+}
@@ -0,0 +1,131 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package checks
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// procRoot is where the process information that
+// ProcessRunning and PortListening use is read from
+const procRoot = "/proc"
+
+// ProcessRunning is a condition that verifies that a process with a given
+// name is running. If MatchCmdline is set, the name is instead treated as
+// a regular expression that the full command line of the process must match.
+// The process list is read from /proc, so this condition requires linux.
+type ProcessRunning struct {
+	Name         string `yaml:"process_running"`
+	MatchCmdline bool   `yaml:"match_cmdline"`
+}
+
+// Validate checks that the condition is well-formed
+func (c *ProcessRunning) Validate() error {
+	if c.MatchCmdline {
+		if _, err := regexp.Compile(c.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Verify checks the condition and returns an error if it fails
+func (c *ProcessRunning) Verify(ctx VerificationContext) error {
+	var re *regexp.Regexp
+	if c.MatchCmdline {
+		var err error
+		if re, err = regexp.Compile(c.Name); err != nil {
+			return err
+		}
+	}
+	if err := requireProc(ctx.FileSystem); err != nil {
+		return err
+	}
+	entries, err := afero.ReadDir(ctx.FileSystem, procRoot)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+		if processExited(ctx.FileSystem, entry.Name()) {
+			continue
+		}
+		// processes may exit while we are looking at them
+		cmdlineBytes, err := afero.ReadFile(ctx.FileSystem, path.Join(procRoot, entry.Name(), "cmdline"))
+		if err != nil {
+			continue
+		}
+		args := strings.Split(string(bytes.TrimRight(cmdlineBytes, "\x00")), "\x00")
+		if re != nil {
+			if re.MatchString(strings.Join(args, " ")) {
+				return nil
+			}
+			continue
+		}
+		// comm is truncated to 15 characters, so the
+		// name of the executable is checked as well
+		commBytes, err := afero.ReadFile(ctx.FileSystem, path.Join(procRoot, entry.Name(), "comm"))
+		if err == nil && strings.TrimSpace(string(commBytes)) == c.Name {
+			return nil
+		}
+		if args[0] != "" && path.Base(args[0]) == c.Name {
+			return nil
+		}
+	}
+	if c.MatchCmdline {
+		return fmt.Errorf("no running process has a command line that matches %q", c.Name)
+	}
+	return fmt.Errorf("no process named %q is running", c.Name)
+}
+
+// processExited reports whether a process has exited but is still
+// listed in /proc, because its parent has not reaped it yet (a zombie)
+// or it is being torn down. The state of the process follows its
+// command name, which is in parentheses and may itself contain them.
+func processExited(fsys afero.Fs, pid string) bool {
+	stat, err := afero.ReadFile(fsys, path.Join(procRoot, pid, "stat"))
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	return len(fields) > 0 && (fields[0] == "Z" || fields[0] == "X")
+}
+
+// requireProc returns an error if /proc is not available
+func requireProc(fsys afero.Fs) error {
+	exists, err := afero.DirExists(fsys, procRoot)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New("this check reads /proc, which is only available on linux")
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package checks
+
+import (
+	"testing"
+)
+
+// fakeProcContents is a minimal /proc with a few processes
+var fakeProcContents = map[string][]byte{
+	"/proc/1/comm":      []byte("systemd\n"),
+	"/proc/1/cmdline":   []byte("/sbin/init\x00splash\x00"),
+	"/proc/42/comm":     []byte("sshd\n"),
+	"/proc/42/cmdline":  []byte("sshd: /usr/sbin/sshd -D [listener]\x00"),
+	"/proc/42/stat":     []byte("42 (sshd) S 1 42 42 0 -1 4194560\n"),
+	"/proc/55/comm":     []byte("beacon\n"),
+	"/proc/55/cmdline":  []byte(""),
+	"/proc/55/stat":     []byte("55 (beacon) Z 1 55 55 0 -1 4227084\n"),
+	"/proc/56/comm":     []byte("x) Z (dying\n"),
+	"/proc/56/cmdline":  []byte(""),
+	"/proc/56/stat":     []byte("56 (x) Z (dying) X 1 56 56 0 -1 4227084\n"),
+	"/proc/77/comm":     []byte("very-long-proce\n"),
+	"/proc/77/cmdline":  []byte("/opt/very-long-process-name\x00--port\x008080\x00"),
+	"/proc/self/comm":   []byte("ttpforge\n"),
+	"/proc/net/tcp":     []byte(fakeTCPTable),
+	"/proc/net/tcp6":    []byte(fakeTCP6Table),
+	"/proc/net/udp":     []byte(fakeUDPTable),
+	"/proc/uptime":      []byte("1.0 1.0\n"),
+	"/proc/notapid/foo": []byte("bar"),
+}
+
+func TestProcessRunning(t *testing.T) {
+	runCheckTestCases(t, []checkTestCase{
+		{
+			name: "Process Name From comm",
+			contentStr: `msg: sshd is not running
+process_running: sshd`,
+			fsysContents: fakeProcContents,
+		},
+		{
+			name: "Process Name From Truncated comm",
+			contentStr: `msg: process is not running
+process_running: very-long-process-name`,
+			fsysContents: fakeProcContents,
+		},
+		{
+			name: "Process Not Running",
+			contentStr: `msg: nginx is not running
+process_running: nginx`,
+			fsysContents:      fakeProcContents,
+			expectVerifyError: true,
+		},
+		{
+			name: "Partial Name Does Not Match",
+			contentStr: `msg: ssh is not running
+process_running: ssh`,
+			fsysContents:      fakeProcContents,
+			expectVerifyError: true,
+		},
+		{
+			name: "Zombie Process Is Not Running",
+			contentStr: `msg: beacon is not running
+process_running: beacon`,
+			fsysContents:      fakeProcContents,
+			expectVerifyError: true,
+		},
+		{
+			name: "Dead Process Is Not Running",
+			contentStr: `msg: process is not running
+process_running: x) Z (dying`,
+			fsysContents:      fakeProcContents,
+			expectVerifyError: true,
+		},
+		{
+			name: "Command Line Matches",
+			contentStr: `msg: process is not running on port 8080
+process_running: 'very-long-process-name --port 8080$'
+match_cmdline: true`,
+			fsysContents: fakeProcContents,
+		},
+		{
+			name: "Command Line Does Not Match",
+			contentStr: `msg: process is not running on port 9090
+process_running: '--port 9090'
+match_cmdline: true`,
+			fsysContents:      fakeProcContents,
+			expectVerifyError: true,
+		},
+		{
+			name: "No /proc",
+			contentStr: `msg: sshd is not running
+process_running: sshd`,
+			fsysContents:      map[string][]byte{"/etc/hostname": []byte("foo")},
+			expectVerifyError: true,
+		},
+		{
+			name: "Invalid Command Line Regex",
+			contentStr: `msg: invalid
+process_running: '(unclosed'
+match_cmdline: true`,
+			expectUnmarshalError: true,
+		},
+	})
+}
@@ -0,0 +1,194 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+// Package configedit edits the values at key paths of structured
+// configuration files - YAML, JSON, TOML, INI and files made of
+// "Key value" lines such as sshd_config - while keeping the rest
+// of each file (key order, comments and indentation) as it was.
+// YAML edits that change more than a single scalar do lose blank lines.
+package configedit
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Format identifies the syntax of a configuration file
+type Format string
+
+const (
+	// YAML files are edited through their node tree, which keeps
+	// comments - but not blank lines, unless only a scalar changes
+	YAML Format = "yaml"
+	// JSON files keep their key order and indentation
+	JSON Format = "json"
+	// TOML files are edited line by line, with [table] headers as sections
+	TOML Format = "toml"
+	// INI files are edited line by line, with [section] headers as sections
+	INI Format = "ini"
+	// KeyValue files (such as sshd_config) consist of "Key value" lines
+	KeyValue Format = "keyvalue"
+)
+
+// formatsByExtension maps file extensions to the formats they imply
+var formatsByExtension = map[string]Format{
+	".yaml": YAML,
+	".yml":  YAML,
+	".json": JSON,
+	".toml": TOML,
+	".ini":  INI,
+}
+
+// ParseFormat checks that name is a supported format
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(strings.ToLower(name)); format {
+	case YAML, JSON, TOML, INI, KeyValue:
+		return format, nil
+	}
+	return "", fmt.Errorf("unsupported format %q - must be one of yaml, json, toml, ini or keyvalue", name)
+}
+
+// InferFormat determines the format of a file from its extension
+func InferFormat(filePath string) (Format, bool) {
+	format, ok := formatsByExtension[strings.ToLower(filepath.Ext(filePath))]
+	return format, ok
+}
+
+// Operation is what an Edit does at its key path
+type Operation string
+
+const (
+	// Set sets the value at the key path, creating the key if needed
+	Set Operation = "set"
+	// Delete removes the key at the key path
+	Delete Operation = "delete"
+	// Append adds a value to the list at the key path, or
+	// (for line-based formats) adds another line for the key
+	Append Operation = "append"
+)
+
+// Edit is a change to the value at a key path. Key paths separate keys
+// with dots (use \. for a literal dot) and index lists with numbers,
+// as in servers.0.port - the same syntax as the json_path output filter.
+type Edit struct {
+	Op    Operation
+	Path  string
+	Value *yaml.Node
+}
+
+// Validate checks that the edit can be applied to files of the specified format
+func (e Edit) Validate(format Format) error {
+	segments, err := splitPath(e.Path)
+	if err != nil {
+		return err
+	}
+	switch e.Op {
+	case Set, Append:
+		if e.Value == nil {
+			return fmt.Errorf("%v requires a value", e.Op)
+		}
+	case Delete:
+	default:
+		return fmt.Errorf("unsupported operation %q", e.Op)
+	}
+
+	switch format {
+	case YAML, JSON:
+		return nil
+	case TOML:
+		if e.Value != nil && e.Value.Kind == yaml.AliasNode {
+			return errors.New("aliases are not supported in toml values")
+		}
+		return nil
+	case INI:
+		if len(segments) > 2 {
+			return fmt.Errorf("ini key path %q must be key or section.key", e.Path)
+		}
+	case KeyValue:
+		if len(segments) > 1 {
+			return fmt.Errorf("keyvalue key path %q must be a single key", e.Path)
+		}
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+	if e.Value != nil && e.Value.Kind != yaml.ScalarNode {
+		return fmt.Errorf("%v values must be strings, numbers or booleans", format)
+	}
+	return nil
+}
+
+// Apply applies the edit to the contents of a file of the specified format
+func Apply(format Format, contents string, edit Edit) (string, error) {
+	if err := edit.Validate(format); err != nil {
+		return "", err
+	}
+	segments, err := splitPath(edit.Path)
+	if err != nil {
+		return "", err
+	}
+	switch format {
+	case YAML:
+		return editYAML(contents, segments, edit)
+	case JSON:
+		return editJSON(contents, segments, edit)
+	default:
+		return editLines(format, contents, segments, edit)
+	}
+}
+
+// splitPath splits a key path into its keys
+func splitPath(keyPath string) ([]string, error) {
+	if keyPath == "" {
+		return nil, errors.New("key path must not be empty")
+	}
+	var segments []string
+	var current strings.Builder
+	for idx := 0; idx < len(keyPath); idx++ {
+		switch c := keyPath[idx]; {
+		case c == '\\' && idx+1 < len(keyPath) && keyPath[idx+1] == '.':
+			current.WriteByte('.')
+			idx++
+		case c == '.':
+			segments = append(segments, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(c)
+		}
+	}
+	segments = append(segments, current.String())
+	for _, segment := range segments {
+		if segment == "" {
+			return nil, fmt.Errorf("key path %q contains an empty key", keyPath)
+		}
+	}
+	return segments, nil
+}
+
+// displayPath joins keys back into a key path for error messages
+func displayPath(segments []string) string {
+	escaped := make([]string, len(segments))
+	for idx, segment := range segments {
+		escaped[idx] = strings.ReplaceAll(segment, ".", `\.`)
+	}
+	return strings.Join(escaped, ".")
+}
@@ -0,0 +1,495 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package configedit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func value(t *testing.T, text string) *yaml.Node {
+	var doc yaml.Node
+	require.NoError(t, yaml.Unmarshal([]byte(text), &doc))
+	return doc.Content[0]
+}
+
+func TestApply(t *testing.T) {
+	testCases := []struct {
+		name           string
+		format         Format
+		contents       string
+		op             Operation
+		path           string
+		value          string
+		expected       string
+		wantErrContain string
+	}{
+		{
+			name:   "YAML Set Keeps Comments",
+			format: YAML,
+			contents: `# server settings
+server:
+    port: 80 # the port
+    host: localhost
+`,
+			op:    Set,
+			path:  "server.port",
+			value: "8080",
+			expected: `# server settings
+server:
+    port: 8080 # the port
+    host: localhost
+`,
+		},
+		{
+			name:   "YAML Set Scalar Keeps Formatting",
+			format: YAML,
+			contents: `server:
+  host: 'localhost'   # listen address
+
+  port: 80
+tags: [a, b]
+`,
+			op:    Set,
+			path:  "server.host",
+			value: `"0.0.0.0"`,
+			expected: `server:
+  host: "0.0.0.0"   # listen address
+
+  port: 80
+tags: [a, b]
+`,
+		},
+		{
+			name:     "YAML Set Multi-Line Scalar",
+			format:   YAML,
+			contents: "motd: |\n  hello\n  world\n\nport: 80\n",
+			op:       Set,
+			path:     "motd",
+			value:    "bye",
+			// the value is not on a single line, so the document is
+			// encoded again - which removes the blank line
+			expected: "motd: bye\nport: 80\n",
+		},
+		{
+			name:     "YAML Set Creates Keys",
+			format:   YAML,
+			contents: "a: 1\n",
+			op:       Set,
+			path:     "b.c",
+			value:    "{d: true}",
+			expected: "a: 1\nb:\n  c: {d: true}\n",
+		},
+		{
+			name:     "YAML Set List Element",
+			format:   YAML,
+			contents: "servers:\n  - name: a\n  - name: b\n",
+			op:       Set,
+			path:     "servers.1.name",
+			value:    "c",
+			expected: "servers:\n  - name: a\n  - name: c\n",
+		},
+		{
+			name:     "YAML Set Dotted Key",
+			format:   YAML,
+			contents: "labels:\n  app.kubernetes.io/name: web\n",
+			op:       Set,
+			path:     `labels.app\.kubernetes\.io/name`,
+			value:    "api",
+			expected: "labels:\n  app.kubernetes.io/name: api\n",
+		},
+		{
+			name:     "YAML Delete",
+			format:   YAML,
+			contents: "---\na: 1\nb: 2\n",
+			op:       Delete,
+			path:     "a",
+			expected: "---\nb: 2\n",
+		},
+		{
+			name:           "YAML Delete Missing Key",
+			format:         YAML,
+			contents:       "a: 1\n",
+			op:             Delete,
+			path:           "b.c",
+			wantErrContain: "key path b not found",
+		},
+		{
+			name:     "YAML Append",
+			format:   YAML,
+			contents: "users:\n  - alice\n",
+			op:       Append,
+			path:     "users",
+			value:    "bob",
+			expected: "users:\n  - alice\n  - bob\n",
+		},
+		{
+			name:     "YAML Append Loses Blank Lines And Comment Spacing",
+			format:   YAML,
+			contents: "users:\n  - alice    # admin\n\nport: 80\n",
+			op:       Append,
+			path:     "users",
+			value:    "bob",
+			expected: "users:\n  - alice # admin\n  - bob\nport: 80\n",
+		},
+		{
+			name:     "YAML Append Creates List",
+			format:   YAML,
+			contents: "",
+			op:       Append,
+			path:     "users",
+			value:    "bob",
+			expected: "users:\n  - bob\n",
+		},
+		{
+			name:           "YAML Append To Mapping",
+			format:         YAML,
+			contents:       "users:\n  alice: admin\n",
+			op:             Append,
+			path:           "users",
+			value:          "bob",
+			wantErrContain: "cannot append to users: it is not a list",
+		},
+		{
+			name:     "JSON Set Keeps Key Order",
+			format:   JSON,
+			contents: "{\n    \"z\": 1,\n    \"a\": {\n        \"url\": \"http://x?a=1&b=2\"\n    }\n}\n",
+			op:       Set,
+			path:     "a.enabled",
+			value:    "true",
+			expected: "{\n    \"z\": 1,\n    \"a\": {\n        \"url\": \"http://x?a=1&b=2\",\n        \"enabled\": true\n    }\n}\n",
+		},
+		{
+			name:     "JSON Single Line",
+			format:   JSON,
+			contents: `{"a":[1,2.5],"b":null}`,
+			op:       Append,
+			path:     "a",
+			value:    "{c: d}",
+			expected: `{"a":[1,2.5,{"c":"d"}],"b":null}`,
+		},
+		{
+			name:     "JSON Delete",
+			format:   JSON,
+			contents: "{\n  \"a\": 1,\n  \"b\": [\n    2,\n    3\n  ]\n}",
+			op:       Delete,
+			path:     "b.0",
+			expected: "{\n  \"a\": 1,\n  \"b\": [\n    3\n  ]\n}",
+		},
+		{
+			name:           "JSON Invalid",
+			format:         JSON,
+			contents:       `{"a": 1} x`,
+			op:             Delete,
+			path:           "a",
+			wantErrContain: "failed to parse json",
+		},
+		{
+			name:     "INI Set",
+			format:   INI,
+			contents: "; comment\n[Server]\nPort=80\nhost = localhost\n\n[client]\nport = 1\n",
+			op:       Set,
+			path:     "server.port",
+			value:    "8080",
+			expected: "; comment\n[Server]\nPort=8080\nhost = localhost\n\n[client]\nport = 1\n",
+		},
+		{
+			name:     "INI Set New Key In Section",
+			format:   INI,
+			contents: "[server]\nport = 80\n\n[client]\nport = 1\n",
+			op:       Set,
+			path:     "server.debug",
+			value:    "true",
+			expected: "[server]\nport = 80\ndebug = true\n\n[client]\nport = 1\n",
+		},
+		{
+			name:     "INI Set New Section",
+			format:   INI,
+			contents: "[server]\nport = 80\n",
+			op:       Set,
+			path:     "logging.level",
+			value:    "debug",
+			expected: "[server]\nport = 80\n\n[logging]\nlevel = debug\n",
+		},
+		{
+			name:     "INI Set Global Key",
+			format:   INI,
+			contents: "name = test\n\n[server]\nport = 80\n",
+			op:       Set,
+			path:     "debug",
+			value:    "1",
+			expected: "name = test\ndebug = 1\n\n[server]\nport = 80\n",
+		},
+		{
+			name:           "INI Nested Path",
+			format:         INI,
+			contents:       "",
+			op:             Set,
+			path:           "a.b.c",
+			value:          "1",
+			wantErrContain: "must be key or section.key",
+		},
+		{
+			name:           "INI List Value",
+			format:         INI,
+			contents:       "",
+			op:             Set,
+			path:           "a",
+			value:          "[1, 2]",
+			wantErrContain: "ini values must be strings, numbers or booleans",
+		},
+		{
+			name:     "TOML Set",
+			format:   TOML,
+			contents: "title = \"old\"\n\n[database]\nports = [8000]\nenabled = false\n",
+			op:       Set,
+			path:     "title",
+			value:    "new \"one\"",
+			expected: "title = \"new \\\"one\\\"\"\n\n[database]\nports = [8000]\nenabled = false\n",
+		},
+		{
+			name:     "TOML Set Nested Table",
+			format:   TOML,
+			contents: "[servers.alpha]\nip = \"10.0.0.1\"\n",
+			op:       Set,
+			path:     "servers.alpha.dc",
+			value:    "{name: eqdc10, racks: [1, 2]}",
+			expected: "[servers.alpha]\nip = \"10.0.0.1\"\ndc = { name = \"eqdc10\", racks = [1, 2] }\n",
+		},
+		{
+			name:     "TOML Append",
+			format:   TOML,
+			contents: "[database]\nports = [ 8000, 8001 ]\n",
+			op:       Append,
+			path:     "database.ports",
+			value:    "8002",
+			expected: "[database]\nports = [8000, 8001, 8002]\n",
+		},
+		{
+			name:     "TOML Append Creates Array",
+			format:   TOML,
+			contents: "[database]\n",
+			op:       Append,
+			path:     "database.hosts",
+			value:    "db1",
+			expected: "[database]\nhosts = [\"db1\"]\n",
+		},
+		{
+			name:           "TOML Append To Scalar",
+			format:         TOML,
+			contents:       "port = 80\n",
+			op:             Append,
+			path:           "port",
+			value:          "81",
+			wantErrContain: "cannot append to port",
+		},
+		{
+			name:     "TOML Delete",
+			format:   TOML,
+			contents: "[a]\nx = 1\n[b]\nx = 2\n",
+			op:       Delete,
+			path:     "b.x",
+			expected: "[a]\nx = 1\n[b]\n",
+		},
+		{
+			name:     "TOML Set Dotted Key",
+			format:   TOML,
+			contents: "server.port = 80\n\n[database]\nenabled = true\n",
+			op:       Set,
+			path:     "server.port",
+			value:    "90",
+			expected: "server.port = 90\n\n[database]\nenabled = true\n",
+		},
+		{
+			name:     "TOML Set Quoted Keys",
+			format:   TOML,
+			contents: "[ servers . \"alpha.example\" ]\n\"ip address\" = \"10.0.0.1\"\n",
+			op:       Set,
+			path:     `servers.alpha\.example.ip address`,
+			value:    "10.0.0.2",
+			expected: "[ servers . \"alpha.example\" ]\n\"ip address\" = \"10.0.0.2\"\n",
+		},
+		{
+			name:     "TOML Set Key Of Dotted Table",
+			format:   TOML,
+			contents: "server.host = \"localhost\"\n\n[database]\ntls.cert = \"a.pem\"\n",
+			op:       Set,
+			path:     "server.port",
+			value:    "90",
+			expected: "server.host = \"localhost\"\nserver.port = 90\n\n[database]\ntls.cert = \"a.pem\"\n",
+		},
+		{
+			name:     "TOML Set Key Of Dotted Table In Section",
+			format:   TOML,
+			contents: "[database]\ntls.cert = \"a.pem\"\n",
+			op:       Set,
+			path:     "database.tls.key",
+			value:    "a.key",
+			expected: "[database]\ntls.cert = \"a.pem\"\ntls.key = \"a.key\"\n",
+		},
+		{
+			name:     "TOML Set Creates Quoted Table",
+			format:   TOML,
+			contents: "title = \"servers\"\n",
+			op:       Set,
+			path:     `servers.alpha\.example.ip`,
+			value:    "10.0.0.1",
+			expected: "title = \"servers\"\n\n[servers.\"alpha.example\"]\nip = \"10.0.0.1\"\n",
+		},
+		{
+			name:     "TOML Delete Dotted Key",
+			format:   TOML,
+			contents: "server.port = 80\nserver.host = \"localhost\"\n",
+			op:       Delete,
+			path:     "server.port",
+			expected: "server.host = \"localhost\"\n",
+		},
+		{
+			name:     "TOML Ignores Arrays Of Tables",
+			format:   TOML,
+			contents: "[[products]]\nname = \"hammer\"\n",
+			op:       Set,
+			path:     "name",
+			value:    "catalog",
+			expected: "name = \"catalog\"\n[[products]]\nname = \"hammer\"\n",
+		},
+		{
+			name:     "KeyValue Set",
+			format:   KeyValue,
+			contents: "#PermitRootLogin yes\nPort 22\npermitrootlogin no\n",
+			op:       Set,
+			path:     "PermitRootLogin",
+			value:    "yes",
+			expected: "#PermitRootLogin yes\nPort 22\npermitrootlogin yes\n",
+		},
+		{
+			name:     "KeyValue Set Before Match Block",
+			format:   KeyValue,
+			contents: "Port 22\n\nMatch User backup\n\tPasswordAuthentication no\n",
+			op:       Set,
+			path:     "PasswordAuthentication",
+			value:    "yes",
+			expected: "Port 22\nPasswordAuthentication yes\n\nMatch User backup\n\tPasswordAuthentication no\n",
+		},
+		{
+			name:     "KeyValue Append",
+			format:   KeyValue,
+			contents: "Port 22\nListenAddress 0.0.0.0\nUsePAM yes\n",
+			op:       Append,
+			path:     "ListenAddress",
+			value:    "'::'",
+			expected: "Port 22\nListenAddress 0.0.0.0\nListenAddress ::\nUsePAM yes\n",
+		},
+		{
+			name:     "KeyValue Equals Separator",
+			format:   KeyValue,
+			contents: "Port=22\n",
+			op:       Set,
+			path:     "Banner",
+			value:    "/etc/issue",
+			expected: "Port=22\nBanner=/etc/issue\n",
+		},
+		{
+			name:     "KeyValue Delete All Lines",
+			format:   KeyValue,
+			contents: "ListenAddress 0.0.0.0\nPort 22\nListenAddress ::\n",
+			op:       Delete,
+			path:     "listenaddress",
+			expected: "Port 22\n",
+		},
+		{
+			name:           "KeyValue Delete Missing Key",
+			format:         KeyValue,
+			contents:       "Port 22\n",
+			op:             Delete,
+			path:           "Banner",
+			wantErrContain: "key path Banner not found",
+		},
+		{
+			name:           "Missing Value",
+			format:         YAML,
+			contents:       "",
+			op:             Set,
+			path:           "a",
+			wantErrContain: "set requires a value",
+		},
+		{
+			name:           "Empty Key",
+			format:         YAML,
+			contents:       "",
+			op:             Delete,
+			path:           "a..b",
+			wantErrContain: "contains an empty key",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			edit := Edit{Op: tc.op, Path: tc.path}
+			if tc.value != "" {
+				edit.Value = value(t, tc.value)
+			}
+			edited, err := Apply(tc.format, tc.contents, edit)
+			if tc.wantErrContain != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErrContain)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, edited)
+		})
+	}
+}
+
+func TestFormats(t *testing.T) {
+	format, err := ParseFormat("YAML")
+	require.NoError(t, err)
+	assert.Equal(t, YAML, format)
+	_, err = ParseFormat("xml")
+	require.Error(t, err)
+
+	for path, expected := range map[string]Format{
+		"config.yml":           YAML,
+		"/etc/app/config.JSON": JSON,
+		"pyproject.toml":       TOML,
+		"php.ini":              INI,
+	} {
+		format, ok := InferFormat(path)
+		assert.True(t, ok, path)
+		assert.Equal(t, expected, format, path)
+	}
+	_, ok := InferFormat("/etc/ssh/sshd_config")
+	assert.False(t, ok)
+}
+
+func TestSplitPath(t *testing.T) {
+	segments, err := splitPath(`a.b\.c.0`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b.c", "0"}, segments)
+	assert.Equal(t, `a.b\.c.0`, displayPath(segments))
+
+	_, err = splitPath("")
+	require.Error(t, err)
+	_, err = splitPath("a.")
+	require.Error(t, err)
+}
@@ -0,0 +1,203 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package configedit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// editJSON applies an edit to a JSON file. The file is parsed into the
+// same node tree as YAML files, which (unlike Go maps) keeps the order
+// of keys, and written back with the indentation of the original.
+func editJSON(contents string, segments []string, edit Edit) (string, error) {
+	decoder := json.NewDecoder(strings.NewReader(contents))
+	decoder.UseNumber()
+	root, err := decodeJSONNode(decoder)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse json: %w", err)
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return "", errors.New("failed to parse json: unexpected data after top-level value")
+	}
+	if err := editTree(root, segments, edit); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := writeJSON(&buf, root, jsonIndent(contents), 0); err != nil {
+		return "", err
+	}
+	if strings.HasSuffix(contents, "\n") {
+		buf.WriteByte('\n')
+	}
+	return buf.String(), nil
+}
+
+func decodeJSONNode(decoder *json.Decoder) (*yaml.Node, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch value := token.(type) {
+	case json.Delim:
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		if value == '[' {
+			node.Kind, node.Tag = yaml.SequenceNode, "!!seq"
+		}
+		for decoder.More() {
+			if node.Kind == yaml.MappingNode {
+				keyToken, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, keyNode(keyToken.(string)))
+			}
+			elem, err := decodeJSONNode(decoder)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, elem)
+		}
+		// consume the closing delimiter
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}, nil
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(value.String(), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value.String()}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(value)}, nil
+	default:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	}
+}
+
+// jsonIndent returns the indentation of the first indented line
+// of a JSON file, or "" if the file is written on a single line
+func jsonIndent(contents string) string {
+	for _, line := range strings.Split(strings.TrimSpace(contents), "\n")[1:] {
+		if trimmed := strings.TrimLeft(line, " \t"); trimmed != "" && len(trimmed) < len(line) {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+	if strings.Contains(strings.TrimSpace(contents), "\n") {
+		return "  "
+	}
+	return ""
+}
+
+// writeJSON writes a node tree as JSON, with each nesting
+// level indented by indent (or on a single line if it is empty)
+func writeJSON(buf *bytes.Buffer, node *yaml.Node, indent string, depth int) error {
+	newline := func(depth int) {
+		if indent != "" {
+			buf.WriteByte('\n')
+			buf.WriteString(strings.Repeat(indent, depth))
+		}
+	}
+	switch node.Kind {
+	case yaml.MappingNode, yaml.SequenceNode:
+		open, closing, step := byte('['), byte(']'), 1
+		if node.Kind == yaml.MappingNode {
+			open, closing, step = '{', '}', 2
+		}
+		buf.WriteByte(open)
+		for idx := 0; idx < len(node.Content); idx += step {
+			if idx > 0 {
+				buf.WriteByte(',')
+			}
+			newline(depth + 1)
+			if node.Kind == yaml.MappingNode {
+				writeJSONString(buf, node.Content[idx].Value)
+				buf.WriteByte(':')
+				if indent != "" {
+					buf.WriteByte(' ')
+				}
+			}
+			if err := writeJSON(buf, node.Content[idx+step-1], indent, depth+1); err != nil {
+				return err
+			}
+		}
+		if len(node.Content) > 0 {
+			newline(depth)
+		}
+		buf.WriteByte(closing)
+		return nil
+	case yaml.ScalarNode:
+		return writeJSONScalar(buf, node)
+	case yaml.AliasNode:
+		return writeJSON(buf, node.Alias, indent, depth)
+	}
+	return fmt.Errorf("cannot convert yaml node of kind %v to json", node.Kind)
+}
+
+func writeJSONScalar(buf *bytes.Buffer, node *yaml.Node) error {
+	switch node.ShortTag() {
+	case "!!null":
+		buf.WriteString("null")
+	case "!!bool":
+		var value bool
+		if err := node.Decode(&value); err != nil {
+			return err
+		}
+		buf.WriteString(strconv.FormatBool(value))
+	case "!!int", "!!float":
+		// keep numbers as written unless they use YAML-only syntax
+		if json.Valid([]byte(node.Value)) {
+			buf.WriteString(node.Value)
+			return nil
+		}
+		var value float64
+		if err := node.Decode(&value); err != nil {
+			return err
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("cannot convert %v to json: %w", node.Value, err)
+		}
+		buf.Write(encoded)
+	default:
+		writeJSONString(buf, node.Value)
+	}
+	return nil
+}
+
+func writeJSONString(buf *bytes.Buffer, value string) {
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	// encoding a string cannot fail
+	_ = encoder.Encode(value)
+	buf.Write(bytes.TrimSuffix(encoded.Bytes(), []byte("\n")))
+}
@@ -0,0 +1,506 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package configedit
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// lineSyntax describes the syntax of a line-based format
+type lineSyntax struct {
+	// sections is set for formats with [section] headers
+	sections bool
+	// caseInsensitive is set for formats whose keys ignore case
+	caseInsensitive bool
+	// dottedKeys is set for formats whose keys and section headers
+	// may be dotted and quoted, as in TOML - a.b = 1 at the top
+	// level sets the same key as b = 1 in the [a] table
+	dottedKeys bool
+	// keySeparators are the characters that end keys
+	keySeparators string
+	// separator is written between the keys and values of new lines,
+	// unless the file already uses a different one
+	separator string
+	// blockStart matches lines that start conditional blocks, which
+	// new keys are inserted before (as in the Match blocks of sshd_config)
+	blockStart func(key string) bool
+}
+
+var lineSyntaxes = map[Format]lineSyntax{
+	INI:  {sections: true, caseInsensitive: true, keySeparators: "=:", separator: " = "},
+	TOML: {sections: true, dottedKeys: true, keySeparators: "=", separator: " = "},
+	KeyValue: {
+		caseInsensitive: true,
+		keySeparators:   " \t=",
+		separator:       " ",
+		blockStart: func(key string) bool {
+			return strings.EqualFold(key, "Match") || strings.EqualFold(key, "Host")
+		},
+	},
+}
+
+// configLine is a parsed line of a line-based file
+type configLine struct {
+	text string
+	// section is the section that the line belongs to
+	section string
+	// header is set for [section] headers
+	header bool
+	// key is the key of key/value lines, keyEnd the offset of
+	// the end of the key and valueStart that of the value
+	key        string
+	keyEnd     int
+	valueStart int
+	// table is the table of lines of formats with dotted keys, and
+	// path the full key path that a key/value line sets
+	table []string
+	path  []string
+}
+
+// editLines applies an edit to a file of a line-based format
+func editLines(format Format, contents string, segments []string, edit Edit) (string, error) {
+	syntax := lineSyntaxes[format]
+	value, err := formatLineValue(format, edit.Value)
+	if err != nil {
+		return "", err
+	}
+
+	trailingNewline := strings.HasSuffix(contents, "\n")
+	lines := parseLines(syntax, strings.TrimSuffix(contents, "\n"))
+	matches := syntax.findKey(lines, segments)
+
+	switch {
+	case edit.Op == Delete:
+		if len(matches) == 0 {
+			return "", fmt.Errorf("key path %v not found", displayPath(segments))
+		}
+		for idx := len(matches) - 1; idx >= 0; idx-- {
+			lines = append(lines[:matches[idx]], lines[matches[idx]+1:]...)
+		}
+	case len(matches) > 0 && edit.Op == Set:
+		line := &lines[matches[0]]
+		prefix := line.text[:line.valueStart]
+		if line.valueStart == line.keyEnd {
+			prefix += syntax.separator
+		}
+		line.text = prefix + value
+	case len(matches) > 0 && format == TOML:
+		// appending to a toml key adds a value to its array
+		line := &lines[matches[len(matches)-1]]
+		current := strings.TrimSpace(line.text[line.valueStart:])
+		if !strings.HasPrefix(current, "[") || !strings.HasSuffix(current, "]") {
+			return "", fmt.Errorf("cannot append to %v: it is not an array on a single line", displayPath(segments))
+		}
+		items := strings.TrimSpace(strings.TrimSuffix(current[1:len(current)-1], ","))
+		if items != "" {
+			items += ", "
+		}
+		line.text = line.text[:line.valueStart] + "[" + items + value + "]"
+	default:
+		if edit.Op == Append && format == TOML {
+			value = "[" + value + "]"
+		}
+		lines = syntax.insert(lines, matches, segments, syntax.separatorFor(lines)+value)
+	}
+
+	var buf bytes.Buffer
+	for idx, line := range lines {
+		if idx > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(line.text)
+	}
+	if trailingNewline {
+		buf.WriteByte('\n')
+	}
+	return buf.String(), nil
+}
+
+func parseLines(syntax lineSyntax, contents string) []configLine {
+	var lines []configLine
+	section := ""
+	var table []string
+	for _, text := range strings.Split(contents, "\n") {
+		line := configLine{text: text, section: section, table: table}
+		trimmed := strings.TrimSpace(text)
+		switch {
+		case trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";"):
+		case syntax.sections && strings.HasPrefix(trimmed, "["):
+			section = parseHeader(trimmed)
+			if syntax.dottedKeys && section != unnamedSection {
+				table = parseDottedKey(section)
+				section = displayPath(table)
+			}
+			line.section, line.header, line.table = section, true, table
+		default:
+			line.key, line.keyEnd, line.valueStart = parseKeyValue(text, syntax.keySeparators)
+			if syntax.dottedKeys {
+				keys := parseDottedKey(text[:line.keyEnd])
+				line.key = displayPath(keys)
+				line.path = append(slices.Clip(table), keys...)
+			}
+			if syntax.startsBlock(line) {
+				// keys within conditional blocks cannot be edited
+				section = unnamedSection
+			}
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// unnamedSection is the section of lines that no key path can refer to
+const unnamedSection = "[["
+
+// parseHeader returns the name of the section that a [section] header
+// starts. The [[name]] headers of TOML arrays of tables start sections
+// that no key path can refer to.
+func parseHeader(header string) string {
+	if strings.HasPrefix(header, "[[") {
+		return unnamedSection
+	}
+	name := header[1:]
+	if end := strings.Index(name, "]"); end >= 0 {
+		name = name[:end]
+	}
+	return strings.TrimSpace(name)
+}
+
+// parseKeyValue splits a key/value line at the first of the separators,
+// returning its key and the offsets of the end of the key and of the value
+func parseKeyValue(text, separators string) (string, int, int) {
+	indent := len(text) - len(strings.TrimLeft(text, " \t"))
+	keyEnd := indexUnquoted(text[indent:], separators)
+	if keyEnd < 0 {
+		return strings.TrimSpace(text), len(text), len(text)
+	}
+	keyEnd += indent
+	key := strings.TrimRight(text[indent:keyEnd], " \t")
+	keyEnd = indent + len(key)
+
+	// the value follows whitespace and at most one separator
+	valueStart := skipBlanks(text, keyEnd)
+	if valueStart < len(text) && strings.ContainsRune(strings.Trim(separators, " \t"), rune(text[valueStart])) {
+		valueStart = skipBlanks(text, valueStart+1)
+	}
+	return strings.Trim(key, `"'`), keyEnd, valueStart
+}
+
+// indexUnquoted returns the index of the first of chars in text
+// that is not within single or double quotes, or -1 if there is none
+func indexUnquoted(text, chars string) int {
+	var quote byte
+	for idx := 0; idx < len(text); idx++ {
+		switch c := text[idx]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				idx++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case strings.IndexByte(chars, c) >= 0:
+			return idx
+		}
+	}
+	return -1
+}
+
+// parseDottedKey splits a toml key such as a."b.c" . d into its keys
+func parseDottedKey(key string) []string {
+	var keys []string
+	var current strings.Builder
+	for idx := 0; idx < len(key); idx++ {
+		switch c := key[idx]; c {
+		case '.':
+			keys = append(keys, current.String())
+			current.Reset()
+		case ' ', '\t':
+		case '"', '\'':
+			end := idx + 1
+			for end < len(key) && key[end] != c {
+				if c == '"' && key[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			quoted := key[idx+1 : min(end, len(key))]
+			if c == '"' {
+				if unquoted, err := strconv.Unquote(`"` + quoted + `"`); err == nil {
+					quoted = unquoted
+				}
+			}
+			current.WriteString(quoted)
+			idx = end
+		default:
+			current.WriteByte(c)
+		}
+	}
+	return append(keys, current.String())
+}
+
+// formatDottedKey formats keys as a toml key,
+// quoting those that are not bare keys
+func formatDottedKey(keys []string) string {
+	formatted := make([]string, len(keys))
+	for idx, key := range keys {
+		formatted[idx] = key
+		if key == "" || strings.IndexFunc(key, isNotBareKeyChar) >= 0 {
+			formatted[idx] = quoteTOMLString(key)
+		}
+	}
+	return strings.Join(formatted, ".")
+}
+
+func isNotBareKeyChar(r rune) bool {
+	return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-')
+}
+
+func skipBlanks(text string, idx int) int {
+	for idx < len(text) && (text[idx] == ' ' || text[idx] == '\t') {
+		idx++
+	}
+	return idx
+}
+
+// findKey returns the indices of the lines that set the key at the key path
+func (s lineSyntax) findKey(lines []configLine, segments []string) []int {
+	section, key := s.sectionOf(segments), segments[len(segments)-1]
+	var matches []int
+	for idx, line := range lines {
+		if line.header || line.key == "" || line.section == unnamedSection {
+			continue
+		}
+		if s.dottedKeys {
+			if slices.Equal(line.path, segments) {
+				matches = append(matches, idx)
+			}
+			continue
+		}
+		if s.equal(line.section, section) && s.equal(line.key, key) {
+			matches = append(matches, idx)
+		}
+	}
+	return matches
+}
+
+// sectionOf returns the name of the section that holds the key at the
+// key path, as parseLines names it - or "" for keys without a section
+func (s lineSyntax) sectionOf(segments []string) string {
+	if len(segments) == 1 {
+		return ""
+	}
+	if s.dottedKeys {
+		return displayPath(segments[:len(segments)-1])
+	}
+	return strings.Join(segments[:len(segments)-1], ".")
+}
+
+// formatKey formats keys relative to the table that holds them
+func (s lineSyntax) formatKey(keys []string) string {
+	if s.dottedKeys {
+		return formatDottedKey(keys)
+	}
+	return strings.Join(keys, ".")
+}
+
+// findDottedTable returns the index of the last line whose dotted key
+// defines the table that holds the key at the key path (as a.b = 1
+// defines the table a), or -1 if there is none
+func (s lineSyntax) findDottedTable(lines []configLine, segments []string) int {
+	parent := segments[:len(segments)-1]
+	found := -1
+	for idx, line := range lines {
+		if line.header || line.key == "" || line.section == unnamedSection {
+			continue
+		}
+		if len(line.table) < len(parent) && len(line.path) > len(parent) && slices.Equal(line.path[:len(parent)], parent) {
+			found = idx
+		}
+	}
+	return found
+}
+
+func (s lineSyntax) equal(a, b string) bool {
+	if s.caseInsensitive {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// separatorFor returns the separator of the first key/value
+// line of the file, or the default separator of the format
+func (s lineSyntax) separatorFor(lines []configLine) string {
+	for _, line := range lines {
+		if line.key != "" && line.valueStart > line.keyEnd {
+			return line.text[line.keyEnd:line.valueStart]
+		}
+	}
+	return s.separator
+}
+
+// startsBlock reports whether the line starts a conditional block
+func (s lineSyntax) startsBlock(line configLine) bool {
+	return line.key != "" && s.blockStart != nil && s.blockStart(line.key)
+}
+
+// insert adds a line that sets the key at the key path to the value
+// (preceded by its separator) after the last line that sets the same
+// key, or else at the end of its section - creating the section if it
+// does not exist yet. Keys without a section are inserted before the
+// first section header or conditional block. In formats with dotted
+// keys, tables that are only defined by dotted keys get no section:
+// the key is inserted after their last key instead.
+func (s lineSyntax) insert(lines []configLine, matches []int, segments []string, value string) []configLine {
+	section, key := s.sectionOf(segments), segments[len(segments)-1]
+	newLine := configLine{text: s.formatKey([]string{key}) + value, section: section, key: key}
+	if len(matches) > 0 {
+		return insertAt(lines, matches[len(matches)-1]+1, newLine)
+	}
+	if len(lines) == 1 && lines[0].text == "" {
+		lines = nil
+	}
+	if s.dottedKeys && !s.hasSection(lines, section) {
+		if idx := s.findDottedTable(lines, segments); idx >= 0 {
+			table := lines[idx].table
+			newLine.text = formatDottedKey(segments[len(table):]) + value
+			newLine.section, newLine.table = lines[idx].section, table
+			return insertAt(lines, idx+1, newLine)
+		}
+	}
+
+	start, end := -1, len(lines)
+	if section == "" {
+		start = 0
+	}
+	for idx, line := range lines {
+		if start < 0 {
+			if line.header && s.equal(line.section, section) {
+				start = idx + 1
+			}
+			continue
+		}
+		if line.header || s.startsBlock(line) {
+			end = idx
+			break
+		}
+	}
+
+	if start < 0 {
+		if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1].text) != "" {
+			lines = append(lines, configLine{})
+		}
+		header := "[" + s.formatKey(segments[:len(segments)-1]) + "]"
+		lines = append(lines, configLine{text: header, section: section, header: true})
+		return append(lines, newLine)
+	}
+	// blank lines that separate the section from the next one stay in place
+	insertIdx := end
+	for insertIdx > start && strings.TrimSpace(lines[insertIdx-1].text) == "" {
+		insertIdx--
+	}
+	return insertAt(lines, insertIdx, newLine)
+}
+
+// hasSection reports whether a header starts the section
+func (s lineSyntax) hasSection(lines []configLine, section string) bool {
+	if section == "" {
+		return true
+	}
+	for _, line := range lines {
+		if line.header && s.equal(line.section, section) {
+			return true
+		}
+	}
+	return false
+}
+
+func insertAt(lines []configLine, idx int, line configLine) []configLine {
+	lines = append(lines, configLine{})
+	copy(lines[idx+1:], lines[idx:])
+	lines[idx] = line
+	return lines
+}
+
+// formatLineValue formats a value for a line-based format
+func formatLineValue(format Format, value *yaml.Node) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	if format != TOML {
+		return value.Value, nil
+	}
+	return formatTOMLValue(value)
+}
+
+// formatTOMLValue formats a value as TOML: strings are quoted,
+// lists become arrays and mappings become inline tables
+func formatTOMLValue(value *yaml.Node) (string, error) {
+	switch value.Kind {
+	case yaml.SequenceNode:
+		items := make([]string, len(value.Content))
+		for idx, elem := range value.Content {
+			item, err := formatTOMLValue(elem)
+			if err != nil {
+				return "", err
+			}
+			items[idx] = item
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	case yaml.MappingNode:
+		items := make([]string, 0, len(value.Content)/2)
+		for idx := 0; idx+1 < len(value.Content); idx += 2 {
+			item, err := formatTOMLValue(value.Content[idx+1])
+			if err != nil {
+				return "", err
+			}
+			items = append(items, value.Content[idx].Value+" = "+item)
+		}
+		return "{ " + strings.Join(items, ", ") + " }", nil
+	case yaml.ScalarNode:
+		switch value.ShortTag() {
+		case "!!int", "!!float", "!!bool", "!!timestamp":
+			return value.Value, nil
+		case "!!null":
+			return "", fmt.Errorf("toml has no null values")
+		}
+		return quoteTOMLString(value.Value), nil
+	}
+	return "", fmt.Errorf("unsupported toml value %v", value.Value)
+}
+
+// quoteTOMLString formats s as a toml basic string - every
+// escape sequence of JSON strings is valid in toml as well
+func quoteTOMLString(s string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	// strings can always be encoded
+	_ = encoder.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
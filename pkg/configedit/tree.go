@@ -0,0 +1,157 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package configedit
+
+import (
+	"fmt"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// editTree applies an edit to the node tree of a YAML or JSON document
+func editTree(root *yaml.Node, segments []string, edit Edit) error {
+	parent, err := walk(root, segments[:len(segments)-1], edit.Op != Delete)
+	if err != nil {
+		return err
+	}
+	key := segments[len(segments)-1]
+	switch edit.Op {
+	case Set:
+		return setChild(parent, key, edit.Value, segments)
+	case Delete:
+		return deleteChild(parent, key, segments)
+	default:
+		list := child(parent, key)
+		if list == nil {
+			return setChild(parent, key, &yaml.Node{
+				Kind:    yaml.SequenceNode,
+				Tag:     "!!seq",
+				Content: []*yaml.Node{edit.Value},
+			}, segments)
+		}
+		if list.Kind != yaml.SequenceNode {
+			return fmt.Errorf("cannot append to %v: it is not a list", displayPath(segments))
+		}
+		list.Content = append(list.Content, edit.Value)
+		return nil
+	}
+}
+
+// walk follows the keys from node, creating missing
+// mappings along the way if create is set
+func walk(node *yaml.Node, segments []string, create bool) (*yaml.Node, error) {
+	for idx, key := range segments {
+		next := child(node, key)
+		if next == nil {
+			if !create || node.Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("key path %v not found", displayPath(segments[:idx+1]))
+			}
+			next = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			node.Content = append(node.Content, keyNode(key), next)
+		}
+		node = next
+	}
+	return node, nil
+}
+
+// child returns the value of key in a mapping or the element
+// at index key in a list, or nil if there is none
+func child(node *yaml.Node, key string) *yaml.Node {
+	switch node.Kind {
+	case yaml.MappingNode:
+		if idx := mappingIndex(node, key); idx >= 0 {
+			return node.Content[idx+1]
+		}
+	case yaml.SequenceNode:
+		if idx, ok := listIndex(node, key); ok {
+			return node.Content[idx]
+		}
+	}
+	return nil
+}
+
+func setChild(node *yaml.Node, key string, value *yaml.Node, segments []string) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		if idx := mappingIndex(node, key); idx >= 0 {
+			// comments belong to the key rather than its value
+			value = withComments(value, node.Content[idx+1])
+			node.Content[idx+1] = value
+		} else {
+			node.Content = append(node.Content, keyNode(key), value)
+		}
+		return nil
+	case yaml.SequenceNode:
+		if idx, ok := listIndex(node, key); ok {
+			node.Content[idx] = withComments(value, node.Content[idx])
+			return nil
+		}
+		return fmt.Errorf("key path %v not found", displayPath(segments))
+	}
+	return fmt.Errorf("cannot set %v: its parent is neither a mapping nor a list", displayPath(segments))
+}
+
+func deleteChild(node *yaml.Node, key string, segments []string) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		if idx := mappingIndex(node, key); idx >= 0 {
+			node.Content = append(node.Content[:idx], node.Content[idx+2:]...)
+			return nil
+		}
+	case yaml.SequenceNode:
+		if idx, ok := listIndex(node, key); ok {
+			node.Content = append(node.Content[:idx], node.Content[idx+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("key path %v not found", displayPath(segments))
+}
+
+// mappingIndex returns the index of the key node of key in a mapping, or -1
+func mappingIndex(node *yaml.Node, key string) int {
+	for idx := 0; idx+1 < len(node.Content); idx += 2 {
+		if node.Content[idx].Value == key {
+			return idx
+		}
+	}
+	return -1
+}
+
+func listIndex(node *yaml.Node, key string) (int, bool) {
+	idx, err := strconv.Atoi(key)
+	if err != nil || idx < 0 || idx >= len(node.Content) {
+		return 0, false
+	}
+	return idx, true
+}
+
+func keyNode(key string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}
+}
+
+// withComments returns a copy of value that keeps the comments of the node it replaces
+func withComments(value, replaced *yaml.Node) *yaml.Node {
+	valueCopy := *value
+	valueCopy.HeadComment = replaced.HeadComment
+	valueCopy.LineComment = replaced.LineComment
+	valueCopy.FootComment = replaced.FootComment
+	return &valueCopy
+}
@@ -0,0 +1,180 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package configedit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// editYAML applies an edit to the first document of a YAML file.
+// Setting a scalar to another scalar only replaces the text of the value,
+// but other edits encode the documents again - which keeps their comments
+// and key order, but not their blank lines or the spacing of comments.
+func editYAML(contents string, segments []string, edit Edit) (string, error) {
+	var docs []*yaml.Node
+	decoder := yaml.NewDecoder(strings.NewReader(contents))
+	for {
+		var doc yaml.Node
+		err := decoder.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse yaml: %w", err)
+		}
+		docs = append(docs, &doc)
+	}
+	if len(docs) == 0 {
+		docs = append(docs, &yaml.Node{Kind: yaml.DocumentNode})
+	}
+	doc := docs[0]
+	if edited, ok := spliceYAMLScalar(contents, doc, segments, edit); ok {
+		return edited, nil
+	}
+	if len(doc.Content) == 0 {
+		doc.Content = append(doc.Content, &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"})
+	}
+	if err := editTree(doc.Content[0], segments, edit); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(yamlIndent(contents))
+	for _, doc := range docs {
+		if err := encoder.Encode(doc); err != nil {
+			return "", fmt.Errorf("failed to encode yaml: %w", err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return "", fmt.Errorf("failed to encode yaml: %w", err)
+	}
+	edited := buf.String()
+	if strings.HasPrefix(contents, "---") && !strings.HasPrefix(edited, "---") {
+		edited = "---\n" + edited
+	}
+	return edited, nil
+}
+
+// yamlIndent determines the number of spaces by which a YAML file
+// indents nested blocks from the smallest indentation of its lines
+func yamlIndent(contents string) int {
+	indent := 0
+	for _, line := range strings.Split(contents, "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if spaces := len(line) - len(trimmed); spaces > 0 && (indent == 0 || spaces < indent) {
+			indent = spaces
+		}
+	}
+	if indent < 2 {
+		return 2
+	}
+	return indent
+}
+
+// spliceYAMLScalar applies a set edit that replaces a scalar on a single
+// line with another scalar by replacing only the text of the old value.
+// It reports false if the edit is not such an edit.
+func spliceYAMLScalar(contents string, doc *yaml.Node, segments []string, edit Edit) (string, bool) {
+	if edit.Op != Set || edit.Value.Kind != yaml.ScalarNode || len(doc.Content) == 0 {
+		return "", false
+	}
+	parent, err := walk(doc.Content[0], segments[:len(segments)-1], false)
+	if err != nil || parent.Style&yaml.FlowStyle != 0 {
+		return "", false
+	}
+	old := child(parent, segments[len(segments)-1])
+	if old == nil || old.Kind != yaml.ScalarNode || old.Anchor != "" || old.Line < 1 || old.Column < 1 {
+		return "", false
+	}
+
+	lines := strings.SplitAfter(contents, "\n")
+	if old.Line > len(lines) || old.Column > len(lines[old.Line-1]) {
+		return "", false
+	}
+	line := lines[old.Line-1]
+	start := old.Column - 1
+	end, ok := yamlScalarEnd(line, start, old.Style)
+	if !ok {
+		return "", false
+	}
+	// the text must be exactly the old value, which
+	// excludes scalars that span more than one line
+	var parsed string
+	if err := yaml.Unmarshal([]byte(line[start:end]), &parsed); err != nil || parsed != old.Value {
+		return "", false
+	}
+
+	value := *edit.Value
+	value.HeadComment, value.LineComment, value.FootComment = "", "", ""
+	rendered, err := yaml.Marshal(&value)
+	if err != nil {
+		return "", false
+	}
+	text := strings.TrimSuffix(string(rendered), "\n")
+	if strings.Contains(text, "\n") {
+		return "", false
+	}
+	lines[old.Line-1] = line[:start] + text + line[end:]
+	return strings.Join(lines, ""), true
+}
+
+// yamlScalarEnd returns the offset in line of the end of the
+// scalar of the specified style that starts at offset start
+func yamlScalarEnd(line string, start int, style yaml.Style) (int, bool) {
+	switch {
+	case style == 0 || style == yaml.TaggedStyle:
+		// plain scalars end at a comment or at the end of the line
+		end := len(line)
+		if idx := strings.Index(line[start:], " #"); idx >= 0 {
+			end = start + idx
+		}
+		return len(strings.TrimRight(line[:end], " \t\r\n")), true
+	case style&yaml.SingleQuotedStyle != 0:
+		for idx := start + 1; idx < len(line); idx++ {
+			if line[idx] == '\'' {
+				if idx+1 < len(line) && line[idx+1] == '\'' {
+					idx++
+					continue
+				}
+				return idx + 1, true
+			}
+		}
+	case style&yaml.DoubleQuotedStyle != 0:
+		for idx := start + 1; idx < len(line); idx++ {
+			switch line[idx] {
+			case '\\':
+				idx++
+			case '"':
+				return idx + 1, true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,169 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package executors
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+const (
+	// DeliveryStdin passes the body of an inline step to the
+	// interpreter through its standard input
+	DeliveryStdin = "stdin"
+	// DeliveryFile writes the body of an inline step to a
+	// temporary script file, whose path is passed to the interpreter
+	DeliveryFile = "file"
+
+	// BodyPlaceholder is replaced with the body of an inline step
+	// when it is wrapped
+	BodyPlaceholder = "{{body}}"
+	// ScriptPlaceholder is replaced with the path of the script file
+	// in the command of an executor
+	ScriptPlaceholder = "{{script}}"
+)
+
+// Definition describes how an executor runs the inline logic of
+// basic steps and the script files of file steps.
+type Definition struct {
+	// Name is what steps specify as their `executor:`
+	Name string `yaml:"name"`
+	// Command is the command line that runs inline logic. For file
+	// delivery, ScriptPlaceholder marks where the path of the script
+	// goes - if it is missing, the path is appended to the command.
+	Command []string `yaml:"command"`
+	// FileCommand is the command line that runs the script files of file
+	// steps, followed by the path of the script and the step arguments.
+	// If it is not set, Command is used instead.
+	FileCommand []string `yaml:"file_command,omitempty"`
+	// Delivery is either DeliveryStdin (the default) or DeliveryFile
+	Delivery string `yaml:"delivery,omitempty"`
+	// Extensions are the file extensions (such as .js) of the scripts
+	// that this executor runs when a file step does not specify
+	// an executor. The first one is also used for temporary script files.
+	Extensions []string `yaml:"extensions,omitempty"`
+	// Wrapper, if set, surrounds the body of inline steps
+	// and must contain BodyPlaceholder
+	Wrapper string `yaml:"wrapper,omitempty"`
+}
+
+// Validate checks that the definition is complete and consistent.
+func (d Definition) Validate() error {
+	if d.Name == "" {
+		return errors.New("executor name must not be empty")
+	}
+	if len(d.Command) == 0 || d.Command[0] == "" {
+		return errors.New("executor command must not be empty")
+	}
+	if strings.Contains(d.Command[0], ScriptPlaceholder) {
+		return fmt.Errorf("the first element of the executor command must be a program, not %v", ScriptPlaceholder)
+	}
+	hasScript := slices.ContainsFunc(d.Command, func(arg string) bool {
+		return strings.Contains(arg, ScriptPlaceholder)
+	})
+	switch d.Delivery {
+	case "", DeliveryStdin:
+		if hasScript {
+			return fmt.Errorf("%v can only be used with delivery %q", ScriptPlaceholder, DeliveryFile)
+		}
+	case DeliveryFile:
+	default:
+		return fmt.Errorf("invalid delivery %q - must be %q or %q", d.Delivery, DeliveryStdin, DeliveryFile)
+	}
+	if len(d.FileCommand) > 0 && d.FileCommand[0] == "" {
+		return errors.New("executor file_command must not start with an empty program")
+	}
+	for _, ext := range d.Extensions {
+		if !strings.HasPrefix(ext, ".") || len(ext) < 2 {
+			return fmt.Errorf("invalid file extension %q - must start with a '.'", ext)
+		}
+	}
+	if d.Wrapper != "" && !strings.Contains(d.Wrapper, BodyPlaceholder) {
+		return fmt.Errorf("executor wrapper must contain %v", BodyPlaceholder)
+	}
+	return nil
+}
+
+// Program returns the program that the executor runs, which
+// must be installed for steps that use this executor to be valid.
+func (d Definition) Program() string {
+	return d.Command[0]
+}
+
+// UsesFile returns true if inline logic is delivered as a script file.
+func (d Definition) UsesFile() bool {
+	return d.Delivery == DeliveryFile
+}
+
+// ScriptExtension returns the extension used for temporary
+// script files, or an empty string if there is none.
+func (d Definition) ScriptExtension() string {
+	if len(d.Extensions) == 0 {
+		return ""
+	}
+	return d.Extensions[0]
+}
+
+// Wrap surrounds body with the wrapper of the executor.
+func (d Definition) Wrap(body string) string {
+	if d.Wrapper == "" {
+		return body
+	}
+	return strings.ReplaceAll(d.Wrapper, BodyPlaceholder, body)
+}
+
+// InlineCommand returns the command line that runs inline logic.
+// The scriptPath is only used for file delivery.
+func (d Definition) InlineCommand(scriptPath string) []string {
+	if !d.UsesFile() {
+		return slices.Clone(d.Command)
+	}
+	return withScript(d.Command, scriptPath)
+}
+
+// ScriptCommand returns the command line that runs the script
+// file at scriptPath with the specified arguments.
+func (d Definition) ScriptCommand(scriptPath string, args []string) []string {
+	command := d.FileCommand
+	if len(command) == 0 {
+		command = d.Command
+	}
+	return append(withScript(command, scriptPath), args...)
+}
+
+// withScript substitutes scriptPath for ScriptPlaceholder
+// in command, or appends it if there is no placeholder.
+func withScript(command []string, scriptPath string) []string {
+	var result []string
+	var substituted bool
+	for _, arg := range command {
+		if strings.Contains(arg, ScriptPlaceholder) {
+			arg = strings.ReplaceAll(arg, ScriptPlaceholder, scriptPath)
+			substituted = true
+		}
+		result = append(result, arg)
+	}
+	if !substituted {
+		result = append(result, scriptPath)
+	}
+	return result
+}
@@ -0,0 +1,188 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package executors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefinitionValidate(t *testing.T) {
+	testCases := []struct {
+		name           string
+		def            Definition
+		wantErrContain string
+	}{
+		{
+			name: "Stdin Delivery",
+			def: Definition{
+				Name:    "node",
+				Command: []string{"node", "-"},
+			},
+		},
+		{
+			name: "File Delivery With Placeholder",
+			def: Definition{
+				Name:       "osascript",
+				Command:    []string{"osascript", "{{script}}"},
+				Delivery:   DeliveryFile,
+				Extensions: []string{".applescript", ".scpt"},
+				Wrapper:    "{{body}}\nreturn",
+			},
+		},
+		{
+			name:           "Missing Name",
+			def:            Definition{Command: []string{"node"}},
+			wantErrContain: "executor name must not be empty",
+		},
+		{
+			name:           "Missing Command",
+			def:            Definition{Name: "node"},
+			wantErrContain: "executor command must not be empty",
+		},
+		{
+			name: "Script Placeholder As Program",
+			def: Definition{
+				Name:     "self",
+				Command:  []string{"{{script}}"},
+				Delivery: DeliveryFile,
+			},
+			wantErrContain: "must be a program",
+		},
+		{
+			name: "Script Placeholder With Stdin Delivery",
+			def: Definition{
+				Name:    "perl",
+				Command: []string{"perl", "{{script}}"},
+			},
+			wantErrContain: `{{script}} can only be used with delivery "file"`,
+		},
+		{
+			name: "Invalid Delivery",
+			def: Definition{
+				Name:     "perl",
+				Command:  []string{"perl"},
+				Delivery: "pipe",
+			},
+			wantErrContain: `invalid delivery "pipe"`,
+		},
+		{
+			name: "Invalid Extension",
+			def: Definition{
+				Name:       "perl",
+				Command:    []string{"perl"},
+				Extensions: []string{"pl"},
+			},
+			wantErrContain: `invalid file extension "pl"`,
+		},
+		{
+			name: "Wrapper Without Body",
+			def: Definition{
+				Name:    "perl",
+				Command: []string{"perl"},
+				Wrapper: "use strict;",
+			},
+			wantErrContain: "executor wrapper must contain {{body}}",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.def.Validate()
+			if tc.wantErrContain != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErrContain)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestDefinitionCommands(t *testing.T) {
+	testCases := []struct {
+		name                  string
+		def                   Definition
+		expectedInlineCommand []string
+		expectedScriptCommand []string
+	}{
+		{
+			name: "Stdin Delivery",
+			def: Definition{
+				Name:    "node",
+				Command: []string{"node", "-"},
+			},
+			expectedInlineCommand: []string{"node", "-"},
+			expectedScriptCommand: []string{"node", "-", "/tmp/script", "arg"},
+		},
+		{
+			name: "Separate File Command",
+			def: Definition{
+				Name:        "pwsh",
+				Command:     []string{"pwsh", "-Command", "-"},
+				FileCommand: []string{"pwsh", "-File"},
+			},
+			expectedInlineCommand: []string{"pwsh", "-Command", "-"},
+			expectedScriptCommand: []string{"pwsh", "-File", "/tmp/script", "arg"},
+		},
+		{
+			name: "File Delivery Appends Path",
+			def: Definition{
+				Name:     "venv-python",
+				Command:  []string{"/opt/venv/bin/python", "-u"},
+				Delivery: DeliveryFile,
+			},
+			expectedInlineCommand: []string{"/opt/venv/bin/python", "-u", "/tmp/script"},
+			expectedScriptCommand: []string{"/opt/venv/bin/python", "-u", "/tmp/script", "arg"},
+		},
+		{
+			name: "File Delivery Substitutes Placeholder",
+			def: Definition{
+				Name:     "perl",
+				Command:  []string{"perl", "-x", "--file={{script}}", "--"},
+				Delivery: DeliveryFile,
+			},
+			expectedInlineCommand: []string{"perl", "-x", "--file=/tmp/script", "--"},
+			expectedScriptCommand: []string{"perl", "-x", "--file=/tmp/script", "--", "arg"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			require.NoError(t, tc.def.Validate())
+			assert.Equal(t, tc.expectedInlineCommand, tc.def.InlineCommand("/tmp/script"))
+			assert.Equal(t, tc.expectedScriptCommand, tc.def.ScriptCommand("/tmp/script", []string{"arg"}))
+		})
+	}
+}
+
+func TestDefinitionWrap(t *testing.T) {
+	def := Definition{Name: "node", Command: []string{"node"}}
+	assert.Equal(t, "console.log(1)", def.Wrap("console.log(1)"))
+
+	def.Wrapper = "(async () => {\n{{body}}\n})()"
+	assert.Equal(t, "(async () => {\nconsole.log(1)\n})()", def.Wrap("console.log(1)"))
+	assert.Equal(t, "", def.ScriptExtension())
+
+	def.Extensions = []string{".mjs", ".js"}
+	assert.Equal(t, ".mjs", def.ScriptExtension())
+}
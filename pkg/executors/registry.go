@@ -0,0 +1,97 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package executors
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/facebookincubator/ttpforge/pkg/logging"
+)
+
+// Registry holds the custom executors defined in the global
+// configuration file and the configuration files of repositories.
+// A nil Registry is empty.
+type Registry struct {
+	byName      map[string]Definition
+	byExtension map[string]string
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		byName:      make(map[string]Definition),
+		byExtension: make(map[string]string),
+	}
+}
+
+// Register validates the provided definitions and adds them to the registry.
+// Definitions replace any previously registered executor
+// with the same name or file extension, which lets repositories
+// override the executors of the global configuration file.
+//
+// **Parameters:**
+//
+// defs: the executor definitions to register
+//
+// **Returns:**
+//
+// error: an error if a definition is invalid or defs contains duplicates
+func (r *Registry) Register(defs ...Definition) error {
+	names := make(map[string]bool)
+	for _, def := range defs {
+		if err := def.Validate(); err != nil {
+			return fmt.Errorf("invalid executor %q: %w", def.Name, err)
+		}
+		if names[def.Name] {
+			return fmt.Errorf("duplicate executor name: %v", def.Name)
+		}
+		names[def.Name] = true
+	}
+	for _, def := range defs {
+		if _, ok := r.byName[def.Name]; ok {
+			logging.L().Debugf("Overriding previously registered executor %v", def.Name)
+		}
+		r.byName[def.Name] = def
+		for _, ext := range def.Extensions {
+			r.byExtension[ext] = def.Name
+		}
+	}
+	return nil
+}
+
+// Lookup returns the executor with the specified name, if it is registered.
+func (r *Registry) Lookup(name string) (Definition, bool) {
+	if r == nil {
+		return Definition{}, false
+	}
+	def, ok := r.byName[name]
+	return def, ok
+}
+
+// Infer returns the name of the executor that is registered
+// for the file extension of filePath, if there is one.
+func (r *Registry) Infer(filePath string) (string, bool) {
+	if r == nil {
+		return "", false
+	}
+	name, ok := r.byExtension[filepath.Ext(filePath)]
+	return name, ok
+}
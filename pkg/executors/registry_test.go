@@ -0,0 +1,89 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package executors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	require.NoError(t, registry.Register(
+		Definition{Name: "node", Command: []string{"node"}, Extensions: []string{".js", ".mjs"}},
+		Definition{Name: "perl", Command: []string{"perl"}, Extensions: []string{".pl"}},
+	))
+
+	def, ok := registry.Lookup("node")
+	require.True(t, ok)
+	assert.Equal(t, []string{"node"}, def.Command)
+	_, ok = registry.Lookup("bash")
+	assert.False(t, ok)
+
+	name, ok := registry.Infer("/path/to/script.mjs")
+	require.True(t, ok)
+	assert.Equal(t, "node", name)
+	_, ok = registry.Infer("/path/to/script.sh")
+	assert.False(t, ok)
+
+	// later definitions override earlier ones
+	require.NoError(t, registry.Register(
+		Definition{Name: "node", Command: []string{"/opt/node/bin/node"}},
+		Definition{Name: "node-esm", Command: []string{"node"}, Extensions: []string{".mjs"}},
+	))
+	def, ok = registry.Lookup("node")
+	require.True(t, ok)
+	assert.Equal(t, []string{"/opt/node/bin/node"}, def.Command)
+	name, ok = registry.Infer("script.mjs")
+	require.True(t, ok)
+	assert.Equal(t, "node-esm", name)
+}
+
+func TestRegistryRegisterErrors(t *testing.T) {
+	registry := NewRegistry()
+
+	err := registry.Register(
+		Definition{Name: "node", Command: []string{"node"}},
+		Definition{Name: "node", Command: []string{"nodejs"}},
+	)
+	require.Error(t, err)
+	assert.Equal(t, "duplicate executor name: node", err.Error())
+
+	err = registry.Register(
+		Definition{Name: "perl", Command: []string{"perl"}},
+		Definition{Name: "broken"},
+	)
+	require.Error(t, err)
+	assert.Equal(t, `invalid executor "broken": executor command must not be empty`, err.Error())
+
+	// nothing is registered if any definition is invalid
+	_, ok := registry.Lookup("perl")
+	assert.False(t, ok)
+}
+
+func TestNilRegistry(t *testing.T) {
+	var registry *Registry
+	_, ok := registry.Lookup("node")
+	assert.False(t, ok)
+	_, ok = registry.Infer("script.js")
+	assert.False(t, ok)
+}
@@ -0,0 +1,393 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+// Package expressions implements the small boolean expression
+// language used by the `if:` field of TTP steps.
+//
+// Expressions compare literals and variable references, for example:
+//
+//	$forge.steps.discover.outputs.count > 0 && $forge.platform.os == "linux"
+//
+// Supported syntax:
+//
+//   - string literals in single or double quotes, numbers, true and false
+//   - variable references starting with `$` (resolved by the caller)
+//   - comparisons: == != < <= > >=
+//   - regular expression matching: =~ !~
+//   - substring matching: contains
+//   - boolean logic: && || ! and parentheses
+//
+// Values are strings. Two values are compared as numbers if both of
+// them are numeric and as strings otherwise. A value standing on its own
+// is true unless it is empty, "false", or "0".
+package expressions
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Resolver returns the value of a variable reference
+// such as `$forge.steps.foo.stdout`. Trailing whitespace,
+// such as the newline that ends the output of most commands,
+// is removed from the resolved value.
+type Resolver func(variable string) (string, error)
+
+// Evaluate parses the provided expression and evaluates it,
+// using resolve to look up the values of variable references.
+//
+// **Parameters:**
+//
+// exprStr: the expression to evaluate
+// resolve: looks up the value of each variable reference in the expression
+//
+// **Returns:**
+//
+// bool: the result of the expression
+// error: an error if the expression is malformed or a variable cannot be resolved
+func Evaluate(exprStr string, resolve Resolver) (bool, error) {
+	tokens, err := tokenize(exprStr)
+	if err != nil {
+		return false, err
+	}
+	p := &parser{tokens: tokens, resolve: resolve}
+	val, err := p.parseOr()
+	if err != nil {
+		return false, err
+	}
+	if !p.atEnd() {
+		return false, fmt.Errorf("unexpected %q in expression %q", p.peek().text, exprStr)
+	}
+	return val.truthy(), nil
+}
+
+// Validate checks that the provided expression is well-formed
+// without resolving any of its variable references.
+func Validate(exprStr string) error {
+	_, err := Evaluate(exprStr, func(string) (string, error) {
+		return "", nil
+	})
+	return err
+}
+
+type tokenKind int
+
+const (
+	tokenString tokenKind = iota
+	tokenNumber
+	tokenBool
+	tokenVariable
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// operators are ordered so that longer operators are matched first
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!"}
+
+func tokenize(exprStr string) ([]token, error) {
+	var tokens []token
+	runes := []rune(exprStr)
+	for pos := 0; pos < len(runes); {
+		r := runes[pos]
+		switch {
+		case unicode.IsSpace(r):
+			pos++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLeftParen, text: "("})
+			pos++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRightParen, text: ")"})
+			pos++
+		case r == '"' || r == '\'':
+			str, next, err := readString(runes, pos)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokenString, text: str})
+			pos = next
+		case r == '$':
+			end := pos + 1
+			for end < len(runes) && isVariableRune(runes[end]) {
+				end++
+			}
+			if end == pos+1 {
+				return nil, fmt.Errorf("empty variable reference at position %d", pos)
+			}
+			tokens = append(tokens, token{kind: tokenVariable, text: string(runes[pos:end])})
+			pos = end
+		case unicode.IsDigit(r) || (r == '-' && pos+1 < len(runes) && unicode.IsDigit(runes[pos+1])):
+			end := pos + 1
+			for end < len(runes) && (unicode.IsDigit(runes[end]) || runes[end] == '.') {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: string(runes[pos:end])})
+			pos = end
+		case unicode.IsLetter(r):
+			end := pos + 1
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_') {
+				end++
+			}
+			word := string(runes[pos:end])
+			switch word {
+			case "true", "false":
+				tokens = append(tokens, token{kind: tokenBool, text: word})
+			case "contains":
+				tokens = append(tokens, token{kind: tokenOperator, text: word})
+			default:
+				return nil, fmt.Errorf("unexpected word %q in expression - string literals must be quoted", word)
+			}
+			pos = end
+		default:
+			var matched string
+			for _, op := range operators {
+				if strings.HasPrefix(string(runes[pos:]), op) {
+					matched = op
+					break
+				}
+			}
+			if matched == "" {
+				return nil, fmt.Errorf("unexpected character %q at position %d", r, pos)
+			}
+			tokens = append(tokens, token{kind: tokenOperator, text: matched})
+			pos += len([]rune(matched))
+		}
+	}
+	return tokens, nil
+}
+
+func isVariableRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.' || r == '[' || r == ']'
+}
+
+// readString reads a quoted string literal starting at pos
+// and returns its unescaped contents along with the position
+// of the first rune after the closing quote
+func readString(runes []rune, pos int) (string, int, error) {
+	quote := runes[pos]
+	var sb strings.Builder
+	for cur := pos + 1; cur < len(runes); cur++ {
+		switch runes[cur] {
+		case '\\':
+			if cur+1 >= len(runes) {
+				return "", 0, fmt.Errorf("unterminated string literal starting at position %d", pos)
+			}
+			cur++
+			sb.WriteRune(runes[cur])
+		case quote:
+			return sb.String(), cur + 1, nil
+		default:
+			sb.WriteRune(runes[cur])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string literal starting at position %d", pos)
+}
+
+type value string
+
+func boolValue(b bool) value {
+	return value(strconv.FormatBool(b))
+}
+
+func (v value) truthy() bool {
+	switch v {
+	case "", "false", "0":
+		return false
+	default:
+		return true
+	}
+}
+
+type parser struct {
+	tokens  []token
+	pos     int
+	resolve Resolver
+}
+
+func (p *parser) atEnd() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) acceptOperator(ops ...string) (string, bool) {
+	if p.atEnd() || p.peek().kind != tokenOperator {
+		return "", false
+	}
+	for _, op := range ops {
+		if p.peek().text == op {
+			p.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+// note that both sides of && and || are always evaluated so
+// that typos in variable references are reported consistently
+func (p *parser) parseOr() (value, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, ok := p.acceptOperator("||"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return "", err
+		}
+		left = boolValue(left.truthy() || right.truthy())
+	}
+}
+
+func (p *parser) parseAnd() (value, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, ok := p.acceptOperator("&&"); !ok {
+			return left, nil
+		}
+		right, err := p.parseNot()
+		if err != nil {
+			return "", err
+		}
+		left = boolValue(left.truthy() && right.truthy())
+	}
+}
+
+func (p *parser) parseNot() (value, error) {
+	if _, ok := p.acceptOperator("!"); ok {
+		operand, err := p.parseNot()
+		if err != nil {
+			return "", err
+		}
+		return boolValue(!operand.truthy()), nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (value, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return "", err
+	}
+	op, ok := p.acceptOperator("==", "!=", "<", "<=", ">", ">=", "=~", "!~", "contains")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseOperand()
+	if err != nil {
+		return "", err
+	}
+	result, err := compare(op, left, right)
+	if err != nil {
+		return "", err
+	}
+	return boolValue(result), nil
+}
+
+func (p *parser) parseOperand() (value, error) {
+	if p.atEnd() {
+		return "", fmt.Errorf("unexpected end of expression")
+	}
+	tok := p.peek()
+	p.pos++
+	switch tok.kind {
+	case tokenString, tokenNumber, tokenBool:
+		return value(tok.text), nil
+	case tokenVariable:
+		resolved, err := p.resolve(tok.text)
+		if err != nil {
+			return "", err
+		}
+		// so that `echo ok` produces "ok" and `echo false` is falsy
+		return value(strings.TrimRight(resolved, " \t\r\n")), nil
+	case tokenLeftParen:
+		inner, err := p.parseOr()
+		if err != nil {
+			return "", err
+		}
+		if p.atEnd() || p.peek().kind != tokenRightParen {
+			return "", fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return inner, nil
+	default:
+		return "", fmt.Errorf("unexpected %q in expression", tok.text)
+	}
+}
+
+func compare(op string, left, right value) (bool, error) {
+	switch op {
+	case "=~", "!~":
+		re, err := regexp.Compile(string(right))
+		if err != nil {
+			return false, fmt.Errorf("invalid regular expression %q: %w", right, err)
+		}
+		matched := re.MatchString(string(left))
+		return matched == (op == "=~"), nil
+	case "contains":
+		return strings.Contains(string(left), string(right)), nil
+	}
+
+	// compare numerically when possible, so that "10" > "9"
+	var cmp int
+	leftNum, leftErr := strconv.ParseFloat(strings.TrimSpace(string(left)), 64)
+	rightNum, rightErr := strconv.ParseFloat(strings.TrimSpace(string(right)), 64)
+	if leftErr == nil && rightErr == nil {
+		switch {
+		case leftNum < rightNum:
+			cmp = -1
+		case leftNum > rightNum:
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(string(left), string(right))
+	}
+
+	switch op {
+	case "==":
+		return cmp == 0, nil
+	case "!=":
+		return cmp != 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case ">=":
+		return cmp >= 0, nil
+	}
+	return false, fmt.Errorf("unsupported operator %q", op)
+}
@@ -0,0 +1,179 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package expressions
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluate(t *testing.T) {
+	variables := map[string]string{
+		"$forge.steps.discover.stdout":        "root\nalice\n",
+		"$forge.steps.discover.outputs.count": "10",
+		"$forge.platform.os":                  "linux",
+		"$forge.args.enabled":                 "true",
+		"$forge.args.empty":                   "",
+		"$forge.steps.check.stdout":           "ok\n",
+		"$forge.steps.disabled.stdout":        "false\n",
+		"$forge.steps.count.stdout":           "0\r\n",
+	}
+	resolve := func(variable string) (string, error) {
+		val, ok := variables[variable]
+		if !ok {
+			return "", fmt.Errorf("unknown variable %v", variable)
+		}
+		return val, nil
+	}
+
+	testCases := []struct {
+		name       string
+		expression string
+		expected   bool
+		wantError  bool
+	}{
+		{
+			name:       "Stdout Equality Ignores Trailing Newline",
+			expression: `$forge.steps.check.stdout == "ok"`,
+			expected:   true,
+		},
+		{
+			name:       "Stdout Of False Is Falsy",
+			expression: `$forge.steps.disabled.stdout`,
+			expected:   false,
+		},
+		{
+			name:       "Stdout Of Zero Is Falsy",
+			expression: `$forge.steps.count.stdout || $forge.args.empty`,
+			expected:   false,
+		},
+		{
+			name:       "Trailing Newline Of Multi-Line Stdout Is Removed",
+			expression: `$forge.steps.discover.stdout =~ "alice$"`,
+			expected:   true,
+		},
+		{
+			name:       "String Equality",
+			expression: `$forge.platform.os == "linux"`,
+			expected:   true,
+		},
+		{
+			name:       "String Inequality With Single Quotes",
+			expression: `$forge.platform.os != 'darwin'`,
+			expected:   true,
+		},
+		{
+			name:       "Numeric Comparison",
+			expression: `$forge.steps.discover.outputs.count > 9`,
+			expected:   true,
+		},
+		{
+			name:       "Numeric Comparison Is Not Lexicographic",
+			expression: `$forge.steps.discover.outputs.count < 9`,
+			expected:   false,
+		},
+		{
+			name:       "Contains",
+			expression: `$forge.steps.discover.stdout contains "alice"`,
+			expected:   true,
+		},
+		{
+			name:       "Regexp Match",
+			expression: `$forge.steps.discover.stdout =~ "(?m)^root$"`,
+			expected:   true,
+		},
+		{
+			name:       "Regexp Non-Match",
+			expression: `$forge.steps.discover.stdout !~ "bob"`,
+			expected:   true,
+		},
+		{
+			name:       "Bare Variable Truthiness",
+			expression: `$forge.args.enabled`,
+			expected:   true,
+		},
+		{
+			name:       "Empty Variable Is False",
+			expression: `$forge.args.empty`,
+			expected:   false,
+		},
+		{
+			name:       "Boolean Logic With Parentheses",
+			expression: `!($forge.platform.os == "darwin" || $forge.args.empty) && true`,
+			expected:   true,
+		},
+		{
+			name:       "And Binds Tighter Than Or",
+			expression: `true || false && false`,
+			expected:   true,
+		},
+		{
+			name:       "Unknown Variable",
+			expression: `$forge.steps.nope.stdout == "x"`,
+			wantError:  true,
+		},
+		{
+			name:       "Unquoted String",
+			expression: `$forge.platform.os == linux`,
+			wantError:  true,
+		},
+		{
+			name:       "Unterminated String",
+			expression: `$forge.platform.os == "linux`,
+			wantError:  true,
+		},
+		{
+			name:       "Missing Parenthesis",
+			expression: `($forge.platform.os == "linux"`,
+			wantError:  true,
+		},
+		{
+			name:       "Trailing Tokens",
+			expression: `true false`,
+			wantError:  true,
+		},
+		{
+			name:       "Invalid Regexp",
+			expression: `$forge.platform.os =~ "("`,
+			wantError:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := Evaluate(tc.expression, resolve)
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, Validate(`$forge.steps.a.stdout contains "x" || !$forge.args.b`))
+	require.Error(t, Validate(`$forge.steps.a.stdout ==`))
+	require.Error(t, Validate(`$forge.steps.a.stdout =~ "["`))
+}
@@ -0,0 +1,351 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package outputs
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/tidwall/gjson"
+	"gopkg.in/yaml.v3"
+)
+
+// filterType describes how a filter is
+// identified and configured in YAML
+type filterType struct {
+	newFilter func() Filter
+	// options lists the fields that may accompany
+	// the field that identifies the filter type
+	options []string
+}
+
+// filterTypes maps the field that identifies
+// each filter type to its description
+var filterTypes = map[string]filterType{
+	"json_path":     {newFilter: func() Filter { return &JSONFilter{} }},
+	"yaml_path":     {newFilter: func() Filter { return &YAMLFilter{} }},
+	"regex":         {newFilter: func() Filter { return &RegexFilter{} }, options: []string{"group"}},
+	"line":          {newFilter: func() Filter { return &LineFilter{} }},
+	"lines":         {newFilter: func() Filter { return &LinesFilter{} }},
+	"split":         {newFilter: func() Filter { return &SplitFilter{} }, options: []string{"index"}},
+	"trim":          {newFilter: func() Filter { return &TrimFilter{} }},
+	"base64_decode": {newFilter: func() Filter { return &Base64DecodeFilter{} }},
+}
+
+// validator is implemented by filters whose
+// configuration must be checked once decoded
+type validator interface {
+	validate() error
+}
+
+// YAMLFilter will parse a YAML string and extract the value
+// at the provided path, which uses the same syntax as JSONFilter
+type YAMLFilter struct {
+	Path string `yaml:"yaml_path"`
+}
+
+// Apply applies this filter to the target string
+// and produces a new string
+func (f *YAMLFilter) Apply(inStr string) (string, error) {
+	result, err := f.lookup(inStr)
+	if err != nil {
+		return "", err
+	}
+	return result.String(), nil
+}
+
+// ApplyValue extracts the value at the path of this filter,
+// keeping its type
+func (f *YAMLFilter) ApplyValue(inStr string) (interface{}, error) {
+	result, err := f.lookup(inStr)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSONValue(result.Raw)
+}
+
+// lookup converts the YAML input to JSON so that
+// the path can be looked up with the same syntax
+func (f *YAMLFilter) lookup(inStr string) (gjson.Result, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal([]byte(inStr), &doc); err != nil {
+		return gjson.Result{}, fmt.Errorf("failed to parse yaml: %w", err)
+	}
+	jsonBytes, err := json.Marshal(normalizeYAML(doc))
+	if err != nil {
+		return gjson.Result{}, fmt.Errorf("failed to convert yaml to json: %w", err)
+	}
+	result := gjson.GetBytes(jsonBytes, f.Path)
+	if !result.Exists() {
+		return gjson.Result{}, fmt.Errorf("yaml path not found: %v", f.Path)
+	}
+	return result, nil
+}
+
+// normalizeYAML converts mappings with non-string keys,
+// which cannot be encoded as JSON, to mappings with string keys
+func normalizeYAML(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, elem := range v {
+			v[key] = normalizeYAML(elem)
+		}
+		return v
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, elem := range v {
+			converted[fmt.Sprint(key)] = normalizeYAML(elem)
+		}
+		return converted
+	case []interface{}:
+		for idx, elem := range v {
+			v[idx] = normalizeYAML(elem)
+		}
+		return v
+	}
+	return value
+}
+
+// RegexFilter extracts the first match of a regular expression.
+// If Group is not set, the first capture group is extracted if the
+// expression has any, and the whole match is extracted otherwise.
+type RegexFilter struct {
+	Pattern string `yaml:"regex"`
+	Group   *int   `yaml:"group,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// validate compiles the expression once, when the filter is decoded
+func (f *RegexFilter) validate() error {
+	re, err := f.compile()
+	if err != nil {
+		return err
+	}
+	f.re = re
+	return nil
+}
+
+func (f *RegexFilter) compile() (*regexp.Regexp, error) {
+	re, err := regexp.Compile(f.Pattern)
+	if err != nil {
+		return nil, err
+	}
+	if f.Group != nil && (*f.Group < 0 || *f.Group > re.NumSubexp()) {
+		return nil, fmt.Errorf("expression %q has no capture group %d", f.Pattern, *f.Group)
+	}
+	return re, nil
+}
+
+// Apply applies this filter to the target string
+// and produces a new string. It does not modify the
+// filter, which may be shared by concurrent steps.
+func (f *RegexFilter) Apply(inStr string) (string, error) {
+	re := f.re
+	if re == nil {
+		// filters that were not decoded from YAML
+		var err error
+		if re, err = f.compile(); err != nil {
+			return "", err
+		}
+	}
+	match := re.FindStringSubmatch(inStr)
+	if match == nil {
+		return "", fmt.Errorf("regex %q did not match", f.Pattern)
+	}
+	group := 0
+	if f.Group != nil {
+		group = *f.Group
+	} else if re.NumSubexp() > 0 {
+		group = 1
+	}
+	return match[group], nil
+}
+
+// LineFilter extracts a single line, counting from 1.
+// Negative line numbers count from the last line,
+// so -1 extracts the last line.
+type LineFilter struct {
+	Line int `yaml:"line"`
+}
+
+func (f *LineFilter) validate() error {
+	if f.Line == 0 {
+		return errors.New("line numbers start at 1")
+	}
+	return nil
+}
+
+// Apply applies this filter to the target string
+// and produces a new string
+func (f *LineFilter) Apply(inStr string) (string, error) {
+	lines := splitLines(inStr)
+	idx := f.Line - 1
+	if f.Line < 0 {
+		idx = len(lines) + f.Line
+	}
+	if idx < 0 || idx >= len(lines) {
+		return "", fmt.Errorf("line %d is out of range (the input has %d lines)", f.Line, len(lines))
+	}
+	return lines[idx], nil
+}
+
+// LinesFilter extracts a range of lines such as "2-5", counting
+// from 1 and including both ends. The end of the range may be
+// omitted ("2-") to extract every line from the start onwards.
+type LinesFilter struct {
+	Range string `yaml:"lines"`
+
+	start int
+	end   int
+}
+
+// validate parses the range once, when the filter is decoded
+func (f *LinesFilter) validate() error {
+	start, end, err := f.parse()
+	if err != nil {
+		return err
+	}
+	f.start = start
+	f.end = end
+	return nil
+}
+
+func (f *LinesFilter) parse() (int, int, error) {
+	startStr, endStr, found := strings.Cut(f.Range, "-")
+	if !found {
+		return 0, 0, fmt.Errorf("line range %q should look like 2-5 or 2-", f.Range)
+	}
+	start, err := strconv.Atoi(strings.TrimSpace(startStr))
+	if err != nil || start < 1 {
+		return 0, 0, fmt.Errorf("line range %q should start at a line number of at least 1", f.Range)
+	}
+	end := -1
+	if endStr = strings.TrimSpace(endStr); endStr != "" {
+		end, err = strconv.Atoi(endStr)
+		if err != nil || end < start {
+			return 0, 0, fmt.Errorf("line range %q should end at a line number of at least %d", f.Range, start)
+		}
+	}
+	return start, end, nil
+}
+
+// Apply applies this filter to the target string
+// and produces a new string. It does not modify the
+// filter, which may be shared by concurrent steps.
+func (f *LinesFilter) Apply(inStr string) (string, error) {
+	start, end := f.start, f.end
+	if start == 0 {
+		// filters that were not decoded from YAML
+		var err error
+		if start, end, err = f.parse(); err != nil {
+			return "", err
+		}
+	}
+	lines := splitLines(inStr)
+	if start > len(lines) {
+		return "", fmt.Errorf("line range %q is out of range (the input has %d lines)", f.Range, len(lines))
+	}
+	if end < 0 || end > len(lines) {
+		end = len(lines)
+	}
+	return strings.Join(lines[start-1:end], "\n"), nil
+}
+
+// splitLines splits a string into lines, ignoring the
+// trailing newline that most commands print
+func splitLines(inStr string) []string {
+	inStr = strings.TrimSuffix(inStr, "\n")
+	if inStr == "" {
+		return nil
+	}
+	lines := strings.Split(inStr, "\n")
+	for idx, line := range lines {
+		lines[idx] = strings.TrimSuffix(line, "\r")
+	}
+	return lines
+}
+
+// SplitFilter splits a string at every occurrence of a separator
+// and extracts the field at the provided index, counting from 0.
+// Negative indices count from the last field, so -1 extracts the last field.
+type SplitFilter struct {
+	Separator string `yaml:"split"`
+	Index     int    `yaml:"index"`
+}
+
+func (f *SplitFilter) validate() error {
+	if f.Separator == "" {
+		return errors.New("separator must not be empty")
+	}
+	return nil
+}
+
+// Apply applies this filter to the target string
+// and produces a new string
+func (f *SplitFilter) Apply(inStr string) (string, error) {
+	fields := strings.Split(inStr, f.Separator)
+	idx := f.Index
+	if idx < 0 {
+		idx += len(fields)
+	}
+	if idx < 0 || idx >= len(fields) {
+		return "", fmt.Errorf("index %d is out of range (the input has %d fields)", f.Index, len(fields))
+	}
+	return fields[idx], nil
+}
+
+// TrimFilter removes leading and trailing whitespace
+type TrimFilter struct {
+	Trim bool `yaml:"trim"`
+}
+
+// Apply applies this filter to the target string
+// and produces a new string
+func (f *TrimFilter) Apply(inStr string) (string, error) {
+	if !f.Trim {
+		return inStr, nil
+	}
+	return strings.TrimSpace(inStr), nil
+}
+
+// Base64DecodeFilter decodes a base64-encoded string.
+// Surrounding whitespace is ignored.
+type Base64DecodeFilter struct {
+	Decode bool `yaml:"base64_decode"`
+}
+
+// Apply applies this filter to the target string
+// and produces a new string
+func (f *Base64DecodeFilter) Apply(inStr string) (string, error) {
+	if !f.Decode {
+		return inStr, nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(inStr))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode base64: %w", err)
+	}
+	return string(decoded), nil
+}
@@ -0,0 +1,304 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package outputs
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestFilters(t *testing.T) {
+	testCases := []struct {
+		name           string
+		input          string
+		spec           string
+		result         string
+		wantApplyError bool
+	}{
+		{
+			name:  "YAML Path",
+			input: "user:\n  name: alice\n  groups:\n    - wheel\n    - staff\n",
+			spec: `filters:
+  - yaml_path: user.groups.1`,
+			result: "staff",
+		},
+		{
+			name:  "YAML Path Not Found",
+			input: "user:\n  name: alice\n",
+			spec: `filters:
+  - yaml_path: user.uid`,
+			wantApplyError: true,
+		},
+		{
+			name:  "YAML Path With Non-String Keys",
+			input: "ports:\n  22: ssh\n  80: http\n",
+			spec: `filters:
+  - yaml_path: ports.80`,
+			result: "http",
+		},
+		{
+			name:  "Regex With Capture Group",
+			input: "started beacon with pid=4242 at 10:00\n",
+			spec: `filters:
+  - regex: 'pid=(\d+)'`,
+			result: "4242",
+		},
+		{
+			name:  "Regex Without Capture Group",
+			input: "token: abc123\n",
+			spec: `filters:
+  - regex: '[a-z]+\d+'`,
+			result: "abc123",
+		},
+		{
+			name:  "Regex With Explicit Group",
+			input: "user=alice uid=501\n",
+			spec: `filters:
+  - regex: 'user=(\w+) uid=(\d+)'
+    group: 2`,
+			result: "501",
+		},
+		{
+			name:  "Regex Does Not Match",
+			input: "nothing to see here",
+			spec: `filters:
+  - regex: 'pid=(\d+)'`,
+			wantApplyError: true,
+		},
+		{
+			name:  "Line",
+			input: "first\nsecond\nthird\n",
+			spec: `filters:
+  - line: 2`,
+			result: "second",
+		},
+		{
+			name:  "Last Line",
+			input: "first\r\nsecond\r\nthird\r\n",
+			spec: `filters:
+  - line: -1`,
+			result: "third",
+		},
+		{
+			name:  "Line Out Of Range",
+			input: "first\nsecond\n",
+			spec: `filters:
+  - line: 3`,
+			wantApplyError: true,
+		},
+		{
+			name:  "Lines",
+			input: "first\nsecond\nthird\nfourth\n",
+			spec: `filters:
+  - lines: 2-3`,
+			result: "second\nthird",
+		},
+		{
+			name:  "Lines Until End",
+			input: "first\nsecond\nthird\n",
+			spec: `filters:
+  - lines: 2-`,
+			result: "second\nthird",
+		},
+		{
+			name:  "Lines Out Of Range",
+			input: "first\n",
+			spec: `filters:
+  - lines: 2-3`,
+			wantApplyError: true,
+		},
+		{
+			name:  "Split",
+			input: "root:x:0:0:root:/root:/bin/bash",
+			spec: `filters:
+  - split: ":"
+    index: 5`,
+			result: "/root",
+		},
+		{
+			name:  "Split Negative Index",
+			input: "a,b,c",
+			spec: `filters:
+  - split: ","
+    index: -1`,
+			result: "c",
+		},
+		{
+			name:  "Split Index Out Of Range",
+			input: "a,b,c",
+			spec: `filters:
+  - split: ","
+    index: 3`,
+			wantApplyError: true,
+		},
+		{
+			name:  "Trim",
+			input: "  padded value \n",
+			spec: `filters:
+  - trim: true`,
+			result: "padded value",
+		},
+		{
+			name:  "Base64 Decode",
+			input: "aGVsbG8gd29ybGQ=\n",
+			spec: `filters:
+  - base64_decode: true`,
+			result: "hello world",
+		},
+		{
+			name:  "Invalid Base64",
+			input: "not base64!",
+			spec: `filters:
+  - base64_decode: true`,
+			wantApplyError: true,
+		},
+		{
+			name:  "Chained Filters",
+			input: "header\nuser=alice token=aGVsbG8=\nfooter\n",
+			spec: `filters:
+  - line: 2
+  - split: " "
+    index: 1
+  - regex: 'token=(.*)'
+  - base64_decode: true`,
+			result: "hello",
+		},
+		{
+			name:  "JSON Then Trim",
+			input: `{"path":"  /tmp/payload  "}`,
+			spec: `filters:
+  - json_path: path
+  - trim: true`,
+			result: "/tmp/payload",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var spec Spec
+			err := yaml.Unmarshal([]byte(tc.spec), &spec)
+			require.NoError(t, err)
+
+			result, err := spec.Apply(tc.input)
+			if tc.wantApplyError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.result, result)
+		})
+	}
+}
+
+func TestFilterUnmarshalErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		spec string
+	}{
+		{
+			name: "Unknown Filter Type",
+			spec: `filters:
+  - xpath: /foo`,
+		},
+		{
+			name: "Ambiguous Filter Type",
+			spec: `filters:
+  - json_path: foo
+    regex: bar`,
+		},
+		{
+			name: "Option Of Another Filter Type",
+			spec: `filters:
+  - json_path: foo
+    group: 1`,
+		},
+		{
+			name: "Invalid Regex",
+			spec: `filters:
+  - regex: '(unclosed'`,
+		},
+		{
+			name: "Missing Capture Group",
+			spec: `filters:
+  - regex: 'pid=(\d+)'
+    group: 2`,
+		},
+		{
+			name: "Line Zero",
+			spec: `filters:
+  - line: 0`,
+		},
+		{
+			name: "Invalid Line Range",
+			spec: `filters:
+  - lines: 5-2`,
+		},
+		{
+			name: "Line Range Without Separator",
+			spec: `filters:
+  - lines: "5"`,
+		},
+		{
+			name: "Empty Separator",
+			spec: `filters:
+  - split: ""`,
+		},
+		{
+			name: "No Filters",
+			spec: `filters: []`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var spec Spec
+			err := yaml.Unmarshal([]byte(tc.spec), &spec)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestFiltersAreSafeForConcurrentUse(t *testing.T) {
+	group := 1
+	// filters built in code are not validated up front
+	filters := []Filter{
+		&RegexFilter{Pattern: `pid=(\d+)`, Group: &group},
+		&LinesFilter{Range: "2-"},
+	}
+	expected := []string{"42", "pid=42\nend"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx, filter := range filters {
+				result, err := filter.Apply("start\npid=42\nend\n")
+				assert.NoError(t, err)
+				assert.Equal(t, expected[idx], result)
+			}
+		}()
+	}
+	wg.Wait()
+}
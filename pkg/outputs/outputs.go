@@ -20,8 +20,11 @@ THE SOFTWARE.
 package outputs
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/tidwall/gjson"
 	"gopkg.in/yaml.v3"
@@ -37,16 +40,16 @@ import (
 //
 // **Returns:**
 //
-// map[string]string: the output keys and values
+// map[string]interface{}: the output keys and values
 // error: an error if there is a problem
-func Parse(specs map[string]Spec, inStr string) (map[string]string, error) {
-	outputs := make(map[string]string)
+func Parse(specs map[string]Spec, inStr string) (map[string]interface{}, error) {
+	outputs := make(map[string]interface{})
 	for name, spec := range specs {
-		outStr, err := spec.Apply(inStr)
+		outVal, err := spec.Value(inStr)
 		if err != nil {
 			return nil, err
 		}
-		outputs[name] = outStr
+		outputs[name] = outVal
 	}
 	return outputs, nil
 }
@@ -63,6 +66,34 @@ type Filter interface {
 	Apply(inStr string) (string, error)
 }
 
+// ValueFilter is implemented by filters that extract structured
+// data. If such a filter is the last filter of a spec, the output
+// keeps the type of the extracted value (such as a list or number).
+type ValueFilter interface {
+	Filter
+	ApplyValue(inStr string) (interface{}, error)
+}
+
+// Value applies all filters in this output spec to the target string
+// in order. The result is a string unless the last filter is a
+// ValueFilter, in which case the extracted value keeps its type.
+func (s *Spec) Value(inStr string) (interface{}, error) {
+	if len(s.Filters) == 0 {
+		return inStr, nil
+	}
+	last := len(s.Filters) - 1
+	valueFilter, ok := s.Filters[last].(ValueFilter)
+	if !ok {
+		return s.Apply(inStr)
+	}
+	head := Spec{Filters: s.Filters[:last]}
+	curStr, err := head.Apply(inStr)
+	if err != nil {
+		return nil, err
+	}
+	return valueFilter.ApplyValue(curStr)
+}
+
 // Apply applies all filters in this output spec
 // to the target string in order, producing a new string
 func (s *Spec) Apply(inStr string) (string, error) {
@@ -95,18 +126,12 @@ func (s *Spec) UnmarshalYAML(node *yaml.Node) error {
 	}
 
 	var filters []Filter
-	for _, fn := range tmp.FilterNodes {
-		filterTypes := []Filter{&JSONFilter{}}
-		var alreadyFound bool
-		for _, ft := range filterTypes {
-			if err := fn.Decode(ft); err == nil {
-				if alreadyFound {
-					return errors.New("output spec contains filter with ambiguous type")
-				}
-				filters = append(filters, ft)
-				alreadyFound = true
-			}
+	for idx := range tmp.FilterNodes {
+		filter, err := decodeFilter(&tmp.FilterNodes[idx])
+		if err != nil {
+			return fmt.Errorf("invalid filter #%d in output spec: %w", idx+1, err)
 		}
+		filters = append(filters, filter)
 	}
 	if len(filters) == 0 {
 		return errors.New("no valid filters found in output spec")
@@ -115,6 +140,47 @@ func (s *Spec) UnmarshalYAML(node *yaml.Node) error {
 	return nil
 }
 
+// decodeFilter determines the type of a filter from the
+// key that identifies it and decodes the filter
+func decodeFilter(node *yaml.Node) (Filter, error) {
+	var fields map[string]yaml.Node
+	if err := node.Decode(&fields); err != nil {
+		return nil, err
+	}
+
+	var typeKey string
+	for key := range fields {
+		if _, ok := filterTypes[key]; !ok {
+			continue
+		}
+		if typeKey != "" {
+			return nil, errors.New("filter has ambiguous type")
+		}
+		typeKey = key
+	}
+	if typeKey == "" {
+		return nil, errors.New("filter has no known type")
+	}
+
+	ft := filterTypes[typeKey]
+	for key := range fields {
+		if key != typeKey && !slices.Contains(ft.options, key) {
+			return nil, fmt.Errorf("unexpected field %q in %v filter", key, typeKey)
+		}
+	}
+
+	filter := ft.newFilter()
+	if err := node.Decode(filter); err != nil {
+		return nil, err
+	}
+	if v, ok := filter.(validator); ok {
+		if err := v.validate(); err != nil {
+			return nil, fmt.Errorf("invalid %v filter: %w", typeKey, err)
+		}
+	}
+	return filter, nil
+}
+
 // Apply applies this filters to the target string
 // and produces a new string
 func (f *JSONFilter) Apply(inStr string) (string, error) {
@@ -124,3 +190,25 @@ func (f *JSONFilter) Apply(inStr string) (string, error) {
 	}
 	return result.String(), nil
 }
+
+// ApplyValue extracts the value at the path of this filter,
+// keeping its JSON type
+func (f *JSONFilter) ApplyValue(inStr string) (interface{}, error) {
+	result := gjson.Get(inStr, f.Path)
+	if !result.Exists() {
+		return nil, fmt.Errorf("json path not found: %v", f.Path)
+	}
+	return decodeJSONValue(result.Raw)
+}
+
+// decodeJSONValue decodes a JSON value, keeping numbers
+// as json.Number so that large integers stay exact
+func decodeJSONValue(raw string) (interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(raw))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
@@ -0,0 +1,161 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package outputs
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// lengthField is the field that yields the number of
+// elements of a list or map, or the length of a string
+const lengthField = "length"
+
+// Lookup resolves a path such as `users[0].name` or `hosts.length`
+// within a structured output value. Path segments are separated by
+// dots and may be followed by any number of list indices in brackets.
+//
+// **Parameters:**
+//
+// value: the value to look up the path in, usually a map of outputs
+// path: the path to look up
+//
+// **Returns:**
+//
+// interface{}: the value at the path
+// error: an error if the path does not exist in the value
+func Lookup(value interface{}, path string) (interface{}, error) {
+	cur := value
+	for _, segment := range strings.Split(path, ".") {
+		name, indices, err := parseSegment(segment)
+		if err != nil {
+			return nil, err
+		}
+		if name != "" {
+			if cur, err = lookupField(cur, name); err != nil {
+				return nil, err
+			}
+		}
+		for _, idx := range indices {
+			if cur, err = lookupIndex(cur, idx); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return cur, nil
+}
+
+// parseSegment splits a path segment such as `users[0][1]`
+// into its field name and list indices
+func parseSegment(segment string) (string, []int, error) {
+	name, rest, _ := strings.Cut(segment, "[")
+	if rest == "" {
+		if strings.Contains(segment, "]") || strings.HasSuffix(segment, "[") {
+			return "", nil, fmt.Errorf("invalid path segment %q", segment)
+		}
+		return name, nil, nil
+	}
+	var indices []int
+	for _, indexStr := range strings.Split(strings.TrimSuffix(rest, "]"), "][") {
+		idx, err := strconv.Atoi(indexStr)
+		if err != nil || !strings.HasSuffix(rest, "]") {
+			return "", nil, fmt.Errorf("invalid list index in path segment %q", segment)
+		}
+		indices = append(indices, idx)
+	}
+	return name, indices, nil
+}
+
+func lookupField(value interface{}, name string) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		// a field that is actually called length takes precedence
+		if elem, ok := v[name]; ok {
+			return elem, nil
+		}
+		if name == lengthField {
+			return len(v), nil
+		}
+		return nil, fmt.Errorf("key %v not found", name)
+	case []interface{}:
+		if name == lengthField {
+			return len(v), nil
+		}
+	case string:
+		if name == lengthField {
+			return utf8.RuneCountInString(v), nil
+		}
+	}
+	return nil, fmt.Errorf("cannot look up key %v in %v value", name, typeName(value))
+}
+
+func lookupIndex(value interface{}, idx int) (interface{}, error) {
+	list, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot index into %v value", typeName(value))
+	}
+	pos := idx
+	if pos < 0 {
+		pos += len(list)
+	}
+	if pos < 0 || pos >= len(list) {
+		return nil, fmt.Errorf("index %d is out of range (the list has %d elements)", idx, len(list))
+	}
+	return list[pos], nil
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "map"
+	case []interface{}:
+		return "list"
+	case string:
+		return "string"
+	case nil:
+		return "null"
+	}
+	return "scalar"
+}
+
+// FormatValue converts an output value to the string that
+// is substituted for references to it. Lists and maps are
+// formatted as JSON and null is formatted as an empty string.
+func FormatValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	case float64:
+		// avoid the exponent notation that fmt uses for large numbers
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case map[string]interface{}, []interface{}:
+		formatted, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(formatted)
+	}
+	return fmt.Sprint(value)
+}
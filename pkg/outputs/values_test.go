@@ -0,0 +1,240 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package outputs
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestLookup(t *testing.T) {
+	values := map[string]interface{}{
+		"users": []interface{}{
+			map[string]interface{}{"name": "alice", "uid": json.Number("501")},
+			map[string]interface{}{"name": "bob", "uid": json.Number("502")},
+		},
+		"matrix": []interface{}{
+			[]interface{}{"a", "b"},
+			[]interface{}{"c", "d"},
+		},
+		"config": map[string]interface{}{
+			"length": "custom",
+		},
+		"token": "s3cr3t",
+	}
+
+	testCases := []struct {
+		name      string
+		path      string
+		expected  interface{}
+		wantError bool
+	}{
+		{
+			name:     "Top-Level Value",
+			path:     "token",
+			expected: "s3cr3t",
+		},
+		{
+			name:     "List Index And Field",
+			path:     "users[1].name",
+			expected: "bob",
+		},
+		{
+			name:     "Negative List Index",
+			path:     "users[-1].uid",
+			expected: json.Number("502"),
+		},
+		{
+			name:     "Nested List Indices",
+			path:     "matrix[1][0]",
+			expected: "c",
+		},
+		{
+			name:     "List Length",
+			path:     "users.length",
+			expected: 2,
+		},
+		{
+			name:     "String Length",
+			path:     "token.length",
+			expected: 6,
+		},
+		{
+			name:     "Field Named Length",
+			path:     "config.length",
+			expected: "custom",
+		},
+		{
+			name:      "Missing Output",
+			path:      "hosts",
+			wantError: true,
+		},
+		{
+			name:      "Index Out Of Range",
+			path:      "users[2]",
+			wantError: true,
+		},
+		{
+			name:      "Index Into Map",
+			path:      "config[0]",
+			wantError: true,
+		},
+		{
+			name:      "Field Of String",
+			path:      "token.value",
+			wantError: true,
+		},
+		{
+			name:      "Invalid Index",
+			path:      "users[first]",
+			wantError: true,
+		},
+		{
+			name:      "Unterminated Index",
+			path:      "users[0",
+			wantError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := Lookup(values, tc.path)
+			if tc.wantError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	testCases := []struct {
+		name     string
+		value    interface{}
+		expected string
+	}{
+		{
+			name:     "String",
+			value:    "hello",
+			expected: "hello",
+		},
+		{
+			name:     "Exact Number",
+			value:    json.Number("12345678901234567890"),
+			expected: "12345678901234567890",
+		},
+		{
+			name:     "Large Float",
+			value:    float64(1234567),
+			expected: "1234567",
+		},
+		{
+			name:     "Boolean",
+			value:    true,
+			expected: "true",
+		},
+		{
+			name:     "Null",
+			value:    nil,
+			expected: "",
+		},
+		{
+			name:     "List",
+			value:    []interface{}{"a", json.Number("1")},
+			expected: `["a",1]`,
+		},
+		{
+			name:     "Map",
+			value:    map[string]interface{}{"b": "2", "a": json.Number("1")},
+			expected: `{"a":1,"b":"2"}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, FormatValue(tc.value))
+		})
+	}
+}
+
+func TestTypedOutputs(t *testing.T) {
+	input := `{"hosts":["10.0.0.1","10.0.0.2"],"port":8080,"meta":{"ok":true}}`
+	testCases := []struct {
+		name     string
+		spec     string
+		input    string
+		expected interface{}
+	}{
+		{
+			name: "JSON List",
+			spec: `filters:
+  - json_path: hosts`,
+			input:    input,
+			expected: []interface{}{"10.0.0.1", "10.0.0.2"},
+		},
+		{
+			name: "JSON Number",
+			spec: `filters:
+  - json_path: port`,
+			input:    input,
+			expected: json.Number("8080"),
+		},
+		{
+			name: "JSON Map",
+			spec: `filters:
+  - json_path: meta`,
+			input:    input,
+			expected: map[string]interface{}{"ok": true},
+		},
+		{
+			name: "YAML List",
+			spec: `filters:
+  - yaml_path: hosts`,
+			input:    "hosts:\n  - a\n  - b\n",
+			expected: []interface{}{"a", "b"},
+		},
+		{
+			name: "Later Filters Produce Strings",
+			spec: `filters:
+  - json_path: port
+  - trim: true`,
+			input:    input,
+			expected: "8080",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var spec Spec
+			err := yaml.Unmarshal([]byte(tc.spec), &spec)
+			require.NoError(t, err)
+
+			result, err := spec.Value(tc.input)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package platforms
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// osReleasePaths are the standard locations
+// of the os-release file, in order of precedence
+var osReleasePaths = []string{"/etc/os-release", "/usr/lib/os-release"}
+
+// DistroSpec identifies a linux distribution by the ID field of its
+// os-release file (such as ubuntu or fedora), optionally restricting
+// its VERSION_ID with a version constraint such as ">= 20.04".
+type DistroSpec struct {
+	ID      string `yaml:"id"`
+	Version string `yaml:"version,omitempty"`
+}
+
+// Validate checks whether the distribution spec is valid
+func (d *DistroSpec) Validate() error {
+	if d.ID == "" {
+		return errors.New("distro entries must specify an id")
+	}
+	if d.Version != "" {
+		if _, err := ParseVersionConstraint(d.Version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the distribution described by
+// the fields of an os-release file matches this spec
+func (d *DistroSpec) Matches(osRelease map[string]string) (bool, error) {
+	if osRelease["ID"] != d.ID {
+		return false, nil
+	}
+	if d.Version == "" {
+		return true, nil
+	}
+	constraint, err := ParseVersionConstraint(d.Version)
+	if err != nil {
+		return false, err
+	}
+	versionID, ok := osRelease["VERSION_ID"]
+	if !ok {
+		return false, nil
+	}
+	return constraint.Check(versionID)
+}
+
+// String returns a human readable representation of the spec
+func (d *DistroSpec) String() string {
+	if d.Version == "" {
+		return d.ID
+	}
+	return fmt.Sprintf("%v %v", d.ID, d.Version)
+}
+
+// ReadOSRelease reads the fields (such as ID and VERSION_ID)
+// of the os-release file that identifies a linux distribution
+func ReadOSRelease(fsys afero.Fs) (map[string]string, error) {
+	for _, path := range osReleasePaths {
+		contents, err := afero.ReadFile(fsys, path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		return parseOSRelease(contents), nil
+	}
+	return nil, errors.New("could not identify the linux distribution: no os-release file found")
+}
+
+func parseOSRelease(contents []byte) map[string]string {
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `'"`)
+		}
+		fields[key] = value
+	}
+	return fields
+}
@@ -0,0 +1,117 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package platforms
+
+import (
+	"testing"
+
+	"github.com/facebookincubator/ttpforge/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ubuntuOSRelease = `PRETTY_NAME="Ubuntu 22.04.3 LTS"
+NAME="Ubuntu"
+VERSION_ID="22.04"
+# comments are ignored
+ID=ubuntu
+ID_LIKE=debian
+`
+
+func TestReadOSRelease(t *testing.T) {
+	fsys, err := testutils.MakeAferoTestFs(map[string][]byte{
+		"/usr/lib/os-release": []byte(ubuntuOSRelease),
+	})
+	require.NoError(t, err)
+	osRelease, err := ReadOSRelease(fsys)
+	require.NoError(t, err)
+	assert.Equal(t, "ubuntu", osRelease["ID"])
+	assert.Equal(t, "22.04", osRelease["VERSION_ID"])
+	assert.Equal(t, "Ubuntu 22.04.3 LTS", osRelease["PRETTY_NAME"])
+
+	// /etc/os-release takes precedence
+	fsys, err = testutils.MakeAferoTestFs(map[string][]byte{
+		"/etc/os-release":     []byte("ID='fedora'\nVERSION_ID=39\n"),
+		"/usr/lib/os-release": []byte(ubuntuOSRelease),
+	})
+	require.NoError(t, err)
+	osRelease, err = ReadOSRelease(fsys)
+	require.NoError(t, err)
+	assert.Equal(t, "fedora", osRelease["ID"])
+	assert.Equal(t, "39", osRelease["VERSION_ID"])
+
+	fsys, err = testutils.MakeAferoTestFs(map[string][]byte{})
+	require.NoError(t, err)
+	_, err = ReadOSRelease(fsys)
+	assert.Error(t, err)
+}
+
+func TestDistroSpec(t *testing.T) {
+	osRelease := parseOSRelease([]byte(ubuntuOSRelease))
+	testCases := []struct {
+		name                string
+		spec                DistroSpec
+		expectValidateError bool
+		expectedMatch       bool
+	}{
+		{
+			name:          "ID Only",
+			spec:          DistroSpec{ID: "ubuntu"},
+			expectedMatch: true,
+		},
+		{
+			name:          "ID And Version",
+			spec:          DistroSpec{ID: "ubuntu", Version: ">= 20.04"},
+			expectedMatch: true,
+		},
+		{
+			name: "Version Too Old",
+			spec: DistroSpec{ID: "ubuntu", Version: ">= 24.04"},
+		},
+		{
+			name: "ID_LIKE Is Not Matched",
+			spec: DistroSpec{ID: "debian"},
+		},
+		{
+			name:                "Missing ID",
+			spec:                DistroSpec{Version: ">= 1"},
+			expectValidateError: true,
+		},
+		{
+			name:                "Invalid Version Constraint",
+			spec:                DistroSpec{ID: "ubuntu", Version: "latest"},
+			expectValidateError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.spec.Validate()
+			if tc.expectValidateError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			matches, err := tc.spec.Matches(osRelease)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedMatch, matches)
+		})
+	}
+}
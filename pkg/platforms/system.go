@@ -0,0 +1,87 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package platforms
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// kernelReleasePath holds the release of the running linux kernel
+const kernelReleasePath = "/proc/sys/kernel/osrelease"
+
+// procStatusPath describes the current process,
+// including its capability sets
+const procStatusPath = "/proc/self/status"
+
+// KernelRelease returns the release of
+// the running linux kernel, such as "6.5.0-14-generic"
+func KernelRelease(fsys afero.Fs) (string, error) {
+	contents, err := afero.ReadFile(fsys, kernelReleasePath)
+	if err != nil {
+		return "", fmt.Errorf("could not determine the kernel version, which is only supported on linux: %w", err)
+	}
+	return strings.TrimSpace(string(contents)), nil
+}
+
+// capabilityNames lists the linux capabilities, indexed by their number
+var capabilityNames = []string{
+	"chown", "dac_override", "dac_read_search", "fowner", "fsetid", "kill",
+	"setgid", "setuid", "setpcap", "linux_immutable", "net_bind_service",
+	"net_broadcast", "net_admin", "net_raw", "ipc_lock", "ipc_owner",
+	"sys_module", "sys_rawio", "sys_chroot", "sys_ptrace", "sys_pacct",
+	"sys_admin", "sys_boot", "sys_nice", "sys_resource", "sys_time",
+	"sys_tty_config", "mknod", "lease", "audit_write", "audit_control",
+	"setfcap", "mac_override", "mac_admin", "syslog", "wake_alarm",
+	"block_suspend", "audit_read", "perfmon", "bpf", "checkpoint_restore",
+}
+
+// ParseCapability returns the number of a linux capability, which
+// may be written either as CAP_NET_RAW or as net_raw (in any case)
+func ParseCapability(name string) (int, error) {
+	normalized := strings.TrimPrefix(strings.ToLower(name), "cap_")
+	for number, capName := range capabilityNames {
+		if capName == normalized {
+			return number, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown linux capability %q", name)
+}
+
+// EffectiveCapabilities returns the effective capability
+// set of the current process as a bit mask
+func EffectiveCapabilities(fsys afero.Fs) (uint64, error) {
+	contents, err := afero.ReadFile(fsys, procStatusPath)
+	if err != nil {
+		return 0, fmt.Errorf("could not determine capabilities, which are only supported on linux: %w", err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		if value, found := strings.CutPrefix(scanner.Text(), "CapEff:"); found {
+			return strconv.ParseUint(strings.TrimSpace(value), 16, 64)
+		}
+	}
+	return 0, fmt.Errorf("no CapEff entry found in %v", procStatusPath)
+}
@@ -0,0 +1,78 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package platforms
+
+import (
+	"testing"
+
+	"github.com/facebookincubator/ttpforge/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKernelRelease(t *testing.T) {
+	fsys, err := testutils.MakeAferoTestFs(map[string][]byte{
+		"/proc/sys/kernel/osrelease": []byte("6.5.0-14-generic\n"),
+	})
+	require.NoError(t, err)
+	release, err := KernelRelease(fsys)
+	require.NoError(t, err)
+	assert.Equal(t, "6.5.0-14-generic", release)
+
+	fsys, err = testutils.MakeAferoTestFs(map[string][]byte{})
+	require.NoError(t, err)
+	_, err = KernelRelease(fsys)
+	assert.Error(t, err)
+}
+
+func TestParseCapability(t *testing.T) {
+	for _, name := range []string{"CAP_NET_RAW", "cap_net_raw", "net_raw", "NET_RAW"} {
+		number, err := ParseCapability(name)
+		require.NoError(t, err, name)
+		assert.Equal(t, 13, number, name)
+	}
+	number, err := ParseCapability("CAP_CHOWN")
+	require.NoError(t, err)
+	assert.Equal(t, 0, number)
+	number, err = ParseCapability("CAP_CHECKPOINT_RESTORE")
+	require.NoError(t, err)
+	assert.Equal(t, 40, number)
+
+	_, err = ParseCapability("CAP_TIME_TRAVEL")
+	assert.Error(t, err)
+}
+
+func TestEffectiveCapabilities(t *testing.T) {
+	// CAP_NET_BIND_SERVICE (10) and CAP_NET_RAW (13)
+	fsys, err := testutils.MakeAferoTestFs(map[string][]byte{
+		"/proc/self/status": []byte("Name:\tttpforge\nCapInh:\t0000000000000000\nCapEff:\t0000000000002400\n"),
+	})
+	require.NoError(t, err)
+	effective, err := EffectiveCapabilities(fsys)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1<<10|1<<13), effective)
+
+	fsys, err = testutils.MakeAferoTestFs(map[string][]byte{
+		"/proc/self/status": []byte("Name:\tttpforge\n"),
+	})
+	require.NoError(t, err)
+	_, err = EffectiveCapabilities(fsys)
+	assert.Error(t, err)
+}
@@ -0,0 +1,152 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package platforms
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// VersionConstraint restricts a version (such as that of a kernel or
+// a distribution) with one or more comma-separated comparisons, such as
+// ">= 5.4, < 6". A version satisfies the constraint if it satisfies all
+// of its comparisons. A comparison without an operator means "==".
+type VersionConstraint struct {
+	comparisons []versionComparison
+	raw         string
+}
+
+type versionComparison struct {
+	op      string
+	version []int
+}
+
+// versionOperators are checked in order, so
+// that ">=" is not mistaken for ">" and so on
+var versionOperators = []string{">=", "<=", "==", "!=", ">", "<", "="}
+
+// ParseVersionConstraint parses a constraint such as ">= 20.04"
+func ParseVersionConstraint(s string) (VersionConstraint, error) {
+	constraint := VersionConstraint{raw: s}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		op := "=="
+		for _, candidate := range versionOperators {
+			if rest, ok := strings.CutPrefix(part, candidate); ok {
+				op = candidate
+				part = strings.TrimSpace(rest)
+				break
+			}
+		}
+		if op == "=" {
+			op = "=="
+		}
+		version, rest, err := parseVersionPrefix(part)
+		if err != nil || rest != "" {
+			return VersionConstraint{}, fmt.Errorf("invalid version constraint %q - expected comparisons such as \">= 5.4\"", s)
+		}
+		constraint.comparisons = append(constraint.comparisons, versionComparison{op: op, version: version})
+	}
+	return constraint, nil
+}
+
+// String returns the constraint as it was specified
+func (c VersionConstraint) String() string {
+	return c.raw
+}
+
+// Check reports whether the specified version satisfies the constraint.
+// Only the leading numeric part of the version is compared, so
+// a kernel release such as "5.15.0-91-generic" is treated as 5.15.0.
+// Missing components count as zero, so "6" is equal to "6.0".
+func (c VersionConstraint) Check(version string) (bool, error) {
+	parsed, _, err := parseVersionPrefix(version)
+	if err != nil {
+		return false, err
+	}
+	for _, comparison := range c.comparisons {
+		cmp := compareVersions(parsed, comparison.version)
+		var ok bool
+		switch comparison.op {
+		case ">=":
+			ok = cmp >= 0
+		case "<=":
+			ok = cmp <= 0
+		case ">":
+			ok = cmp > 0
+		case "<":
+			ok = cmp < 0
+		case "!=":
+			ok = cmp != 0
+		default:
+			ok = cmp == 0
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// parseVersionPrefix parses the dot-separated numbers at the start of s
+// and returns them along with the unparsed remainder of s
+func parseVersionPrefix(s string) ([]int, string, error) {
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if end < 0 {
+		end = len(s)
+	}
+	numeric := strings.TrimRight(s[:end], ".")
+	if numeric == "" {
+		return nil, "", fmt.Errorf("invalid version %q", s)
+	}
+	var version []int
+	for _, component := range strings.Split(numeric, ".") {
+		n, err := strconv.Atoi(component)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid version %q", s)
+		}
+		version = append(version, n)
+	}
+	return version, s[len(numeric):], nil
+}
+
+// compareVersions returns -1, 0 or 1 if a is
+// less than, equal to or greater than b
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
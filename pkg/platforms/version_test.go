@@ -0,0 +1,137 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package platforms
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionConstraint(t *testing.T) {
+	testCases := []struct {
+		name              string
+		constraint        string
+		version           string
+		expectParseError  bool
+		expectCheckError  bool
+		expectedSatisfied bool
+	}{
+		{
+			name:              "Greater Or Equal",
+			constraint:        ">= 20.04",
+			version:           "22.04",
+			expectedSatisfied: true,
+		},
+		{
+			name:              "Greater Or Equal (Equal)",
+			constraint:        ">=20.04",
+			version:           "20.04",
+			expectedSatisfied: true,
+		},
+		{
+			name:       "Greater Or Equal (Less)",
+			constraint: ">= 20.04",
+			version:    "18.04",
+		},
+		{
+			name:              "Numeric Rather Than Lexical Comparison",
+			constraint:        "> 5.4",
+			version:           "5.15",
+			expectedSatisfied: true,
+		},
+		{
+			name:              "Kernel Release Suffix Is Ignored",
+			constraint:        ">= 5.4, < 6",
+			version:           "5.15.0-91-generic",
+			expectedSatisfied: true,
+		},
+		{
+			name:       "Range (Above)",
+			constraint: ">= 5.4, < 6",
+			version:    "6.1.0",
+		},
+		{
+			name:              "Missing Components Are Zero",
+			constraint:        "== 6",
+			version:           "6.0.0",
+			expectedSatisfied: true,
+		},
+		{
+			name:              "Bare Version Means Equal",
+			constraint:        "12",
+			version:           "12",
+			expectedSatisfied: true,
+		},
+		{
+			name:       "Not Equal",
+			constraint: "!= 12",
+			version:    "12.0",
+		},
+		{
+			name:              "Less Or Equal",
+			constraint:        "<= 9.3",
+			version:           "9.2",
+			expectedSatisfied: true,
+		},
+		{
+			name:             "Invalid Constraint Operator",
+			constraint:       "~> 1.2",
+			expectParseError: true,
+		},
+		{
+			name:             "Invalid Constraint Version",
+			constraint:       ">= 1.2-rc1",
+			expectParseError: true,
+		},
+		{
+			name:             "Empty Comparison",
+			constraint:       ">= 1.2,",
+			expectParseError: true,
+		},
+		{
+			name:             "Invalid Version",
+			constraint:       ">= 1.2",
+			version:          "rolling",
+			expectCheckError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			constraint, err := ParseVersionConstraint(tc.constraint)
+			if tc.expectParseError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.constraint, constraint.String())
+
+			satisfied, err := constraint.Check(tc.version)
+			if tc.expectCheckError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedSatisfied, satisfied)
+		})
+	}
+}
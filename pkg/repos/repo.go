@@ -28,6 +28,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/facebookincubator/ttpforge/pkg/executors"
 	"github.com/facebookincubator/ttpforge/pkg/fileutils"
 	"github.com/spf13/afero"
 	"gopkg.in/yaml.v3"
@@ -68,6 +69,7 @@ type Repo interface {
 	GetFs() afero.Fs
 	GetName() string
 	GetFullPath() string
+	GetExecutors() []executors.Definition
 }
 
 // Config contains all the fields
@@ -81,6 +83,8 @@ type repo struct {
 	spec                Spec
 	TTPSearchPaths      []string `yaml:"ttp_search_paths"`
 	TemplateSearchPaths []string `yaml:"template_search_paths"`
+	// Executors are custom executors available to the TTPs of this repo
+	Executors []executors.Definition `yaml:"executors"`
 }
 
 // ListsTTPs lists the TTPs in this repo
@@ -128,6 +132,12 @@ func (r *repo) GetFullPath() string {
 	return r.fullPath
 }
 
+// GetExecutors returns the custom executors
+// defined in the repo configuration file
+func (r *repo) GetExecutors() []executors.Definition {
+	return r.Executors
+}
+
 func (r *repo) search(dirsToSearch []string, relPath string) (string, error) {
 	for _, dirToSearch := range dirsToSearch {
 		candidateFullPath := filepath.Join(r.fullPath, dirToSearch, relPath)
@@ -211,6 +221,11 @@ func (spec *Spec) Load(fsys afero.Fs, basePath string) (Repo, error) {
 	if err != nil {
 		return nil, fmt.Errorf("invalid config file found at %v: %w", repoConfigPath, err)
 	}
+	for _, def := range r.Executors {
+		if err := def.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid executor %q in config file %v: %w", def.Name, repoConfigPath, err)
+		}
+	}
 	r.fsys = fsys
 	r.fullPath = repoPath
 	r.spec = *spec
@@ -153,3 +153,38 @@ func TestFindTTP(t *testing.T) {
 		})
 	}
 }
+
+func TestRepoExecutors(t *testing.T) {
+	fsys, err := testutils.MakeAferoTestFs(map[string][]byte{
+		"repos/custom/" + RepoConfigFileName: []byte(`ttp_search_paths: ["ttps"]
+executors:
+  - name: node
+    command: ["node"]
+    extensions: [".js"]
+  - name: osascript
+    command: ["osascript"]
+    delivery: file
+`),
+		"repos/broken/" + RepoConfigFileName: []byte(`ttp_search_paths: ["ttps"]
+executors:
+  - name: node
+    command: ["node"]
+    delivery: pipe
+`),
+	})
+	require.NoError(t, err)
+
+	spec := Spec{Name: "custom", Path: "repos/custom"}
+	r, err := spec.Load(fsys, "")
+	require.NoError(t, err)
+	defs := r.GetExecutors()
+	require.Len(t, defs, 2)
+	assert.Equal(t, "node", defs[0].Name)
+	assert.Equal(t, []string{".js"}, defs[0].Extensions)
+	assert.True(t, defs[1].UsesFile())
+
+	spec = Spec{Name: "broken", Path: "repos/broken"}
+	_, err = spec.Load(fsys, "")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid executor "node"`)
+}
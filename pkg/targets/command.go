@@ -0,0 +1,187 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package targets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Cmd is a command that runs on a target. Like exec.Cmd, it must
+// not be reused after Run or Wait have returned.
+type Cmd struct {
+	// Args holds the program and its arguments
+	Args []string
+	// Dir is the working directory of the command - if it is
+	// empty, the command runs in the home directory of the user
+	Dir string
+	// Env lists environment variables (in KEY=value form) to set in
+	// addition to the login environment of the user on the target
+	Env []string
+	// PTY requests a pseudo-terminal, which interactive programs need
+	PTY    bool
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	ctx      context.Context
+	conn     *Connection
+	session  *ssh.Session
+	exitCode int
+	done     chan struct{}
+}
+
+// ExitError reports that a command on a target exited with a non-zero code.
+type ExitError struct {
+	Code int
+}
+
+// Error formats the exit code in the same way as exec.ExitError
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("exit status %d", e.Code)
+}
+
+// CommandContext returns a Cmd that runs the program with the specified
+// arguments on the target. The command is stopped if ctx is done
+// before it exits.
+func (c *Connection) CommandContext(ctx context.Context, name string, args ...string) *Cmd {
+	return &Cmd{
+		Args:     append([]string{name}, args...),
+		ctx:      ctx,
+		conn:     c,
+		exitCode: -1,
+	}
+}
+
+// String returns the shell command line that is run on the target.
+func (c *Cmd) String() string {
+	var parts []string
+	if c.Dir != "" {
+		parts = append(parts, "cd", ShellQuote(c.Dir), "&&")
+	}
+	if len(c.Env) > 0 {
+		parts = append(parts, "env")
+		for _, kv := range c.Env {
+			parts = append(parts, ShellQuote(kv))
+		}
+	}
+	for _, arg := range c.Args {
+		parts = append(parts, ShellQuote(arg))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Start starts the command but does not wait for it to exit.
+func (c *Cmd) Start() error {
+	if c.session != nil {
+		return errors.New("command already started")
+	}
+	session, err := c.conn.client.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to open session on target %v: %w", c.conn.target, err)
+	}
+	if c.PTY {
+		modes := ssh.TerminalModes{ssh.ECHO: 1}
+		if err := session.RequestPty("xterm", 40, 120, modes); err != nil {
+			session.Close()
+			return fmt.Errorf("failed to request terminal on target %v: %w", c.conn.target, err)
+		}
+	}
+	session.Stdin = c.Stdin
+	session.Stdout = c.Stdout
+	session.Stderr = c.Stderr
+	if err := session.Start(c.String()); err != nil {
+		session.Close()
+		return fmt.Errorf("failed to start command on target %v: %w", c.conn.target, err)
+	}
+	c.session = session
+	c.done = make(chan struct{})
+
+	// SSH cannot reliably signal remote processes, so closing
+	// the session is the best we can do to stop the command
+	go func() {
+		select {
+		case <-c.ctx.Done():
+			_ = session.Signal(ssh.SIGKILL)
+			session.Close()
+		case <-c.done:
+		}
+	}()
+	return nil
+}
+
+// Wait waits for the command to exit. The returned error is an
+// *ExitError if the command ran but exited with a non-zero code.
+func (c *Cmd) Wait() error {
+	if c.session == nil {
+		return errors.New("command not started")
+	}
+	err := c.session.Wait()
+	close(c.done)
+	c.session.Close()
+
+	var sshExitErr *ssh.ExitError
+	switch {
+	case err == nil:
+		c.exitCode = 0
+	case errors.As(err, &sshExitErr):
+		c.exitCode = sshExitErr.ExitStatus()
+		err = &ExitError{Code: c.exitCode}
+	}
+	if ctxErr := c.ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("command on target %v was stopped: %w", c.conn.target, ctxErr)
+	}
+	return err
+}
+
+// Run starts the command and waits for it to exit.
+func (c *Cmd) Run() error {
+	if err := c.Start(); err != nil {
+		return err
+	}
+	return c.Wait()
+}
+
+// ExitCode returns the exit code of the command,
+// or -1 if it has not exited or was stopped.
+func (c *Cmd) ExitCode() int {
+	return c.exitCode
+}
+
+// ShellQuote quotes s so that a POSIX shell treats it as a single word.
+func ShellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, needsQuoting) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func needsQuoting(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return false
+	}
+	return !strings.ContainsRune("-_./=:,@%+", r)
+}
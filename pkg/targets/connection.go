@@ -0,0 +1,201 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package targets
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+
+	"github.com/pkg/sftp"
+	"github.com/spf13/afero"
+	"github.com/spf13/afero/sftpfs"
+	"golang.org/x/crypto/ssh"
+)
+
+// remoteTempDir is where script files are uploaded to
+const remoteTempDir = "/tmp"
+
+// defaultUmask is applied to the mode of new remote files,
+// since SFTP does not apply the umask of the remote user
+const defaultUmask = 0022
+
+// Connection is an open SSH connection to a target.
+type Connection struct {
+	target  Target
+	client  *ssh.Client
+	sftp    *sftp.Client
+	homeDir string
+}
+
+func newConnection(target Target, client *ssh.Client) (*Connection, error) {
+	sftpClient, err := sftp.NewClient(client)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to start SFTP session on target %v: %w", target, err)
+	}
+	// SFTP sessions start in the home directory of the user
+	homeDir, err := sftpClient.Getwd()
+	if err != nil {
+		sftpClient.Close()
+		client.Close()
+		return nil, fmt.Errorf("failed to look up home directory on target %v: %w", target, err)
+	}
+	return &Connection{
+		target:  target,
+		client:  client,
+		sftp:    sftpClient,
+		homeDir: homeDir,
+	}, nil
+}
+
+// Target returns the target that this connection is connected to.
+func (c *Connection) Target() Target {
+	return c.target
+}
+
+// HomeDir returns the home directory of the user on the target.
+func (c *Connection) HomeDir() string {
+	return c.homeDir
+}
+
+// FileSystem returns the file system of the target.
+func (c *Connection) FileSystem() afero.Fs {
+	return &sftpFs{Fs: sftpfs.New(c.sftp), client: c.sftp}
+}
+
+// UploadScript copies the contents of r to a new executable
+// file in the temporary directory of the target and returns
+// its path. The caller is responsible for removing the file.
+func (c *Connection) UploadScript(r io.Reader, extension string) (string, error) {
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	scriptPath := path.Join(remoteTempDir, "ttpforge-script-"+hex.EncodeToString(suffix)+extension)
+	f, err := c.sftp.OpenFile(scriptPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return "", fmt.Errorf("failed to create script file on target %v: %w", c.target, err)
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = c.sftp.Chmod(scriptPath, 0700)
+	}
+	if err != nil {
+		c.sftp.Remove(scriptPath)
+		return "", fmt.Errorf("failed to upload script file to target %v: %w", c.target, err)
+	}
+	return scriptPath, nil
+}
+
+// RemoveFile removes a file from the target.
+func (c *Connection) RemoveFile(name string) error {
+	return c.sftp.Remove(name)
+}
+
+// Close closes the connection.
+func (c *Connection) Close() error {
+	return errors.Join(c.sftp.Close(), c.client.Close())
+}
+
+// sftpFs adapts the afero SFTP file system to
+// the semantics of the local file system
+type sftpFs struct {
+	afero.Fs
+	client *sftp.Client
+}
+
+// Create creates or truncates the named file
+func (s *sftpFs) Create(name string) (afero.File, error) {
+	return s.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+}
+
+// OpenFile opens the named file. The afero SFTP file system sets
+// the mode of the file even if it already exists, so we keep the
+// mode of existing files and apply the default umask to new ones.
+func (s *sftpFs) OpenFile(name string, flag int, perm os.FileMode) (afero.File, error) {
+	if info, err := s.client.Stat(name); err == nil {
+		perm = info.Mode().Perm()
+	} else {
+		perm &^= defaultUmask
+	}
+	return s.Fs.OpenFile(name, flag, perm)
+}
+
+// Mkdir creates a directory with the default mode of the target
+func (s *sftpFs) Mkdir(name string, _ os.FileMode) error {
+	return s.client.Mkdir(name)
+}
+
+// MkdirAll creates a directory and its parents
+// with the default mode of the target
+func (s *sftpFs) MkdirAll(name string, _ os.FileMode) error {
+	return s.client.MkdirAll(name)
+}
+
+// RemoveAll removes the named file or directory along with everything
+// that it contains - the afero SFTP file system does not implement it
+func (s *sftpFs) RemoveAll(name string) error {
+	info, err := s.client.Lstat(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return s.client.Remove(name)
+	}
+	entries, err := s.client.ReadDir(name)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := s.RemoveAll(path.Join(name, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return s.client.RemoveDirectory(name)
+}
+
+// LstatIfPossible returns information about the named file
+// without following symlinks
+func (s *sftpFs) LstatIfPossible(name string) (os.FileInfo, bool, error) {
+	info, err := s.client.Lstat(name)
+	return info, true, err
+}
+
+// SymlinkIfPossible creates newname as a symlink to oldname
+func (s *sftpFs) SymlinkIfPossible(oldname, newname string) error {
+	return s.client.Symlink(oldname, newname)
+}
+
+// ReadlinkIfPossible returns the target of the named symlink
+func (s *sftpFs) ReadlinkIfPossible(name string) (string, error) {
+	return s.client.ReadLink(name)
+}
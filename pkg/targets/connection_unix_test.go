@@ -0,0 +1,268 @@
+//go:build !windows
+// +build !windows
+
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package targets
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/facebookincubator/ttpforge/pkg/testutils"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func connectToTestServer(t *testing.T) *Connection {
+	server := testutils.StartSSHServer(t)
+	target := Target{
+		Host:       server.Addr,
+		User:       server.User,
+		KeyFile:    server.KeyFile,
+		KnownHosts: server.KnownHosts,
+	}
+	conn, err := target.Connect(context.Background())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestConnectErrors(t *testing.T) {
+	server := testutils.StartSSHServer(t)
+	otherServer := testutils.StartSSHServer(t)
+
+	testCases := []struct {
+		name           string
+		target         Target
+		wantErrContain string
+	}{
+		{
+			name: "Unknown Host Key",
+			target: Target{
+				Host:       server.Addr,
+				User:       server.User,
+				KeyFile:    server.KeyFile,
+				KnownHosts: otherServer.KnownHosts,
+			},
+			wantErrContain: "failed to establish SSH connection",
+		},
+		{
+			name: "Unauthorized Key",
+			target: Target{
+				Host:       server.Addr,
+				User:       server.User,
+				KeyFile:    otherServer.KeyFile,
+				KnownHosts: server.KnownHosts,
+			},
+			wantErrContain: "unable to authenticate",
+		},
+		{
+			name: "Missing Key File",
+			target: Target{
+				Host:       server.Addr,
+				User:       server.User,
+				KeyFile:    filepath.Join(t.TempDir(), "missing"),
+				KnownHosts: server.KnownHosts,
+			},
+			wantErrContain: "failed to read key file",
+		},
+		{
+			name: "Invalid Target",
+			target: Target{
+				Host: server.Addr,
+			},
+			wantErrContain: "target user must not be empty",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn, err := tc.target.Connect(context.Background())
+			if err == nil {
+				conn.Close()
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.wantErrContain)
+		})
+	}
+}
+
+func TestInsecureIgnoreHostKey(t *testing.T) {
+	server := testutils.StartSSHServer(t)
+	target := Target{
+		Host:                  server.Addr,
+		User:                  server.User,
+		KeyFile:               server.KeyFile,
+		InsecureIgnoreHostKey: true,
+	}
+	conn, err := target.Connect(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+}
+
+func TestCmdRun(t *testing.T) {
+	conn := connectToTestServer(t)
+	dir := t.TempDir()
+
+	testCases := []struct {
+		name             string
+		args             []string
+		dir              string
+		env              []string
+		stdin            string
+		expectedStdout   string
+		expectedStderr   string
+		expectedExitCode int
+		wantError        bool
+	}{
+		{
+			name:           "Arguments Are Quoted",
+			args:           []string{"echo", "it's", "$HOME"},
+			expectedStdout: "it's $HOME\n",
+		},
+		{
+			name:           "Working Directory And Environment",
+			args:           []string{"sh", "-c", `echo "$(pwd) $GREETING"`},
+			dir:            dir,
+			env:            []string{"GREETING=hello there"},
+			expectedStdout: dir + " hello there\n",
+		},
+		{
+			name:           "Standard Input",
+			args:           []string{"sh"},
+			stdin:          "echo from stdin; echo to stderr >&2",
+			expectedStdout: "from stdin\n",
+			expectedStderr: "to stderr\n",
+		},
+		{
+			name:             "Exit Code",
+			args:             []string{"sh", "-c", "exit 3"},
+			expectedExitCode: 3,
+			wantError:        true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			cmd := conn.CommandContext(context.Background(), tc.args[0], tc.args[1:]...)
+			cmd.Dir = tc.dir
+			cmd.Env = tc.env
+			if tc.stdin != "" {
+				cmd.Stdin = strings.NewReader(tc.stdin)
+			}
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+
+			err := cmd.Run()
+			assert.Equal(t, tc.expectedExitCode, cmd.ExitCode())
+			if tc.wantError {
+				var exitErr *ExitError
+				require.True(t, errors.As(err, &exitErr))
+				assert.Equal(t, "exit status 3", exitErr.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedStdout, stdout.String())
+			assert.Equal(t, tc.expectedStderr, stderr.String())
+		})
+	}
+}
+
+func TestCmdCancel(t *testing.T) {
+	conn := connectToTestServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	cmd := conn.CommandContext(ctx, "sleep", "10")
+	err := cmd.Run()
+	require.Error(t, err)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, -1, cmd.ExitCode())
+	assert.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestFileSystem(t *testing.T) {
+	conn := connectToTestServer(t)
+	fsys := conn.FileSystem()
+	dir := t.TempDir()
+
+	// new files get the default umask applied
+	newFile := filepath.Join(dir, "nested", "new.txt")
+	require.NoError(t, fsys.MkdirAll(filepath.Dir(newFile), 0777))
+	require.NoError(t, afero.WriteFile(fsys, newFile, []byte("hello"), 0666))
+	info, err := os.Stat(newFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+	contents, err := os.ReadFile(newFile)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(contents))
+
+	// existing files keep their mode
+	existingFile := filepath.Join(dir, "existing.txt")
+	require.NoError(t, os.WriteFile(existingFile, []byte("old"), 0600))
+	require.NoError(t, os.Chmod(existingFile, 0600))
+	require.NoError(t, afero.WriteFile(fsys, existingFile, []byte("new"), 0666))
+	info, err = os.Stat(existingFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// directories are removed recursively
+	require.NoError(t, fsys.RemoveAll(filepath.Join(dir, "nested")))
+	_, err = os.Stat(filepath.Join(dir, "nested"))
+	assert.True(t, os.IsNotExist(err))
+	require.NoError(t, fsys.RemoveAll(filepath.Join(dir, "does-not-exist")))
+
+	exists, err := afero.Exists(fsys, existingFile)
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestUploadScript(t *testing.T) {
+	conn := connectToTestServer(t)
+
+	scriptPath, err := conn.UploadScript(strings.NewReader("echo uploaded\n"), ".sh")
+	require.NoError(t, err)
+	defer os.Remove(scriptPath)
+	assert.True(t, strings.HasSuffix(scriptPath, ".sh"))
+
+	info, err := os.Stat(scriptPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	var stdout bytes.Buffer
+	cmd := conn.CommandContext(context.Background(), scriptPath)
+	cmd.Stdout = &stdout
+	require.NoError(t, cmd.Run())
+	assert.Equal(t, "uploaded\n", stdout.String())
+
+	require.NoError(t, conn.RemoveFile(scriptPath))
+	_, err = os.Stat(scriptPath)
+	assert.True(t, os.IsNotExist(err))
+}
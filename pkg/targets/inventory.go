@@ -0,0 +1,160 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package targets
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+)
+
+// Inventory is a list of hosts on which a TTP can be run at once,
+// as loaded from an inventory file.
+type Inventory struct {
+	// Defaults holds the settings and arguments shared by all hosts
+	Defaults Host   `yaml:"defaults,omitempty"`
+	Hosts    []Host `yaml:"hosts"`
+}
+
+// Host is a target in an inventory, along with the values
+// of the TTP arguments that are specific to that host.
+type Host struct {
+	Target `yaml:",inline"`
+	Args   map[string]string `yaml:"args,omitempty"`
+}
+
+// LoadInventory reads an inventory file and applies its defaults to its
+// hosts. Hosts without a host: setting connect to their name.
+func LoadInventory(fsys afero.Fs, inventoryPath string) (*Inventory, error) {
+	contents, err := afero.ReadFile(fsys, inventoryPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read inventory file: %w", err)
+	}
+	var inv Inventory
+	if err := yaml.Unmarshal(contents, &inv); err != nil {
+		return nil, fmt.Errorf("failed to parse inventory file %v: %w", inventoryPath, err)
+	}
+	if err := inv.resolve(); err != nil {
+		return nil, fmt.Errorf("invalid inventory file %v: %w", inventoryPath, err)
+	}
+	return &inv, nil
+}
+
+// resolve applies the defaults of the inventory to its hosts
+// and validates the result
+func (inv *Inventory) resolve() error {
+	if inv.Defaults.Name != "" || inv.Defaults.Host != "" {
+		return errors.New("defaults cannot specify a name or host")
+	}
+	if len(inv.Hosts) == 0 {
+		return errors.New("no hosts specified")
+	}
+	names := make(map[string]bool)
+	for idx := range inv.Hosts {
+		host := &inv.Hosts[idx]
+		if host.Name == "" {
+			return fmt.Errorf("host #%d has no name", idx+1)
+		}
+		if names[host.Name] {
+			return fmt.Errorf("duplicate host name: %v", host.Name)
+		}
+		names[host.Name] = true
+		host.applyDefaults(inv.Defaults)
+		if err := host.Validate(); err != nil {
+			return fmt.Errorf("invalid host %q: %w", host.Name, err)
+		}
+	}
+	return nil
+}
+
+func (h *Host) applyDefaults(defaults Host) {
+	if h.Host == "" {
+		h.Host = h.Name
+	}
+	if h.User == "" {
+		h.User = defaults.User
+	}
+	if h.KeyFile == "" {
+		h.KeyFile = defaults.KeyFile
+	}
+	// hosts either verify their host key or they don't
+	if h.KnownHosts == "" && !h.InsecureIgnoreHostKey {
+		h.KnownHosts = defaults.KnownHosts
+		h.InsecureIgnoreHostKey = defaults.InsecureIgnoreHostKey
+	}
+	args := make(map[string]string)
+	for name, value := range defaults.Args {
+		args[name] = value
+	}
+	for name, value := range h.Args {
+		args[name] = value
+	}
+	h.Args = args
+}
+
+// ArgsList returns the arguments of the host in the
+// name=value form of the --arg flag, sorted by name.
+func (h Host) ArgsList() []string {
+	argsList := make([]string, 0, len(h.Args))
+	for name, value := range h.Args {
+		argsList = append(argsList, name+"="+value)
+	}
+	sort.Strings(argsList)
+	return argsList
+}
+
+// Select returns the hosts whose names match any of the specified
+// glob patterns (such as web*), in the order of the inventory.
+// All hosts are returned if no patterns are specified.
+func (inv *Inventory) Select(patterns []string) ([]Host, error) {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid host pattern %q: %w", pattern, err)
+		}
+	}
+	var selected []Host
+	for _, host := range inv.Hosts {
+		if matchesAny(host.Name, patterns) {
+			selected = append(selected, host)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no hosts in the inventory match %v", strings.Join(patterns, ", "))
+	}
+	return selected, nil
+}
+
+func matchesAny(name string, patterns []string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		// patterns were validated by the caller
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
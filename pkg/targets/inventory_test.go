@@ -0,0 +1,209 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package targets
+
+import (
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadInventory(t *testing.T) {
+	testCases := []struct {
+		name           string
+		content        string
+		expectedHosts  []Host
+		wantErrContain string
+	}{
+		{
+			name: "Defaults Applied",
+			content: `defaults:
+  user: operator
+  key_file: ~/.ssh/lab_key
+  known_hosts: /etc/lab_known_hosts
+  args:
+    port: "80"
+    message: hello
+hosts:
+  - name: web01
+    host: 10.0.0.5:2222
+    args:
+      port: 8080
+  - name: web02.lab
+    user: admin
+    insecure_ignore_host_key: true`,
+			expectedHosts: []Host{
+				{
+					Target: Target{
+						Name:       "web01",
+						Host:       "10.0.0.5:2222",
+						User:       "operator",
+						KeyFile:    "~/.ssh/lab_key",
+						KnownHosts: "/etc/lab_known_hosts",
+					},
+					Args: map[string]string{"port": "8080", "message": "hello"},
+				},
+				{
+					Target: Target{
+						Name:                  "web02.lab",
+						Host:                  "web02.lab",
+						User:                  "admin",
+						KeyFile:               "~/.ssh/lab_key",
+						InsecureIgnoreHostKey: true,
+					},
+					Args: map[string]string{"port": "80", "message": "hello"},
+				},
+			},
+		},
+		{
+			name: "No Defaults",
+			content: `hosts:
+  - name: db01
+    user: root`,
+			expectedHosts: []Host{
+				{
+					Target: Target{Name: "db01", Host: "db01", User: "root"},
+					Args:   map[string]string{},
+				},
+			},
+		},
+		{
+			name:           "No Hosts",
+			content:        `defaults: {user: root}`,
+			wantErrContain: "no hosts specified",
+		},
+		{
+			name: "Host Without Name",
+			content: `hosts:
+  - host: 10.0.0.5
+    user: root`,
+			wantErrContain: "host #1 has no name",
+		},
+		{
+			name: "Duplicate Host Name",
+			content: `defaults: {user: root}
+hosts:
+  - name: web01
+  - name: web01`,
+			wantErrContain: "duplicate host name: web01",
+		},
+		{
+			name: "Host Without User",
+			content: `hosts:
+  - name: web01`,
+			wantErrContain: `invalid host "web01": target user must not be empty`,
+		},
+		{
+			name: "Host In Defaults",
+			content: `defaults: {host: 10.0.0.5}
+hosts:
+  - name: web01`,
+			wantErrContain: "defaults cannot specify a name or host",
+		},
+		{
+			name:           "Invalid YAML",
+			content:        `hosts: {`,
+			wantErrContain: "failed to parse inventory file",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fsys := afero.NewMemMapFs()
+			require.NoError(t, afero.WriteFile(fsys, "hosts.yaml", []byte(tc.content), 0644))
+
+			inv, err := LoadInventory(fsys, "hosts.yaml")
+			if tc.wantErrContain != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErrContain)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedHosts, inv.Hosts)
+		})
+	}
+}
+
+func TestInventorySelect(t *testing.T) {
+	inv := Inventory{
+		Hosts: []Host{
+			{Target: Target{Name: "web01"}},
+			{Target: Target{Name: "db01"}},
+			{Target: Target{Name: "web02"}},
+			{Target: Target{Name: "mail01"}},
+		},
+	}
+
+	testCases := []struct {
+		name           string
+		patterns       []string
+		expectedNames  []string
+		wantErrContain string
+	}{
+		{
+			name:          "All Hosts",
+			expectedNames: []string{"web01", "db01", "web02", "mail01"},
+		},
+		{
+			name:          "Glob",
+			patterns:      []string{"web*"},
+			expectedNames: []string{"web01", "web02"},
+		},
+		{
+			name:          "Several Patterns In Inventory Order",
+			patterns:      []string{"mail01", "db0?", "web01"},
+			expectedNames: []string{"web01", "db01", "mail01"},
+		},
+		{
+			name:           "No Match",
+			patterns:       []string{"app*"},
+			wantErrContain: "no hosts in the inventory match app*",
+		},
+		{
+			name:           "Invalid Pattern",
+			patterns:       []string{"web["},
+			wantErrContain: `invalid host pattern "web["`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			hosts, err := inv.Select(tc.patterns)
+			if tc.wantErrContain != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErrContain)
+				return
+			}
+			require.NoError(t, err)
+			var names []string
+			for _, host := range hosts {
+				names = append(names, host.Name)
+			}
+			assert.Equal(t, tc.expectedNames, names)
+		})
+	}
+}
+
+func TestHostArgsList(t *testing.T) {
+	host := Host{Args: map[string]string{"port": "8080", "message": "a=b"}}
+	assert.Equal(t, []string{"message=a=b", "port=8080"}, host.ArgsList())
+}
@@ -0,0 +1,186 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package targets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/facebookincubator/ttpforge/pkg/fileutils"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// defaultPort is the SSH port used if the host of a target does not specify one
+const defaultPort = "22"
+
+// dialTimeout bounds how long connecting to a target may take
+const dialTimeout = 30 * time.Second
+
+// Target describes a remote host on which steps run over SSH.
+type Target struct {
+	// Name identifies targets defined in configuration files
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// Host is a hostname or IP address, optionally followed by :port
+	Host string `yaml:"host" json:"host"`
+	User string `yaml:"user" json:"user"`
+	// KeyFile is the private key used to authenticate - if it is
+	// not set, the keys of the running SSH agent are used instead
+	KeyFile string `yaml:"key_file,omitempty" json:"key_file,omitempty"`
+	// KnownHosts is the known_hosts file used to verify the host
+	// key of the target. Default: ~/.ssh/known_hosts
+	KnownHosts string `yaml:"known_hosts,omitempty" json:"known_hosts,omitempty"`
+	// InsecureIgnoreHostKey disables host key verification,
+	// which is only appropriate for disposable lab hosts
+	InsecureIgnoreHostKey bool `yaml:"insecure_ignore_host_key,omitempty" json:"insecure_ignore_host_key,omitempty"`
+}
+
+// Validate checks that the target specifies where and as whom to connect.
+func (t Target) Validate() error {
+	if t.Host == "" {
+		return errors.New("target host must not be empty")
+	}
+	if t.User == "" {
+		return errors.New("target user must not be empty")
+	}
+	if t.InsecureIgnoreHostKey && t.KnownHosts != "" {
+		return errors.New("known_hosts cannot be used with insecure_ignore_host_key")
+	}
+	return nil
+}
+
+// Address returns the host and port to connect to.
+func (t Target) Address() string {
+	if _, _, err := net.SplitHostPort(t.Host); err == nil {
+		return t.Host
+	}
+	return net.JoinHostPort(strings.Trim(t.Host, "[]"), defaultPort)
+}
+
+// String returns the target in user@host form.
+func (t Target) String() string {
+	return t.User + "@" + t.Host
+}
+
+// Connect opens an SSH connection to the target, along with an SFTP
+// session for file operations. The caller must close the connection.
+func (t Target) Connect(ctx context.Context) (*Connection, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	config, closeAgent, err := t.clientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid settings for target %v: %w", t, err)
+	}
+	// the agent is only needed to authenticate
+	defer closeAgent()
+
+	dialer := net.Dialer{Timeout: dialTimeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", t.Address())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to target %v: %w", t, err)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, t.Address(), config)
+	if err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("failed to establish SSH connection to target %v: %w", t, err)
+	}
+	return newConnection(t, ssh.NewClient(sshConn, chans, reqs))
+}
+
+// clientConfig returns the SSH client configuration for the target,
+// along with a function that closes the connection to the SSH agent
+// (if one was needed) once the configuration is no longer used
+func (t Target) clientConfig() (*ssh.ClientConfig, func(), error) {
+	hostKeyCallback, err := t.hostKeyCallback()
+	if err != nil {
+		return nil, nil, err
+	}
+	auth, closeAgent, err := t.authMethod()
+	if err != nil {
+		return nil, nil, err
+	}
+	return &ssh.ClientConfig{
+		User:            t.User,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         dialTimeout,
+	}, closeAgent, nil
+}
+
+func (t Target) authMethod() (ssh.AuthMethod, func(), error) {
+	if t.KeyFile == "" {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if socket == "" {
+			return nil, nil, errors.New("no key_file specified and no SSH agent is running")
+		}
+		agentConn, err := net.Dial("unix", socket)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to SSH agent: %w", err)
+		}
+		closeAgent := func() { agentConn.Close() }
+		return ssh.PublicKeysCallback(agent.NewClient(agentConn).Signers), closeAgent, nil
+	}
+
+	keyPath, err := fileutils.ExpandTilde(t.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyBytes, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(keyBytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse key file %v: %w", keyPath, err)
+	}
+	return ssh.PublicKeys(signer), func() {}, nil
+}
+
+func (t Target) hostKeyCallback() (ssh.HostKeyCallback, error) {
+	if t.InsecureIgnoreHostKey {
+		// #nosec G106 - explicitly requested for disposable lab hosts
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	knownHostsPath := t.KnownHosts
+	if knownHostsPath == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		knownHostsPath = filepath.Join(homeDir, ".ssh", "known_hosts")
+	}
+	knownHostsPath, err := fileutils.ExpandTilde(knownHostsPath)
+	if err != nil {
+		return nil, err
+	}
+	callback, err := knownhosts.New(knownHostsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known_hosts file: %w", err)
+	}
+	return callback, nil
+}
@@ -0,0 +1,125 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package targets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetValidate(t *testing.T) {
+	testCases := []struct {
+		name           string
+		target         Target
+		wantErrContain string
+	}{
+		{
+			name:   "Valid",
+			target: Target{Host: "web01", User: "operator"},
+		},
+		{
+			name:           "Missing Host",
+			target:         Target{User: "operator"},
+			wantErrContain: "target host must not be empty",
+		},
+		{
+			name:           "Missing User",
+			target:         Target{Host: "web01"},
+			wantErrContain: "target user must not be empty",
+		},
+		{
+			name: "Conflicting Host Key Settings",
+			target: Target{
+				Host:                  "web01",
+				User:                  "operator",
+				KnownHosts:            "/tmp/known_hosts",
+				InsecureIgnoreHostKey: true,
+			},
+			wantErrContain: "known_hosts cannot be used with insecure_ignore_host_key",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.target.Validate()
+			if tc.wantErrContain != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErrContain)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestTargetAddress(t *testing.T) {
+	testCases := []struct {
+		host     string
+		expected string
+	}{
+		{host: "web01", expected: "web01:22"},
+		{host: "web01:2222", expected: "web01:2222"},
+		{host: "10.0.0.1", expected: "10.0.0.1:22"},
+		{host: "::1", expected: "[::1]:22"},
+		{host: "[::1]", expected: "[::1]:22"},
+		{host: "[::1]:2222", expected: "[::1]:2222"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.host, func(t *testing.T) {
+			target := Target{Host: tc.host, User: "operator"}
+			assert.Equal(t, tc.expected, target.Address())
+		})
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected string
+	}{
+		{input: "simple", expected: "simple"},
+		{input: "/path/to/file.sh", expected: "/path/to/file.sh"},
+		{input: "KEY=value", expected: "KEY=value"},
+		{input: "", expected: "''"},
+		{input: "two words", expected: "'two words'"},
+		{input: "it's", expected: `'it'\''s'`},
+		{input: "$HOME", expected: "'$HOME'"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			assert.Equal(t, tc.expected, ShellQuote(tc.input))
+		})
+	}
+}
+
+func TestCmdString(t *testing.T) {
+	conn := &Connection{}
+	cmd := conn.CommandContext(context.Background(), "bash", "-c", "echo $GREETING")
+	assert.Equal(t, `bash -c 'echo $GREETING'`, cmd.String())
+
+	cmd.Dir = "/tmp/my dir"
+	cmd.Env = []string{"GREETING=hello world"}
+	assert.Equal(t, `cd '/tmp/my dir' && env 'GREETING=hello world' bash -c 'echo $GREETING'`, cmd.String())
+}
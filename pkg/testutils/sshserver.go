@@ -0,0 +1,242 @@
+/*
+Copyright © 2024-present, Meta Platforms, Inc. and affiliates
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+The above copyright notice and this permission notice shall be included in
+all copies or substantial portions of the Software.
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+THE SOFTWARE.
+*/
+
+package testutils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHServer is an in-process SSH server for tests. It runs the
+// commands of its clients with sh and serves the local file system
+// over SFTP, so a test can exercise remote execution without a real host.
+// Like sshd, it sets SSH_CONNECTION in the environment of commands, which
+// otherwise only contains PATH, HOME and USER.
+type SSHServer struct {
+	// Addr is the host:port that the server listens on
+	Addr string
+	// User is the user name that clients must log in as
+	User string
+	// KeyFile is the private key that clients must authenticate with
+	KeyFile string
+	// KnownHosts is a known_hosts file containing the host key of the server
+	KnownHosts string
+
+	listener    net.Listener
+	config      *ssh.ServerConfig
+	wg          sync.WaitGroup
+	connections atomic.Int64
+}
+
+// StartSSHServer starts an SSHServer that is stopped when the test finishes.
+func StartSSHServer(t *testing.T) *SSHServer {
+	t.Helper()
+	dir := t.TempDir()
+
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientPub, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorizedKey, err := ssh.NewPublicKey(clientPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyBlock, err := ssh.MarshalPrivateKey(clientPriv, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(keyBlock), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+	knownHostsLine := knownhosts.Line([]string{knownhosts.Normalize(addr)}, hostSigner.PublicKey())
+	if err := os.WriteFile(knownHostsFile, []byte(knownHostsLine+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &SSHServer{
+		Addr:       addr,
+		User:       "ttpforge",
+		KeyFile:    keyFile,
+		KnownHosts: knownHostsFile,
+		listener:   listener,
+	}
+	s.config = &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == s.User && string(key.Marshal()) == string(authorizedKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unauthorized")
+		},
+	}
+	s.config.AddHostKey(hostSigner)
+
+	s.wg.Add(1)
+	go s.serve()
+	t.Cleanup(func() {
+		listener.Close()
+		s.wg.Wait()
+	})
+	return s
+}
+
+// Connections returns the number of SSH connections
+// that clients have established with the server so far.
+func (s *SSHServer) Connections() int {
+	return int(s.connections.Load())
+}
+
+func (s *SSHServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handleConn(conn)
+	}
+}
+
+func (s *SSHServer) handleConn(netConn net.Conn) {
+	_, chans, reqs, err := ssh.NewServerConn(netConn, s.config)
+	if err != nil {
+		netConn.Close()
+		return
+	}
+	s.connections.Add(1)
+	go ssh.DiscardRequests(reqs)
+	for newChan := range chans {
+		if newChan.ChannelType() != "session" {
+			_ = newChan.Reject(ssh.UnknownChannelType, "only sessions are supported")
+			continue
+		}
+		channel, requests, err := newChan.Accept()
+		if err != nil {
+			continue
+		}
+		go s.handleSession(channel, requests)
+	}
+}
+
+func (s *SSHServer) handleSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer channel.Close()
+	var cmd *exec.Cmd
+	for req := range requests {
+		switch req.Type {
+		case "pty-req", "env":
+			_ = req.Reply(true, nil)
+		case "signal":
+			if cmd != nil && cmd.Process != nil {
+				_ = cmd.Process.Kill()
+			}
+		case "subsystem":
+			var payload struct{ Name string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil || payload.Name != "sftp" {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			_ = req.Reply(true, nil)
+			server, err := sftp.NewServer(channel)
+			if err != nil {
+				return
+			}
+			_ = server.Serve()
+			return
+		case "exec":
+			var payload struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+				_ = req.Reply(false, nil)
+				continue
+			}
+			_ = req.Reply(true, nil)
+			cmd = exec.Command("sh", "-c", payload.Command)
+			cmd.Env = s.commandEnv()
+			go runSessionCommand(cmd, channel)
+		default:
+			_ = req.Reply(false, nil)
+		}
+	}
+}
+
+// commandEnv returns the environment of the commands run by the server
+func (s *SSHServer) commandEnv() []string {
+	homeDir, _ := os.UserHomeDir()
+	_, port, _ := net.SplitHostPort(s.Addr)
+	return []string{
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + homeDir,
+		"USER=" + s.User,
+		"SSH_CONNECTION=127.0.0.1 0 127.0.0.1 " + port,
+	}
+}
+
+func runSessionCommand(cmd *exec.Cmd, channel ssh.Channel) {
+	defer channel.Close()
+	cmd.Stdout = channel
+	cmd.Stderr = channel.Stderr()
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return
+	}
+	exitCode := 255
+	if err := cmd.Start(); err == nil {
+		// the command may exit before its input is closed
+		go func() {
+			_, _ = io.Copy(stdin, channel)
+			stdin.Close()
+		}()
+		_ = cmd.Wait()
+		// processes that were killed have no exit code
+		if code := cmd.ProcessState.ExitCode(); code >= 0 {
+			exitCode = code
+		}
+	}
+	status := struct{ Status uint32 }{uint32(exitCode)}
+	_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(&status))
+}